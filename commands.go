@@ -0,0 +1,546 @@
+// This file implements the non-interactive subcommands of ebpfmon. They print
+// the same enriched information the TUI displays as json, yaml or an aligned
+// text table so that it can be consumed by scripts
+package main
+
+import (
+	"ebpfmon/metrics"
+	"ebpfmon/utils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Returned by `baseline check` when the system doesn't match the baseline
+var errDrift = errors.New("the loaded programs or maps don't match the baseline")
+
+const commandUsage = `Commands:
+  progs                 List all bpf programs
+  prog <id>             Show a single bpf program along with its disassembly
+  maps                  List all bpf maps
+  map dump <id>         Dump the entries of a map
+  map export <id>       Export the entries of a map as json or csv. See map export -h
+  map import <id>       Import entries exported with map export into a map. See map import -h
+  serve                 Serve prometheus metrics. See serve -h
+  baseline save         Save the loaded programs and maps as a known good baseline
+  baseline check        Compare the loaded programs and maps against a baseline.
+                        Exits with status 2 if anything changed
+
+Each command except serve, map export and map import accepts -o json|yaml|text
+to select the output format`
+
+// Run one of the subcommands. args[0] is the name of the subcommand
+func runCommand(args []string, out io.Writer) error {
+	switch args[0] {
+	case "progs":
+		return progsCommand(args[1:], out)
+	case "prog":
+		return progCommand(args[1:], out)
+	case "maps":
+		return mapsCommand(args[1:], out)
+	case "map":
+		if len(args) < 2 {
+			return fmt.Errorf("unknown map command. Expected `map dump|export|import <id>`\n%s", commandUsage)
+		}
+		switch args[1] {
+		case "dump":
+			return mapDumpCommand(args[2:], out)
+		case "export":
+			return mapExportCommand(args[2:], out)
+		case "import":
+			return mapImportCommand(args[2:], out)
+		}
+		return fmt.Errorf("unknown map command. Expected `map dump|export|import <id>`\n%s", commandUsage)
+	case "serve":
+		return serveCommand(args[1:], out)
+	case "baseline":
+		if len(args) < 2 || (args[1] != "save" && args[1] != "check") {
+			return fmt.Errorf("unknown baseline command. Expected `baseline save` or `baseline check`\n%s", commandUsage)
+		}
+		if args[1] == "save" {
+			return baselineSaveCommand(args[2:], out)
+		}
+		return baselineCheckCommand(args[2:], out)
+	}
+	return fmt.Errorf("unknown command %s\n%s", args[0], commandUsage)
+}
+
+// Build the flag set shared by all the subcommands
+func newCommandFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := flags.String("o", "text", "Output format. One of json, yaml or text")
+	return flags, output
+}
+
+// Parse the arguments of a subcommand that takes a single id
+func parseIdArg(flags *flag.FlagSet, args []string) (int, error) {
+	err := flags.Parse(args)
+	if err != nil {
+		return 0, err
+	}
+	if flags.NArg() != 1 {
+		return 0, fmt.Errorf("%s expects a single id", flags.Name())
+	}
+	id, err := strconv.Atoi(flags.Arg(0))
+	if err != nil {
+		return 0, fmt.Errorf("invalid id %s", flags.Arg(0))
+	}
+	return id, nil
+}
+
+// Write v in the requested format. text is used for the text format
+func writeOutput(out io.Writer, format string, v interface{}, text func(w *tabwriter.Writer)) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	case "yaml":
+		// Go through json first so the yaml keys match the json ones
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		err = json.Unmarshal(data, &generic)
+		if err != nil {
+			return err
+		}
+		encoder := yaml.NewEncoder(out)
+		encoder.SetIndent(2)
+		err = encoder.Encode(generic)
+		if err != nil {
+			return err
+		}
+		return encoder.Close()
+	case "text":
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		text(w)
+		return w.Flush()
+	}
+	return fmt.Errorf("unknown output format %s. Expected json, yaml or text", format)
+}
+
+// Summarize the processes that own a program for the text output
+func ownerSummary(p utils.BpfProgram) string {
+	parts := []string{}
+	for _, pid := range p.Pids {
+		parts = append(parts, fmt.Sprintf("%s(%d)", pid.Comm, pid.Pid))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Where warnings about missing information are printed. Tests replace it
+var warnings io.Writer = os.Stderr
+
+// Get every program. Failing to find the extra context of the programs isn't
+// fatal but the output is missing some columns so it is reported as a warning
+func collectPrograms() (map[int]utils.BpfProgram, error) {
+	programs, err := utils.CollectPrograms()
+	if err != nil {
+		if !utils.IsEnrichError(err) {
+			return nil, err
+		}
+		fmt.Fprintf(warnings, "Warning: some program information is missing: %v\n", err)
+	}
+	return programs, nil
+}
+
+// Get all the programs sorted by id
+func sortedPrograms() ([]utils.BpfProgram, error) {
+	programs, err := collectPrograms()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]utils.BpfProgram, 0, len(programs))
+	for _, p := range programs {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ProgramId < result[j].ProgramId
+	})
+	return result, nil
+}
+
+func progsCommand(args []string, out io.Writer) error {
+	flags, output := newCommandFlags("progs")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	programs, err := sortedPrograms()
+	if err != nil {
+		return err
+	}
+	return writeOutput(out, *output, programs, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tTYPE\tTAG\tNAME\tFINGERPRINT\tRISKY HELPERS\tATTACH\tOWNER")
+		for _, p := range programs {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", p.ProgramId, p.ProgType, p.Tag, p.Name, p.Fingerprint, strings.Join(p.RiskyHelpers(), ","), p.AttachSummary(), ownerSummary(p))
+		}
+	})
+}
+
+func progCommand(args []string, out io.Writer) error {
+	flags, output := newCommandFlags("prog")
+	id, err := parseIdArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	programs, err := collectPrograms()
+	if err != nil {
+		return err
+	}
+	p, ok := programs[id]
+	if !ok {
+		return fmt.Errorf("no program with id %d", id)
+	}
+
+	insns, err := utils.GetBpfProgramDisassembly(id)
+	if err != nil {
+		return err
+	}
+	for _, insn := range insns {
+		if insn != "" {
+			p.Instructions = append(p.Instructions, insn)
+		}
+	}
+
+	return writeOutput(out, *output, p, func(w *tabwriter.Writer) {
+		fmt.Fprintf(w, "Name:\t%s\n", p.Name)
+		fmt.Fprintf(w, "Tag:\t%s\n", p.Tag)
+		fmt.Fprintf(w, "ProgramId:\t%d\n", p.ProgramId)
+		fmt.Fprintf(w, "ProgType:\t%s\n", p.ProgType)
+		fmt.Fprintf(w, "Fingerprint:\t%s\n", p.Fingerprint)
+		for _, pid := range p.Pids {
+			fmt.Fprintf(w, "Owner:\t%s\n", pid.Comm)
+			fmt.Fprintf(w, "OwnerCmdline:\t%s\n", pid.Cmdline)
+			fmt.Fprintf(w, "OwnerPath:\t%s\n", pid.Path)
+			fmt.Fprintf(w, "OwnerPid:\t%d\n", pid.Pid)
+		}
+		fmt.Fprintf(w, "GplCompat:\t%v\n", p.GplCompatible)
+		fmt.Fprintf(w, "LoadedAt:\t%v\n", time.Unix(int64(p.LoadedAt), 0))
+		fmt.Fprintf(w, "BytesXlated:\t%d\n", p.BytesXlated)
+		fmt.Fprintf(w, "Jited:\t%v\n", p.Jited)
+		fmt.Fprintf(w, "BytesMemlock:\t%d\n", p.BytesMemlock)
+		fmt.Fprintf(w, "BtfId:\t%d\n", p.BtfId)
+		if len(p.MapIds) > 0 {
+			fmt.Fprintf(w, "MapIds:\t%v\n", p.MapIds)
+		}
+		if len(p.Pinned) > 0 {
+			fmt.Fprintf(w, "Pinned:\t%s\n", p.Pinned)
+		}
+		if attach := p.AttachSummary(); attach != "" {
+			fmt.Fprintf(w, "AttachPoint:\t%s\n", attach)
+		}
+		for _, helper := range p.Helpers {
+			if helper.Risk != "" {
+				fmt.Fprintf(w, "Helper:\t%s (%d calls, risky: %s)\n", helper.Name, helper.Calls, helper.Risk)
+			} else {
+				fmt.Fprintf(w, "Helper:\t%s (%d calls)\n", helper.Name, helper.Calls)
+			}
+		}
+		// Flush so the disassembly isn't aligned with the info above
+		w.Flush()
+		fmt.Fprintln(w, "\nDisassembly:")
+		for _, insn := range p.Instructions {
+			fmt.Fprintln(w, insn)
+		}
+	})
+}
+
+func mapsCommand(args []string, out io.Writer) error {
+	flags, output := newCommandFlags("maps")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	maps, err := utils.GetBpfMapInfo()
+	if err != nil {
+		return err
+	}
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].Id < maps[j].Id
+	})
+	return writeOutput(out, *output, maps, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "ID\tTYPE\tNAME\tKEY\tVALUE\tMAX_ENTRIES\tMEMLOCK\tFROZEN")
+		for _, m := range maps {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%d\t%d\t%v\n", m.Id, m.Type, m.Name, m.KeySize, m.ValueSize, m.MaxEntries, m.Memlock, m.Frozen == 1)
+		}
+	})
+}
+
+// Format bytes as space separated hex for the text output
+func hexBytes(data []byte) string {
+	parts := make([]string, len(data))
+	for i, b := range data {
+		parts[i] = fmt.Sprintf("%02x", b)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Format the value of an entry as hex. The values of per cpu entries are
+// separated by a |
+func valueHexBytes(e utils.BpfMapEntry) string {
+	if len(e.Values) == 0 {
+		return hexBytes(e.Value)
+	}
+	parts := []string{}
+	for _, v := range e.Values {
+		parts = append(parts, hexBytes(v))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func mapDumpCommand(args []string, out io.Writer) error {
+	flags, output := newCommandFlags("map dump")
+	id, err := parseIdArg(flags, args)
+	if err != nil {
+		return err
+	}
+
+	entries, err := utils.GetBpfMapEntries(id)
+	if err != nil {
+		return err
+	}
+	if entries == nil {
+		entries = []utils.BpfMapEntry{}
+	}
+	return writeOutput(out, *output, entries, func(w *tabwriter.Writer) {
+		fmt.Fprintln(w, "KEY\tVALUE")
+		for _, e := range entries {
+			fmt.Fprintf(w, "%s\t%s\n", hexBytes(e.Key), valueHexBytes(e))
+		}
+	})
+}
+
+// Add the flags that select how map keys and values are written to a file
+func addEntryFormatFlags(flags *flag.FlagSet) func() (utils.EntryFormat, error) {
+	format := flags.String("format", "hex", "Format of the keys and values. One of hex, decimal or raw")
+	width := flags.Int("width", 1, "Size in bytes of each number. One of 1, 2, 4 or 8")
+	endianness := flags.String("endian", "little", "Byte order of each number. little or big")
+	return func() (utils.EntryFormat, error) {
+		return utils.ParseEntryFormat(*format, *width, *endianness)
+	}
+}
+
+// Get a single map by id
+func getMap(id int) (utils.BpfMap, error) {
+	maps, err := utils.GetBpfMapInfoByIds([]int{id})
+	if err != nil {
+		return utils.BpfMap{}, fmt.Errorf("map %d not found: %v", id, err)
+	}
+	return maps[0], nil
+}
+
+// Export the entries of a map so they can be restored with map import
+func mapExportCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("map export", flag.ContinueOnError)
+	output := flags.String("o", "json", "Output format. json or csv")
+	entryFormat := addEntryFormatFlags(flags)
+	id, err := parseIdArg(flags, args)
+	if err != nil {
+		return err
+	}
+	f, err := entryFormat()
+	if err != nil {
+		return err
+	}
+
+	m, err := getMap(id)
+	if err != nil {
+		return err
+	}
+	entries, err := utils.GetBpfMapEntries(id)
+	if err != nil {
+		return err
+	}
+	return utils.WriteMapEntries(out, *output, m, entries, f)
+}
+
+// Import the entries of a file into a map. The changes are only printed unless
+// -apply is given and entries missing from the file are only deleted with
+// -prune
+func mapImportCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("map import", flag.ContinueOnError)
+	path := flags.String("f", "", "File to import. Files ending in .csv are read as csv, anything else as json")
+	apply := flags.Bool("apply", false, "Apply the changes. Without it they are only printed")
+	prune := flags.Bool("prune", false, "Delete the entries of the map that aren't in the file")
+	entryFormat := addEntryFormatFlags(flags)
+	id, err := parseIdArg(flags, args)
+	if err != nil {
+		return err
+	}
+	if *path == "" {
+		return errors.New("map import expects a file to import with -f")
+	}
+	f, err := entryFormat()
+	if err != nil {
+		return err
+	}
+
+	m, err := getMap(id)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	imported, err := utils.ReadMapEntries(file, utils.MapFileType(*path), m, f)
+	if err != nil {
+		return err
+	}
+	current, err := utils.GetBpfMapEntries(id)
+	if err != nil {
+		return err
+	}
+
+	plan := utils.PlanMapImport(m, current, imported)
+	if !*prune {
+		plan.Delete = nil
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "\tKEY\tVALUE")
+	for _, e := range plan.Add {
+		fmt.Fprintf(w, "+\t%s\t%s\n", hexBytes(e.Key), valueHexBytes(e))
+	}
+	for i, e := range plan.Change {
+		fmt.Fprintf(w, "~\t%s\t%s -> %s\n", hexBytes(e.Key), valueHexBytes(plan.Previous[i]), valueHexBytes(e))
+	}
+	for _, e := range plan.Delete {
+		fmt.Fprintf(w, "-\t%s\t%s\n", hexBytes(e.Key), valueHexBytes(e))
+	}
+	w.Flush()
+	fmt.Fprintln(out, plan)
+
+	if !*apply {
+		if !plan.Empty() {
+			fmt.Fprintln(out, "Nothing was changed. Run again with -apply to apply the changes")
+		}
+		return nil
+	}
+	if plan.Empty() {
+		return nil
+	}
+	return utils.ApplyMapImport(id, plan)
+}
+
+// Serve the bpf programs and maps as prometheus metrics. This only returns if
+// the server fails
+func serveCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := flags.String("metrics", ":9435", "Address to serve the metrics on")
+	interval := flags.Duration("interval", 15*time.Second, "How often to collect the bpf information")
+	countLimit := flags.Int("count-limit", metrics.DefaultCountLimit, "Only count the entries of maps with at most this many max_entries. 0 turns counting off")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	exporter := metrics.NewExporter()
+	exporter.CountLimit = *countLimit
+	err = exporter.Update()
+	if err != nil {
+		// Not fatal. Whatever could be collected is still served
+		fmt.Fprintf(out, "Failed to collect some bpf information: %v\n", err)
+	}
+	go exporter.Run(*interval, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exporter)
+	fmt.Fprintf(out, "Serving metrics on %s/metrics\n", *addr)
+	return http.ListenAndServe(*addr, mux)
+}
+
+// Get the programs and maps that are compared with a baseline. Unlike the
+// other commands missing information is an error since it would show up as
+// drift
+func baselineSnapshot() (map[int]utils.BpfProgram, []utils.BpfMap, error) {
+	programs, err := utils.CollectPrograms()
+	if err != nil {
+		return nil, nil, err
+	}
+	maps, err := utils.GetBpfMapInfo()
+	if err != nil {
+		return nil, nil, err
+	}
+	return programs, maps, nil
+}
+
+func baselineSaveCommand(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("baseline save", flag.ContinueOnError)
+	path := flags.String("f", "baseline.json", "File to save the baseline to")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	programs, maps, err := baselineSnapshot()
+	if err != nil {
+		return err
+	}
+	baseline := utils.NewBaseline(programs, maps)
+	err = utils.SaveBaseline(*path, baseline)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Saved %d programs and %d maps to %s\n", len(baseline.Programs), len(baseline.Maps), *path)
+	return nil
+}
+
+func baselineCheckCommand(args []string, out io.Writer) error {
+	flags, output := newCommandFlags("baseline check")
+	path := flags.String("f", "baseline.json", "The baseline to compare against")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	baseline, err := utils.LoadBaseline(*path)
+	if err != nil {
+		return err
+	}
+	programs, maps, err := baselineSnapshot()
+	if err != nil {
+		return err
+	}
+
+	drift := baseline.Check(programs, maps)
+	err = writeOutput(out, *output, drift, func(w *tabwriter.Writer) {
+		if len(drift) == 0 {
+			fmt.Fprintln(w, "No drift from the baseline")
+			return
+		}
+		fmt.Fprintln(w, "KIND\tOBJECT\tKEY\tIDS\tDETAILS")
+		for _, d := range drift {
+			details := ""
+			if d.Kind == utils.DriftChanged {
+				details = fmt.Sprintf("expected [%s] got [%s]", strings.Join(d.Expected, "; "), strings.Join(d.Actual, "; "))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%s\n", d.Kind, d.Object, d.Key, d.Ids, details)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(drift) > 0 {
+		return errDrift
+	}
+	return nil
+}
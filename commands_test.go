@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"ebpfmon/utils"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func defaultOutputs() map[string]string {
+	return map[string]string{
+		"-j prog show":          `[{"id":3,"type":"kprobe","tag":"aaaa","name":"open_probe","pids":[{"pid":42,"comm":"agent"}]},{"id":7,"type":"xdp","tag":"bbbb","name":"xdp_fw"}]`,
+		"-j perf list":          `[{"pid":42,"fd":9,"prog_id":3,"fd_type":"kprobe","func":"do_sys_openat2","offset":0}]`,
+		"-j cgroup tree":        `[]`,
+		"-j net show":           `[{"xdp":[{"devname":"eth0","ifindex":2,"mode":"driver","id":7}],"tc":[],"flow_dissector":[]}]`,
+		"-j map show":           `[{"id":5,"type":"hash","name":"counts","flags":0,"bytes_key":4,"bytes_value":8,"max_entries":16,"bytes_memlock":4096}]`,
+		"-jf map dump id 5":     `[{"key":["0x01","0x00","0x00","0x00"],"value":["0x02","0x00","0x00","0x00","0x00","0x00","0x00","0x00"]}]`,
+		"prog dump xlated id 3": "   0: (b7) r0 = 0\n   1: (95) exit\n",
+	}
+}
+
+func TestProgsCommandJson(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"progs", "-o", "json"}, out)
+	if err != nil {
+		t.Fatalf("progs failed: %v", err)
+	}
+
+	programs := []map[string]interface{}{}
+	err = json.Unmarshal(out.Bytes(), &programs)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v\n%s", err, out.String())
+	}
+	if len(programs) != 2 {
+		t.Fatalf("Expected 2 programs, got %d", len(programs))
+	}
+	attach, ok := programs[0]["attach_point"].([]interface{})
+	if !ok || len(attach) != 1 || attach[0] != "do_sys_openat2" {
+		t.Errorf("Expected the kprobe attach point in the output, got %v", programs[0]["attach_point"])
+	}
+	if fingerprint, _ := programs[0]["fingerprint"].(string); len(fingerprint) != 64 {
+		t.Errorf("Expected the fingerprint in the output, got %v", programs[0]["fingerprint"])
+	}
+	if programs[1]["interface"] != "eth0" {
+		t.Errorf("Expected the xdp interface in the output, got %v", programs[1]["interface"])
+	}
+}
+
+func TestProgsCommandText(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"progs"}, out)
+	if err != nil {
+		t.Fatalf("progs failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 programs, got %v", lines)
+	}
+	if !strings.Contains(lines[1], "do_sys_openat2") || !strings.Contains(lines[1], "agent(42)") {
+		t.Errorf("Expected attach point and owner in '%s'", lines[1])
+	}
+}
+
+// Missing attachment info still lists the programs but warns about it
+func TestProgsCommandPartialInfo(t *testing.T) {
+	outputs := defaultOutputs()
+	delete(outputs, "-j cgroup tree")
+	utils.UseReplayBackend(t, outputs)
+	previous := warnings
+	stderr := &bytes.Buffer{}
+	warnings = stderr
+	defer func() { warnings = previous }()
+
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"progs"}, out)
+	if err != nil {
+		t.Fatalf("progs failed: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 {
+		t.Errorf("Expected a header and 2 programs, got %v", lines)
+	}
+	if !strings.Contains(stderr.String(), "cgroup") {
+		t.Errorf("Expected a warning about the missing cgroup info, got %q", stderr.String())
+	}
+}
+
+func TestProgsCommandRiskyHelpers(t *testing.T) {
+	outputs := defaultOutputs()
+	outputs["-j prog show"] = `[{"id":9,"type":"kprobe","tag":"cccc","name":"writer"}]`
+	outputs["prog dump xlated id 9"] = "   0: (85) call bpf_probe_write_user#-50000\n   1: (85) call bpf_probe_write_user#-50000\n   2: (95) exit\n"
+	utils.UseReplayBackend(t, outputs)
+
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"progs"}, out)
+	if err != nil {
+		t.Fatalf("progs failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "RISKY HELPERS") || !strings.Contains(lines[1], "bpf_probe_write_user") {
+		t.Errorf("Expected the risky helper in the output, got %v", lines)
+	}
+
+	out.Reset()
+	err = runCommand([]string{"prog", "-o", "json", "9"}, out)
+	if err != nil {
+		t.Fatalf("prog failed: %v", err)
+	}
+	program := utils.BpfProgram{}
+	err = json.Unmarshal(out.Bytes(), &program)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v\n%s", err, out.String())
+	}
+	if len(program.Helpers) != 1 || program.Helpers[0].Calls != 2 || program.Helpers[0].Risk == "" {
+		t.Errorf("Expected the helper inventory in the output, got %+v", program.Helpers)
+	}
+}
+
+func TestProgCommandYaml(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"prog", "-o", "yaml", "3"}, out)
+	if err != nil {
+		t.Fatalf("prog failed: %v", err)
+	}
+
+	program := map[string]interface{}{}
+	err = yaml.Unmarshal(out.Bytes(), &program)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v\n%s", err, out.String())
+	}
+	if program["name"] != "open_probe" {
+		t.Errorf("Expected name open_probe, got %v", program["name"])
+	}
+	insns, ok := program["instructions"].([]interface{})
+	if !ok || len(insns) != 2 {
+		t.Errorf("Expected 2 instructions, got %v", program["instructions"])
+	}
+
+	err = runCommand([]string{"prog", "99"}, out)
+	if err == nil {
+		t.Errorf("Expected an error for a missing program")
+	}
+}
+
+func TestMapDumpCommand(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"map", "dump", "-o", "json", "5"}, out)
+	if err != nil {
+		t.Fatalf("map dump failed: %v", err)
+	}
+	if !strings.Contains(out.String(), `"0x02"`) {
+		t.Errorf("Expected hex encoded values in the output, got %s", out.String())
+	}
+
+	out.Reset()
+	err = runCommand([]string{"map", "dump", "5"}, out)
+	if err != nil {
+		t.Fatalf("map dump failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "01 00 00 00  02 00 00 00 00 00 00 00") {
+		t.Errorf("Unexpected text output %s", out.String())
+	}
+}
+
+func TestMapDumpCommandPerCpu(t *testing.T) {
+	outputs := defaultOutputs()
+	outputs["-jf map dump id 5"] = `[{"key":["0x01","0x00","0x00","0x00"],"values":[{"cpu":0,"value":["0x02","0x00"]},{"cpu":1,"value":["0x03","0x00"]}]}]`
+	utils.UseReplayBackend(t, outputs)
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"map", "dump", "5"}, out)
+	if err != nil {
+		t.Fatalf("map dump failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "01 00 00 00  02 00 | 03 00") {
+		t.Errorf("Expected the value of every cpu, got %s", out.String())
+	}
+}
+
+func TestMapExportImportCommands(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"map", "export", "-format", "decimal", "-width", "4", "5"}, out)
+	if err != nil {
+		t.Fatalf("map export failed: %v", err)
+	}
+
+	exported := map[string]interface{}{}
+	err = json.Unmarshal(out.Bytes(), &exported)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v\n%s", err, out.String())
+	}
+	if exported["format"] != "decimal" || !strings.Contains(out.String(), `"value": "2 0"`) {
+		t.Fatalf("Unexpected export %s", out.String())
+	}
+
+	// Change the existing entry and add a new one
+	path := filepath.Join(t.TempDir(), "counts.csv")
+	err = os.WriteFile(path, []byte("key,value\n0x01 0x00 0x00 0x00,0x03 0 0 0 0 0 0 0\n0x07 0 0 0,0x01 0 0 0 0 0 0 0\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	out.Reset()
+	err = runCommand([]string{"map", "import", "-f", path, "5"}, out)
+	if err != nil {
+		t.Fatalf("map import failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 to add, 1 to change, 0 to delete") || !strings.Contains(out.String(), "-apply") {
+		t.Errorf("Unexpected import plan %s", out.String())
+	}
+
+	// Entries missing from the file are only deleted with -prune
+	err = os.WriteFile(path, []byte("key,value\n0x07 0 0 0,0x01 0 0 0 0 0 0 0\n"), 0644)
+	if err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	out.Reset()
+	err = runCommand([]string{"map", "import", "-f", path, "-prune", "5"}, out)
+	if err != nil || !strings.Contains(out.String(), "1 to add, 0 to change, 1 to delete") {
+		t.Errorf("Unexpected import plan with -prune %s (%v)", out.String(), err)
+	}
+
+	// Applying fails since maps can't be changed while replaying
+	err = runCommand([]string{"map", "import", "-f", path, "-apply", "5"}, out)
+	if err == nil {
+		t.Errorf("Expected the import to fail while replaying")
+	}
+
+	// Formats that can't be imported back aren't exported
+	err = runCommand([]string{"map", "export", "-format", "char", "5"}, out)
+	if err == nil {
+		t.Errorf("Expected the char format to be refused")
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	err := runCommand([]string{"bogus"}, &bytes.Buffer{})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown command")
+	}
+	err = runCommand([]string{"maps", "-o", "xml"}, &bytes.Buffer{})
+	if err == nil {
+		t.Errorf("Expected an error for an unknown output format")
+	}
+}
+
+func TestBaselineCommands(t *testing.T) {
+	utils.UseReplayBackend(t, defaultOutputs())
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	out := &bytes.Buffer{}
+	err := runCommand([]string{"baseline", "save", "-f", path}, out)
+	if err != nil {
+		t.Fatalf("baseline save failed: %v", err)
+	}
+
+	out.Reset()
+	err = runCommand([]string{"baseline", "check", "-f", path}, out)
+	if err != nil {
+		t.Fatalf("Expected no drift, got %v\n%s", err, out.String())
+	}
+
+	// Drop a program from the baseline so the live one is new
+	baseline, err := utils.LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("Failed to load baseline: %v", err)
+	}
+	baseline.Programs = baseline.Programs[1:]
+	err = utils.SaveBaseline(path, baseline)
+	if err != nil {
+		t.Fatalf("Failed to save baseline: %v", err)
+	}
+
+	out.Reset()
+	err = runCommand([]string{"baseline", "check", "-f", path, "-o", "json"}, out)
+	if !errors.Is(err, errDrift) {
+		t.Fatalf("Expected drift, got %v", err)
+	}
+	drift := []utils.Drift{}
+	err = json.Unmarshal(out.Bytes(), &drift)
+	if err != nil {
+		t.Fatalf("Failed to decode output: %v\n%s", err, out.String())
+	}
+	if len(drift) != 1 || drift[0].Kind != utils.DriftNew || drift[0].Key != "kprobe/open_probe@do_sys_openat2" {
+		t.Errorf("Unexpected drift %+v", drift)
+	}
+}
@@ -2,17 +2,20 @@
 // Author: research@redcanary.com
 //
 // This tool is used to visualize the bpf programs and maps that are loaded
-// on a system. It uses the bpftool binary to get the information about the
-// programs and maps and then displays them in a tui using the tview library.
+// on a system. It uses the bpftool binary (or the bpf syscall directly) to get
+// the information about the programs and maps and then displays them in a tui
+// using the tview library.
 // The user can select a program and then see the maps that are used by that
 // program. The user can also see the disassembly of a program by selecting
 // the program using the enter key
 package main
 
 import (
+	"ebpfmon/rules"
 	"ebpfmon/ui"
 	"ebpfmon/utils"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -22,9 +25,6 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-// The global path to the bpftool binary
-var BpftoolPath string
-
 // A struct for storing the output of `bpftool version -j`
 type BpftoolVersionInfo struct {
 	Version       string `json:"version"`
@@ -45,6 +45,9 @@ type Config struct {
 	// The path to the bpftool binary
 	BpftoolPath string
 
+	// Where the bpf information comes from. Either bpftool or native
+	Backend string
+
 	// Logging verbosity
 	Verbose bool
 }
@@ -57,7 +60,17 @@ func main() {
 	version := flag.Bool("version", false, "Display version information")
 	logFileArg := flag.String("logfile", "", "Path to log file. Defaults to log.txt")
 	bpftool_path := flag.String("bpftool", "", "Path to bpftool binary. Defaults to the bpftool located in PATH")
-
+	backendArg := flag.String("backend", "bpftool", "Where to get bpf information from. Either bpftool or native (uses the bpf syscall directly)")
+	recordArg := flag.String("record", "", "Save the raw output of every bpftool command to this directory")
+	replayArg := flag.String("replay", "", "Replay the bpftool output saved with -record instead of looking at the live system")
+	baselineArg := flag.String("baseline", "", "Path to a baseline saved with the baseline save command to compare the live system against")
+	rulesArg := flag.String("rules", "", "Path to a yaml file of rules to flag suspicious programs with")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nFlags:\n", os.Args[0])
+		flag.PrintDefaults()
+		fmt.Fprintf(flag.CommandLine.Output(), "\n%s\n", commandUsage)
+	}
 	flag.Parse()
 
 	if *help {
@@ -100,61 +113,141 @@ func main() {
 		log.SetLevel(log.InfoLevel)
 	}
 
-	// Set the global bpftool path variable. It can be set by the command line
-	// argument or by the BPFTOOL_PATH environment variable. It defaults to
-	// the bpftool binary in the PATH
+	config := Config{
+		Verbose: *verbose,
+		Backend: *backendArg,
+	}
+	if *recordArg != "" && *replayArg != "" {
+		fmt.Println("-record and -replay can't be used together")
+		os.Exit(1)
+	}
+
+	switch config.Backend {
+	case "bpftool":
+		// Replaying doesn't need bpftool (or root) at all
+		if *replayArg != "" {
+			replayer, err := utils.NewReplayer(*replayArg)
+			if err != nil {
+				fmt.Printf("Failed to open recording %s\n%v\n", *replayArg, err)
+				os.Exit(1)
+			}
+			utils.SetBackend(&utils.BpftoolBackend{Replay: replayer})
+			break
+		}
+
+		config.BpftoolPath = findBpftool(*bpftool_path)
+		config.Version = getBpftoolVersion(config.BpftoolPath)
+		backend := utils.NewBpftoolBackend(config.BpftoolPath)
+		backend.JitDisassembly = config.Version.Features.Libbfd || config.Version.Features.Llvm
+		if *recordArg != "" {
+			backend.Record, err = utils.NewRecorder(*recordArg)
+			if err != nil {
+				fmt.Printf("Failed to create recording directory %s\n%v\n", *recordArg, err)
+				os.Exit(1)
+			}
+		}
+		utils.SetBackend(backend)
+	case "native":
+		if *recordArg != "" || *replayArg != "" {
+			fmt.Println("-record and -replay only work with the bpftool backend")
+			os.Exit(1)
+		}
+		backend, err := utils.NewNativeBackend()
+		if err != nil {
+			fmt.Printf("Failed to use the native backend\n%v\n", err)
+			os.Exit(1)
+		}
+		utils.SetBackend(backend)
+	default:
+		fmt.Printf("Unknown backend %s. Expected bpftool or native\n", config.Backend)
+		os.Exit(1)
+	}
+
+	// Run a subcommand instead of the TUI if one was given
+	if flag.NArg() > 0 {
+		err := runCommand(flag.Args(), os.Stdout)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			if errors.Is(err, errDrift) {
+				os.Exit(2)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *rulesArg != "" {
+		ui.Rules, err = rules.Load(*rulesArg)
+		if err != nil {
+			fmt.Printf("Failed to load rules from %s\n%v\n", *rulesArg, err)
+			os.Exit(1)
+		}
+	}
+
+	if *baselineArg != "" {
+		baseline, err := utils.LoadBaseline(*baselineArg)
+		if err != nil {
+			fmt.Printf("Failed to load baseline from %s\n%v\n", *baselineArg, err)
+			os.Exit(1)
+		}
+		ui.Baseline = &baseline
+	}
+
+	app := ui.NewTui()
+	log.Info("Starting ebpfmon")
+
+	// Run the app
+	if err := app.App.Run(); err != nil {
+		panic(err)
+	}
+}
+
+// Find the bpftool binary. It can be set by the command line argument or by
+// the BPFTOOL_PATH environment variable. It defaults to the bpftool binary in
+// the PATH
+func findBpftool(argPath string) string {
 	bpftoolEnvPath, exists := os.LookupEnv("BPFTOOL_PATH")
-	if *bpftool_path != "" {
-		_, err := os.Stat(*bpftool_path)
+	if argPath != "" {
+		_, err := os.Stat(argPath)
 		if err != nil {
-			fmt.Printf("Failed to find bpftool binary at %s\n", *bpftool_path)
+			fmt.Printf("Failed to find bpftool binary at %s\n", argPath)
 			os.Exit(1)
 		}
-		BpftoolPath = *bpftool_path
+		return argPath
 	} else if exists {
 		_, err := os.Stat(bpftoolEnvPath)
 		if err != nil {
 			fmt.Printf("Failed to find bpftool binary specified by BPFTOOL_PATH at %s\n", bpftoolEnvPath)
 			os.Exit(1)
 		}
-		BpftoolPath = bpftoolEnvPath
-	} else {
-		BpftoolPath, err = exec.LookPath("bpftool")
-		if err != nil {
-			fmt.Println("Failed to find compiled version of bpftool")
-			os.Exit(1)
-		} else {
-			BpftoolPath, err = filepath.Abs(BpftoolPath)
-			if err != nil {
-				fmt.Println("Failed to find compiled version of bpftool")
-				os.Exit(1)
-			}
-		}
+		return bpftoolEnvPath
 	}
 
-	versionInfo := BpftoolVersionInfo{}
-	stdout, stderr, err := utils.RunCmd(BpftoolPath, "version", "-j")
+	path, err := exec.LookPath("bpftool")
 	if err != nil {
-		fmt.Printf("Failed to run `%s version -j`\n%s\n", BpftoolPath, string(stderr))
+		fmt.Println("Failed to find compiled version of bpftool")
 		os.Exit(1)
 	}
-	err = json.Unmarshal(stdout, &versionInfo)
+	path, err = filepath.Abs(path)
 	if err != nil {
-		fmt.Println("Failed to parse bpftool version output")
+		fmt.Println("Failed to find compiled version of bpftool")
 		os.Exit(1)
 	}
+	return path
+}
 
-	config := Config{
-		Version:     versionInfo,
-		BpftoolPath: BpftoolPath,
-		Verbose:     *verbose,
+// Get the output of `bpftool version -j`
+func getBpftoolVersion(bpftoolPath string) BpftoolVersionInfo {
+	versionInfo := BpftoolVersionInfo{}
+	stdout, stderr, err := utils.RunCmd(bpftoolPath, "version", "-j")
+	if err != nil {
+		fmt.Printf("Failed to run `%s version -j`\n%s\n", bpftoolPath, string(stderr))
+		os.Exit(1)
 	}
-	utils.BpftoolPath = config.BpftoolPath
-	app := ui.NewTui(config.BpftoolPath)
-	log.Info("Starting ebpfmon")
-
-	// Run the app
-	if err := app.App.Run(); err != nil {
-		panic(err)
+	err = json.Unmarshal(stdout, &versionInfo)
+	if err != nil {
+		fmt.Println("Failed to parse bpftool version output")
+		os.Exit(1)
 	}
+	return versionInfo
 }
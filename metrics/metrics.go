@@ -0,0 +1,222 @@
+// The metrics package exposes the bpf programs and maps loaded on the system
+// as prometheus gauges. The metrics are written by hand in the prometheus text
+// exposition format so no client library is needed
+package metrics
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Map types that don't support iterating over their keys so their entries
+// can't be counted
+var uncountableMapTypes = map[string]bool{
+	"ringbuf":      true,
+	"user_ringbuf": true,
+	"queue":        true,
+	"stack":        true,
+	"bloom_filter": true,
+}
+
+// Counting the entries of a map means dumping the whole map so by default
+// only maps that can hold at most this many entries are counted
+const DefaultCountLimit = 10000
+
+// Holds the most recent snapshot of the programs and maps and serves it as
+// prometheus metrics
+type Exporter struct {
+	lock sync.RWMutex
+
+	programs map[int]utils.BpfProgram
+	maps     []utils.BpfMap
+
+	// The number of entries in each map keyed by map id. Maps whose entries
+	// couldn't be counted are missing
+	mapEntries map[int]int
+
+	// Whether or not the last update succeeded
+	lastUpdateOk bool
+
+	// Maps with a larger max_entries aren't counted. 0 turns counting off
+	CountLimit int
+}
+
+func NewExporter() *Exporter {
+	return &Exporter{
+		programs:   map[int]utils.BpfProgram{},
+		mapEntries: map[int]int{},
+		CountLimit: DefaultCountLimit,
+	}
+}
+
+// Collect a new snapshot of the programs and maps. The snapshot is replaced
+// even if there was an error so that partial information is still exported
+func (e *Exporter) Update() error {
+	programs, err := utils.CollectPrograms()
+
+	maps, mapErr := utils.GetBpfMapInfo()
+	if mapErr != nil && err == nil {
+		err = mapErr
+	}
+	mapEntries := map[int]int{}
+	for _, m := range maps {
+		if uncountableMapTypes[m.Type] || m.MaxEntries > e.CountLimit {
+			continue
+		}
+		entries, entryErr := utils.GetBpfMapEntries(m.Id)
+		if entryErr != nil {
+			continue
+		}
+		mapEntries[m.Id] = len(entries)
+	}
+
+	e.lock.Lock()
+	e.programs = programs
+	e.maps = maps
+	e.mapEntries = mapEntries
+	e.lastUpdateOk = err == nil
+	e.lock.Unlock()
+	return err
+}
+
+// Update the snapshot every interval until stop is closed
+func (e *Exporter) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := e.Update()
+			if err != nil {
+				log.Errorf("Failed to update metrics: %v\n", err)
+			}
+		}
+	}
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	e.WriteMetrics(w)
+}
+
+// Escape a label value as required by the text exposition format
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// A single metric family. Samples are written in the order they were added
+type family struct {
+	name       string
+	help       string
+	metricType string
+	samples    []string
+}
+
+func (f *family) add(labels string, value int) {
+	f.samples = append(f.samples, fmt.Sprintf("%s{%s} %d", f.name, labels, value))
+}
+
+func (f *family) write(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.metricType)
+	for _, sample := range f.samples {
+		fmt.Fprintln(w, sample)
+	}
+}
+
+// Write the current snapshot in the prometheus text format
+func (e *Exporter) WriteMetrics(w io.Writer) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	programCount := &family{name: "ebpfmon_programs", help: "Number of loaded bpf programs by type", metricType: "gauge"}
+	progMemlock := &family{name: "ebpfmon_program_memlock_bytes", help: "Memory locked by the program", metricType: "gauge"}
+	progXlated := &family{name: "ebpfmon_program_xlated_bytes", help: "Size of the translated program", metricType: "gauge"}
+	progJited := &family{name: "ebpfmon_program_jited_bytes", help: "Size of the jited program", metricType: "gauge"}
+	progRunCnt := &family{name: "ebpfmon_program_run_count_total", help: "Number of times the program has run. Requires kernel.bpf_stats_enabled", metricType: "counter"}
+	progRunTime := &family{name: "ebpfmon_program_run_time_ns_total", help: "Total time spent running the program in nanoseconds. Requires kernel.bpf_stats_enabled", metricType: "counter"}
+	mapCount := &family{name: "ebpfmon_maps", help: "Number of loaded bpf maps by type", metricType: "gauge"}
+	mapEntries := &family{name: "ebpfmon_map_entries", help: "Number of entries in the map", metricType: "gauge"}
+	mapMaxEntries := &family{name: "ebpfmon_map_max_entries", help: "Maximum number of entries the map can hold", metricType: "gauge"}
+	mapMemlock := &family{name: "ebpfmon_map_memlock_bytes", help: "Memory locked by the map", metricType: "gauge"}
+	updateOk := &family{name: "ebpfmon_last_update_success", help: "Whether the last collection of bpf information succeeded", metricType: "gauge"}
+
+	programs := make([]utils.BpfProgram, 0, len(e.programs))
+	for _, p := range e.programs {
+		programs = append(programs, p)
+	}
+	sort.Slice(programs, func(i, j int) bool {
+		return programs[i].ProgramId < programs[j].ProgramId
+	})
+
+	typeCounts := map[string]int{}
+	for _, p := range programs {
+		typeCounts[p.ProgType]++
+		labels := fmt.Sprintf(`id="%d",name="%s",tag="%s",type="%s"`, p.ProgramId, escapeLabel(p.Name), escapeLabel(p.Tag), escapeLabel(p.ProgType))
+		progMemlock.add(labels, p.BytesMemlock)
+		progXlated.add(labels, p.BytesXlated)
+		progJited.add(labels, p.BytesJited)
+
+		// The stats are only reported when kernel.bpf_stats_enabled is on
+		if p.RunCnt > 0 || p.RunTimeNs > 0 {
+			progRunCnt.add(labels, p.RunCnt)
+			progRunTime.add(labels, p.RunTimeNs)
+		}
+	}
+	addTypeCounts(programCount, typeCounts)
+
+	maps := make([]utils.BpfMap, len(e.maps))
+	copy(maps, e.maps)
+	sort.Slice(maps, func(i, j int) bool {
+		return maps[i].Id < maps[j].Id
+	})
+
+	typeCounts = map[string]int{}
+	for _, m := range maps {
+		typeCounts[m.Type]++
+		labels := fmt.Sprintf(`id="%d",name="%s",type="%s"`, m.Id, escapeLabel(m.Name), escapeLabel(m.Type))
+		if count, ok := e.mapEntries[m.Id]; ok {
+			mapEntries.add(labels, count)
+		}
+		mapMaxEntries.add(labels, m.MaxEntries)
+		mapMemlock.add(labels, m.Memlock)
+	}
+	addTypeCounts(mapCount, typeCounts)
+
+	if e.lastUpdateOk {
+		updateOk.samples = append(updateOk.samples, "ebpfmon_last_update_success 1")
+	} else {
+		updateOk.samples = append(updateOk.samples, "ebpfmon_last_update_success 0")
+	}
+
+	for _, f := range []*family{programCount, progMemlock, progXlated, progJited, progRunCnt, progRunTime, mapCount, mapEntries, mapMaxEntries, mapMemlock, updateOk} {
+		f.write(w)
+	}
+}
+
+// Add one sample per type sorted by type name
+func addTypeCounts(f *family, counts map[string]int) {
+	types := make([]string, 0, len(counts))
+	for t := range counts {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		f.add(fmt.Sprintf(`type="%s"`, escapeLabel(t)), counts[t])
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"ebpfmon/utils"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// The bpftool output the metrics are scraped from
+func setupReplay(t *testing.T) {
+	outputs := map[string]string{
+		"-j prog show":      `[{"id":3,"type":"kprobe","tag":"aaaa","name":"open_probe","bytes_xlated":96,"jited":true,"bytes_jited":64,"bytes_memlock":4096,"run_time_ns":5000,"run_cnt":10},{"id":7,"type":"xdp","tag":"bbbb","name":"xdp_fw","bytes_xlated":16,"bytes_memlock":4096},{"id":8,"type":"xdp","tag":"cccc"}]`,
+		"-j perf list":      `[]`,
+		"-j cgroup tree":    `[]`,
+		"-j net show":       `[]`,
+		"-j map show":       `[{"id":5,"type":"hash","name":"counts","bytes_key":4,"bytes_value":8,"max_entries":16,"bytes_memlock":4096},{"id":6,"type":"ringbuf","name":"events","max_entries":4096,"bytes_memlock":8192}]`,
+		"-jf map dump id 5": `[{"key":["0x01","0x00","0x00","0x00"],"value":["0x02","0x00","0x00","0x00","0x00","0x00","0x00","0x00"]},{"key":["0x02","0x00","0x00","0x00"],"value":["0x03","0x00","0x00","0x00","0x00","0x00","0x00","0x00"]}]`,
+	}
+	utils.UseReplayBackend(t, outputs)
+}
+
+func TestScrape(t *testing.T) {
+	setupReplay(t)
+	exporter := NewExporter()
+	err := exporter.Update()
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+
+	server := httptest.NewServer(exporter)
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Failed to scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read the response: %v", err)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("Unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	output := string(body)
+	expected := []string{
+		"# TYPE ebpfmon_programs gauge",
+		`ebpfmon_programs{type="kprobe"} 1`,
+		`ebpfmon_programs{type="xdp"} 2`,
+		`ebpfmon_program_memlock_bytes{id="3",name="open_probe",tag="aaaa",type="kprobe"} 4096`,
+		`ebpfmon_program_xlated_bytes{id="7",name="xdp_fw",tag="bbbb",type="xdp"} 16`,
+		`ebpfmon_program_jited_bytes{id="3",name="open_probe",tag="aaaa",type="kprobe"} 64`,
+		`ebpfmon_program_run_count_total{id="3",name="open_probe",tag="aaaa",type="kprobe"} 10`,
+		`ebpfmon_program_run_time_ns_total{id="3",name="open_probe",tag="aaaa",type="kprobe"} 5000`,
+		`ebpfmon_maps{type="hash"} 1`,
+		`ebpfmon_map_entries{id="5",name="counts",type="hash"} 2`,
+		`ebpfmon_map_max_entries{id="5",name="counts",type="hash"} 16`,
+		`ebpfmon_map_memlock_bytes{id="6",name="events",type="ringbuf"} 8192`,
+		"ebpfmon_last_update_success 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Expected '%s' in the output\n%s", line, output)
+		}
+	}
+
+	// Programs without stats and maps that can't be counted have no sample
+	unexpected := []string{
+		`ebpfmon_program_run_count_total{id="7"`,
+		`ebpfmon_map_entries{id="6"`,
+	}
+	for _, line := range unexpected {
+		if strings.Contains(output, line) {
+			t.Errorf("Didn't expect '%s' in the output\n%s", line, output)
+		}
+	}
+}
+
+// Maps that can hold more entries than the limit aren't dumped
+func TestCountLimit(t *testing.T) {
+	setupReplay(t)
+	exporter := NewExporter()
+	exporter.CountLimit = 8
+	err := exporter.Update()
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	output := &strings.Builder{}
+	exporter.WriteMetrics(output)
+	if strings.Contains(output.String(), "ebpfmon_map_entries{") {
+		t.Errorf("Didn't expect the entries of a map over the limit to be counted\n%s", output)
+	}
+	if !strings.Contains(output.String(), `ebpfmon_map_max_entries{id="5",name="counts",type="hash"} 16`) {
+		t.Errorf("Expected the map to still be exported\n%s", output)
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	escaped := escapeLabel("a\"b\\c\nd")
+	if escaped != `a\"b\\c\nd` {
+		t.Errorf("Unexpected escaped label %s", escaped)
+	}
+}
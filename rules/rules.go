@@ -0,0 +1,252 @@
+// The rules package matches bpf programs against a set of rules loaded from a
+// yaml file. It is used to flag programs that look suspicious. An example
+// rules file
+//
+//	rules:
+//	  - name: write-user-memory
+//	    description: Programs that can write to user space memory
+//	    severity: high
+//	    match:
+//	      helpers: [bpf_probe_write_user]
+//	  - name: bpftrace-kprobe
+//	    severity: low
+//	    match:
+//	      prog_type: ^kprobe$
+//	      comm: ^bpftrace$
+//
+// Every matcher of a rule must match for the rule to match. All the matchers
+// except helpers are regular expressions. helpers matches if the program
+// calls any of the listed helpers
+package rules
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The severity levels from least to most severe
+var Severities = []string{"info", "low", "medium", "high", "critical"}
+
+// Get the rank of a severity. Higher is more severe. -1 is returned for an
+// unknown severity
+func SeverityRank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return -1
+}
+
+// The conditions a program has to meet for a rule to match. Empty fields are
+// ignored
+type Matcher struct {
+	ProgType    string   `yaml:"prog_type,omitempty"`
+	Name        string   `yaml:"name,omitempty"`
+	Tag         string   `yaml:"tag,omitempty"`
+	AttachPoint string   `yaml:"attach_point,omitempty"`
+	Comm        string   `yaml:"comm,omitempty"`
+	Path        string   `yaml:"path,omitempty"`
+	Cgroup      string   `yaml:"cgroup,omitempty"`
+	Interface   string   `yaml:"interface,omitempty"`
+	Helpers     []string `yaml:"helpers,omitempty"`
+
+	// The compiled version of each non empty regex field keyed by field name
+	regexes map[string]*regexp.Regexp
+}
+
+type Rule struct {
+	Name        string  `yaml:"name"`
+	Description string  `yaml:"description,omitempty"`
+	Severity    string  `yaml:"severity"`
+	Match       Matcher `yaml:"match"`
+}
+
+type RuleSet struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// A rule that matched a program
+type Alert struct {
+	Rule        string
+	Description string
+	Severity    string
+	Program     utils.BpfProgram
+}
+
+// Load and compile the rules in a yaml file
+func Load(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse and compile yaml rules
+func Parse(data []byte) (*RuleSet, error) {
+	ruleSet := &RuleSet{}
+	err := yaml.Unmarshal(data, ruleSet)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rules: %v", err)
+	}
+
+	for i := range ruleSet.Rules {
+		rule := &ruleSet.Rules[i]
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+		if SeverityRank(rule.Severity) == -1 {
+			return nil, fmt.Errorf("rule %s has unknown severity %q. Expected one of %v", rule.Name, rule.Severity, Severities)
+		}
+		err = rule.Match.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %v", rule.Name, err)
+		}
+	}
+	return ruleSet, nil
+}
+
+func (m *Matcher) fields() map[string]string {
+	return map[string]string{
+		"prog_type":    m.ProgType,
+		"name":         m.Name,
+		"tag":          m.Tag,
+		"attach_point": m.AttachPoint,
+		"comm":         m.Comm,
+		"path":         m.Path,
+		"cgroup":       m.Cgroup,
+		"interface":    m.Interface,
+	}
+}
+
+func (m *Matcher) compile() error {
+	m.regexes = map[string]*regexp.Regexp{}
+	for field, pattern := range m.fields() {
+		if pattern == "" {
+			continue
+		}
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid %s regex: %v", field, err)
+		}
+		m.regexes[field] = r
+	}
+	if len(m.regexes) == 0 && len(m.Helpers) == 0 {
+		return fmt.Errorf("no matchers")
+	}
+	return nil
+}
+
+// Check if any of the values match the regex of a field. Fields without a
+// regex always match
+func (m *Matcher) matchAny(field string, values []string) bool {
+	r, ok := m.regexes[field]
+	if !ok {
+		return true
+	}
+	for _, value := range values {
+		if r.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check if the program matches. helpers are the helpers the program calls and
+// are only used if the matcher has a helpers condition
+func (m *Matcher) Matches(p utils.BpfProgram, helpers []string) bool {
+	comms := []string{}
+	paths := []string{}
+	for _, pid := range p.Pids {
+		comms = append(comms, pid.Comm)
+		paths = append(paths, pid.Path)
+	}
+	attachPoints := p.AttachPoint
+	if len(attachPoints) == 0 {
+		attachPoints = []string{""}
+	}
+
+	if !m.matchAny("prog_type", []string{p.ProgType}) ||
+		!m.matchAny("name", []string{p.Name}) ||
+		!m.matchAny("tag", []string{p.Tag}) ||
+		!m.matchAny("attach_point", attachPoints) ||
+		!m.matchAny("comm", comms) ||
+		!m.matchAny("path", paths) ||
+		!m.matchAny("cgroup", []string{p.Cgroup}) ||
+		!m.matchAny("interface", []string{p.Interface}) {
+		return false
+	}
+
+	if len(m.Helpers) == 0 {
+		return true
+	}
+	for _, wanted := range m.Helpers {
+		for _, helper := range helpers {
+			if helper == wanted {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Check if any rule needs the helpers a program calls. Getting them requires
+// the disassembly of the program
+func (r *RuleSet) NeedsHelpers() bool {
+	for _, rule := range r.Rules {
+		if len(rule.Match.Helpers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Get an alert for every rule that matches the program
+func (r *RuleSet) Evaluate(p utils.BpfProgram, helpers []string) []Alert {
+	alerts := []Alert{}
+	for _, rule := range r.Rules {
+		if rule.Match.Matches(p, helpers) {
+			alerts = append(alerts, Alert{
+				Rule:        rule.Name,
+				Description: rule.Description,
+				Severity:    rule.Severity,
+				Program:     p,
+			})
+		}
+	}
+	return alerts
+}
+
+// Evaluate every program. The helpers of each program are only fetched if a
+// rule needs them. Programs whose helpers can't be found are still matched
+// against the rules that don't use helpers. The first error is returned
+// along with the alerts
+func (r *RuleSet) EvaluateAll(programs map[int]utils.BpfProgram) ([]Alert, error) {
+	ids := make([]int, 0, len(programs))
+	for id := range programs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var firstErr error
+	alerts := []Alert{}
+	for _, id := range ids {
+		p := programs[id]
+		var helpers []string
+		if r.NeedsHelpers() {
+			var err error
+			helpers, err = utils.GetProgramHelpers(p)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		alerts = append(alerts, r.Evaluate(p, helpers)...)
+	}
+	return alerts, firstErr
+}
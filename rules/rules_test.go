@@ -0,0 +1,98 @@
+package rules
+
+import (
+	"ebpfmon/utils"
+	"testing"
+)
+
+const testRules = `
+rules:
+  - name: write-user-memory
+    description: Programs that can write to user space memory
+    severity: high
+    match:
+      helpers: [bpf_probe_write_user, bpf_override_return]
+  - name: bpftrace-kprobe
+    severity: low
+    match:
+      prog_type: ^kprobe$
+      comm: ^bpftrace$
+  - name: credential-hooks
+    severity: critical
+    match:
+      attach_point: cred
+  - name: eth0-xdp
+    severity: medium
+    match:
+      prog_type: xdp
+      interface: ^eth0$
+`
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		"rules: [{severity: high, match: {name: x}}]",
+		"rules: [{name: a, severity: urgent, match: {name: x}}]",
+		"rules: [{name: a, severity: high, match: {name: '('}}]",
+		"rules: [{name: a, severity: high}]",
+		"rules: {",
+	}
+	for _, data := range invalid {
+		_, err := Parse([]byte(data))
+		if err == nil {
+			t.Errorf("Expected an error parsing %s", data)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	ruleSet, err := Parse([]byte(testRules))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	if !ruleSet.NeedsHelpers() {
+		t.Errorf("Expected the rules to need helpers")
+	}
+
+	tests := []struct {
+		program  utils.BpfProgram
+		helpers  []string
+		expected []string
+	}{
+		{
+			program:  utils.BpfProgram{ProgType: "kprobe", AttachPoint: []string{"commit_creds"}, Pids: []utils.ProcessInfo{{Comm: "bpftrace"}}},
+			helpers:  []string{"bpf_probe_write_user"},
+			expected: []string{"write-user-memory", "bpftrace-kprobe", "credential-hooks"},
+		},
+		{
+			program:  utils.BpfProgram{ProgType: "kprobe", AttachPoint: []string{"do_sys_open"}, Pids: []utils.ProcessInfo{{Comm: "agent"}}},
+			helpers:  []string{"bpf_map_lookup_elem"},
+			expected: []string{},
+		},
+		{
+			// No owner so the comm matcher can't match
+			program:  utils.BpfProgram{ProgType: "kprobe"},
+			expected: []string{},
+		},
+		{
+			program:  utils.BpfProgram{ProgType: "xdp", Interface: "eth0"},
+			expected: []string{"eth0-xdp"},
+		},
+		{
+			program:  utils.BpfProgram{ProgType: "xdp", Interface: "eth01"},
+			expected: []string{},
+		},
+	}
+
+	for i, test := range tests {
+		alerts := ruleSet.Evaluate(test.program, test.helpers)
+		if len(alerts) != len(test.expected) {
+			t.Errorf("Test %d: expected %v, got %+v", i, test.expected, alerts)
+			continue
+		}
+		for j, alert := range alerts {
+			if alert.Rule != test.expected[j] {
+				t.Errorf("Test %d: expected rule %s, got %s", i, test.expected[j], alert.Rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// This file handles the alerts page of the TUI. It lists every program that
+// matched one of the rules given with -rules. An alert is only listed once
+// per program and rule even though the rules are checked on every refresh
+package ui
+
+import (
+	"ebpfmon/rules"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// An alert along with when it was first raised
+type AlertEntry struct {
+	Time  time.Time
+	Alert rules.Alert
+}
+
+var severityColors = map[string]string{
+	"info":     "white",
+	"low":      "blue",
+	"medium":   "yellow",
+	"high":     "red",
+	"critical": "fuchsia",
+}
+
+type AlertsView struct {
+	table *tview.Table
+
+	// The number of alerts currently in the table and the time of the newest
+	// one
+	shown    int
+	lastTime time.Time
+}
+
+func NewAlertsView() *AlertsView {
+	v := &AlertsView{}
+	v.buildTable()
+	return v
+}
+
+// Add any new alerts to the table
+func (v *AlertsView) Update() {
+	lock.Lock()
+	alerts := make([]AlertEntry, len(Alerts))
+	copy(alerts, Alerts)
+	lock.Unlock()
+
+	tui.App.QueueUpdateDraw(func() {
+		if len(alerts) != v.shown || (len(alerts) > 0 && !alerts[len(alerts)-1].Time.Equal(v.lastTime)) {
+			v.render(alerts)
+		}
+	})
+}
+
+func (v *AlertsView) render(alerts []AlertEntry) {
+	v.table.Clear()
+	headers := []string{"Time", "Severity", "Rule", "Id", "Type", "Name", "Tag", "Owner", "Attach Point", "Description"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+
+	if Rules == nil {
+		v.table.SetCell(1, 0, tview.NewTableCell("No rules loaded. Start ebpfmon with -rules <file>").SetSelectable(false))
+	}
+
+	// Newest alerts first
+	for i := range alerts {
+		entry := alerts[len(alerts)-1-i]
+		p := entry.Alert.Program
+		owners := []string{}
+		for _, owner := range p.Pids {
+			owners = append(owners, fmt.Sprintf("%s(%d)", owner.Comm, owner.Pid))
+		}
+
+		cells := []string{
+			entry.Time.Format("15:04:05"),
+			entry.Alert.Severity,
+			entry.Alert.Rule,
+			strconv.Itoa(p.ProgramId),
+			p.ProgType,
+			p.Name,
+			p.Tag,
+			strings.Join(owners, ", "),
+			p.AttachSummary(),
+			entry.Alert.Description,
+		}
+		for j, cell := range cells {
+			tableCell := tview.NewTableCell(tview.Escape(cell))
+			if j == 1 {
+				tableCell.SetTextColor(tcell.GetColor(severityColors[entry.Alert.Severity]))
+			}
+			v.table.SetCell(i+1, j, tableCell)
+		}
+	}
+	v.shown = len(alerts)
+	if len(alerts) > 0 {
+		v.lastTime = alerts[len(alerts)-1].Time
+	}
+}
+
+func (v *AlertsView) buildTable() {
+	v.table = tview.NewTable()
+	v.table.SetBorder(true).SetTitle("Alerts")
+	v.table.SetSelectable(true, false)
+	v.table.SetFixed(1, 0)
+	v.render([]AlertEntry{})
+}
@@ -0,0 +1,327 @@
+// This page lists the btf objects (vmlinux, kernel modules and the btf loaded
+// with programs and maps) along with the programs and maps that use each of
+// them. Pressing ENTER on an object renders its types as C. The types can be
+// searched by name and pressing ENTER on a map shows its key and value types
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// vmlinux has tens of thousands of types so only the first ones are shown
+// until the search narrows them down
+const maxBtfDecls = 200
+
+// What an entry of the reference list points to
+const (
+	btfRefProgram = 0
+	btfRefMap     = 1
+)
+
+type btfRef struct {
+	kind int
+	id   int
+
+	// The btf object that is used
+	btfId int
+}
+
+type BtfView struct {
+	flex    *tview.Flex
+	objects *tview.Table
+	refs    *tview.List
+	search  *tview.InputField
+	types   *tview.TextView
+	app     *Tui
+
+	// The btf objects in the order they are shown and the maps that use them
+	btfObjects []utils.BtfObject
+	maps       map[int]utils.BpfMap
+
+	// The entries of the reference list of the selected object
+	refIds []btfRef
+
+	// The object whose types are shown. Its declarations are cached since
+	// dumping vmlinux takes a while
+	btfId int
+	decls map[int][]utils.CDecl
+
+	// Describes the key and value types of a map when they are shown
+	header string
+}
+
+// Describe a btf object in a single line i.e. `vmlinux` or `12 (program)`
+func btfObjectName(o utils.BtfObject) string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return fmt.Sprintf("%d (%s)", o.Id, o.Kind())
+}
+
+// Fill the table with the btf objects. Kernel btf comes first
+func (v *BtfView) render(objects []utils.BtfObject) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		if objects[i].Kernel != objects[j].Kernel {
+			return objects[i].Kernel
+		}
+		return objects[i].Id < objects[j].Id
+	})
+	v.btfObjects = objects
+
+	v.objects.Clear()
+	for i, header := range []string{"Id", "Kind", "Name", "Progs", "Maps"} {
+		v.objects.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+	if len(objects) == 0 {
+		v.objects.SetCell(1, 0, tview.NewTableCell("No btf objects").SetSelectable(false))
+	}
+	for i, o := range objects {
+		cells := []string{
+			strconv.Itoa(o.Id),
+			o.Kind(),
+			o.Name,
+			strconv.Itoa(len(o.ProgIds)),
+			strconv.Itoa(len(o.MapIds)),
+		}
+		for j, cell := range cells {
+			v.objects.SetCell(i+1, j, tview.NewTableCell(tview.Escape(cell)))
+		}
+	}
+}
+
+// Get the btf objects and rebuild the table
+func (v *BtfView) Update() {
+	objects, err := utils.GetBtfObjects()
+	if err != nil {
+		v.app.DisplayError(fmt.Sprintf("Failed to get the btf objects: %v", err))
+		return
+	}
+	maps, _ := utils.GetBpfMapInfo()
+	v.maps = map[int]utils.BpfMap{}
+	for _, m := range maps {
+		v.maps[m.Id] = m
+	}
+	v.render(objects)
+	v.objects.Select(1, 0)
+	v.showRefs(1)
+}
+
+// Get the object shown in a row of the table
+func (v *BtfView) objectAt(row int) (utils.BtfObject, bool) {
+	if row < 1 || row > len(v.btfObjects) {
+		return utils.BtfObject{}, false
+	}
+	return v.btfObjects[row-1], true
+}
+
+// List the programs and maps that use the object in a row of the table
+func (v *BtfView) showRefs(row int) {
+	v.refs.Clear()
+	v.refIds = nil
+	o, ok := v.objectAt(row)
+	if !ok {
+		return
+	}
+
+	lock.Lock()
+	for _, id := range o.ProgIds {
+		text := fmt.Sprintf("Program %d", id)
+		if p, ok := Programs[id]; ok {
+			text = fmt.Sprintf("Program %d: %s %s", id, p.ProgType, p.Name)
+		}
+		v.refs.AddItem(tview.Escape(text), "", 0, nil)
+		v.refIds = append(v.refIds, btfRef{kind: btfRefProgram, id: id, btfId: o.Id})
+	}
+	lock.Unlock()
+	for _, id := range o.MapIds {
+		text := fmt.Sprintf("Map %d", id)
+		if m, ok := v.maps[id]; ok {
+			text = fmt.Sprintf("Map %d: %s %s", id, m.Type, m.Name)
+		}
+		v.refs.AddItem(tview.Escape(text), "", 0, nil)
+		v.refIds = append(v.refIds, btfRef{kind: btfRefMap, id: id, btfId: o.Id})
+	}
+	if len(v.refIds) == 0 {
+		v.refs.AddItem("Not used by any program or map", "", 0, nil)
+	}
+	v.refs.SetTitle(fmt.Sprintf("Used by (btf %s)", tview.Escape(btfObjectName(o))))
+}
+
+// Render the types of a btf object as C. Returns false if they can't be
+// dumped
+func (v *BtfView) showTypes(btfId int) bool {
+	decls, ok := v.decls[btfId]
+	if !ok {
+		c, err := utils.GetBtfC(btfId)
+		if err != nil {
+			v.app.DisplayError(fmt.Sprintf("Failed to dump btf %d: %v", btfId, err))
+			return false
+		}
+		decls = utils.SplitCDecls(c)
+		v.decls[btfId] = decls
+	}
+	v.btfId = btfId
+	v.header = ""
+	v.updateTypes()
+	return true
+}
+
+// Show the key and value types of a map by searching for them in its btf
+func (v *BtfView) showMapTypes(btfId int, mapId int) {
+	m, err := utils.GetBpfMapBtf(mapId)
+	if err != nil {
+		v.app.DisplayError(fmt.Sprintf("Failed to get the btf of map %d: %v", mapId, err))
+		return
+	}
+	if !v.showTypes(btfId) {
+		return
+	}
+	v.header = fmt.Sprintf("Map %d %s: key %s, value %s", mapId, v.maps[mapId].Name, m.Btf.TypeName(m.KeyTypeId), m.Btf.TypeName(m.ValueTypeId))
+
+	// The value is usually the interesting type. Scalar values are declared
+	// by the compiler so the key is looked up instead
+	name := m.Btf.DeclName(m.ValueTypeId)
+	if name == "" || len(utils.SearchCDecls(v.decls[v.btfId], name)) == 0 {
+		name = m.Btf.DeclName(m.KeyTypeId)
+	}
+	// Setting the text redraws the types through the changed func
+	v.search.SetText(name)
+	v.app.App.SetFocus(v.types)
+}
+
+// Show the declarations of the current object that match the search
+func (v *BtfView) updateTypes() {
+	v.types.Clear()
+	if v.btfId == 0 {
+		v.types.SetTitle("Types")
+		return
+	}
+
+	all := v.decls[v.btfId]
+	matches := utils.SearchCDecls(all, v.search.GetText())
+	shown := matches
+	if len(shown) > maxBtfDecls {
+		shown = shown[:maxBtfDecls]
+	}
+
+	if v.header != "" {
+		fmt.Fprintf(v.types, "[yellow]// %s[-]\n\n", tview.Escape(v.header))
+	}
+	if len(matches) > len(shown) {
+		fmt.Fprintf(v.types, "[gray]// Showing %d of %d types. Search to narrow them down[-]\n\n", len(shown), len(matches))
+	}
+	texts := []string{}
+	for _, d := range shown {
+		texts = append(texts, tview.Escape(d.Text))
+	}
+	fmt.Fprint(v.types, strings.Join(texts, "\n\n"))
+	v.types.ScrollToBeginning()
+	v.types.SetTitle(fmt.Sprintf("Types of btf %d (%d of %d)", v.btfId, len(matches), len(all)))
+}
+
+// Follow the selected entry of the reference list
+func (v *BtfView) followRef(index int) {
+	if index < 0 || index >= len(v.refIds) {
+		return
+	}
+	ref := v.refIds[index]
+	if ref.kind == btfRefMap {
+		v.showMapTypes(ref.btfId, ref.id)
+		return
+	}
+	v.app.pages.SwitchToPage("programs")
+	v.app.App.SetFocus(v.app.bpfExplorerView.programList)
+	if !v.app.bpfExplorerView.ShowProgram(ref.id) {
+		v.app.DisplayError(fmt.Sprintf("Program %d is no longer loaded", ref.id))
+	}
+}
+
+// The keys shared by every pane of the page. TAB moves between the panes
+func (v *BtfView) inputCapture(next tview.Primitive) func(event *tcell.EventKey) *tcell.EventKey {
+	return func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTab {
+			v.app.App.SetFocus(next)
+			return nil
+		}
+		switch event.Rune() {
+		case '/':
+			v.app.App.SetFocus(v.search)
+		case 'r':
+			v.Update()
+		default:
+			return event
+		}
+		return nil
+	}
+}
+
+func (v *BtfView) buildObjects() {
+	v.objects = tview.NewTable()
+	v.objects.SetBorder(true).SetTitle("Btf objects (ENTER: show types, /: search, r: refresh)")
+	v.objects.SetSelectable(true, false)
+	v.objects.SetFixed(1, 0)
+	v.objects.SetSelectionChangedFunc(func(row int, column int) {
+		v.showRefs(row)
+	})
+	v.objects.SetSelectedFunc(func(row int, column int) {
+		if o, ok := v.objectAt(row); ok && v.showTypes(o.Id) {
+			v.app.App.SetFocus(v.search)
+		}
+	})
+}
+
+func (v *BtfView) buildRefs() {
+	v.refs = tview.NewList()
+	v.refs.ShowSecondaryText(false)
+	v.refs.SetBorder(true).SetTitle("Used by")
+	v.refs.SetSelectedFunc(func(i int, s1, s2 string, r rune) {
+		v.followRef(i)
+	})
+}
+
+func (v *BtfView) buildSearch() {
+	v.search = tview.NewInputField().SetLabel("Search: ")
+	v.search.SetChangedFunc(func(text string) {
+		v.updateTypes()
+	})
+	v.search.SetDoneFunc(func(key tcell.Key) {
+		v.app.App.SetFocus(v.types)
+	})
+}
+
+func (v *BtfView) buildTypes() {
+	v.types = tview.NewTextView().
+		SetDynamicColors(true).
+		SetWrap(false)
+	v.types.SetBorder(true).SetTitle("Types")
+}
+
+func NewBtfView(t *Tui) *BtfView {
+	v := &BtfView{app: t, decls: map[int][]utils.CDecl{}}
+	v.buildObjects()
+	v.buildRefs()
+	v.buildSearch()
+	v.buildTypes()
+	v.objects.SetInputCapture(v.inputCapture(v.refs))
+	v.refs.SetInputCapture(v.inputCapture(v.types))
+	v.types.SetInputCapture(v.inputCapture(v.objects))
+	v.render(nil)
+
+	right := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.refs, 8, 0, false).
+		AddItem(v.search, 1, 0, false).
+		AddItem(v.types, 0, 1, false)
+	v.flex = tview.NewFlex().
+		AddItem(v.objects, 0, 1, true).
+		AddItem(right, 0, 2, false)
+	return v
+}
@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"ebpfmon/utils"
+	"strings"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+func TestBtfView(t *testing.T) {
+	backend := newFakeBackend()
+	backend.maps = []utils.BpfMap{{Id: 8, Type: "hash", Name: "events", BtfId: 7}}
+	backend.btfObjs = []utils.BtfObject{
+		{Id: 7, Size: 1024, ProgIds: []int{1}, MapIds: []int{8}},
+		{Id: 1, Size: 5976078, Kernel: true, Name: "vmlinux"},
+	}
+	backend.btfC = map[int]string{
+		7: "typedef unsigned int __u32;\n\nstruct event {\n\t__u32 pid;\n};\n\nstruct other {\n\tint x;\n};\n",
+	}
+	backend.btf = map[int]*utils.MapBtf{
+		8: {
+			Btf: utils.NewBtf([]utils.BtfType{
+				{Id: 1, Kind: "INT", Name: "unsigned int", Size: 4},
+				{Id: 2, Kind: "TYPEDEF", Name: "__u32", TypeId: 1},
+				{Id: 3, Kind: "STRUCT", Name: "event", Size: 4, Members: []utils.BtfMember{{Name: "pid", TypeId: 2}}},
+			}),
+			KeyTypeId:   2,
+			ValueTypeId: 3,
+		},
+	}
+	utils.SetBackend(backend)
+	lock.Lock()
+	Programs = map[int]utils.BpfProgram{1: {ProgramId: 1, ProgType: "kprobe", Name: "kprobe_prog"}}
+	lock.Unlock()
+
+	v := NewBtfView(&Tui{App: tview.NewApplication()})
+	v.Update()
+
+	// Kernel btf comes first
+	if v.objects.GetRowCount() != 3 || v.objects.GetCell(1, 1).Text != "vmlinux" || v.objects.GetCell(2, 1).Text != "program" {
+		t.Fatalf("Unexpected btf objects %d %s", v.objects.GetRowCount(), v.objects.GetCell(1, 1).Text)
+	}
+
+	v.showRefs(2)
+	if v.refs.GetItemCount() != 2 {
+		t.Fatalf("Expected a program and a map, got %d references", v.refs.GetItemCount())
+	}
+	if text, _ := v.refs.GetItemText(0); text != "Program 1: kprobe kprobe_prog" {
+		t.Errorf("Unexpected program reference %s", text)
+	}
+	if text, _ := v.refs.GetItemText(1); text != "Map 8: hash events" {
+		t.Errorf("Unexpected map reference %s", text)
+	}
+
+	// Following the map shows its value type
+	v.followRef(1)
+	if v.search.GetText() != "struct event" {
+		t.Errorf("Expected a search for the value type, got %q", v.search.GetText())
+	}
+	text := v.types.GetText(true)
+	if !strings.Contains(text, "key __u32, value struct event") || !strings.Contains(text, "struct event {") || strings.Contains(text, "struct other") {
+		t.Errorf("Unexpected types %q", text)
+	}
+
+	v.search.SetText("")
+	if text := v.types.GetText(true); !strings.Contains(text, "struct other {") {
+		t.Errorf("Expected every type without a search, got %q", text)
+	}
+}
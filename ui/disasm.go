@@ -0,0 +1,142 @@
+// This file builds the text of the disassembly pane of the explorer. The
+// xlated instructions are highlighted and the maps and instructions they
+// reference become links. A link is followed by clicking it or by selecting
+// it with l/L and pressing ENTER. Following a map opens it in the map view and
+// following a branch (or a call of a bpf function) jumps to its target. Every
+// line starts a region so jump targets and search results can be highlighted
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// What a link in the disassembly points to
+const (
+	linkMap  = 0
+	linkInsn = 1
+)
+
+type disasmLink struct {
+	kind int
+
+	// The id of the map or the index of the instruction
+	target int
+}
+
+// The lines of the disassembly pane and the links in them
+type disasmText struct {
+	lines []string
+
+	// The region at the start of every line. Instructions use insn-N so
+	// they can be jumped to
+	anchors []string
+
+	// The links keyed by region in the order they show up
+	links   map[string]disasmLink
+	linkIds []string
+}
+
+// Splits an xlated instruction like `  12: (15) if r1 == 0x0 goto pc+5` into
+// its index, opcode and the instruction itself
+var xlatedInsnRegex = regexp.MustCompile(`^(\s*)(\d+):(\s+\([0-9a-f]{2}\))?(.*)$`)
+
+// The parts of an instruction that are highlighted. The order matters as the
+// first alternative wins i.e. the id of a map isn't a number of its own
+var xlatedTokenRegex = regexp.MustCompile(`map\[id:(\d+)\]|call ([A-Za-z_][\w.]*)#-?\d+|call pc([+-]\d+)|gotol? pc([+-]\d+)|\b[rw](?:10|[0-9])\b|\b(?:if|goto|call|exit)\b|\b0x[0-9a-f]+\b|\b\d+\b`)
+
+func newDisasmText() *disasmText {
+	return &disasmText{links: map[string]disasmLink{}}
+}
+
+func insnAnchor(index int) string {
+	return fmt.Sprintf("insn-%d", index)
+}
+
+// Add a line that is already formatted
+func (d *disasmText) addText(text string) {
+	anchor := fmt.Sprintf("line-%d", len(d.lines))
+	d.anchors = append(d.anchors, anchor)
+	d.lines = append(d.lines, fmt.Sprintf(`["%s"]%s[""]`, anchor, text))
+}
+
+// Wrap text in a new link and return it
+func (d *disasmText) link(text string, link disasmLink) string {
+	id := fmt.Sprintf("link-%d", len(d.linkIds))
+	d.links[id] = link
+	d.linkIds = append(d.linkIds, id)
+	return fmt.Sprintf(`["%s"][::u]%s[::-][""]`, id, text)
+}
+
+// Add a line of the xlated disassembly. Source lines are green and the names
+// of functions are yellow
+func (d *disasmText) addXlated(line string) {
+	match := xlatedInsnRegex.FindStringSubmatch(line)
+	if match == nil {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, ";"):
+			d.addText("[green]" + tview.Escape(line) + "[-]")
+		case strings.HasSuffix(trimmed, ":"):
+			d.addText("[yellow]" + tview.Escape(line) + "[-]")
+		default:
+			d.addText(tview.Escape(line))
+		}
+		return
+	}
+
+	index, _ := strconv.Atoi(match[2])
+	anchor := insnAnchor(index)
+	d.anchors = append(d.anchors, anchor)
+	d.lines = append(d.lines, fmt.Sprintf(`%s["%s"]%s:[""][gray]%s[-]%s`, match[1], anchor, match[2], match[3], d.formatInsn(index, match[4])))
+}
+
+// Highlight an instruction and turn its references into links. The summary
+// of a helper is appended to the call
+func (d *disasmText) formatInsn(index int, insn string) string {
+	var b strings.Builder
+	summary := ""
+	last := 0
+	for _, m := range xlatedTokenRegex.FindAllStringSubmatchIndex(insn, -1) {
+		b.WriteString(tview.Escape(insn[last:m[0]]))
+		last = m[1]
+		token := insn[m[0]:m[1]]
+		switch {
+		case m[2] >= 0:
+			id, _ := strconv.Atoi(insn[m[2]:m[3]])
+			b.WriteString(d.link("[purple]"+tview.Escape(token)+"[-]", disasmLink{kind: linkMap, target: id}))
+		case m[4] >= 0:
+			name := insn[m[4]:m[5]]
+			summary = utils.HelperSummary(name)
+			b.WriteString("[yellow]call[-] [aqua]" + tview.Escape(name) + "[-]" + tview.Escape(insn[m[5]:m[1]]))
+		case m[6] >= 0 || m[8] >= 0:
+			group := 6
+			if m[8] >= 0 {
+				group = 8
+			}
+			offset, _ := strconv.Atoi(insn[m[group]:m[group+1]])
+			keyword, target := strings.Fields(token)[0], strings.Fields(token)[1]
+			b.WriteString("[yellow]" + keyword + "[-] " + d.link(target, disasmLink{kind: linkInsn, target: index + 1 + offset}))
+		case token[0] == 'r' || token[0] == 'w':
+			b.WriteString("[aqua]" + token + "[-]")
+		case token[0] >= '0' && token[0] <= '9':
+			b.WriteString("[purple]" + token + "[-]")
+		default:
+			b.WriteString("[yellow]" + token + "[-]")
+		}
+	}
+	b.WriteString(tview.Escape(insn[last:]))
+	if summary != "" {
+		b.WriteString("  [gray]; " + tview.Escape(summary) + "[-]")
+	}
+	return b.String()
+}
+
+func (d *disasmText) String() string {
+	return strings.Join(d.lines, "\n")
+}
@@ -0,0 +1,89 @@
+// This file handles the drift page of the TUI. It lists the programs and maps
+// that are new, missing or changed compared to the baseline given with
+// -baseline. The list is recomputed on every refresh
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+var driftColors = map[string]tcell.Color{
+	utils.DriftNew:     tcell.ColorOrange,
+	utils.DriftMissing: tcell.ColorRed,
+	utils.DriftChanged: tcell.ColorYellow,
+}
+
+type DriftView struct {
+	table *tview.Table
+}
+
+func NewDriftView() *DriftView {
+	v := &DriftView{}
+	v.buildTable()
+	return v
+}
+
+func (v *DriftView) Update() {
+	lock.Lock()
+	drift := make([]utils.Drift, len(Drift))
+	copy(drift, Drift)
+	incomplete := driftIncomplete
+	lock.Unlock()
+
+	tui.App.QueueUpdateDraw(func() {
+		v.render(drift, incomplete)
+	})
+}
+
+// incomplete is set if some attach points couldn't be collected for the last
+// check
+func (v *DriftView) render(drift []utils.Drift, incomplete bool) {
+	row, _ := v.table.GetSelection()
+	if incomplete {
+		v.table.SetTitle("Drift [yellow](some attach points couldn't be collected, attach changes may be wrong)[-]")
+	} else {
+		v.table.SetTitle("Drift")
+	}
+	v.table.Clear()
+	headers := []string{"Kind", "Object", "Key", "Ids", "Expected", "Actual"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+
+	if Baseline == nil {
+		v.table.SetCell(1, 0, tview.NewTableCell("No baseline loaded. Start ebpfmon with -baseline <file>").SetSelectable(false))
+	} else if len(drift) == 0 {
+		v.table.SetCell(1, 0, tview.NewTableCell("No drift from the baseline").SetSelectable(false))
+	}
+
+	for i, d := range drift {
+		ids := ""
+		if len(d.Ids) > 0 {
+			ids = fmt.Sprint(d.Ids)
+		}
+		cells := []string{d.Kind, d.Object, d.Key, ids, strings.Join(d.Expected, "; "), strings.Join(d.Actual, "; ")}
+		for j, cell := range cells {
+			tableCell := tview.NewTableCell(tview.Escape(cell))
+			if j == 0 {
+				tableCell.SetTextColor(driftColors[d.Kind])
+			}
+			v.table.SetCell(i+1, j, tableCell)
+		}
+	}
+	v.table.Select(row, 0)
+}
+
+func (v *DriftView) buildTable() {
+	v.table = tview.NewTable()
+	v.table.SetBorder(true).SetTitle("Drift")
+	v.table.SetSelectable(true, false)
+	v.table.SetFixed(1, 0)
+	v.render([]utils.Drift{}, false)
+}
@@ -7,8 +7,8 @@
 package ui
 
 import (
+	"ebpfmon/rules"
 	"ebpfmon/utils"
-	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
@@ -17,200 +17,210 @@ import (
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
+	log "github.com/sirupsen/logrus"
 )
 
 var tui *Tui
 
-type CgroupProgram struct {
-	Id          int    `json:"id"`
-	AttachType  string `json:"attach_type"`
-	AttachFlags string `json:"attach_flags"`
-	Name        string `json:"name"`
-}
-
-type CgroupInfo struct {
-	Cgroup   string          `json:"cgroup"`
-	Programs []CgroupProgram `json:"programs"`
-}
-
-type XdpInfo struct {
-	DevName string `json:"devname"`
-	IfIndex int    `json:"ifindex"`
-	Mode    string `json:"mode"`
-	Id      int    `json:"id"`
-}
-
-type NetInfo struct {
-	Xdp           []XdpInfo           `json:"xdp"`
-	Tc            []TcInfo            `json:"tc"`
-	FlowDissector []FlowDissectorInfo `json:"flow_dissector"`
-}
-
-type PerfInfo struct {
-	Pid        int    `json:"pid"`
-	Fd         int    `json:"fd"`
-	ProgId     int    `json:"prog_id"`
-	FdType     string `json:"fd_type"`
-	Func       string `json:"func",omitempty`
-	Offset     int    `json:"offset",omitempty`
-	Filename   string `json:"filename",omitempty`
-	Tracepoint string `json:"tracepoint",omitempty`
-}
-
 type BpfExplorerView struct {
 	flex        *tview.Flex
 	programList *tview.List
 	disassembly *tview.TextView
 	bpfInfoView *tview.TextView
 	mapList     *tview.List
+
+	// Asks where to export the control flow graph of the program to
+	exportForm *tview.Form
+
+	// The program that is shown and which of its disassemblies
+	progId     int
+	disasmMode int
+
+	// The text of the disassembly and the link that is selected in it
+	text *disasmText
+	link int
+
+	// The links that were followed to instructions so they can be gone
+	// back to
+	history []string
+
+	// Set while the pane highlights a region itself. Regions that are
+	// highlighted otherwise were clicked
+	highlighting bool
+
+	// Searches the disassembly. The matches are the regions of the lines
+	// that contain the search text
+	search  *tview.InputField
+	matches []string
+	match   int
 }
 
-func applyNetData() {
-	netInfo := []NetInfo{}
-	stdout, _, err := utils.RunCmd("sudo", BpftoolPath, "-j", "net", "show")
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error running `sudo %s -j net show`: %s\n", BpftoolPath, err))
-	}
-	err = json.Unmarshal(stdout, &netInfo)
+// What the disassembly pane shows
+const (
+	DisasmXlated     = 0
+	DisasmJited      = 1
+	DisasmSideBySide = 2
+	DisasmCfg        = 3
+)
+
+var disasmModeNames = []string{"xlated", "jited", "side by side", "cfg"}
+
+// The xlated column of the side by side view is cut off after this many
+// characters
+const maxXlatedWidth = 60
+
+// Ask the backend for the list of available programs
+// This runs as a go routine and updates the Programs variable
+func updateBpfPrograms() {
+	programs, err := utils.CollectPrograms()
 	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error decoding json output of `sudo %s -j net show`: %s\n", BpftoolPath, err))
+		tui.DisplayError(err.Error())
 	}
 
-	for _, prog := range netInfo {
-		for _, xdp := range prog.Xdp {
-			if entry, ok := Programs[xdp.Id]; ok {
-				entry.Interface = xdp.DevName
-				Programs[xdp.Id] = entry
-			}
-		}
-		for _, tc := range prog.Tc {
-			// Update programs with tc data
-			if entry, ok := Programs[tc.Id]; ok {
-				entry.Interface = tc.DevName
-				entry.Name = tc.Name
-				entry.TcKind = tc.Kind
-				Programs[tc.Id] = entry
-			}
+	// This may need the disassembly of new programs so it is done before
+	// taking the lock
+	var alerts []rules.Alert
+	if Rules != nil {
+		var alertErr error
+		alerts, alertErr = Rules.EvaluateAll(programs)
+		if alertErr != nil {
+			log.Errorf("Failed to get the helpers used by programs: %v\n", alertErr)
 		}
 	}
-}
 
-// Try an add extra information to the BpfProgram struct
-// If it fails that's ok. It just means we won't have the extra info
-// This runs as a go routine
-func applyCgroupData() {
-	cgroupInfo := []CgroupInfo{}
-	stdout, _, err := utils.RunCmd("sudo", BpftoolPath, "-j", "cgroup", "tree")
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error running `sudo %s -j cgroup tree`: %s\n", BpftoolPath, err))
+	// The drift is only left alone when the programs couldn't be listed at
+	// all. Missing attach points can show up as drift so the drift page
+	// says when they are incomplete
+	listed := err == nil || utils.IsEnrichError(err)
+	var drift []utils.Drift
+	checkDrift := false
+	if Baseline != nil && listed {
+		maps, mapErr := utils.GetBpfMapInfo()
+		if mapErr == nil {
+			drift = Baseline.Check(programs, maps)
+			checkDrift = true
+		}
 	}
-	err = json.Unmarshal(stdout, &cgroupInfo)
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error decoding json output of `sudo %s -j cgroup tree`: %s\n", BpftoolPath, err))
+
+	lock.Lock()
+	Programs = programs
+	recordAlerts(alerts)
+	if checkDrift {
+		recordDrift(drift)
+		driftIncomplete = err != nil
 	}
 
-	for _, prog := range cgroupInfo {
-		for _, cgroupProg := range prog.Programs {
-			if entry, ok := Programs[cgroupProg.Id]; ok {
-				entry.Cgroup = prog.Cgroup
-				entry.CgroupAttachFlags = cgroupProg.AttachFlags
-				entry.CgroupAttachType = cgroupProg.AttachType
-				Programs[cgroupProg.Id] = entry
-			}
-		}
+	// A failed listing would look like every program being unloaded so it
+	// isn't compared at all. Missing attach points would look like programs
+	// being detached so only loads and unloads are recorded when some of the
+	// extra information couldn't be collected
+	if err == nil {
+		recordEvents(tracker.Update(programs, time.Now()))
+	} else if utils.IsEnrichError(err) {
+		recordEvents(tracker.UpdateLoaded(programs, time.Now()))
 	}
+	lock.Unlock()
 }
 
-// Adds extra context to the BpfProgram struct
-// This runs as a go routine
-func enrichPrograms() {
-	applyPerfEventData()
-	applyCgroupData()
-	applyNetData()
+// Remember which programs matched a rule and log each alert the first time it
+// is raised for a program. The lock must be held
+func recordAlerts(alerts []rules.Alert) {
+	programAlerts = map[int][]rules.Alert{}
+	now := time.Now()
+	for _, alert := range alerts {
+		p := alert.Program
+		programAlerts[p.ProgramId] = append(programAlerts[p.ProgramId], alert)
+
+		key := fmt.Sprintf("%d/%s/%s", p.ProgramId, p.Tag, alert.Rule)
+		if raisedAlerts[key] {
+			continue
+		}
+		raisedAlerts[key] = true
+		Alerts = append(Alerts, AlertEntry{Time: now, Alert: alert})
+
+		log.WithFields(log.Fields{
+			"rule":        alert.Rule,
+			"severity":    alert.Severity,
+			"description": alert.Description,
+			"prog_id":     p.ProgramId,
+			"prog_name":   p.Name,
+			"prog_type":   p.ProgType,
+			"prog_tag":    p.Tag,
+			"attach":      p.AttachSummary(),
+			"owner_pids":  ownerPids(p.Pids),
+			"owner_comm":  ownerComms(p.Pids),
+		}).Warn("bpf program matched rule " + alert.Rule)
+	}
+	if len(Alerts) > maxEvents {
+		Alerts = Alerts[len(Alerts)-maxEvents:]
+	}
 }
 
-// Call the bpftool binary using the `perf` option to get the
-// list of perf events
-// This runs as a go routine
-func applyPerfEventData() {
-	perfInfo := []PerfInfo{}
-	stdout, _, err := utils.RunCmd("sudo", BpftoolPath, "-j", "perf", "list")
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error running `sudo %s -j perf list`: %s\n", BpftoolPath, err))
+// Remember the drift from the baseline and log anything that wasn't drifting
+// before. The lock must be held
+func recordDrift(drift []utils.Drift) {
+	previous := map[string]bool{}
+	for _, d := range Drift {
+		previous[d.String()] = true
 	}
 
-	err = json.Unmarshal(stdout, &perfInfo)
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Error decoding json output of `sudo %s -j perf list`: %s\n", BpftoolPath, err))
-	}
-
-	for _, prog := range perfInfo {
-		if entry, ok := Programs[prog.ProgId]; ok {
-			entry.Fd = prog.Fd
-			entry.ProgType = prog.FdType
-			if prog.FdType == "kprobe" || prog.FdType == "kretprobe" {
-				entry.AttachPoint = append(entry.AttachPoint, prog.Func)
-				entry.Offset = prog.Offset
-			} else if prog.FdType == "uprobe" || prog.FdType == "uretprobe" {
-				entry.AttachPoint = append(entry.AttachPoint, prog.Filename)
-				entry.Offset = prog.Offset
-			} else {
-				entry.AttachPoint = append(entry.AttachPoint, prog.Tracepoint)
+	programDrift = map[int]string{}
+	for _, d := range drift {
+		if d.Object == "program" {
+			for _, id := range d.Ids {
+				programDrift[id] = d.Kind
 			}
-			Programs[prog.ProgId] = entry
+		}
+		if !previous[d.String()] {
+			log.WithFields(log.Fields{
+				"drift":    d.Kind,
+				"object":   d.Object,
+				"key":      d.Key,
+				"ids":      d.Ids,
+				"expected": d.Expected,
+				"actual":   d.Actual,
+			}).Warn("drift from baseline")
 		}
 	}
+	Drift = drift
 }
 
-// Call the bpftool binary to gather the list of available programs
-// and return a list of BpfProgram structs
-// This runs as a go routine and updates the Programs variable
-func updateBpfPrograms() {
-	// I think the bug is here. We need to intelligently update the Programs variable
-	// Use a mutex
-	lock.Lock()
-
-	Programs = map[int]utils.BpfProgram{}
-	tmp := []utils.BpfProgram{}
-	stdout, stderr, err := utils.RunCmd("sudo", BpftoolPath, "-j", "prog", "show")
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Failed to run `sudo %s -j prog show`\n%s\n", BpftoolPath, string(stderr)))
-	}
-	err = json.Unmarshal(stdout, &tmp)
-	if err != nil {
-		tui.DisplayError(fmt.Sprintf("Failed to run `sudo %s -j prog show`\n%s\n", BpftoolPath, string(stderr)))
-	}
-
-	for _, program := range tmp {
-		Programs[program.ProgramId] = program
-	}
-
-	for _, value := range Programs {
-		for j, pid := range value.Pids {
-			cmdline, err := utils.GetProcessCmdline(pid.Pid)
-			if err == nil {
-				value.Pids[j].Cmdline = cmdline
-			}
-			path, err := utils.GetProcessPath(pid.Pid)
-			if err == nil {
-				value.Pids[j].Path = path
-			}
+// Log the events and add them to the timeline. The lock must be held
+func recordEvents(events []utils.ProgramEvent) {
+	for _, event := range events {
+		fields := log.Fields{
+			"event":      event.Type,
+			"prog_id":    event.ProgramId,
+			"prog_name":  event.Name,
+			"prog_type":  event.ProgType,
+			"prog_tag":   event.Tag,
+			"attach":     event.AttachPoint,
+			"owner_pids": ownerPids(event.Owners),
+			"owner_comm": ownerComms(event.Owners),
 		}
+		if event.Type == utils.EventAttachChange {
+			fields["previous_attach"] = event.PreviousAttachPoint
+		}
+		log.WithFields(fields).Info("bpf program " + event.Type)
 	}
 
-	enrichPrograms()
-	lock.Unlock()
+	Events = append(Events, events...)
+	if len(Events) > maxEvents {
+		Events = Events[len(Events)-maxEvents:]
+	}
 }
 
 func NewBpfExplorerView(t *Tui) *BpfExplorerView {
 	// Ensure that this pointer gets set first!
 	tui = t
 
-	BpfExplorerView := &BpfExplorerView{}
+	BpfExplorerView := &BpfExplorerView{text: newDisasmText(), link: -1}
 	BpfExplorerView.buildProgramList()
 	BpfExplorerView.buildMapList()
 	BpfExplorerView.buildDisassemblyView()
+	BpfExplorerView.buildSearch()
 	BpfExplorerView.buildBpfInfoView()
+	BpfExplorerView.buildExportForm()
 	BpfExplorerView.buildLayout()
 	return BpfExplorerView
 }
@@ -227,6 +237,10 @@ func (b *BpfExplorerView) Update() {
 		})
 		time.Sleep(3 * time.Second)
 		updateBpfPrograms()
+		tui.bpfTopView.Update()
+		tui.timelineView.Update()
+		tui.alertsView.Update()
+		tui.driftView.Update()
 	}
 }
 
@@ -239,8 +253,12 @@ func (b *BpfExplorerView) buildLayout() {
 		AddItem(b.mapList, 0, 1, false)
 
 	// Alternate layout
+	disasmFlex := tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(b.disassembly, 0, 1, false).
+		AddItem(b.search, 1, 0, false)
 	aflex := tview.NewFlex().
-		AddItem(b.disassembly, 0, 2, false).
+		AddItem(disasmFlex, 0, 2, false).
 		AddItem(rightFlex, 0, 1, false)
 
 	b.flex = tview.NewFlex()
@@ -282,89 +300,133 @@ func (b *BpfExplorerView) buildProgramList() {
 	populateList(b.programList)
 
 	b.programList.SetSelectedFunc(func(i int, s1, s2 string, r rune) {
-		b.mapList.Clear()
-		b.bpfInfoView.Clear()
-		b.disassembly.Clear()
-
-		lock.Lock()
-		progId, err := strconv.Atoi(strings.TrimSpace(strings.Split(s1, ":")[0]))
+		progId, err := listProgramId(s1)
 		if err != nil {
+			b.mapList.Clear()
+			b.disassembly.Clear()
+			b.bpfInfoView.Clear()
 			fmt.Fprintf(b.bpfInfoView, "Failed to parse program id: %s\n", err)
+			return
 		}
+		b.showProgram(progId)
+	})
+}
 
-		selectedProgram := Programs[progId]
+// Get the id of the program shown in an item of the program list
+func listProgramId(text string) (int, error) {
+	return strconv.Atoi(strings.TrimSpace(strings.Split(text, ":")[0]))
+}
 
-		lock.Unlock()
-		insns, err := utils.GetBpfProgramDisassembly(progId)
-		if err != nil {
-			fmt.Fprintf(b.disassembly, "Error getting disassembly: %s\n", err)
-		} else {
-			for _, line := range insns {
-				fmt.Fprintf(b.disassembly, "%s\n", line)
-			}
+// Select a program in the program list and show its details. Returns false if
+// the program isn't in the list (i.e. it was unloaded)
+func (b *BpfExplorerView) ShowProgram(progId int) bool {
+	for i := 0; i < b.programList.GetItemCount(); i++ {
+		text, _ := b.programList.GetItemText(i)
+		if id, err := listProgramId(text); err == nil && id == progId {
+			b.programList.SetCurrentItem(i)
+			b.showProgram(progId)
+			return true
 		}
+	}
+	return false
+}
 
-		// Get the map info for each map used by the selected program
-		if len(selectedProgram.MapIds) > 0 {
-			mapInfo, err := utils.GetBpfMapInfoByIds(selectedProgram.MapIds)
-			if err != nil {
-				fmt.Fprintf(b.bpfInfoView, "Failed to get map info: %s\n", err)
-			}
-			for _, map_ := range mapInfo {
-				b.mapList.AddItem(map_.String(), "", 0, nil)
-			}
-		}
+// Show the disassembly, details and maps of a program
+func (b *BpfExplorerView) showProgram(progId int) {
+	b.mapList.Clear()
+	b.bpfInfoView.Clear()
+	b.disassembly.Clear()
 
-		// Output the info for the selected program
-		fmt.Fprintf(b.bpfInfoView, "[blue]Name:[-] %s\n", selectedProgram.Name)
-		fmt.Fprintf(b.bpfInfoView, "[blue]Tag:[-] %s\n", selectedProgram.Tag)
-		fmt.Fprintf(b.bpfInfoView, "[blue]ProgramId:[-] %d\n", selectedProgram.ProgramId)
-		fmt.Fprintf(b.bpfInfoView, "[blue]ProgType:[-] %s\n", selectedProgram.ProgType)
-		for _, pid := range selectedProgram.Pids {
-			fmt.Fprintf(b.bpfInfoView, "[blue]Owner:[-] %s\n", pid.Comm)
-			fmt.Fprintf(b.bpfInfoView, "[blue]OwnerCmdline:[-] %s\n", pid.Cmdline)
-			fmt.Fprintf(b.bpfInfoView, "[blue]OwnerPath:[-] %s\n", pid.Path)
-			fmt.Fprintf(b.bpfInfoView, "[blue]OwnerPid:[-] %d\n", pid.Pid)
-			fmt.Fprintf(b.bpfInfoView, "[blue]OwnerUid:[-] %d\n", pid.Uid)
-			fmt.Fprintf(b.bpfInfoView, "[blue]OwnerGid:[-] %d\n", pid.Gid)
-		}
-		fmt.Fprintf(b.bpfInfoView, "[blue]GplCompat:[-] %v\n", selectedProgram.GplCompatible)
-		fmt.Fprintf(b.bpfInfoView, "[blue]LoadedAt:[-] %v\n", time.Unix(int64(selectedProgram.LoadedAt), 0))
-		fmt.Fprintf(b.bpfInfoView, "[blue]BytesXlated:[-] %d\n", selectedProgram.BytesXlated)
-		fmt.Fprintf(b.bpfInfoView, "[blue]Jited:[-] %v\n", selectedProgram.Jited)
-		fmt.Fprintf(b.bpfInfoView, "[blue]BytesMemlock:[-] %d\n", selectedProgram.BytesXlated)
-		fmt.Fprintf(b.bpfInfoView, "[blue]BtfId:[-] %d\n", selectedProgram.BtfId)
-		if len(selectedProgram.MapIds) > 0 {
-			fmt.Fprintf(b.bpfInfoView, "[blue]MapIds:[-] %v\n", selectedProgram.MapIds)
-		}
-		if len(selectedProgram.Pinned) > 0 {
-			fmt.Fprintf(b.bpfInfoView, "[blue]Pinned:[-] %s\n", selectedProgram.Pinned)
-		}
-		// fmt.Println(selectedProgram.ProgType)
-		if selectedProgram.ProgType == "kprobe" ||
-			selectedProgram.ProgType == "kretprobe" ||
-			selectedProgram.ProgType == "tracepoint" ||
-			selectedProgram.ProgType == "raw_tracepoint" ||
-			selectedProgram.ProgType == "uprobe" ||
-			selectedProgram.ProgType == "uretprobe" {
-			// fmt.Println(selectedProgram.AttachPoint)
-			fmt.Fprintf(b.bpfInfoView, "[blue]AttachPoint:[-]\n")
-			for _, attachPoint := range selectedProgram.AttachPoint {
-				fmt.Fprintf(b.bpfInfoView, "\t└─%s\n", attachPoint)
-			}
-			fmt.Fprintf(b.bpfInfoView, "[blue]Offset:[-] %d\n", selectedProgram.Offset)
-			fmt.Fprintf(b.bpfInfoView, "[blue]Fd:[-] %d\n", selectedProgram.Fd)
+	lock.Lock()
+	selectedProgram := Programs[progId]
+	lock.Unlock()
+	b.progId = progId
+	b.showDisassembly()
+
+	// Get the map info for each map used by the selected program
+	if len(selectedProgram.MapIds) > 0 {
+		mapInfo, err := utils.GetBpfMapInfoByIds(selectedProgram.MapIds)
+		if err != nil {
+			fmt.Fprintf(b.bpfInfoView, "Failed to get map info: %s\n", err)
 		}
+		for _, map_ := range mapInfo {
+			b.mapList.AddItem(map_.String(), "", 0, nil)
+		}
+	}
 
-		if strings.Contains(selectedProgram.ProgType, "xdp") || strings.Contains(selectedProgram.ProgType, "sched") {
-			fmt.Fprintf(b.bpfInfoView, "[blue]Interface:[-] %s\n", selectedProgram.Interface)
+	// Output the info for the selected program
+	fmt.Fprintf(b.bpfInfoView, "[blue]Name:[-] %s\n", selectedProgram.Name)
+	fmt.Fprintf(b.bpfInfoView, "[blue]Tag:[-] %s\n", selectedProgram.Tag)
+	fmt.Fprintf(b.bpfInfoView, "[blue]ProgramId:[-] %d\n", selectedProgram.ProgramId)
+	fmt.Fprintf(b.bpfInfoView, "[blue]ProgType:[-] %s\n", selectedProgram.ProgType)
+	if selectedProgram.Fingerprint != "" {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Fingerprint:[-] %s\n", selectedProgram.Fingerprint)
+	}
+	for _, pid := range selectedProgram.Pids {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Owner:[-] %s\n", pid.Comm)
+		fmt.Fprintf(b.bpfInfoView, "[blue]OwnerCmdline:[-] %s\n", pid.Cmdline)
+		fmt.Fprintf(b.bpfInfoView, "[blue]OwnerPath:[-] %s\n", pid.Path)
+		fmt.Fprintf(b.bpfInfoView, "[blue]OwnerPid:[-] %d\n", pid.Pid)
+		fmt.Fprintf(b.bpfInfoView, "[blue]OwnerUid:[-] %d\n", pid.Uid)
+		fmt.Fprintf(b.bpfInfoView, "[blue]OwnerGid:[-] %d\n", pid.Gid)
+	}
+	fmt.Fprintf(b.bpfInfoView, "[blue]GplCompat:[-] %v\n", selectedProgram.GplCompatible)
+	fmt.Fprintf(b.bpfInfoView, "[blue]LoadedAt:[-] %v\n", time.Unix(int64(selectedProgram.LoadedAt), 0))
+	fmt.Fprintf(b.bpfInfoView, "[blue]BytesXlated:[-] %d\n", selectedProgram.BytesXlated)
+	fmt.Fprintf(b.bpfInfoView, "[blue]Jited:[-] %v\n", selectedProgram.Jited)
+	fmt.Fprintf(b.bpfInfoView, "[blue]BytesMemlock:[-] %d\n", selectedProgram.BytesXlated)
+	fmt.Fprintf(b.bpfInfoView, "[blue]BtfId:[-] %d\n", selectedProgram.BtfId)
+	if selectedProgram.RunCnt > 0 || selectedProgram.RunTimeNs > 0 {
+		fmt.Fprintf(b.bpfInfoView, "[blue]RunCnt:[-] %d\n", selectedProgram.RunCnt)
+		fmt.Fprintf(b.bpfInfoView, "[blue]RunTimeNs:[-] %d\n", selectedProgram.RunTimeNs)
+		fmt.Fprintf(b.bpfInfoView, "[blue]RecursionMisses:[-] %d\n", selectedProgram.RecursionMisses)
+	}
+	if len(selectedProgram.MapIds) > 0 {
+		fmt.Fprintf(b.bpfInfoView, "[blue]MapIds:[-] %v\n", selectedProgram.MapIds)
+	}
+	if len(selectedProgram.Pinned) > 0 {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Pinned:[-] %s\n", selectedProgram.Pinned)
+	}
+	// fmt.Println(selectedProgram.ProgType)
+	if selectedProgram.ProgType == "kprobe" ||
+		selectedProgram.ProgType == "kretprobe" ||
+		selectedProgram.ProgType == "tracepoint" ||
+		selectedProgram.ProgType == "raw_tracepoint" ||
+		selectedProgram.ProgType == "uprobe" ||
+		selectedProgram.ProgType == "uretprobe" {
+		// fmt.Println(selectedProgram.AttachPoint)
+		fmt.Fprintf(b.bpfInfoView, "[blue]AttachPoint:[-]\n")
+		for _, attachPoint := range selectedProgram.AttachPoint {
+			fmt.Fprintf(b.bpfInfoView, "\t└─%s\n", attachPoint)
 		}
-		if strings.Contains(selectedProgram.ProgType, "cgroup") {
-			fmt.Fprintf(b.bpfInfoView, "[blue]Cgroup:[-] %s\n", selectedProgram.Cgroup)
-			fmt.Fprintf(b.bpfInfoView, "[blue]CgroupAttachType:[-] %s\n", selectedProgram.CgroupAttachType)
-			fmt.Fprintf(b.bpfInfoView, "[blue]CgroupAttachFlags:[-] %s\n", selectedProgram.CgroupAttachFlags)
+		fmt.Fprintf(b.bpfInfoView, "[blue]Offset:[-] %d\n", selectedProgram.Offset)
+		fmt.Fprintf(b.bpfInfoView, "[blue]Fd:[-] %d\n", selectedProgram.Fd)
+	} else if len(selectedProgram.AttachPoint) > 0 {
+		// Programs attached through links (fentry, lsm, iter etc)
+		fmt.Fprintf(b.bpfInfoView, "[blue]AttachPoint:[-]\n")
+		for _, attachPoint := range selectedProgram.AttachPoint {
+			fmt.Fprintf(b.bpfInfoView, "\t└─%s\n", tview.Escape(attachPoint))
 		}
-	})
+	}
+
+	if strings.Contains(selectedProgram.ProgType, "xdp") || strings.Contains(selectedProgram.ProgType, "sched") {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Interface:[-] %s\n", selectedProgram.Interface)
+	}
+	if strings.Contains(selectedProgram.ProgType, "cgroup") {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Cgroup:[-] %s\n", selectedProgram.Cgroup)
+		fmt.Fprintf(b.bpfInfoView, "[blue]CgroupAttachType:[-] %s\n", selectedProgram.CgroupAttachType)
+		fmt.Fprintf(b.bpfInfoView, "[blue]CgroupAttachFlags:[-] %s\n", selectedProgram.CgroupAttachFlags)
+	}
+	if len(selectedProgram.Helpers) > 0 {
+		fmt.Fprintf(b.bpfInfoView, "[blue]Helpers:[-]\n")
+		for _, helper := range selectedProgram.Helpers {
+			fmt.Fprintf(b.bpfInfoView, "\t└─%s (%d calls)", helper.Name, helper.Calls)
+			if helper.Risk != "" {
+				fmt.Fprintf(b.bpfInfoView, " [red]risky: %s[-]", helper.Risk)
+			}
+			fmt.Fprintf(b.bpfInfoView, "\n")
+		}
+	}
 }
 
 func (b *BpfExplorerView) buildMapList() {
@@ -375,26 +437,32 @@ func (b *BpfExplorerView) buildMapList() {
 	b.mapList.SetSelectedFunc(func(i int, s1, s2 string, r rune) {
 		mapId := strings.TrimSpace(strings.Split(utils.RemoveStringColors(s1), ":")[0])
 		mapIdInt, _ := strconv.Atoi(mapId)
+		openMap(mapIdInt)
+	})
+}
 
-		mapInfo, err := utils.GetBpfMapInfoByIds([]int{mapIdInt})
-		if err != nil {
-			tui.DisplayError(fmt.Sprintf("Failed to get map info: %v\n", err))
-		} else {
-			if mapInfo[0].Type == "ringbuf" {
-				tui.DisplayError("Cannot read from a ringbuf map")
-				return
-			}
+// Open a map in the map view
+func openMap(mapId int) {
+	mapInfo, err := utils.GetBpfMapInfoByIds([]int{mapId})
+	if err != nil {
+		tui.DisplayError(fmt.Sprintf("Failed to get map info: %v\n", err))
+	} else {
+		// Ringbufs and perf event arrays can't be dumped. Their records
+		// are streamed instead
+		if utils.IsStreamMap(mapInfo[0].Type) {
+			tui.mapEventsView.Open(mapInfo[0])
+			return
+		}
 
-			err := tui.bpfMapTableView.UpdateMap(mapInfo[0])
-			if err == nil {
-				tui.pages.SwitchToPage("maptable")
-			}
+		err := tui.bpfMapTableView.OpenMap(mapInfo[0])
+		if err == nil {
+			tui.pages.SwitchToPage("maptable")
 		}
-	})
+	}
 }
 
 func buildFrame(programList *tview.List) *tview.Frame {
-	frame := tview.NewFrame(programList).AddText("    Id: Type          Tag              Name                 Attach Point", true, tview.AlignLeft, tcell.ColorWhite)
+	frame := tview.NewFrame(programList).AddText("    Id: Risk Type          Tag              Name                 Attach Point", true, tview.AlignLeft, tcell.ColorWhite)
 	frame.SetBorder(true).SetTitle("Programs")
 	return frame
 }
@@ -413,10 +481,336 @@ func (b *BpfExplorerView) buildDisassemblyView() {
 		SetRegions(true).
 		SetWordWrap(true)
 	b.disassembly.SetBorder(true).SetTitle("Disassembly")
+	b.disassembly.SetHighlightedFunc(func(added, removed, remaining []string) {
+		if b.highlighting || len(added) == 0 {
+			return
+		}
+		if _, ok := b.text.links[added[0]]; ok {
+			b.followLink(added[0])
+		}
+	})
+	b.disassembly.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEnter {
+			if b.link >= 0 {
+				b.followLink(b.text.linkIds[b.link])
+			}
+			return nil
+		}
+		switch event.Rune() {
+		case 'j':
+			b.disasmMode = (b.disasmMode + 1) % len(disasmModeNames)
+			if b.progId != 0 {
+				b.showDisassembly()
+			}
+		case 'x':
+			if b.progId != 0 {
+				b.showExportForm()
+			}
+		case 'l':
+			b.selectLink(1)
+		case 'L':
+			b.selectLink(-1)
+		case 'b':
+			b.goBack()
+		case '/':
+			tui.App.SetFocus(b.search)
+		case 'n':
+			b.selectMatch(1)
+		case 'N':
+			b.selectMatch(-1)
+		default:
+			return event
+		}
+		return nil
+	})
+}
+
+func (b *BpfExplorerView) buildSearch() {
+	b.search = tview.NewInputField().SetLabel("Search: ")
+	b.search.SetChangedFunc(func(text string) {
+		b.updateMatches()
+		b.selectMatch(0)
+	})
+	b.search.SetDoneFunc(func(key tcell.Key) {
+		tui.App.SetFocus(b.disassembly)
+	})
+}
+
+// Highlight regions of the disassembly and scroll to them
+func (b *BpfExplorerView) highlight(regions ...string) {
+	b.highlighting = true
+	b.disassembly.Highlight(regions...).ScrollToHighlight()
+	b.highlighting = false
+}
+
+// Select the next (or previous) link
+func (b *BpfExplorerView) selectLink(direction int) {
+	count := len(b.text.linkIds)
+	if count == 0 {
+		return
+	}
+	b.link = ((b.link+direction)%count + count) % count
+	b.highlight(b.text.linkIds[b.link])
+}
+
+// Open the map of a link or jump to the instruction it points to
+func (b *BpfExplorerView) followLink(region string) {
+	link := b.text.links[region]
+	for i, id := range b.text.linkIds {
+		if id == region {
+			b.link = i
+		}
+	}
+	switch link.kind {
+	case linkMap:
+		openMap(link.target)
+	case linkInsn:
+		b.history = append(b.history, region)
+		b.highlight(insnAnchor(link.target))
+	}
+}
+
+// Go back to the link that was last followed to an instruction
+func (b *BpfExplorerView) goBack() {
+	if len(b.history) == 0 {
+		return
+	}
+	region := b.history[len(b.history)-1]
+	b.history = b.history[:len(b.history)-1]
+	b.highlight(region)
+}
+
+// Find the lines that contain the search text. The search isn't case
+// sensitive
+func (b *BpfExplorerView) updateMatches() {
+	b.matches = nil
+	b.match = 0
+	search := strings.ToLower(b.search.GetText())
+	if search != "" {
+		lines := strings.Split(b.disassembly.GetText(true), "\n")
+		for i, line := range lines {
+			if i < len(b.text.anchors) && strings.Contains(strings.ToLower(line), search) {
+				b.matches = append(b.matches, b.text.anchors[i])
+			}
+		}
+	}
+	b.updateTitle()
+}
+
+// Move to the next (or previous) line that matches the search
+func (b *BpfExplorerView) selectMatch(direction int) {
+	if len(b.matches) == 0 {
+		return
+	}
+	b.match = ((b.match+direction)%len(b.matches) + len(b.matches)) % len(b.matches)
+	b.highlight(b.matches[b.match])
+	b.updateTitle()
+}
+
+func (b *BpfExplorerView) updateTitle() {
+	title := fmt.Sprintf("Disassembly (%s, j to switch, x to export the cfg)", disasmModeNames[b.disasmMode])
+	if b.search.GetText() != "" {
+		if len(b.matches) == 0 {
+			title += " no matches"
+		} else {
+			title += fmt.Sprintf(" match %d/%d", b.match+1, len(b.matches))
+		}
+	}
+	b.disassembly.SetTitle(title)
+}
+
+// Show the disassembly of the current program in the current mode
+func (b *BpfExplorerView) showDisassembly() {
+	b.disassembly.Clear()
+	b.text = newDisasmText()
+	b.link = -1
+	b.history = nil
+	b.updateMatches()
+	b.disassembly.SetWrap(b.disasmMode != DisasmSideBySide)
+
+	var xlated, jited []string
+	var err error
+	if b.disasmMode != DisasmJited {
+		xlated, err = utils.GetBpfProgramDisassembly(b.progId)
+		if err != nil {
+			fmt.Fprintf(b.disassembly, "Error getting disassembly: %s\n", err)
+			return
+		}
+	}
+	if b.disasmMode == DisasmJited || b.disasmMode == DisasmSideBySide {
+		jited, err = utils.GetBpfProgramJitedDisassembly(b.progId)
+		if err != nil {
+			fmt.Fprintf(b.disassembly, "Error getting jited disassembly: %s\n", tview.Escape(err.Error()))
+			return
+		}
+	}
+
+	text := newDisasmText()
+	switch b.disasmMode {
+	case DisasmXlated:
+		for _, line := range xlated {
+			text.addXlated(line)
+		}
+	case DisasmJited:
+		for _, line := range jited {
+			text.addText(tview.Escape(line))
+		}
+	case DisasmSideBySide:
+		for _, line := range sideBySideLines(utils.AlignDisassembly(xlated, jited)) {
+			text.addText(line)
+		}
+	case DisasmCfg:
+		cfg, err := utils.NewCfg(xlated)
+		if err != nil {
+			fmt.Fprintf(b.disassembly, "Error building the control flow graph: %s\n", tview.Escape(err.Error()))
+			return
+		}
+		addCfgLines(text, cfg)
+	}
+	b.text = text
+	b.disassembly.SetText(text.String())
+	b.disassembly.ScrollToBeginning()
+	b.updateMatches()
+}
+
+// Print the basic blocks of a program. Each block starts with the blocks that
+// lead to it and ends with links to the blocks it leads to. Back edges are red
+func addCfgLines(text *disasmText, cfg *utils.Cfg) {
+	from := map[int][]string{}
+	for _, block := range cfg.Blocks {
+		for _, edge := range block.Edges {
+			from[edge.To] = append(from[edge.To], strconv.Itoa(block.Id))
+		}
+	}
+
+	for _, block := range cfg.Blocks {
+		header := fmt.Sprintf("[yellow]block %d[-] (%d-%d)", block.Id, block.Start, block.End)
+		if len(from[block.Id]) > 0 {
+			header += " from " + strings.Join(from[block.Id], ", ")
+		}
+		text.addText(header)
+		for _, line := range block.Lines {
+			text.addXlated(line)
+		}
+		for _, edge := range block.Edges {
+			target := text.link(fmt.Sprintf("block %d", edge.To), disasmLink{kind: linkInsn, target: cfg.Blocks[edge.To].Start})
+			if edge.BackEdge {
+				text.addText(fmt.Sprintf("  [red]-> %s (%s, back edge)[-]", target, edge.Kind))
+			} else {
+				text.addText(fmt.Sprintf("  -> %s (%s)", target, edge.Kind))
+			}
+		}
+		text.addText("")
+	}
+}
+
+// Ask where to export the control flow graph of the current program
+func (b *BpfExplorerView) showExportForm() {
+	path := b.exportForm.GetFormItemByLabel("File").(*tview.InputField)
+	path.SetText(fmt.Sprintf("prog_%d.dot", b.progId))
+	b.exportForm.GetFormItemByLabel("Format").(*tview.DropDown).SetCurrentOption(0)
+	b.exportForm.SetFocus(0)
+	previousPage = "programs"
+	tui.pages.SwitchToPage("cfgexport")
+	tui.App.SetFocus(b.exportForm)
+}
+
+// Build the control flow graph of the current program and write it to a file
+func (b *BpfExplorerView) exportCfg(path string, format string) error {
+	xlated, err := utils.GetBpfProgramDisassembly(b.progId)
+	if err != nil {
+		return err
+	}
+	cfg, err := utils.NewCfg(xlated)
+	if err != nil {
+		return err
+	}
+	lock.Lock()
+	name := Programs[b.progId].Name
+	lock.Unlock()
+	if name == "" {
+		name = fmt.Sprintf("prog_%d", b.progId)
+	}
+	return utils.WriteCfg(path, format, name, cfg)
 }
 
-// Populate a tview.List with the output of GetBpfPrograms
+func (b *BpfExplorerView) buildExportForm() {
+	b.exportForm = tview.NewForm().
+		AddInputField("File", "", 0, nil, nil).
+		AddDropDown("Format", utils.CfgFormats, 0, func(option string, index int) {
+			// This already runs while the form is being built
+			if b.exportForm == nil {
+				return
+			}
+			path := b.exportForm.GetFormItemByLabel("File").(*tview.InputField)
+			text := path.GetText()
+			for _, format := range utils.CfgFormats {
+				text = strings.TrimSuffix(text, "."+format)
+			}
+			if text != "" {
+				path.SetText(text + "." + option)
+			}
+		}).
+		AddButton("Export", func() {
+			path := b.exportForm.GetFormItemByLabel("File").(*tview.InputField).GetText()
+			_, format := b.exportForm.GetFormItemByLabel("Format").(*tview.DropDown).GetCurrentOption()
+			if err := b.exportCfg(path, format); err != nil {
+				tui.DisplayError(fmt.Sprintf("Failed to export the control flow graph to %s: %v", path, err))
+				return
+			}
+			tui.pages.SwitchToPage("programs")
+			tui.App.SetFocus(b.disassembly)
+		}).
+		AddButton("Cancel", func() {
+			tui.pages.SwitchToPage("programs")
+			tui.App.SetFocus(b.disassembly)
+		})
+	b.exportForm.SetBorder(true).SetTitle("Export the control flow graph (svg needs graphviz)")
+}
+
+// Print the xlated instructions and their jited code next to each other with
+// the source line of each block above it
+func sideBySideLines(blocks []utils.DisassemblyBlock) []string {
+	width := 0
+	for _, block := range blocks {
+		for _, line := range block.Xlated {
+			if len(line) > width {
+				width = len(line)
+			}
+		}
+	}
+	if width > maxXlatedWidth {
+		width = maxXlatedWidth
+	}
+
+	result := []string{}
+	for _, block := range blocks {
+		if block.Source != "" {
+			result = append(result, "[green]; "+tview.Escape(block.Source)+"[-]")
+		}
+		for i := 0; i < len(block.Xlated) || i < len(block.Jited); i++ {
+			left, right := "", ""
+			if i < len(block.Xlated) {
+				left = strings.ReplaceAll(block.Xlated[i], "\t", " ")
+			}
+			if i < len(block.Jited) {
+				right = strings.ReplaceAll(block.Jited[i], "\t", " ")
+			}
+			if len(left) > width {
+				left = left[:width]
+			}
+			result = append(result, tview.Escape(fmt.Sprintf("%-*s | %s", width, left, right)))
+		}
+	}
+	return result
+}
+
+// Populate a tview.List with the output of GetBpfPrograms. Programs that
+// matched a rule get the most severe rule appended in its severity color and
+// programs that drifted from the baseline get the kind of drift appended
 func populateList(list *tview.List) {
+	lock.Lock()
+	defer lock.Unlock()
 	keys := make([]int, 0, len(Programs))
 	for k := range Programs {
 		keys = append(keys, k)
@@ -424,6 +818,19 @@ func populateList(list *tview.List) {
 	sort.Ints(keys)
 
 	for _, k := range keys {
-		list.AddItem(Programs[k].String(), "", 0, nil)
+		text := Programs[k].String()
+		if alerts := programAlerts[k]; len(alerts) > 0 {
+			worst := alerts[0]
+			for _, alert := range alerts[1:] {
+				if rules.SeverityRank(alert.Severity) > rules.SeverityRank(worst.Severity) {
+					worst = alert
+				}
+			}
+			text += fmt.Sprintf(" [%s]<%s: %s>[-]", severityColors[worst.Severity], worst.Severity, worst.Rule)
+		}
+		if kind, ok := programDrift[k]; ok {
+			text += fmt.Sprintf(" [orange]<drift: %s>[-]", kind)
+		}
+		list.AddItem(text, "", 0, nil)
 	}
 }
@@ -0,0 +1,445 @@
+package ui
+
+import (
+	"ebpfmon/rules"
+	"ebpfmon/utils"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rivo/tview"
+)
+
+// A Backend that returns canned data so the ui can be tested without root
+// or a live kernel
+type fakeBackend struct {
+	programs []utils.BpfProgram
+	maps     []utils.BpfMap
+	entries  map[int][]utils.BpfMapEntry
+	net      []utils.NetInfo
+	cgroups  []utils.CgroupInfo
+	perf     []utils.PerfInfo
+	links    []utils.BpfLink
+	btf      map[int]*utils.MapBtf
+	btfObjs  []utils.BtfObject
+	btfC     map[int]string
+	events   []utils.MapEvent
+	trace    []utils.TraceLine
+}
+
+func (f *fakeBackend) Programs() ([]utils.BpfProgram, error) {
+	// Hand out copies so the enrichment can't modify the canned data
+	result := make([]utils.BpfProgram, len(f.programs))
+	copy(result, f.programs)
+	return result, nil
+}
+
+func (f *fakeBackend) Maps() ([]utils.BpfMap, error) {
+	return f.maps, nil
+}
+
+func (f *fakeBackend) MapEntries(mapId int) ([]utils.BpfMapEntry, error) {
+	return f.entries[mapId], nil
+}
+
+func (f *fakeBackend) UpdateMapEntry(mapId int, key []byte, value []byte) error {
+	for i, e := range f.entries[mapId] {
+		if string(e.Key) == string(key) {
+			f.entries[mapId][i].Value = value
+			return nil
+		}
+	}
+	f.entries[mapId] = append(f.entries[mapId], utils.BpfMapEntry{Key: key, Value: value})
+	return nil
+}
+
+func (f *fakeBackend) UpdateMapEntryValues(mapId int, key []byte, values [][]byte) error {
+	for i, e := range f.entries[mapId] {
+		if string(e.Key) == string(key) {
+			f.entries[mapId][i].Value = values[0]
+			f.entries[mapId][i].Values = values
+			return nil
+		}
+	}
+	f.entries[mapId] = append(f.entries[mapId], utils.BpfMapEntry{Key: key, Value: values[0], Values: values})
+	return nil
+}
+
+func (f *fakeBackend) DeleteMapEntry(mapId int, key []byte) error {
+	for i, e := range f.entries[mapId] {
+		if string(e.Key) == string(key) {
+			f.entries[mapId] = append(f.entries[mapId][:i], f.entries[mapId][i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("no such key")
+}
+
+func (f *fakeBackend) MapBtf(mapId int) (*utils.MapBtf, error) {
+	if m, ok := f.btf[mapId]; ok {
+		return m, nil
+	}
+	return nil, utils.ErrNotSupported
+}
+
+func (f *fakeBackend) Btf(btfId int) (*utils.Btf, error) {
+	for _, m := range f.btf {
+		return m.Btf, nil
+	}
+	return nil, utils.ErrNotSupported
+}
+
+func (f *fakeBackend) MapEvents(m utils.BpfMap, events chan<- utils.MapEvent, stop <-chan struct{}) error {
+	for _, e := range f.events {
+		select {
+		case events <- e:
+		case <-stop:
+			return nil
+		}
+	}
+	<-stop
+	return nil
+}
+
+func (f *fakeBackend) TraceLog(lines chan<- utils.TraceLine, stop <-chan struct{}) error {
+	for _, l := range f.trace {
+		select {
+		case lines <- l:
+		case <-stop:
+			return nil
+		}
+	}
+	<-stop
+	return nil
+}
+
+func (f *fakeBackend) ProgramDisassembly(progId int) ([]string, error) {
+	return []string{"0: (b7) r0 = 0", "1: (95) exit"}, nil
+}
+
+func (f *fakeBackend) ProgramJitedDisassembly(progId int) ([]string, error) {
+	return []string{"   0:\tendbr64", "   4:\txor\t%eax,%eax", "   6:\tret"}, nil
+}
+
+func (f *fakeBackend) NetInfo() ([]utils.NetInfo, error) {
+	return f.net, nil
+}
+
+func (f *fakeBackend) CgroupInfo() ([]utils.CgroupInfo, error) {
+	return f.cgroups, nil
+}
+
+func (f *fakeBackend) PerfInfo() ([]utils.PerfInfo, error) {
+	return f.perf, nil
+}
+
+func (f *fakeBackend) BtfObjects() ([]utils.BtfObject, error) {
+	return f.btfObjs, nil
+}
+
+func (f *fakeBackend) BtfC(btfId int) (string, error) {
+	c, ok := f.btfC[btfId]
+	if !ok {
+		return "", utils.ErrNotSupported
+	}
+	return c, nil
+}
+
+func (f *fakeBackend) Links() ([]utils.BpfLink, error) {
+	return f.links, nil
+}
+
+func (f *fakeBackend) Features() (string, error) {
+	return "", nil
+}
+
+func (f *fakeBackend) StatsEnabled() (bool, error) {
+	return false, nil
+}
+
+func (f *fakeBackend) SetStatsEnabled(enabled bool) error {
+	return errors.New("not implemented")
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		programs: []utils.BpfProgram{
+			{ProgramId: 1, ProgType: "kprobe", Tag: "aaaa", Name: "kprobe_prog"},
+			{ProgramId: 2, ProgType: "cgroup_skb", Tag: "bbbb", Name: "cgroup_prog"},
+			{ProgramId: 3, ProgType: "xdp", Tag: "cccc", Name: "xdp_prog"},
+			{ProgramId: 4, ProgType: "sched_cls", Tag: "dddd"},
+		},
+		net: []utils.NetInfo{
+			{
+				Xdp: []utils.XdpInfo{{DevName: "eth0", IfIndex: 2, Mode: "driver", Id: 3}},
+				Tc:  []utils.TcInfo{{DevName: "eth1", IfIndex: 3, Kind: "clsact/ingress", Name: "tc_prog", Id: 4}},
+			},
+		},
+		cgroups: []utils.CgroupInfo{
+			{
+				Cgroup:   "/sys/fs/cgroup/system.slice",
+				Programs: []utils.CgroupProgram{{Id: 2, AttachType: "ingress", AttachFlags: "multi"}},
+			},
+		},
+		perf: []utils.PerfInfo{
+			{Pid: 100, Fd: 5, ProgId: 1, FdType: "kprobe", Func: "do_sys_open", Offset: 0},
+		},
+		links: []utils.BpfLink{
+			{Id: 1, Type: "perf_event", ProgId: 1, EventType: "kprobe", Func: "do_sys_open"},
+			{Id: 2, Type: "tracing", ProgId: 5, AttachType: "trace_fentry", TargetBtfId: 100},
+		},
+	}
+}
+
+func TestUpdateBpfPrograms(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	updateBpfPrograms()
+
+	if len(Programs) != 4 {
+		t.Fatalf("Expected 4 programs, got %d", len(Programs))
+	}
+
+	kprobe := Programs[1]
+	if len(kprobe.AttachPoint) != 1 || kprobe.AttachPoint[0] != "do_sys_open" {
+		t.Errorf("Expected attach point do_sys_open, got %v", kprobe.AttachPoint)
+	}
+	if kprobe.Fd != 5 {
+		t.Errorf("Expected fd 5, got %d", kprobe.Fd)
+	}
+
+	cgroup := Programs[2]
+	if cgroup.Cgroup != "/sys/fs/cgroup/system.slice" || cgroup.CgroupAttachType != "ingress" || cgroup.CgroupAttachFlags != "multi" {
+		t.Errorf("Cgroup data was not applied, got %+v", cgroup)
+	}
+
+	if Programs[3].Interface != "eth0" {
+		t.Errorf("Expected xdp interface eth0, got %s", Programs[3].Interface)
+	}
+
+	tc := Programs[4]
+	if tc.Interface != "eth1" || tc.TcKind != "clsact/ingress" || tc.Name != "tc_prog" {
+		t.Errorf("Tc data was not applied, got %+v", tc)
+	}
+}
+
+func TestUpdateBpfProgramsEvents(t *testing.T) {
+	backend := newFakeBackend()
+	utils.SetBackend(backend)
+	tracker = utils.NewProgramTracker()
+	Events = nil
+
+	// The first refresh is the baseline
+	updateBpfPrograms()
+	if len(Events) != 0 {
+		t.Fatalf("Expected no events after the first refresh, got %+v", Events)
+	}
+
+	backend.programs = append(backend.programs[1:], utils.BpfProgram{ProgramId: 5, ProgType: "tracepoint", Tag: "eeee"})
+	updateBpfPrograms()
+	if len(Events) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", Events)
+	}
+	if Events[0].Type != utils.EventUnload || Events[0].ProgramId != 1 || Events[0].AttachPoint != "do_sys_open" {
+		t.Errorf("Expected an unload of program 1, got %+v", Events[0])
+	}
+	if Events[1].Type != utils.EventLoad || Events[1].ProgramId != 5 {
+		t.Errorf("Expected a load of program 5, got %+v", Events[1])
+	}
+}
+
+func TestUpdateBpfProgramsAlerts(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	var err error
+	Rules, err = rules.Parse([]byte(`
+rules:
+  - name: xdp
+    severity: medium
+    match:
+      prog_type: xdp
+  - name: eth0
+    severity: high
+    match:
+      interface: eth0
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	defer func() { Rules = nil }()
+	Alerts = nil
+
+	// Alerts are only raised once per program and rule
+	updateBpfPrograms()
+	updateBpfPrograms()
+	if len(Alerts) != 2 {
+		t.Fatalf("Expected 2 alerts, got %+v", Alerts)
+	}
+	for _, entry := range Alerts {
+		if entry.Alert.Program.ProgramId != 3 {
+			t.Errorf("Expected an alert for program 3, got %+v", entry.Alert)
+		}
+	}
+
+	list := tview.NewList()
+	populateList(list)
+	text, _ := list.GetItemText(2)
+	if !strings.HasSuffix(text, "<high: eth0>[-]") {
+		t.Errorf("Expected the most severe alert to be highlighted, got %s", text)
+	}
+}
+
+func TestUpdateBpfProgramsDrift(t *testing.T) {
+	backend := newFakeBackend()
+	utils.SetBackend(backend)
+	updateBpfPrograms()
+
+	// Everything but the xdp program is in the baseline
+	lock.Lock()
+	golden := map[int]utils.BpfProgram{}
+	for id, p := range Programs {
+		if id != 3 {
+			golden[id] = p
+		}
+	}
+	lock.Unlock()
+	baseline := utils.NewBaseline(golden, nil)
+	Baseline = &baseline
+	defer func() { Baseline = nil }()
+
+	updateBpfPrograms()
+	if len(Drift) != 1 || Drift[0].Kind != utils.DriftNew || programDrift[3] != utils.DriftNew {
+		t.Fatalf("Expected the xdp program to be new, got %+v", Drift)
+	}
+
+	list := tview.NewList()
+	populateList(list)
+	text, _ := list.GetItemText(2)
+	if !strings.HasSuffix(text, "<drift: new>[-]") {
+		t.Errorf("Expected the drift to be highlighted, got %s", text)
+	}
+}
+
+func TestDisassemblyModes(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	b := NewBpfExplorerView(&Tui{})
+	b.progId = 1
+
+	b.showDisassembly()
+	if text := b.disassembly.GetText(true); !strings.Contains(text, "(95) exit") || strings.Contains(text, "endbr64") {
+		t.Errorf("Expected only the xlated instructions, got %s", text)
+	}
+
+	b.disasmMode = DisasmJited
+	b.showDisassembly()
+	if text := b.disassembly.GetText(true); !strings.Contains(text, "endbr64") || strings.Contains(text, "exit") {
+		t.Errorf("Expected only the jited code, got %s", text)
+	}
+
+	b.disasmMode = DisasmSideBySide
+	b.showDisassembly()
+	lines := strings.Split(strings.TrimSpace(b.disassembly.GetText(true)), "\n")
+	if len(lines) != 3 || lines[1] != "1: (95) exit   |    4: xor %eax,%eax" {
+		t.Errorf("Expected the xlated instructions next to the jited code, got %q", lines)
+	}
+
+	b.disasmMode = DisasmCfg
+	b.showDisassembly()
+	lines = strings.Split(strings.TrimSpace(b.disassembly.GetText(true)), "\n")
+	if len(lines) != 3 || lines[0] != "block 0 (0-1)" || lines[2] != "1: (95) exit" {
+		t.Errorf("Expected a single basic block, got %q", lines)
+	}
+}
+
+func TestAddCfgLines(t *testing.T) {
+	cfg, err := utils.NewCfg([]string{
+		"0: (b7) r0 = 0",
+		"1: (07) r0 += 1",
+		"2: (a5) if r0 < 0xa goto pc-2",
+		"3: (95) exit",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := newDisasmText()
+	addCfgLines(text, cfg)
+	view := tview.NewTextView().SetDynamicColors(true).SetRegions(true).SetText(text.String())
+
+	expected := []string{
+		"block 0 (0-0)",
+		"0: (b7) r0 = 0",
+		"  -> block 1 (fallthrough)",
+		"",
+		"block 1 (1-2) from 0, 1",
+		"1: (07) r0 += 1",
+		"2: (a5) if r0 < 0xa goto pc-2",
+		"  -> block 1 (taken, back edge)",
+		"  -> block 2 (fallthrough)",
+		"",
+		"block 2 (3-3) from 1",
+		"3: (95) exit",
+		"",
+	}
+	if lines := strings.Split(view.GetText(true), "\n"); !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Unexpected lines\n%q\nexpected\n%q", lines, expected)
+	}
+
+	// The goto of the loop and the edges link to the instructions
+	targets := []int{}
+	for _, id := range text.linkIds {
+		targets = append(targets, text.links[id].target)
+	}
+	if !reflect.DeepEqual(targets, []int{1, 1, 1, 3}) {
+		t.Errorf("Unexpected link targets %v", targets)
+	}
+}
+
+func TestDisassemblyLinks(t *testing.T) {
+	b := NewBpfExplorerView(&Tui{})
+	text := newDisasmText()
+	for _, line := range []string{
+		"int prog(void * ctx):",
+		"; return lookup();",
+		"   0: (18) r1 = map[id:42]",
+		"   2: (85) call bpf_map_lookup_elem#1",
+		"   3: (15) if r0 == 0x0 goto pc+1",
+		"   4: (b7) r0 = 1",
+		"   5: (95) exit",
+	} {
+		text.addXlated(line)
+	}
+	b.text = text
+	b.disassembly.SetText(text.String())
+
+	lines := strings.Split(b.disassembly.GetText(true), "\n")
+	if lines[2] != "   0: (18) r1 = map[id:42]" {
+		t.Errorf("Expected the instruction without tags, got %q", lines[2])
+	}
+	if lines[3] != "   2: (85) call bpf_map_lookup_elem#1  ; "+utils.HelperSummary("bpf_map_lookup_elem") {
+		t.Errorf("Expected the call with the summary of the helper, got %q", lines[3])
+	}
+
+	if len(text.linkIds) != 2 || text.links[text.linkIds[0]] != (disasmLink{kind: linkMap, target: 42}) || text.links[text.linkIds[1]] != (disasmLink{kind: linkInsn, target: 5}) {
+		t.Fatalf("Unexpected links %v %v", text.linkIds, text.links)
+	}
+
+	// Following the branch highlights its target and going back highlights
+	// the branch again
+	b.selectLink(1)
+	b.selectLink(1)
+	b.followLink(text.linkIds[b.link])
+	if h := b.disassembly.GetHighlights(); len(h) != 1 || h[0] != "insn-5" {
+		t.Errorf("Expected the target of the branch to be highlighted, got %v", h)
+	}
+	b.goBack()
+	if h := b.disassembly.GetHighlights(); len(h) != 1 || h[0] != text.linkIds[1] {
+		t.Errorf("Expected the branch to be highlighted, got %v", h)
+	}
+
+	b.search.SetText("R0 = 1")
+	if len(b.matches) != 1 || b.matches[0] != "insn-4" {
+		t.Errorf("Expected a single match, got %v", b.matches)
+	}
+	if h := b.disassembly.GetHighlights(); len(h) != 1 || h[0] != "insn-4" {
+		t.Errorf("Expected the match to be highlighted, got %v", h)
+	}
+}
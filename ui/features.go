@@ -78,12 +78,12 @@ func (b *BpfFeatureView) buildFeatureView(tui *Tui) {
 		return event
 	})
 
-	// Run bpftool feature command and display the output (or stderr on failure)
-	stdout, stderr, err := utils.RunCmd("sudo", BpftoolPath, "feature", "probe")
+	// Probe the features and display the output (or the error on failure)
+	features, err := utils.GetBpfFeatures()
 	if err != nil {
-		flex.GetItem(1).(*tview.TextView).SetText(string(stderr))
+		flex.GetItem(1).(*tview.TextView).SetText(err.Error())
 	} else {
-		featureInfo = string(stdout)
+		featureInfo = features
 		flex.GetItem(1).(*tview.TextView).SetText(featureInfo)
 	}
 
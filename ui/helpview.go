@@ -16,6 +16,6 @@ func NewHelpView() *HelpView {
 func (h *HelpView) buildHelpView() {
 	modal := tview.NewModal()
 	modal.SetBorder(true).SetTitle("Help")
-	modal.SetText("F1: Help\nCtrl-e: Bpf program view\nCtrl-f: Bpf feature view\n'q'|'Q': Quit")
+	modal.SetText("F1: Help\nCtrl-e: Bpf program view\nCtrl-f: Bpf feature view\nCtrl-t: Bpf program cpu usage (top) view\nCtrl-l: Program load/unload timeline\nCtrl-r: Rule alerts\nCtrl-g: Drift from baseline\nCtrl-p: Trace pipe (bpf_printk output)\nCtrl-k: Tail call chains\nCtrl-n: Bpf links\nCtrl-b: Btf objects and types\n'q'|'Q': Quit")
 	h.modal = modal
 }
@@ -0,0 +1,113 @@
+// This page lists the bpf links on the system. Links are how fentry/fexit,
+// lsm, iterators, struct_ops, netfilter, tcx, kprobe_multi and uprobe_multi
+// programs are attached. Pressing ENTER on a link shows its program in the
+// explorer
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type LinksView struct {
+	table *tview.Table
+	app   *Tui
+
+	// The links in the order they are shown
+	links []utils.BpfLink
+}
+
+// Fill the table with the links. programs is used for the program names
+func (v *LinksView) render(links []utils.BpfLink, programs map[int]utils.BpfProgram) {
+	sort.Slice(links, func(i, j int) bool { return links[i].Id < links[j].Id })
+	v.links = links
+
+	v.table.Clear()
+	headers := []string{"Id", "Type", "Program", "Attach Point", "Owner"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+	if len(links) == 0 {
+		v.table.SetCell(1, 0, tview.NewTableCell("No links").SetSelectable(false))
+	}
+
+	for i, link := range links {
+		program := fmt.Sprintf("%d", link.ProgId)
+		if p, ok := programs[link.ProgId]; ok {
+			program = fmt.Sprintf("%d: %s %s", p.ProgramId, p.ProgType, p.Name)
+		}
+		owners := []string{}
+		for _, owner := range link.Pids {
+			owners = append(owners, fmt.Sprintf("%s(%d)", owner.Comm, owner.Pid))
+		}
+
+		cells := []string{
+			strconv.Itoa(link.Id),
+			link.Type,
+			program,
+			link.AttachPoint(),
+			strings.Join(owners, ", "),
+		}
+		for j, cell := range cells {
+			v.table.SetCell(i+1, j, tview.NewTableCell(tview.Escape(cell)))
+		}
+	}
+}
+
+// Get the links and rebuild the table
+func (v *LinksView) Update() {
+	lock.Lock()
+	programs := make(map[int]utils.BpfProgram, len(Programs))
+	for id, p := range Programs {
+		programs[id] = p
+	}
+	lock.Unlock()
+
+	links, err := utils.GetBpfLinks()
+	if err != nil {
+		v.app.DisplayError(fmt.Sprintf("Failed to get the links: %v", err))
+		return
+	}
+	v.render(links, programs)
+	v.table.Select(1, 0)
+}
+
+func (v *LinksView) buildTable() {
+	v.table = tview.NewTable()
+	v.table.SetBorder(true).SetTitle("Links (ENTER: show program, r: refresh)")
+	v.table.SetSelectable(true, false)
+	v.table.SetFixed(1, 0)
+	v.table.SetSelectedFunc(func(row int, column int) {
+		if row < 1 || row > len(v.links) {
+			return
+		}
+		id := v.links[row-1].ProgId
+		v.app.pages.SwitchToPage("programs")
+		v.app.App.SetFocus(v.app.bpfExplorerView.programList)
+		if !v.app.bpfExplorerView.ShowProgram(id) {
+			v.app.DisplayError(fmt.Sprintf("Program %d is no longer loaded", id))
+		}
+	})
+	v.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'r' {
+			v.Update()
+			return nil
+		}
+		return event
+	})
+	v.render(nil, nil)
+}
+
+func NewLinksView(t *Tui) *LinksView {
+	v := &LinksView{app: t}
+	v.buildTable()
+	return v
+}
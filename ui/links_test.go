@@ -0,0 +1,28 @@
+package ui
+
+import (
+	"ebpfmon/utils"
+	"testing"
+)
+
+func TestLinksView(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	lock.Lock()
+	Programs = map[int]utils.BpfProgram{1: {ProgramId: 1, ProgType: "kprobe", Name: "kprobe_prog"}}
+	lock.Unlock()
+	v := NewLinksView(&Tui{})
+	v.Update()
+
+	if v.table.GetRowCount() != 3 {
+		t.Fatalf("Expected a header and 2 links, got %d rows", v.table.GetRowCount())
+	}
+	if text := v.table.GetCell(1, 2).Text; text != "1: kprobe kprobe_prog" {
+		t.Errorf("Expected the program of the link, got %s", text)
+	}
+	if text := v.table.GetCell(2, 2).Text; text != "5" {
+		t.Errorf("Expected the id of the unknown program, got %s", text)
+	}
+	if text := v.table.GetCell(2, 3).Text; text != "trace_fentry (btf 0 type 100)" {
+		t.Errorf("Unexpected attach point %s", text)
+	}
+}
@@ -5,10 +5,11 @@ package ui
 
 import (
 	"ebpfmon/utils"
-	"encoding/binary"
 	"fmt"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
@@ -16,21 +17,22 @@ import (
 )
 
 const (
-	Hex     = 0
-	Decimal = 1
-	Char    = 2
-	Raw     = 3
+	Hex     = utils.FormatHex
+	Decimal = utils.FormatDecimal
+	Char    = utils.FormatChar
+	Raw     = utils.FormatRaw
+	Btf     = utils.FormatBtf
 )
 
 const (
-	DataWidth8  = 1
-	DataWidth16 = 2
-	DataWidth32 = 4
-	DataWidth64 = 8
+	DataWidth8  = utils.DataWidth8
+	DataWidth16 = utils.DataWidth16
+	DataWidth32 = utils.DataWidth32
+	DataWidth64 = utils.DataWidth64
 )
 const (
-	Little = 0
-	Big    = 1
+	Little = utils.EndianLittle
+	Big    = utils.EndianBig
 )
 
 var curFormat = Hex
@@ -43,221 +45,348 @@ type BpfMapTableView struct {
 	filter     *tview.Form
 	table      *tview.Table
 	confirm    *tview.Modal
+	tree       *tview.TreeView
+	btfForm    *tview.Form
+	exportForm *tview.Form
+	importForm *tview.Form
+	preview    *tview.TextView
 	app        *Tui
 	Map        utils.BpfMap
 	MapEntries []utils.BpfMapEntry
+
+	// The btf of the current map. Only loaded when an entry is edited
+	btf      *utils.MapBtf
+	btfMapId int
+
+	// The changes of the import that is being previewed
+	importPlan utils.MapImportPlan
+
+	// Set while the map is being watched. Closing watchStop stops the watch
+	watcher   *utils.MapWatcher
+	watched   []utils.WatchedEntry
+	watchStop chan struct{}
+
+	// The entry the edit form or the delete confirmation was opened for. A
+	// watch can redraw the table while they are shown so the selected row may
+	// point to another entry by the time they are used
+	pendingEntry utils.BpfMapEntry
+
+	// The outer maps the current map was opened from when it is the inner map
+	// of a map of maps. ESC goes back to the last one
+	breadcrumbs []mapBreadcrumb
+
+	// The inner maps of a map of maps keyed by id
+	innerMaps map[int]utils.BpfMap
 }
 
-func asDecimal(width int, endian int, data []byte) string {
-	var result string = ""
-	switch width {
-	case DataWidth8:
-		for _, b := range data {
-			result += strconv.Itoa(int(b)) + " "
-		}
-		break
-	case DataWidth16:
-		if len(data)%DataWidth16 != 0 {
-			return ""
-		}
+// An outer map along with the row of the inner map that was opened
+type mapBreadcrumb struct {
+	Map utils.BpfMap
+	Row int
+}
 
-		if endian == Little {
-			for i := 0; i < len(data); i += 2 {
-				result += strconv.Itoa(int(binary.LittleEndian.Uint16(data[i:i+2]))) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 2 {
-				result += strconv.Itoa(int(binary.BigEndian.Uint16(data[i:i+2]))) + " "
-			}
-		}
-		break
-	case DataWidth32:
-		if len(data)%DataWidth32 != 0 {
-			return ""
-		}
-		if endian == Little {
-			for i := 0; i < len(data); i += 4 {
-				result += strconv.Itoa(int(binary.LittleEndian.Uint32(data[i:i+4]))) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 4 {
-				result += strconv.Itoa(int(binary.BigEndian.Uint32(data[i:i+4]))) + " "
-			}
-		}
-		break
-	case DataWidth64:
-		if len(data)%DataWidth64 != 0 {
-			return ""
-		}
+// How often a watched map is dumped
+const mapWatchInterval = time.Second
 
-		if endian == Little {
-			for i := 0; i < len(data); i += 8 {
-				result += strconv.Itoa(int(binary.LittleEndian.Uint64(data[i:i+8]))) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 8 {
-				result += strconv.Itoa(int(binary.BigEndian.Uint64(data[i:i+8]))) + " "
-			}
-		}
-		break
-	}
-	result = strings.Trim(result, " ")
-	return result
+// The colors of the entries of a watched map
+var watchColors = map[int]tcell.Color{
+	utils.EntryNew:     tcell.ColorGreen,
+	utils.EntryChanged: tcell.ColorYellow,
+	utils.EntryRemoved: tcell.ColorRed,
 }
 
-// Similar to the asDecimal function except it displays the data as hex
-func asHex(width int, endian int, data []byte) string {
-	var result string = ""
-	switch width {
-	case DataWidth8:
-		for _, b := range data {
-			result += fmt.Sprintf("%#02x", b) + " "
-		}
-		break
-	case DataWidth16:
-		if len(data)%DataWidth16 != 0 {
-			return ""
-		}
+// Adds padding to the bytes based on endianness
+func padBytes(data []byte, width int) []byte {
+	return utils.PadBytes(data, width)
+}
 
-		if endian == Little {
-			for i := 0; i < len(data); i += 2 {
-				result += fmt.Sprintf("%#04x", binary.LittleEndian.Uint16(data[i:i+2])) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 2 {
-				result += fmt.Sprintf("%#04x", binary.BigEndian.Uint16(data[i:i+2])) + " "
-			}
-		}
-		break
-	case DataWidth32:
-		if len(data)%DataWidth32 != 0 {
-			return ""
-		}
-		if endian == Little {
-			for i := 0; i < len(data); i += 4 {
-				result += fmt.Sprintf("%#08x", binary.LittleEndian.Uint32(data[i:i+4])) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 4 {
-				result += fmt.Sprintf("%#08x", binary.BigEndian.Uint32(data[i:i+4])) + " "
-			}
-		}
-		break
-	case DataWidth64:
-		if len(data)%DataWidth64 != 0 {
-			return ""
-		}
+// Apply a format based on the specified format, width, endianness
+func applyFormat(format int, width int, endianness int, data []byte) string {
+	return utils.FormatBytes(format, width, endianness, data)
+}
 
-		if endian == Little {
-			for i := 0; i < len(data); i += 8 {
-				result += fmt.Sprintf("%#016x", binary.LittleEndian.Uint64(data[i:i+8])) + " "
-			}
-		} else {
-			for i := 0; i < len(data); i += 8 {
-				result += fmt.Sprintf("%#016x", binary.BigEndian.Uint64(data[i:i+8])) + " "
-			}
-		}
-		break
+// Get the format that is currently selected in the map view
+func CurrentEntryFormat() utils.EntryFormat {
+	return utils.EntryFormat{Format: curFormat, Width: curWidth, Endianness: curEndianness}
+}
+
+// Format the key and value of an entry with the current format. The btf format
+// falls back to hex for entries that bpftool couldn't format
+func formatEntry(entry utils.BpfMapEntry) (string, string) {
+	keyText, valueText := CurrentEntryFormat().FormatEntry(entry)
+	if curFormat == Btf {
+		return tview.Escape(keyText), tview.Escape(valueText)
 	}
-	result = strings.Trim(result, " ")
+	return keyText, valueText
+}
 
-	return result
+// Get a short name for a map i.e. inner_map (12)
+func mapLabel(m utils.BpfMap) string {
+	if m.Name == "" {
+		return fmt.Sprintf("map %d", m.Id)
+	}
+	return fmt.Sprintf("%s (%d)", m.Name, m.Id)
 }
 
-func asChar(data []byte) string {
-	var result string = ""
-	for _, b := range data {
-		if b >= 32 && b <= 126 {
-			result += fmt.Sprintf("%c", b)
-		} else {
-			result += "."
+// Get the title of the table. The outer maps are shown as breadcrumbs when
+// the map is the inner map of a map of maps. status is appended if it is set
+func (b *BpfMapTableView) title(status string) string {
+	title := "Map Info"
+	if len(b.breadcrumbs) > 0 {
+		labels := []string{}
+		for _, crumb := range b.breadcrumbs {
+			labels = append(labels, mapLabel(crumb.Map))
 		}
+		labels = append(labels, mapLabel(b.Map))
+		title += ": " + tview.Escape(strings.Join(labels, " > ")) + " (ESC to go back)"
 	}
-	return result
+	if status != "" {
+		title += " (" + status + ")"
+	}
+	return title
 }
 
-// Doesn't change the default formatting of the data
-func asRaw(data []byte) string {
-	return fmt.Sprintf("%v", data)
+// Describe the inner map an entry of a map of maps points to
+func (b *BpfMapTableView) innerMapText(entry utils.BpfMapEntry) string {
+	id, ok := utils.InnerMapId(entry)
+	if !ok {
+		return applyFormat(Hex, DataWidth8, Little, entry.Value)
+	}
+	inner, ok := b.innerMaps[id]
+	if !ok {
+		return fmt.Sprintf("%d (not found)", id)
+	}
+	return tview.Escape(fmt.Sprintf("%d: %s %s", id, inner.Type, inner.Name))
 }
 
-// Adds some null bytes to the beggining of a slice
-func padBytesBeginning(data []byte, width int) []byte {
-	if len(data)%width == 0 {
-		return data
+// Describe the program in a slot of a prog array
+func progArrayText(entry utils.BpfMapEntry) string {
+	id, ok := utils.TailCallTarget(entry)
+	if !ok {
+		return applyFormat(Hex, DataWidth8, Little, entry.Value)
 	}
-
-	var bytesNeeded int = width - (len(data) % width)
-
-	var result []byte
-	for i := 0; i < bytesNeeded; i++ {
-		result = append(result, 0)
+	lock.Lock()
+	p, ok := Programs[id]
+	lock.Unlock()
+	if !ok {
+		return fmt.Sprintf("%d (not loaded)", id)
 	}
-	result = append(result, data...)
-	return result
+	return tview.Escape(fmt.Sprintf("%d: %s %s", id, p.ProgType, p.Name))
 }
 
-// Add some null bytes to the end of a slice
-func padBytesEnd(data []byte, width int) []byte {
-	if len(data)%width == 0 {
-		return data
+// Get the text of the value columns of an entry. Maps of maps and prog arrays
+// show the inner map or program instead of its id as bytes
+func (b *BpfMapTableView) valueCells(entry utils.BpfMapEntry) []string {
+	if utils.IsMapOfMaps(b.Map.Type) {
+		return []string{b.innerMapText(entry)}
 	}
+	if b.Map.Type == "prog_array" {
+		return []string{progArrayText(entry)}
+	}
+	return valueCells(entry)
+}
 
-	var bytesNeeded int = width - (len(data) % width)
-
-	var result []byte
-	for i := 0; i < bytesNeeded; i++ {
-		result = append(result, 0)
+// Show the program in a slot of a prog array in the explorer
+func (b *BpfMapTableView) openProgram(index int) {
+	id, ok := utils.TailCallTarget(b.MapEntries[index])
+	if !ok {
+		return
+	}
+	b.app.pages.SwitchToPage("programs")
+	b.app.App.SetFocus(b.app.bpfExplorerView.programList)
+	if !b.app.bpfExplorerView.ShowProgram(id) {
+		b.app.DisplayError(fmt.Sprintf("Program %d is no longer loaded", id))
 	}
-	result = append(data, result...)
-	return result
 }
 
-// Adds padding to the bytes based on endianness
-func padBytes(data []byte, width int) []byte {
-	if len(data)%width == 0 {
-		return data
+// Look up the inner maps of a map of maps. Inner maps can be replaced at any
+// time so the ones that no longer exist are simply left out
+func (b *BpfMapTableView) loadInnerMaps() {
+	b.innerMaps = nil
+	if !utils.IsMapOfMaps(b.Map.Type) || len(b.MapEntries) == 0 {
+		return
 	}
 
-	return padBytesEnd(data, width)
+	ids := []int{}
+	for _, e := range b.MapEntries {
+		if id, ok := utils.InnerMapId(e); ok {
+			ids = append(ids, id)
+		}
+	}
+	maps, _ := utils.GetBpfMapInfoByIds(ids)
+	b.innerMaps = map[int]utils.BpfMap{}
+	for _, m := range maps {
+		b.innerMaps[m.Id] = m
+	}
 }
 
-// Apply a format based on the specified format, width, endianness
-func applyFormat(format int, width int, endianness int, data []byte) string {
-	if len(data) == 0 {
-		return ""
+// Open the inner map of an entry of a map of maps. The current map is added to
+// the breadcrumbs so ESC can go back to it
+func (b *BpfMapTableView) openInnerMap(index int) {
+	id, ok := utils.InnerMapId(b.MapEntries[index])
+	if !ok {
+		return
+	}
+	maps, err := utils.GetBpfMapInfoByIds([]int{id})
+	if err != nil {
+		b.app.DisplayError(fmt.Sprintf("Failed to get inner map %d: %v", id, err))
+		return
 	}
 
-	data = padBytes(data, width)
+	b.breadcrumbs = append(b.breadcrumbs, mapBreadcrumb{Map: b.Map, Row: index + 1})
+	err = b.UpdateMap(maps[0])
+	if err != nil {
+		b.breadcrumbs = b.breadcrumbs[:len(b.breadcrumbs)-1]
+		return
+	}
+	b.table.Select(1, 0)
+}
 
-	switch format {
-	case Hex:
-		return asHex(width, endianness, data)
-	case Decimal:
-		return asDecimal(width, endianness, data)
-	case Char:
-		return asChar(data)
-	default:
-		return asRaw(data)
+// Go back to the outer map. Returns false if there is none
+func (b *BpfMapTableView) closeInnerMap() bool {
+	if len(b.breadcrumbs) == 0 {
+		return false
 	}
+	crumb := b.breadcrumbs[len(b.breadcrumbs)-1]
+	b.breadcrumbs = b.breadcrumbs[:len(b.breadcrumbs)-1]
+	b.UpdateMap(crumb.Map)
+	b.table.Select(crumb.Row, 0)
+	return true
 }
 
 // Update the table view with the new map entries
 func (b *BpfMapTableView) updateTable() {
 	b.table.Clear()
-	b.table.SetCell(0, 0, tview.NewTableCell("Index").SetSelectable(false))
-	b.table.SetCell(0, 1, tview.NewTableCell("Key").SetSelectable(false))
-	b.table.SetCell(0, 2, tview.NewTableCell("Value").SetSelectable(false))
+	headers := append([]string{"Index", "Key"}, valueHeaders(b.MapEntries)...)
+	if utils.IsMapOfMaps(b.Map.Type) {
+		headers = []string{"Index", "Key", "Inner Map"}
+	} else if b.Map.Type == "prog_array" {
+		headers = []string{"Index", "Key", "Program"}
+	}
+	if b.watcher != nil {
+		headers = append(headers, "Changes")
+	}
+	for column, header := range headers {
+		b.table.SetCell(0, column, tview.NewTableCell(header).SetSelectable(false))
+	}
+	if b.watcher != nil {
+		b.updateWatchedTable()
+		return
+	}
 	for i, entry := range b.MapEntries {
-		b.table.SetCell(i+1, 0, tview.NewTableCell(strconv.Itoa(i)))
-		b.table.SetCell(i+1, 1, tview.NewTableCell(applyFormat(curFormat, curWidth, curEndianness, entry.Key)))
-		b.table.SetCell(i+1, 2, tview.NewTableCell(applyFormat(curFormat, curWidth, curEndianness, entry.Value)))
+		keyText, _ := formatEntry(entry)
+		cells := append([]string{strconv.Itoa(i), keyText}, b.valueCells(entry)...)
+		for column, text := range cells {
+			b.table.SetCell(i+1, column, tview.NewTableCell(text))
+		}
+	}
+}
+
+// Show the entries of a watched map colored by what changed in the last dump
+// along with how often each one changed. Removed entries are shown at the end
+// and can't be selected
+func (b *BpfMapTableView) updateWatchedTable() {
+	for i, watched := range b.watched {
+		keyText, _ := formatEntry(watched.Entry)
+		cells := append([]string{strconv.Itoa(i), keyText}, b.valueCells(watched.Entry)...)
+		cells = append(cells, strconv.Itoa(watched.Changes))
+		if watched.Status == utils.EntryRemoved {
+			cells[0] = "-"
+		}
+		for column, text := range cells {
+			cell := tview.NewTableCell(text).SetSelectable(watched.Status != utils.EntryRemoved)
+			if color, ok := watchColors[watched.Status]; ok {
+				cell.SetTextColor(color)
+			}
+			b.table.SetCell(i+1, column, cell)
+		}
+	}
+}
+
+// Start or stop refreshing the entries of the map every mapWatchInterval
+func (b *BpfMapTableView) toggleWatch() {
+	if b.watchStop != nil {
+		b.stopWatch()
+		b.updateTable()
+		return
+	}
+
+	b.watcher = utils.NewMapWatcher()
+	b.watched = b.watcher.Update(b.MapEntries, time.Now())
+	b.watchStop = make(chan struct{})
+	b.table.SetTitle(b.title(fmt.Sprintf("watching every %v, press w to stop", mapWatchInterval)))
+	b.updateTable()
+	go b.watch(b.Map.Id, b.watchStop)
+}
+
+func (b *BpfMapTableView) stopWatch() {
+	if b.watchStop == nil {
+		return
+	}
+	close(b.watchStop)
+	b.watchStop = nil
+	b.watcher = nil
+	b.watched = nil
+	b.table.SetTitle(b.title(""))
+}
+
+// Stop watching the map when its page is left. The table is redrawn without
+// the colors of the watch
+func (b *BpfMapTableView) leave() {
+	if b.watchStop == nil {
+		return
+	}
+	b.stopWatch()
+	b.updateTable()
+}
+
+func (b *BpfMapTableView) watch(mapId int, stop chan struct{}) {
+	ticker := time.NewTicker(mapWatchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		entries, err := utils.GetBpfMapEntries(mapId)
+		b.app.App.QueueUpdateDraw(func() {
+			// The watch may have been stopped while the map was dumped
+			if b.watchStop != stop {
+				return
+			}
+			if err != nil {
+				b.table.SetTitle(b.title(fmt.Sprintf("failed to dump the map: %v", err)))
+				return
+			}
+			b.applyWatchedEntries(entries, time.Now())
+		})
 	}
 }
 
+// Compare a new dump with the previous one and redraw the table
+func (b *BpfMapTableView) applyWatchedEntries(entries []utils.BpfMapEntry, now time.Time) {
+	b.MapEntries = entries
+	b.watched = b.watcher.Update(entries, now)
+	b.loadInnerMaps()
+	b.table.SetTitle(b.title(fmt.Sprintf("watching every %v, press w to stop, last update %s", mapWatchInterval, now.Format("15:04:05"))))
+	b.updateTable()
+}
+
+// Open a map from the map list. Any breadcrumbs of a previous map of maps are
+// dropped
+func (b *BpfMapTableView) OpenMap(m utils.BpfMap) error {
+	b.breadcrumbs = nil
+	return b.UpdateMap(m)
+}
+
 // Update Map
 func (b *BpfMapTableView) UpdateMap(m utils.BpfMap) error {
 	var err error
+	if m.Id != b.Map.Id {
+		b.stopWatch()
+	}
 	b.Map = m
 
 	entries, err := utils.GetBpfMapEntries(b.Map.Id)
@@ -265,8 +394,14 @@ func (b *BpfMapTableView) UpdateMap(m utils.BpfMap) error {
 		b.app.DisplayError(fmt.Sprintf("Error getting map entries for map %d: %v\n", b.Map.Id, err))
 		return err
 	}
+	if b.watcher != nil {
+		b.applyWatchedEntries(entries, time.Now())
+		return nil
+	}
 	b.MapEntries = entries
+	b.loadInnerMaps()
 
+	b.table.SetTitle(b.title(""))
 	b.updateTable()
 	return nil
 }
@@ -280,20 +415,59 @@ func (b *BpfMapTableView) buildMapTableView() {
 		// If the user presses the esc key they should go back to the main view
 		if event.Key() == tcell.KeyEsc {
 			// app.SetFocus("main")
+			b.closeInnerMap()
 			return nil
 		} else if event.Rune() == 'd' {
-			b.pages.SwitchToPage("confirm")
+			row, _ := b.table.GetSelection()
+			if row > 0 && row <= len(b.MapEntries) {
+				b.pendingEntry = b.MapEntries[row-1]
+				b.pages.SwitchToPage("confirm")
+			}
+			return nil
+		} else if event.Rune() == 'x' {
+			_, fileType := b.exportForm.GetFormItemByLabel("Type").(*tview.DropDown).GetCurrentOption()
+			path := b.exportForm.GetFormItemByLabel("File").(*tview.InputField)
+			path.SetText(fmt.Sprintf("map_%d.%s", b.Map.Id, fileType))
+			b.exportForm.SetFocus(0)
+			b.pages.SwitchToPage("export")
+			return nil
+		} else if event.Rune() == 'i' {
+			b.importForm.SetFocus(0)
+			b.pages.SwitchToPage("import")
+			return nil
+		} else if event.Rune() == 'w' {
+			b.toggleWatch()
+			return nil
+		} else if event.Rune() == 't' {
+			row, _ := b.table.GetSelection()
+			if row > 0 && row <= len(b.MapEntries) {
+				b.showTree(b.MapEntries[row-1])
+			}
 			return nil
 		}
 		return event
 	})
 	b.table.SetSelectedFunc(func(row int, column int) {
-		if len(b.MapEntries) <= 0 {
+		if row <= 0 || row > len(b.MapEntries) {
+			return
+		}
+
+		if utils.IsMapOfMaps(b.Map.Type) {
+			b.openInnerMap(row - 1)
+			return
+		}
+		if b.Map.Type == "prog_array" {
+			b.openProgram(row - 1)
 			return
 		}
 
-		key := b.MapEntries[row-1].Key
-		value := b.MapEntries[row-1].Value
+		if b.showBtfForm(row - 1) {
+			return
+		}
+
+		b.pendingEntry = b.MapEntries[row-1]
+		key := b.pendingEntry.Key
+		value := b.pendingEntry.Value
 
 		keyPtr, ok := b.form.GetFormItemByLabel("Key").(*tview.InputField)
 		if ok {
@@ -303,16 +477,13 @@ func (b *BpfMapTableView) buildMapTableView() {
 		if ok {
 			valuePtr.SetText(fmt.Sprintf("%v", value))
 		}
+		b.setCpuOptions(b.pendingEntry)
 
 		b.form.SetFocus(0)
 		b.pages.SwitchToPage("form")
 	})
 }
 
-func cellTextToHexString(cellValue string) string {
-	return strings.Trim(cellValue, "[]")
-}
-
 func cellTextToByteSlice(cellValue string) []byte {
 	trimmed := strings.Trim(cellValue, "[]")
 	split := strings.Split(trimmed, " ")
@@ -328,16 +499,36 @@ func cellTextToByteSlice(cellValue string) []byte {
 	return result
 }
 
+// Add a dropdown to the edit form to pick which cpu of a per cpu entry is
+// edited. The value input shows the value of the selected cpu. Selecting all
+// sets every cpu to the same value
+func (b *BpfMapTableView) setCpuOptions(entry utils.BpfMapEntry) {
+	index := b.form.GetFormItemIndex("CPU")
+	if index >= 0 {
+		b.form.RemoveFormItem(index)
+	}
+	if len(entry.Values) == 0 {
+		return
+	}
+
+	options := []string{"All"}
+	for cpu := range entry.Values {
+		options = append(options, strconv.Itoa(cpu))
+	}
+	b.form.AddDropDown("CPU", options, 0, func(option string, optionIndex int) {
+		valuePtr, ok := b.form.GetFormItemByLabel("Value").(*tview.InputField)
+		if ok && optionIndex > 0 {
+			valuePtr.SetText(fmt.Sprintf("%v", entry.Values[optionIndex-1]))
+		}
+	})
+}
+
 func (b *BpfMapTableView) buildMapTableEditForm() {
 	var keyText string = ""
 	var valueText string = ""
 	b.form.AddInputField("Key", "", 0, nil, nil).
 		AddInputField("Value", "", 0, nil, nil).
 		AddButton("Save", func() {
-			if len(b.MapEntries) <= 0 {
-				return
-			}
-
 			// Get the new text value that the use input or the old one if they didn't change it
 			keyPtr, ok := b.form.GetFormItemByLabel("Key").(*tview.InputField)
 			if ok {
@@ -348,20 +539,37 @@ func (b *BpfMapTableView) buildMapTableEditForm() {
 				valueText = valuePtr.GetText()
 			}
 
-			cmd := strings.Split("sudo "+utils.BpftoolPath+" map update id "+strconv.Itoa(b.Map.Id)+" key "+cellTextToHexString(keyText)+" value "+cellTextToHexString(valueText), " ")
-			_, _, err := utils.RunCmd(cmd...)
+			key := cellTextToByteSlice(keyText)
+			value := cellTextToByteSlice(valueText)
+			if len(key) == 0 || len(value) == 0 {
+				b.app.DisplayError(fmt.Sprintf("Failed to parse map entry. Expected a list of bytes like [1 0 0 0]\nKey: %s\nValue: %s", keyText, valueText))
+				return
+			}
+
+			// Per cpu maps can have a single cpu selected. Every other cpu
+			// keeps its current value
+			var err error
+			cpu := -1
+			if cpuPtr, ok := b.form.GetFormItemByLabel("CPU").(*tview.DropDown); ok {
+				cpu, _ = cpuPtr.GetCurrentOption()
+				cpu--
+			}
+			if cpu >= 0 && cpu < len(b.pendingEntry.Values) {
+				values := append([][]byte{}, b.pendingEntry.Values...)
+				values[cpu] = value
+				err = utils.UpdateBpfMapEntryValues(b.Map.Id, key, values)
+			} else {
+				err = utils.UpdateBpfMapEntry(b.Map.Id, key, value)
+			}
 			if err != nil {
 				if b.Map.Frozen == 1 {
 					b.app.DisplayError("Failed to update map entry because the map is frozen")
 				} else {
-					b.app.DisplayError(fmt.Sprintf("Failed to update map entry: %v\nAttempted cmd: %s", err, cmd))
+					b.app.DisplayError(fmt.Sprintf("Failed to update map entry: %v", err))
 				}
 			}
 
 			// Update the map entries
-			row, _ := b.table.GetSelection()
-			b.MapEntries[row-1].Key = []byte(cellTextToByteSlice(keyText))
-			b.MapEntries[row-1].Value = []byte(cellTextToByteSlice(valueText))
 			b.UpdateMap(b.Map)
 			b.pages.SwitchToPage("table")
 		}).
@@ -370,21 +578,262 @@ func (b *BpfMapTableView) buildMapTableEditForm() {
 		})
 }
 
+// Get the key and value fields of the current map. The key fields are nil if
+// the key can't be edited field by field (i.e. it has no btf type)
+func (b *BpfMapTableView) btfFields() ([]utils.BtfField, []utils.BtfField, error) {
+	if b.btf == nil || b.btfMapId != b.Map.Id {
+		m, err := utils.GetBpfMapBtf(b.Map.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.btf = m
+		b.btfMapId = b.Map.Id
+	}
+
+	valueFields, err := b.btf.Btf.Fields(b.btf.ValueTypeId, "value")
+	if err != nil {
+		return nil, nil, err
+	}
+	keyFields, err := b.btf.Btf.Fields(b.btf.KeyTypeId, "key")
+	if err != nil {
+		keyFields = nil
+	}
+	return keyFields, valueFields, nil
+}
+
+// Show a form with an input for every field of the key and value of an entry.
+// Returns false if the map has no usable btf in which case the raw byte form
+// should be used instead
+func (b *BpfMapTableView) showBtfForm(index int) bool {
+	// Per cpu entries use the byte editor so a single cpu can be edited
+	if b.Map.BtfId == 0 || len(b.MapEntries[index].Values) > 0 {
+		return false
+	}
+	keyFields, valueFields, err := b.btfFields()
+	if err != nil {
+		log.Debugf("Falling back to the byte editor for map %d: %v\n", b.Map.Id, err)
+		return false
+	}
+
+	entry := b.MapEntries[index]
+	fields := append(keyFields, valueFields...)
+	b.btfForm.Clear(true)
+	texts := make([]string, len(fields))
+	for i, f := range fields {
+		data := entry.Value
+		if i < len(keyFields) {
+			data = entry.Key
+		}
+		text, err := f.Decode(data)
+		if err != nil {
+			log.Debugf("Falling back to the byte editor for map %d: %v\n", b.Map.Id, err)
+			return false
+		}
+		texts[i] = text
+		b.btfForm.AddInputField(fmt.Sprintf("%s (%s)", f.Path, f.CType), text, 0, nil, nil)
+	}
+
+	b.btfForm.AddButton("Save", func() {
+		key := append([]byte{}, entry.Key...)
+		value := append([]byte{}, entry.Value...)
+		for i, f := range fields {
+			// Fields that weren't touched keep their bytes as they are
+			input, ok := b.btfForm.GetFormItem(i).(*tview.InputField)
+			if !ok || input.GetText() == texts[i] {
+				continue
+			}
+			data := value
+			if i < len(keyFields) {
+				data = key
+			}
+			err := f.Encode(data, input.GetText())
+			if err != nil {
+				b.app.DisplayError(fmt.Sprintf("Invalid value: %v", err))
+				return
+			}
+		}
+
+		err := utils.UpdateBpfMapEntry(b.Map.Id, key, value)
+		if err != nil {
+			if b.Map.Frozen == 1 {
+				b.app.DisplayError("Failed to update map entry because the map is frozen")
+			} else {
+				b.app.DisplayError(fmt.Sprintf("Failed to update map entry: %v", err))
+			}
+			return
+		}
+		b.UpdateMap(b.Map)
+		b.pages.SwitchToPage("table")
+	}).
+		AddButton("Cancel", func() {
+			b.pages.SwitchToPage("table")
+		})
+
+	b.btfForm.SetFocus(0)
+	b.pages.SwitchToPage("btfform")
+	return true
+}
+
+func (b *BpfMapTableView) buildExportForm() {
+	b.exportForm = tview.NewForm().AddInputField("File", "", 0, nil, nil)
+	path := b.exportForm.GetFormItemByLabel("File").(*tview.InputField)
+	b.exportForm.AddDropDown("Type", []string{"json", "csv"}, 0, func(option string, optionIndex int) {
+		name := strings.TrimSuffix(strings.TrimSuffix(path.GetText(), ".json"), ".csv")
+		if name != "" {
+			path.SetText(name + "." + option)
+		}
+	})
+	b.exportForm.AddButton("Export", func() {
+		_, fileType := b.exportForm.GetFormItemByLabel("Type").(*tview.DropDown).GetCurrentOption()
+		err := b.exportEntries(path.GetText(), fileType)
+		if err != nil {
+			b.app.DisplayError(fmt.Sprintf("Failed to export map %d: %v", b.Map.Id, err))
+			return
+		}
+		b.pages.SwitchToPage("table")
+	}).
+		AddButton("Cancel", func() {
+			b.pages.SwitchToPage("table")
+		})
+	b.exportForm.SetBorder(true).SetTitle("Export map entries")
+}
+
+// Write the entries of the map to a file with the current format
+func (b *BpfMapTableView) exportEntries(path string, fileType string) error {
+	format := CurrentEntryFormat()
+	err := format.CheckImportable()
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = utils.WriteMapEntries(f, fileType, b.Map, b.MapEntries, format)
+	if err != nil {
+		return err
+	}
+	b.table.SetTitle(b.title(fmt.Sprintf("exported %d entries to %s", len(b.MapEntries), tview.Escape(path))))
+	return nil
+}
+
+// Load the entries of a file and work out what importing them would change
+func (b *BpfMapTableView) planImport(path string) (utils.MapImportPlan, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return utils.MapImportPlan{}, err
+	}
+	defer f.Close()
+
+	imported, err := utils.ReadMapEntries(f, utils.MapFileType(path), b.Map, CurrentEntryFormat())
+	if err != nil {
+		return utils.MapImportPlan{}, err
+	}
+	current, err := utils.GetBpfMapEntries(b.Map.Id)
+	if err != nil {
+		return utils.MapImportPlan{}, err
+	}
+	return utils.PlanMapImport(b.Map, current, imported), nil
+}
+
+// Describe the changes of an import with one line for each entry
+func importPreviewText(plan utils.MapImportPlan, f utils.EntryFormat) string {
+	if plan.Empty() {
+		return "The map already matches the file. There is nothing to import"
+	}
+
+	lines := []string{plan.String(), ""}
+	for _, e := range plan.Add {
+		key, _ := f.FormatEntry(e)
+		key, value := tview.Escape(key), tview.Escape(f.FormatValue(e))
+		lines = append(lines, fmt.Sprintf("[green]+ %s: %s[-]", key, value))
+	}
+	for i, e := range plan.Change {
+		key, _ := f.FormatEntry(e)
+		key, value, previous := tview.Escape(key), tview.Escape(f.FormatValue(e)), tview.Escape(f.FormatValue(plan.Previous[i]))
+		lines = append(lines, fmt.Sprintf("[yellow]~ %s: %s -> %s[-]", key, previous, value))
+	}
+	for _, e := range plan.Delete {
+		key, _ := f.FormatEntry(e)
+		key, value := tview.Escape(key), tview.Escape(f.FormatValue(e))
+		lines = append(lines, fmt.Sprintf("[red]- %s: %s[-]", key, value))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *BpfMapTableView) buildImportForm() {
+	b.importForm = tview.NewForm().
+		AddInputField("File", "", 0, nil, nil).
+		AddButton("Preview", func() {
+			path := b.importForm.GetFormItemByLabel("File").(*tview.InputField).GetText()
+			plan, err := b.planImport(path)
+			if err != nil {
+				b.app.DisplayError(fmt.Sprintf("Failed to import %s: %v", path, err))
+				return
+			}
+			b.importPlan = plan
+			b.preview.SetText(importPreviewText(plan, CurrentEntryFormat())).ScrollToBeginning()
+			b.pages.SwitchToPage("preview")
+		}).
+		AddButton("Cancel", func() {
+			b.pages.SwitchToPage("table")
+		})
+	b.importForm.SetBorder(true).SetTitle("Import map entries")
+}
+
+func (b *BpfMapTableView) buildImportPreview() tview.Primitive {
+	b.preview = tview.NewTextView().SetDynamicColors(true).SetScrollable(true)
+	b.preview.SetBorder(true).SetTitle("Import preview")
+
+	buttons := tview.NewForm().
+		AddButton("Apply", func() {
+			err := utils.ApplyMapImport(b.Map.Id, b.importPlan)
+			if err != nil {
+				b.app.DisplayError(fmt.Sprintf("Failed to import into map %d: %v", b.Map.Id, err))
+			}
+			b.UpdateMap(b.Map)
+			b.pages.SwitchToPage("table")
+		}).
+		AddButton("Cancel", func() {
+			b.pages.SwitchToPage("table")
+		})
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(b.preview, 0, 1, false).
+		AddItem(buttons, 3, 0, true)
+	flex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyTAB {
+			if b.preview.HasFocus() {
+				b.app.App.SetFocus(buttons)
+			} else {
+				b.app.App.SetFocus(b.preview)
+			}
+			return nil
+		}
+		return event
+	})
+	return flex
+}
+
+// Delete the entry the confirmation was opened for
+func (b *BpfMapTableView) deletePendingEntry() {
+	err := utils.DeleteBpfMapEntry(b.Map.Id, b.pendingEntry.Key)
+	if err != nil {
+		b.app.DisplayError(fmt.Sprintf("Error deleting map entry: %v\n", err))
+	}
+
+	b.UpdateMap(b.Map)
+}
+
 func (b *BpfMapTableView) buildConfirmModal() {
 	b.confirm = tview.NewModal().
 		SetText("Are you sure you want to delete this map entry?").
 		AddButtons([]string{"Yes", "No"}).
 		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
 			if buttonLabel == "Yes" {
-				row, _ := b.table.GetSelection()
-				key := strings.Trim(fmt.Sprintf("%v", b.MapEntries[row-1].Key), "[]")
-				cmd := strings.Split("sudo "+utils.BpftoolPath+" map delete id "+strconv.Itoa(b.Map.Id)+" key "+key, " ")
-				_, _, err := utils.RunCmd(cmd...)
-				if err != nil {
-					b.app.DisplayError(fmt.Sprintf("Error deleting map entry: %v\n", err))
-				}
-
-				b.UpdateMap(b.Map)
+				b.deletePendingEntry()
 			}
 			b.pages.SwitchToPage("table")
 		})
@@ -392,7 +841,7 @@ func (b *BpfMapTableView) buildConfirmModal() {
 
 func (b *BpfMapTableView) buildFilterForm() {
 	b.filter = tview.NewForm().
-		AddDropDown("Data Format", []string{"Hex", "Decimal", "Char", "Raw"}, 0, func(option string, optionIndex int) {
+		AddDropDown("Data Format", []string{"Hex", "Decimal", "Char", "Raw", "BTF"}, 0, func(option string, optionIndex int) {
 			switch optionIndex {
 			case 0:
 				curFormat = Hex
@@ -403,8 +852,11 @@ func (b *BpfMapTableView) buildFilterForm() {
 			case 2:
 				curFormat = Char
 				break
-			default:
+			case 3:
 				curFormat = Raw
+				break
+			default:
+				curFormat = Btf
 			}
 			b.updateTable()
 		}).AddDropDown("Endianness", []string{"Little", "Big"}, 0, func(option string, optionIndex int) {
@@ -431,23 +883,96 @@ func (b *BpfMapTableView) buildFilterForm() {
 			curWidth = DataWidth64
 		}
 		b.updateTable()
+	}).AddDropDown("Per CPU", perCpuNames, 0, func(option string, optionIndex int) {
+		curPerCpu = optionIndex
+		b.updateTable()
 	})
 
 }
 
+// Build a tree node (and all its children) for a formatted key or value.
+// Structs and arrays below the top level start collapsed so large values stay
+// readable
+func newFormattedTreeNode(n *utils.FormattedNode, name string, depth int) *tview.TreeNode {
+	text := name
+	if n.IsStruct {
+		text += fmt.Sprintf(" [blue]{%d fields}[-]", len(n.Children))
+	} else if n.IsArray {
+		text += fmt.Sprintf(" [blue][%d elements][-]", len(n.Children))
+	} else {
+		text += ": " + tview.Escape(n.Value)
+	}
+
+	node := tview.NewTreeNode(text).SetSelectable(true)
+	for _, child := range n.Children {
+		node.AddChild(newFormattedTreeNode(child, tview.Escape(child.Name), depth+1))
+	}
+	node.SetExpanded(depth < 2)
+	return node
+}
+
+// Show the key and value of an entry as an expandable tree
+func (b *BpfMapTableView) showTree(entry utils.BpfMapEntry) {
+	if entry.Formatted == nil {
+		b.app.DisplayError("This map entry has no btf information. Only maps with btf can be shown as a tree")
+		return
+	}
+
+	root := tview.NewTreeNode(fmt.Sprintf("Map %d entry", b.Map.Id))
+	for _, part := range []struct {
+		name string
+		data []byte
+	}{{"key", entry.Formatted.Key}, {"value", entry.Formatted.Value}} {
+		if len(part.data) == 0 {
+			continue
+		}
+		n, err := utils.ParseFormatted(part.data)
+		if err != nil {
+			root.AddChild(tview.NewTreeNode(fmt.Sprintf("%s: failed to decode btf: %v", part.name, err)))
+			continue
+		}
+		root.AddChild(newFormattedTreeNode(n, part.name, 1))
+	}
+
+	b.tree.SetRoot(root).SetCurrentNode(root)
+	b.pages.SwitchToPage("tree")
+	b.app.App.SetFocus(b.tree)
+}
+
+func (b *BpfMapTableView) buildTreeView() {
+	b.tree = tview.NewTreeView()
+	b.tree.SetBorder(true).SetTitle("BTF (enter to expand/collapse, esc to go back)")
+	b.tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		node.SetExpanded(!node.IsExpanded())
+	})
+	b.tree.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			b.pages.SwitchToPage("table")
+			b.app.App.SetFocus(b.table)
+			return nil
+		}
+		return event
+	})
+}
+
 // Make a new BpfMapTableView. These functions only need to be called once
 func NewBpfMapTableView(tui *Tui) *BpfMapTableView {
 	b := BpfMapTableView{
-		form:  tview.NewForm(),
-		table: tview.NewTable(),
-		pages: tview.NewPages(),
-		app:   tui,
+		form:    tview.NewForm(),
+		table:   tview.NewTable(),
+		pages:   tview.NewPages(),
+		btfForm: tview.NewForm(),
+		app:     tui,
 	}
 
 	b.buildMapTableView()
 	b.buildMapTableEditForm()
 	b.buildConfirmModal()
 	b.buildFilterForm()
+	b.buildTreeView()
+	b.buildExportForm()
+	b.buildImportForm()
+	preview := b.buildImportPreview()
 
 	flex := tview.NewFlex().
 		AddItem(b.filter, 0, 1, false).
@@ -473,6 +998,11 @@ func NewBpfMapTableView(tui *Tui) *BpfMapTableView {
 	b.pages.AddPage("table", flex, true, true)
 	b.pages.AddPage("form", b.form, true, false)
 	b.pages.AddPage("confirm", b.confirm, true, false)
+	b.pages.AddPage("tree", b.tree, true, false)
+	b.pages.AddPage("btfform", b.btfForm, true, false)
+	b.pages.AddPage("export", b.exportForm, true, false)
+	b.pages.AddPage("import", b.importForm, true, false)
+	b.pages.AddPage("preview", preview, true, false)
 
 	return &b
 }
@@ -1,8 +1,14 @@
 package ui
 
 import (
+	"ebpfmon/utils"
+	"encoding/json"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
 )
 
 // Compares the values of two slices to determine if they are equal
@@ -186,3 +192,301 @@ func TestApplyFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatEntryBtf(t *testing.T) {
+	defer func() { curFormat = Hex }()
+	curFormat = Btf
+
+	entry := utils.BpfMapEntry{
+		Key:   []byte{1, 0, 0, 0},
+		Value: []byte{42, 0, 0, 0},
+		Formatted: &utils.BpfMapEntryFormatted{
+			Key:   json.RawMessage(`1`),
+			Value: json.RawMessage(`{"pid":42,"comm":"[red]"}`),
+		},
+	}
+	key, value := formatEntry(entry)
+	if key != "1" {
+		t.Errorf("Expected the formatted key, got %s", key)
+	}
+	if value != `{pid: 42, comm: "[red[]"}` {
+		t.Errorf("Expected the escaped formatted value, got %s", value)
+	}
+
+	// Entries without btf fall back to hex
+	entry.Formatted = nil
+	key, _ = formatEntry(entry)
+	if key != applyFormat(Hex, curWidth, curEndianness, entry.Key) {
+		t.Errorf("Expected the hex key, got %s", key)
+	}
+}
+
+func TestFormattedTreeNode(t *testing.T) {
+	n, err := utils.ParseFormatted(json.RawMessage(`{"pid":42,"inner":{"a":[1,2]}}`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	root := newFormattedTreeNode(n, "value", 1)
+	if len(root.GetChildren()) != 2 || root.GetChildren()[0].GetText() != "pid: 42" {
+		t.Fatalf("Unexpected children %v", root.GetChildren())
+	}
+	inner := root.GetChildren()[1]
+	if !root.IsExpanded() || inner.IsExpanded() {
+		t.Errorf("Expected nested structs to start collapsed")
+	}
+}
+
+func TestBtfForm(t *testing.T) {
+	backend := newFakeBackend()
+	backend.entries = map[int][]utils.BpfMapEntry{
+		4: {{Key: []byte{0, 0, 0, 0}, Value: []byte{1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 2}}},
+	}
+	backend.btf = map[int]*utils.MapBtf{
+		4: {
+			Btf: utils.NewBtf([]utils.BtfType{
+				{Id: 1, Kind: "INT", Name: "unsigned int", Size: 4, NrBits: 32, Encoding: "(none)"},
+				{Id: 2, Kind: "INT", Name: "int", Size: 4, NrBits: 32, Encoding: "SIGNED"},
+				{Id: 3, Kind: "STRUCT", Name: "config", Size: 9, Members: []utils.BtfMember{
+					{Name: "pid", TypeId: 1},
+					{Name: "delta", TypeId: 2, BitsOffset: 32},
+					{Name: "on", TypeId: 4, BitsOffset: 64},
+				}},
+				{Id: 4, Kind: "INT", Name: "_Bool", Size: 1, NrBits: 8, Encoding: "BOOL"},
+			}),
+			KeyTypeId:   1,
+			ValueTypeId: 3,
+		},
+	}
+	utils.SetBackend(backend)
+
+	b := NewBpfMapTableView(&Tui{})
+	b.Map = utils.BpfMap{Id: 4, BtfId: 9}
+	b.MapEntries = backend.entries[4]
+	if !b.showBtfForm(0) {
+		t.Fatalf("Expected the btf form to be shown")
+	}
+
+	expected := []string{"key (unsigned int)", "value.pid (unsigned int)", "value.delta (int)", "value.on (_Bool)"}
+	values := []string{"0", "1", "-1", "true"}
+	if b.btfForm.GetFormItemCount() != len(expected) {
+		t.Fatalf("Expected %d inputs, got %d", len(expected), b.btfForm.GetFormItemCount())
+	}
+	for i := range expected {
+		input := b.btfForm.GetFormItem(i).(*tview.InputField)
+		if input.GetLabel() != expected[i] || input.GetText() != values[i] {
+			t.Errorf("Expected %s = %s, got %s = %s", expected[i], values[i], input.GetLabel(), input.GetText())
+		}
+	}
+
+	b.btfForm.GetFormItem(2).(*tview.InputField).SetText("-2")
+	b.btfForm.GetButton(0).InputHandler()(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), func(p tview.Primitive) {})
+	// The bool holds 2 which would be written back as 1 if it was re-encoded
+	if !compareSlices(backend.entries[4][0].Value, []byte{1, 0, 0, 0, 0xfe, 0xff, 0xff, 0xff, 2}) {
+		t.Errorf("Unexpected value after saving %v", backend.entries[4][0].Value)
+	}
+
+	// Maps without btf use the byte editor
+	b.Map = utils.BpfMap{Id: 5}
+	if b.showBtfForm(0) {
+		t.Errorf("Expected the btf form to be skipped for a map without btf")
+	}
+}
+
+func TestImportPreviewText(t *testing.T) {
+	m := utils.BpfMap{Type: "hash"}
+	current := []utils.BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{2}},
+	}
+	imported := []utils.BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{5}},
+		{Key: []byte{3}, Value: []byte{3}},
+	}
+	text := importPreviewText(utils.PlanMapImport(m, current, imported), utils.EntryFormat{Format: Decimal, Width: DataWidth8})
+	for _, line := range []string{"1 to add, 1 to change, 1 to delete", "[green]+ 3: 3[-]", "[yellow]~ 1: 1 -> 5[-]", "[red]- 2: 2[-]"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("Expected %s in the preview\n%s", line, text)
+		}
+	}
+}
+
+func TestWatchedTable(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	b := NewBpfMapTableView(&Tui{})
+	b.MapEntries = []utils.BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{2}},
+	}
+	b.watcher = utils.NewMapWatcher()
+	b.watched = b.watcher.Update(b.MapEntries, time.Now())
+
+	b.applyWatchedEntries([]utils.BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{9}},
+		{Key: []byte{3}, Value: []byte{3}},
+	}, time.Now())
+
+	if len(b.MapEntries) != 2 || b.table.GetRowCount() != 4 {
+		t.Fatalf("Expected 2 entries and a removed row, got %d entries and %d rows", len(b.MapEntries), b.table.GetRowCount())
+	}
+	expected := []struct {
+		color   tcell.Color
+		changes string
+	}{
+		{tcell.ColorYellow, "1"},
+		{tcell.ColorGreen, "0"},
+		{tcell.ColorRed, "0"},
+	}
+	for i, e := range expected {
+		cell := b.table.GetCell(i+1, 1)
+		if cell.Color != e.color || b.table.GetCell(i+1, 3).Text != e.changes {
+			t.Errorf("Row %d: expected %v with %s changes, got %v with %s", i+1, e.color, e.changes, cell.Color, b.table.GetCell(i+1, 3).Text)
+		}
+	}
+	if b.table.GetCell(3, 1).NotSelectable != true {
+		t.Errorf("Expected the removed entry to not be selectable")
+	}
+}
+
+func TestWatchedDeleteKeepsKey(t *testing.T) {
+	backend := newFakeBackend()
+	backend.entries = map[int][]utils.BpfMapEntry{
+		4: {{Key: []byte{1}, Value: []byte{1}}, {Key: []byte{2}, Value: []byte{2}}},
+	}
+	utils.SetBackend(backend)
+	b := NewBpfMapTableView(&Tui{})
+	b.UpdateMap(utils.BpfMap{Id: 4})
+	b.table.Select(1, 0)
+	b.table.InputHandler()(tcell.NewEventKey(tcell.KeyRune, 'd', tcell.ModNone), func(p tview.Primitive) {})
+
+	// A watch redraws the table with a new entry in the selected row
+	b.MapEntries = append([]utils.BpfMapEntry{{Key: []byte{0}, Value: []byte{0}}}, b.MapEntries...)
+	b.updateTable()
+	b.deletePendingEntry()
+	if len(backend.entries[4]) != 1 || backend.entries[4][0].Key[0] != 2 {
+		t.Errorf("Expected the entry the confirmation was opened for to be deleted, got %v", backend.entries[4])
+	}
+}
+
+func TestLeaveStopsWatch(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	b := NewBpfMapTableView(&Tui{})
+	b.MapEntries = []utils.BpfMapEntry{{Key: []byte{1}, Value: []byte{1}}}
+	stop := make(chan struct{})
+	b.watcher = utils.NewMapWatcher()
+	b.watched = b.watcher.Update(b.MapEntries, time.Now())
+	b.watchStop = stop
+
+	b.leave()
+	select {
+	case <-stop:
+	default:
+		t.Errorf("Expected the watch to be stopped")
+	}
+	if b.watchStop != nil || b.watched != nil {
+		t.Errorf("Expected the watch state to be cleared")
+	}
+}
+
+func TestPerCpuValues(t *testing.T) {
+	defer func() { curPerCpu, curWidth, curFormat = PerCpuColumns, DataWidth8, Hex }()
+	values := [][]byte{{1, 0, 0xff, 0}, {2, 0, 0x02, 0}, {3, 0, 0x01, 0}}
+
+	if sum := aggregateValues(values, PerCpuSum, DataWidth16, Little); !compareSlices(sum, []byte{6, 0, 0x02, 0x01}) {
+		t.Errorf("Unexpected sum %v", sum)
+	}
+	if min := aggregateValues(values, PerCpuMin, DataWidth16, Little); !compareSlices(min, []byte{1, 0, 0x01, 0}) {
+		t.Errorf("Unexpected min %v", min)
+	}
+	if max := aggregateValues(values, PerCpuMax, DataWidth8, Big); !compareSlices(max, []byte{3, 0, 0xff, 0}) {
+		t.Errorf("Unexpected max %v", max)
+	}
+
+	entries := []utils.BpfMapEntry{{Key: []byte{0}, Value: values[0], Values: values}}
+	curFormat, curWidth = Decimal, DataWidth16
+	if headers := valueHeaders(entries); len(headers) != 3 || headers[2] != "CPU 2" {
+		t.Errorf("Expected a column for each cpu, got %v", headers)
+	}
+	if cells := valueCells(entries[0]); len(cells) != 3 || cells[1] != "2 2" {
+		t.Errorf("Unexpected cpu columns %v", cells)
+	}
+
+	curPerCpu = PerCpuSum
+	if headers := valueHeaders(entries); len(headers) != 1 || headers[0] != "Value (sum)" {
+		t.Errorf("Expected a single sum column, got %v", headers)
+	}
+	if cells := valueCells(entries[0]); len(cells) != 1 || cells[0] != "6 258" {
+		t.Errorf("Unexpected sum %v", cells)
+	}
+}
+
+func TestEditSingleCpu(t *testing.T) {
+	backend := newFakeBackend()
+	backend.entries = map[int][]utils.BpfMapEntry{
+		6: {{Key: []byte{0}, Value: []byte{1}, Values: [][]byte{{1}, {2}}}},
+	}
+	utils.SetBackend(backend)
+
+	b := NewBpfMapTableView(&Tui{})
+	b.Map = utils.BpfMap{Id: 6, Type: "percpu_array"}
+	b.MapEntries = backend.entries[6]
+	b.updateTable()
+	b.table.Select(1, 0)
+	b.table.InputHandler()(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), func(p tview.Primitive) {})
+
+	cpu := b.form.GetFormItemByLabel("CPU").(*tview.DropDown)
+	cpu.SetCurrentOption(2)
+	value := b.form.GetFormItemByLabel("Value").(*tview.InputField)
+	if value.GetText() != "[2]" {
+		t.Errorf("Expected the value of cpu 1, got %s", value.GetText())
+	}
+	b.form.GetFormItemByLabel("Key").(*tview.InputField).SetText("[0]")
+	value.SetText("[7]")
+	b.form.GetButton(0).InputHandler()(tcell.NewEventKey(tcell.KeyEnter, 0, tcell.ModNone), func(p tview.Primitive) {})
+
+	values := backend.entries[6][0].Values
+	if values[0][0] != 1 || values[1][0] != 7 {
+		t.Errorf("Expected only cpu 1 to change, got %v", values)
+	}
+
+	// Other maps don't get a cpu option
+	b.setCpuOptions(utils.BpfMapEntry{Key: []byte{0}, Value: []byte{1}})
+	if b.form.GetFormItemIndex("CPU") >= 0 {
+		t.Errorf("Expected the cpu option to be removed")
+	}
+}
+
+func TestMapOfMaps(t *testing.T) {
+	backend := newFakeBackend()
+	backend.maps = []utils.BpfMap{
+		{Id: 10, Type: "array_of_maps", Name: "outer"},
+		{Id: 11, Type: "hash", Name: "inner"},
+	}
+	backend.entries = map[int][]utils.BpfMapEntry{
+		10: {{Key: []byte{0, 0, 0, 0}, Value: []byte{11, 0, 0, 0}}, {Key: []byte{1, 0, 0, 0}, Value: []byte{12, 0, 0, 0}}},
+		11: {{Key: []byte{1}, Value: []byte{2}}},
+	}
+	utils.SetBackend(backend)
+
+	b := NewBpfMapTableView(&Tui{})
+	if err := b.OpenMap(backend.maps[0]); err != nil {
+		t.Fatalf("Failed to open the outer map: %v", err)
+	}
+	if b.table.GetCell(0, 2).Text != "Inner Map" || b.table.GetCell(1, 2).Text != "11: hash inner" || b.table.GetCell(2, 2).Text != "12 (not found)" {
+		t.Errorf("Unexpected inner maps %s, %s", b.table.GetCell(1, 2).Text, b.table.GetCell(2, 2).Text)
+	}
+
+	b.openInnerMap(0)
+	if b.Map.Id != 11 || len(b.MapEntries) != 1 {
+		t.Fatalf("Expected the inner map to be opened, got map %d", b.Map.Id)
+	}
+	if title := b.table.GetTitle(); !strings.Contains(title, "outer (10) > inner (11)") {
+		t.Errorf("Expected breadcrumbs in the title, got %s", title)
+	}
+
+	if !b.closeInnerMap() || b.Map.Id != 10 {
+		t.Errorf("Expected to go back to the outer map, got map %d", b.Map.Id)
+	}
+	if b.closeInnerMap() {
+		t.Errorf("Expected no more outer maps")
+	}
+}
@@ -0,0 +1,474 @@
+// This page streams the records that bpf programs write to ringbuf and perf
+// event array maps. These maps can't be dumped like other maps so the records
+// are shown as they arrive along with how many arrive per second. The records
+// can be decoded with a btf type and saved to a file as json lines
+package ui
+
+import (
+	"ebpfmon/utils"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const (
+	EventHex   = 0
+	EventAscii = 1
+	EventBtf   = 2
+)
+
+var eventFormatNames = []string{"hex", "ascii", "btf"}
+
+// Only the newest records are kept
+const maxMapEvents = 1000
+
+// How often new records are added to the table
+const mapEventsInterval = 250 * time.Millisecond
+
+type MapEventsView struct {
+	pages    *tview.Pages
+	status   *tview.TextView
+	table    *tview.Table
+	confirm  *tview.Modal
+	typeForm *tview.Form
+	saveForm *tview.Form
+	app      *Tui
+	Map      utils.BpfMap
+
+	// The newest records with the oldest one first
+	events []utils.MapEvent
+
+	// Counters since the stream started
+	total int
+	lost  int
+
+	// Records per second over the last second
+	rate      float64
+	rateTotal int
+	rateTime  time.Time
+
+	// One of the Event* constants
+	format int
+
+	// The btf type records are decoded with when the format is EventBtf
+	btf      *utils.Btf
+	typeName string
+	fields   []utils.BtfField
+
+	// Set while the records are being saved
+	save     io.WriteCloser
+	savePath string
+
+	// Set while the stream is running. Closing it stops the stream
+	stop chan struct{}
+}
+
+// A record as it is saved to a file. Lost records don't have any data
+type savedMapEvent struct {
+	Time string `json:"time"`
+	Cpu  int    `json:"cpu"`
+	Size int    `json:"size"`
+	Data string `json:"data,omitempty"`
+	Lost int    `json:"lost,omitempty"`
+}
+
+// Write a record as a single line of json
+func writeMapEvent(w io.Writer, e utils.MapEvent) error {
+	line, err := json.Marshal(savedMapEvent{
+		Time: e.Time.Format(time.RFC3339Nano),
+		Cpu:  e.Cpu,
+		Size: len(e.Data),
+		Data: hex.EncodeToString(e.Data),
+		Lost: e.Lost,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// Decode a record with the fields of a btf type i.e. pid=12 comm=bash
+func decodeMapEvent(fields []utils.BtfField, data []byte) string {
+	parts := []string{}
+	for _, f := range fields {
+		text, err := f.Decode(data)
+		if err != nil {
+			return fmt.Sprintf("failed to decode: %v", err)
+		}
+		if f.Path == "" {
+			parts = append(parts, text)
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%s", f.Path, text))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Get the text of the data column of a record
+func (m *MapEventsView) formatData(e utils.MapEvent) string {
+	if e.Lost > 0 {
+		return fmt.Sprintf("[red]lost %d records[-]", e.Lost)
+	}
+
+	var text string
+	switch m.format {
+	case EventAscii:
+		text = applyFormat(Char, DataWidth8, Little, e.Data)
+	case EventBtf:
+		if m.fields == nil {
+			text = "no btf type selected. Press t to select one"
+		} else {
+			text = decodeMapEvent(m.fields, e.Data)
+		}
+	default:
+		text = fmt.Sprintf("% x", e.Data)
+	}
+	return tview.Escape(text)
+}
+
+// Add new records to the table and update the counters
+func (m *MapEventsView) addEvents(events []utils.MapEvent, now time.Time) {
+	for _, e := range events {
+		m.total++
+		m.lost += e.Lost
+		if m.save != nil {
+			err := writeMapEvent(m.save, e)
+			if err != nil {
+				path := m.savePath
+				m.stopSave()
+				m.app.DisplayError(fmt.Sprintf("Failed to save records to %s: %v", path, err))
+			}
+		}
+	}
+	m.events = append(m.events, events...)
+	if len(m.events) > maxMapEvents {
+		m.events = m.events[len(m.events)-maxMapEvents:]
+	}
+
+	if elapsed := now.Sub(m.rateTime); elapsed >= time.Second {
+		m.rate = float64(m.total-m.rateTotal) / elapsed.Seconds()
+		m.rateTotal = m.total
+		m.rateTime = now
+	}
+
+	if len(events) > 0 {
+		m.updateTable()
+	}
+	m.updateStatus()
+}
+
+func (m *MapEventsView) updateStatus() {
+	state := "stopped"
+	if m.stop != nil {
+		state = "streaming"
+	}
+	saving := "not saving"
+	if m.save != nil {
+		saving = "saving to " + tview.Escape(m.savePath)
+	}
+	format := eventFormatNames[m.format]
+	if m.format == EventBtf && m.typeName != "" {
+		format += " (" + tview.Escape(m.typeName) + ")"
+	}
+
+	m.status.SetText(fmt.Sprintf(
+		"[blue]Map:[-] %d %s (%s)  [blue]State:[-] %s  [blue]Records:[-] %d  [blue]Rate:[-] %.1f/s  [blue]Lost:[-] %d  [blue]Format:[-] %s  [blue]File:[-] %s",
+		m.Map.Id, tview.Escape(m.Map.Name), m.Map.Type, state, m.total, m.rate, m.lost, format, saving))
+}
+
+// Show the records with the newest one first
+func (m *MapEventsView) updateTable() {
+	m.table.Clear()
+	for column, header := range []string{"Time", "CPU", "Size", "Data"} {
+		m.table.SetCell(0, column, tview.NewTableCell(header).SetSelectable(false).SetTextColor(tcell.ColorYellow))
+	}
+
+	for i := range m.events {
+		e := m.events[len(m.events)-1-i]
+		cpu := "-"
+		if e.Cpu >= 0 {
+			cpu = strconv.Itoa(e.Cpu)
+		}
+		cells := []string{e.Time.Format("15:04:05.000"), cpu, strconv.Itoa(len(e.Data)), m.formatData(e)}
+		for column, text := range cells {
+			m.table.SetCell(i+1, column, tview.NewTableCell(text))
+		}
+	}
+}
+
+// Open the view for a map. The stream only starts once the user confirms
+// since the records are taken away from the program that reads them
+func (m *MapEventsView) Open(bpfMap utils.BpfMap) {
+	m.Stop()
+	m.stopSave()
+	if bpfMap.Id != m.Map.Id {
+		m.setType(nil, "", nil)
+		m.format = EventHex
+	}
+	m.Map = bpfMap
+	m.events = nil
+	m.total, m.lost, m.rate, m.rateTotal = 0, 0, 0, 0
+	m.updateTable()
+	m.updateStatus()
+
+	text := fmt.Sprintf("Reading the records of %s map %d takes them away from the program that normally reads them. It won't see any records while the stream is running.", bpfMap.Type, bpfMap.Id)
+	if bpfMap.Type == "perf_event_array" {
+		text += " bpftool also replaces the perf buffers of the map so the owner won't get any records until it is restarted."
+	}
+	m.confirm.SetText(text + "\n\nStart streaming?")
+	m.pages.SwitchToPage("confirm")
+	m.app.pages.SwitchToPage("mapevents")
+	m.app.App.SetFocus(m.confirm)
+}
+
+// Start reading records in the background
+func (m *MapEventsView) Start() {
+	if m.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	m.stop = stop
+	m.rateTime = time.Now()
+	m.updateStatus()
+
+	events := make(chan utils.MapEvent, 256)
+	bpfMap := m.Map
+	go func() {
+		err := utils.StreamBpfMapEvents(bpfMap, events, stop)
+		m.app.App.QueueUpdateDraw(func() {
+			// The stream may have been stopped or restarted in the meantime
+			if m.stop != stop {
+				return
+			}
+			m.Stop()
+			if err != nil {
+				m.app.DisplayError(fmt.Sprintf("Failed to read map %d: %v", bpfMap.Id, err))
+			}
+		})
+	}()
+	go m.receive(events, stop)
+}
+
+// Collect records and add them to the table every mapEventsInterval. The
+// stream is stopped once the user switches to another page
+func (m *MapEventsView) receive(events <-chan utils.MapEvent, stop chan struct{}) {
+	ticker := time.NewTicker(mapEventsInterval)
+	defer ticker.Stop()
+	pending := []utils.MapEvent{}
+	for {
+		select {
+		case <-stop:
+			return
+		case e := <-events:
+			pending = append(pending, e)
+			continue
+		case <-ticker.C:
+		}
+
+		batch := pending
+		pending = []utils.MapEvent{}
+		m.app.App.QueueUpdateDraw(func() {
+			if m.stop != stop {
+				return
+			}
+			page, _ := m.app.pages.GetFrontPage()
+			if page != "mapevents" && page != "help" && page != "error" {
+				m.Stop()
+				m.stopSave()
+				return
+			}
+			m.addEvents(batch, time.Now())
+		})
+	}
+}
+
+// Stop reading records
+func (m *MapEventsView) Stop() {
+	if m.stop == nil {
+		return
+	}
+	close(m.stop)
+	m.stop = nil
+	m.updateStatus()
+}
+
+func (m *MapEventsView) stopSave() {
+	if m.save == nil {
+		return
+	}
+	m.save.Close()
+	m.save = nil
+	m.savePath = ""
+	m.updateStatus()
+}
+
+// Decode records with a btf type of the map. An empty name goes back to hex
+func (m *MapEventsView) selectType(name string) error {
+	if name == "" {
+		m.setType(nil, "", nil)
+		m.format = EventHex
+		return nil
+	}
+	if m.Map.BtfId == 0 {
+		return fmt.Errorf("map %d has no btf", m.Map.Id)
+	}
+
+	if m.btf == nil {
+		btf, err := utils.GetBpfBtf(m.Map.BtfId)
+		if err != nil {
+			return err
+		}
+		m.btf = btf
+	}
+	id, ok := m.btf.FindType(name)
+	if !ok {
+		return fmt.Errorf("btf %d has no type named %s", m.Map.BtfId, name)
+	}
+	fields, err := m.btf.Fields(id, "")
+	if err != nil {
+		return err
+	}
+	m.setType(m.btf, name, fields)
+	m.format = EventBtf
+	return nil
+}
+
+func (m *MapEventsView) setType(btf *utils.Btf, name string, fields []utils.BtfField) {
+	m.btf = btf
+	m.typeName = name
+	m.fields = fields
+	for i := range m.fields {
+		m.fields[i].Path = strings.TrimPrefix(m.fields[i].Path, ".")
+	}
+}
+
+func (m *MapEventsView) buildTable() {
+	m.status = tview.NewTextView().SetDynamicColors(true)
+	m.status.SetBorder(true).SetTitle("Stream (f: format, t: btf type, s: save, p: pause, ESC: back)")
+
+	m.table = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	m.table.SetBorder(true).SetTitle("Records")
+	m.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() == tcell.KeyEsc {
+			m.Stop()
+			m.stopSave()
+			m.app.pages.SwitchToPage("programs")
+			return nil
+		}
+
+		switch event.Rune() {
+		case 'f':
+			m.format = (m.format + 1) % len(eventFormatNames)
+		case 't':
+			m.typeForm.GetFormItemByLabel("Type").(*tview.InputField).SetText(m.typeName)
+			m.typeForm.SetFocus(0)
+			m.pages.SwitchToPage("type")
+			return nil
+		case 's':
+			if m.save != nil {
+				m.stopSave()
+				return nil
+			}
+			path := m.saveForm.GetFormItemByLabel("File").(*tview.InputField)
+			path.SetText(fmt.Sprintf("map_%d_events.json", m.Map.Id))
+			m.saveForm.SetFocus(0)
+			m.pages.SwitchToPage("save")
+			return nil
+		case 'p':
+			if m.stop != nil {
+				m.Stop()
+			} else {
+				m.Start()
+			}
+			return nil
+		default:
+			return event
+		}
+		m.updateTable()
+		m.updateStatus()
+		return nil
+	})
+}
+
+func (m *MapEventsView) buildConfirmModal() {
+	m.confirm = tview.NewModal().
+		AddButtons([]string{"Start", "Cancel"}).
+		SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+			if buttonLabel != "Start" {
+				m.app.pages.SwitchToPage("programs")
+				return
+			}
+			m.pages.SwitchToPage("events")
+			m.app.App.SetFocus(m.table)
+			m.Start()
+		})
+}
+
+func (m *MapEventsView) buildTypeForm() {
+	m.typeForm = tview.NewForm().
+		AddInputField("Type", "", 0, nil, nil).
+		AddButton("Apply", func() {
+			name := strings.TrimSpace(m.typeForm.GetFormItemByLabel("Type").(*tview.InputField).GetText())
+			err := m.selectType(name)
+			if err != nil {
+				m.app.DisplayError(fmt.Sprintf("Failed to select btf type %s: %v", name, err))
+				return
+			}
+			m.updateTable()
+			m.updateStatus()
+			m.pages.SwitchToPage("events")
+		}).
+		AddButton("Cancel", func() {
+			m.pages.SwitchToPage("events")
+		})
+	m.typeForm.SetBorder(true).SetTitle("Decode records as a btf struct (leave empty for hex)")
+}
+
+func (m *MapEventsView) buildSaveForm() {
+	m.saveForm = tview.NewForm().
+		AddInputField("File", "", 0, nil, nil).
+		AddButton("Save", func() {
+			path := m.saveForm.GetFormItemByLabel("File").(*tview.InputField).GetText()
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				m.app.DisplayError(fmt.Sprintf("Failed to open %s: %v", path, err))
+				return
+			}
+			m.save = f
+			m.savePath = path
+			m.updateStatus()
+			m.pages.SwitchToPage("events")
+		}).
+		AddButton("Cancel", func() {
+			m.pages.SwitchToPage("events")
+		})
+	m.saveForm.SetBorder(true).SetTitle("Save new records as json lines")
+}
+
+func NewMapEventsView(tui *Tui) *MapEventsView {
+	m := &MapEventsView{app: tui, pages: tview.NewPages()}
+	m.buildTable()
+	m.buildConfirmModal()
+	m.buildTypeForm()
+	m.buildSaveForm()
+	m.updateTable()
+
+	flex := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(m.status, 3, 0, false).
+		AddItem(m.table, 0, 1, true)
+
+	m.pages.AddPage("events", flex, true, true)
+	m.pages.AddPage("confirm", m.confirm, true, false)
+	m.pages.AddPage("type", m.typeForm, true, false)
+	m.pages.AddPage("save", m.saveForm, true, false)
+	return m
+}
@@ -0,0 +1,63 @@
+package ui
+
+import (
+	"bytes"
+	"ebpfmon/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMapEventsView(t *testing.T) {
+	backend := newFakeBackend()
+	backend.btf = map[int]*utils.MapBtf{
+		8: {
+			Btf: utils.NewBtf([]utils.BtfType{
+				{Id: 1, Kind: "INT", Name: "unsigned int", Size: 4, NrBits: 32, Encoding: "(none)"},
+				{Id: 2, Kind: "INT", Name: "char", Size: 1, NrBits: 8, Encoding: "SIGNED"},
+				{Id: 3, Kind: "ARRAY", TypeId: 2, NrElems: 4},
+				{Id: 4, Kind: "STRUCT", Name: "event", Size: 8, Members: []utils.BtfMember{
+					{Name: "pid", TypeId: 1},
+					{Name: "comm", TypeId: 3, BitsOffset: 32},
+				}},
+			}),
+		},
+	}
+	utils.SetBackend(backend)
+
+	m := NewMapEventsView(&Tui{})
+	m.Map = utils.BpfMap{Id: 8, Type: "ringbuf", BtfId: 3}
+	now := time.Unix(1000, 0)
+	m.rateTime = now
+	m.addEvents([]utils.MapEvent{
+		{Time: now, Cpu: -1, Data: []byte{42, 0, 0, 0, 'b', 'a', 's', 'h'}},
+		{Time: now, Cpu: 2, Lost: 3},
+	}, now.Add(2*time.Second))
+
+	if m.total != 2 || m.lost != 3 || m.rate != 1 {
+		t.Errorf("Unexpected counters total %d lost %d rate %v", m.total, m.lost, m.rate)
+	}
+	if m.table.GetRowCount() != 3 || m.table.GetCell(1, 1).Text != "2" || m.table.GetCell(2, 1).Text != "-" {
+		t.Fatalf("Expected the newest record first, got %d rows", m.table.GetRowCount())
+	}
+	if text := m.table.GetCell(2, 3).Text; text != "2a 00 00 00 62 61 73 68" {
+		t.Errorf("Unexpected hex data %s", text)
+	}
+
+	if err := m.selectType("missing"); err == nil {
+		t.Errorf("Expected an error for an unknown type")
+	}
+	if err := m.selectType("event"); err != nil {
+		t.Fatalf("Failed to select the event type: %v", err)
+	}
+	m.updateTable()
+	if text := m.table.GetCell(2, 3).Text; text != "pid=42 comm=bash" {
+		t.Errorf("Unexpected btf data %s", text)
+	}
+
+	var saved bytes.Buffer
+	err := writeMapEvent(&saved, m.events[0])
+	if err != nil || !strings.Contains(saved.String(), `"cpu":-1,"size":8,"data":"2a00000062617368"`) {
+		t.Errorf("Unexpected saved record %s (%v)", saved.String(), err)
+	}
+}
@@ -0,0 +1,158 @@
+// This file handles how the values of per cpu maps are shown in the map view.
+// Each cpu can get its own column or the values of all the cpus can be
+// combined into one (sum, min or max) using the selected data width
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+const (
+	PerCpuColumns = 0
+	PerCpuSum     = 1
+	PerCpuMin     = 2
+	PerCpuMax     = 3
+)
+
+var perCpuNames = []string{"Columns", "Sum", "Min", "Max"}
+
+var curPerCpu = PerCpuColumns
+
+// Read a number of width bytes
+func readNumber(data []byte, endianness int) uint64 {
+	var v uint64
+	for i := range data {
+		if endianness == Big {
+			v = v<<8 | uint64(data[i])
+		} else {
+			v |= uint64(data[i]) << (8 * i)
+		}
+	}
+	return v
+}
+
+// Write v into the width bytes of data
+func writeNumber(data []byte, endianness int, v uint64) {
+	for i := range data {
+		if endianness == Big {
+			data[len(data)-1-i] = byte(v >> (8 * i))
+		} else {
+			data[i] = byte(v >> (8 * i))
+		}
+	}
+}
+
+// Combine the values of every cpu into one. The values are split into
+// numbers of the given width which are combined separately. Sums wrap around
+// like the counters they usually are
+func aggregateValues(values [][]byte, op int, width int, endianness int) []byte {
+	if len(values) == 0 {
+		return nil
+	}
+
+	size := len(values[0])
+	result := padBytes(append([]byte{}, values[0]...), width)
+	for _, value := range values[1:] {
+		value = padBytes(append([]byte{}, value...), width)
+		for i := 0; i+width <= len(result) && i+width <= len(value); i += width {
+			acc := readNumber(result[i:i+width], endianness)
+			v := readNumber(value[i:i+width], endianness)
+			switch op {
+			case PerCpuSum:
+				acc += v
+			case PerCpuMin:
+				if v < acc {
+					acc = v
+				}
+			case PerCpuMax:
+				if v > acc {
+					acc = v
+				}
+			}
+			writeNumber(result[i:i+width], endianness, acc)
+		}
+	}
+	return result[:size]
+}
+
+// Get the btf formatted value of each cpu if bpftool formatted them
+func formattedCpuValues(entry utils.BpfMapEntry) []string {
+	if entry.Formatted == nil || len(entry.Formatted.Values) == 0 {
+		return nil
+	}
+	node, err := utils.ParseFormatted(entry.Formatted.Values)
+	if err != nil {
+		return nil
+	}
+
+	result := []string{}
+	for _, cpu := range node.Children {
+		for _, child := range cpu.Children {
+			if child.Name == "value" {
+				result = append(result, child.String())
+			}
+		}
+	}
+	return result
+}
+
+// Get the most cpus any entry has a value for. Zero if the map isn't a per
+// cpu map
+func cpuCount(entries []utils.BpfMapEntry) int {
+	count := 0
+	for _, e := range entries {
+		if len(e.Values) > count {
+			count = len(e.Values)
+		}
+	}
+	return count
+}
+
+// Get the headers of the value columns
+func valueHeaders(entries []utils.BpfMapEntry) []string {
+	cpus := cpuCount(entries)
+	if cpus == 0 {
+		return []string{"Value"}
+	}
+	if curPerCpu != PerCpuColumns {
+		return []string{fmt.Sprintf("Value (%s)", strings.ToLower(perCpuNames[curPerCpu]))}
+	}
+
+	headers := []string{}
+	for cpu := 0; cpu < cpus; cpu++ {
+		headers = append(headers, fmt.Sprintf("CPU %d", cpu))
+	}
+	return headers
+}
+
+// Get the text of the value columns of an entry
+func valueCells(entry utils.BpfMapEntry) []string {
+	_, valueText := formatEntry(entry)
+	if len(entry.Values) == 0 {
+		return []string{valueText}
+	}
+
+	format := curFormat
+	if format == Btf {
+		if formatted := formattedCpuValues(entry); curPerCpu == PerCpuColumns && len(formatted) == len(entry.Values) {
+			for i := range formatted {
+				formatted[i] = tview.Escape(formatted[i])
+			}
+			return formatted
+		}
+		format = Hex
+	}
+	if curPerCpu != PerCpuColumns {
+		return []string{applyFormat(format, curWidth, curEndianness, aggregateValues(entry.Values, curPerCpu, curWidth, curEndianness))}
+	}
+
+	cells := []string{}
+	for _, value := range entry.Values {
+		cells = append(cells, applyFormat(format, curWidth, curEndianness, value))
+	}
+	return cells
+}
@@ -0,0 +1,120 @@
+// This page shows the tail call chains of the loaded programs as a tree. Each
+// chain starts at a program that isn't in a prog array itself and every node
+// is a program that can be reached through a slot of a prog array. Pressing
+// ENTER on a program shows its disassembly in the explorer
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type TailCallView struct {
+	tree *tview.TreeView
+	app  *Tui
+}
+
+// Describe a program in the tree i.e. 12: xdp parse_ipv4
+func tailCallProgramText(id int, programs map[int]utils.BpfProgram) string {
+	p, ok := programs[id]
+	if !ok {
+		return fmt.Sprintf("%d (not loaded)", id)
+	}
+	return tview.Escape(fmt.Sprintf("%d: %s %s", id, p.ProgType, p.Name))
+}
+
+// Add the tail calls of a program to its node. A program that is already on
+// the path from the root is a loop and isn't expanded again. Neither is a
+// program that was expanded elsewhere in the same tree
+func addTailCallNodes(node *tview.TreeNode, id int, graph *utils.TailCallGraph, programs map[int]utils.BpfProgram, path map[int]bool, expanded map[int]bool) {
+	if expanded[id] {
+		if len(graph.Calls[id]) > 0 {
+			node.SetText(node.GetText() + " [gray](see above)[-]")
+		}
+		return
+	}
+	expanded[id] = true
+	path[id] = true
+	defer delete(path, id)
+
+	for _, call := range graph.Calls[id] {
+		slot := tview.Escape(fmt.Sprintf("%s[%d]", call.MapName, call.Index))
+		text := fmt.Sprintf("[yellow]%s[-] -> %s", slot, tailCallProgramText(call.ProgramId, programs))
+		child := tview.NewTreeNode(text).SetReference(call.ProgramId).SetSelectable(true)
+		node.AddChild(child)
+		if path[call.ProgramId] {
+			child.SetText(text + " [red](loop)[-]")
+			continue
+		}
+		addTailCallNodes(child, call.ProgramId, graph, programs, path, expanded)
+	}
+}
+
+// Build the tree of every tail call chain
+func newTailCallTree(graph *utils.TailCallGraph, programs map[int]utils.BpfProgram) *tview.TreeNode {
+	root := tview.NewTreeNode("Tail calls").SetSelectable(false)
+	roots := graph.Roots()
+	if len(roots) == 0 {
+		root.AddChild(tview.NewTreeNode("No program makes any tail calls").SetSelectable(false))
+		return root
+	}
+	for _, id := range roots {
+		node := tview.NewTreeNode(tailCallProgramText(id, programs)).SetReference(id).SetSelectable(true)
+		root.AddChild(node)
+		addTailCallNodes(node, id, graph, programs, map[int]bool{}, map[int]bool{})
+	}
+	return root
+}
+
+// Dump the prog arrays and rebuild the tree
+func (v *TailCallView) Update() {
+	lock.Lock()
+	programs := make(map[int]utils.BpfProgram, len(Programs))
+	for id, p := range Programs {
+		programs[id] = p
+	}
+	lock.Unlock()
+
+	graph, err := utils.GetTailCallGraph(programs)
+	if err != nil {
+		v.app.DisplayError(fmt.Sprintf("Failed to get the tail calls: %v", err))
+		return
+	}
+	root := newTailCallTree(graph, programs)
+	v.tree.SetRoot(root)
+	if children := root.GetChildren(); len(children) > 0 {
+		v.tree.SetCurrentNode(children[0])
+	}
+}
+
+func (v *TailCallView) buildTree() {
+	v.tree = tview.NewTreeView()
+	v.tree.SetBorder(true).SetTitle("Tail calls (ENTER: show program, r: refresh)")
+	v.tree.SetSelectedFunc(func(node *tview.TreeNode) {
+		id, ok := node.GetReference().(int)
+		if !ok {
+			return
+		}
+		v.app.pages.SwitchToPage("programs")
+		v.app.App.SetFocus(v.app.bpfExplorerView.programList)
+		if !v.app.bpfExplorerView.ShowProgram(id) {
+			v.app.DisplayError(fmt.Sprintf("Program %d is no longer loaded", id))
+		}
+	})
+	v.tree.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'r' {
+			v.Update()
+			return nil
+		}
+		return event
+	})
+}
+
+func NewTailCallView(t *Tui) *TailCallView {
+	v := &TailCallView{app: t}
+	v.buildTree()
+	return v
+}
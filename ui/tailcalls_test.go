@@ -0,0 +1,40 @@
+package ui
+
+import (
+	"ebpfmon/utils"
+	"strings"
+	"testing"
+)
+
+func TestTailCallTree(t *testing.T) {
+	programs := map[int]utils.BpfProgram{
+		1: {ProgramId: 1, ProgType: "xdp", Name: "entry"},
+		2: {ProgramId: 2, ProgType: "xdp", Name: "parse"},
+	}
+	graph := &utils.TailCallGraph{
+		Calls: map[int][]utils.TailCall{
+			1: {{MapId: 10, MapName: "jmp", Index: 0, ProgramId: 2}, {MapId: 10, MapName: "jmp", Index: 1, ProgramId: 9}},
+			2: {{MapId: 10, MapName: "jmp", Index: 0, ProgramId: 2}},
+		},
+		Targets: map[int]bool{2: true, 9: true},
+	}
+
+	root := newTailCallTree(graph, programs)
+	if len(root.GetChildren()) != 1 {
+		t.Fatalf("Expected a single chain, got %d", len(root.GetChildren()))
+	}
+	entry := root.GetChildren()[0]
+	if entry.GetText() != "1: xdp entry" || len(entry.GetChildren()) != 2 {
+		t.Fatalf("Unexpected entry node %s with %d children", entry.GetText(), len(entry.GetChildren()))
+	}
+	parse := entry.GetChildren()[0]
+	if parse.GetText() != "[yellow]jmp[0[][-] -> 2: xdp parse" || parse.GetReference() != 2 {
+		t.Errorf("Unexpected node %s", parse.GetText())
+	}
+	if text := parse.GetChildren()[0].GetText(); !strings.Contains(text, "(loop)") {
+		t.Errorf("Expected the program calling itself to be a loop, got %s", text)
+	}
+	if text := entry.GetChildren()[1].GetText(); !strings.Contains(text, "9 (not loaded)") {
+		t.Errorf("Expected an unknown program, got %s", text)
+	}
+}
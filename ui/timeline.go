@@ -0,0 +1,135 @@
+// This file handles the timeline page of the TUI. It lists every program that
+// was loaded, unloaded or had its attach point change since ebpfmon started.
+// Changes are only noticed when the program list is refreshed so a program
+// that is loaded and unloaded between two refreshes is never seen
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+type TimelineView struct {
+	table *tview.Table
+
+	// The number of events currently in the table and the time of the newest
+	// one
+	shown    int
+	lastTime time.Time
+}
+
+func NewTimelineView() *TimelineView {
+	v := &TimelineView{}
+	v.buildTable()
+	return v
+}
+
+func ownerPids(owners []utils.ProcessInfo) []int {
+	result := []int{}
+	for _, owner := range owners {
+		result = append(result, owner.Pid)
+	}
+	return result
+}
+
+func ownerComms(owners []utils.ProcessInfo) []string {
+	result := []string{}
+	for _, owner := range owners {
+		result = append(result, owner.Comm)
+	}
+	return result
+}
+
+var eventColors = map[string]tcell.Color{
+	utils.EventLoad:         tcell.ColorGreen,
+	utils.EventUnload:       tcell.ColorRed,
+	utils.EventAttachChange: tcell.ColorYellow,
+}
+
+// Add any new events to the table
+func (v *TimelineView) Update() {
+	lock.Lock()
+	events := make([]utils.ProgramEvent, len(Events))
+	copy(events, Events)
+	lock.Unlock()
+
+	tui.App.QueueUpdateDraw(func() {
+		v.setEvents(events)
+	})
+}
+
+func (v *TimelineView) setEvents(events []utils.ProgramEvent) {
+	// The oldest events get dropped once there are too many so the count
+	// alone doesn't say if there is anything new
+	if len(events) == v.shown && (len(events) == 0 || events[len(events)-1].Time.Equal(v.lastTime)) {
+		return
+	}
+	v.render(events)
+}
+
+func (v *TimelineView) render(events []utils.ProgramEvent) {
+	// Stay at the bottom if the newest event was selected
+	row, _ := v.table.GetSelection()
+	follow := row >= v.shown
+
+	// Old events may have been dropped so the whole table is rebuilt
+	v.table.Clear()
+	headers := []string{"Time", "Event", "Id", "Type", "Name", "Tag", "Owner", "Attach Point"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+	for i, event := range events {
+		owners := []string{}
+		for _, owner := range event.Owners {
+			owners = append(owners, fmt.Sprintf("%s(%d)", owner.Comm, owner.Pid))
+		}
+		attach := event.AttachPoint
+		if event.Type == utils.EventAttachChange {
+			attach = fmt.Sprintf("%s -> %s", event.PreviousAttachPoint, event.AttachPoint)
+		}
+
+		cells := []string{
+			event.Time.Format("15:04:05"),
+			event.Type,
+			strconv.Itoa(event.ProgramId),
+			event.ProgType,
+			event.Name,
+			event.Tag,
+			strings.Join(owners, ", "),
+			attach,
+		}
+		for j, cell := range cells {
+			tableCell := tview.NewTableCell(tview.Escape(cell))
+			if j == 1 {
+				tableCell.SetTextColor(eventColors[event.Type])
+			}
+			v.table.SetCell(i+1, j, tableCell)
+		}
+	}
+	v.shown = len(events)
+	if len(events) > 0 {
+		v.lastTime = events[len(events)-1].Time
+	}
+
+	if follow {
+		v.table.Select(v.shown, 0)
+	} else {
+		v.table.Select(row, 0)
+	}
+}
+
+func (v *TimelineView) buildTable() {
+	v.table = tview.NewTable()
+	v.table.SetBorder(true).SetTitle("Timeline")
+	v.table.SetSelectable(true, false)
+	v.table.SetFixed(1, 0)
+	v.render([]utils.ProgramEvent{})
+}
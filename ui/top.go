@@ -0,0 +1,187 @@
+// This file handles the top page of the TUI. It shows how much cpu each bpf
+// program is using based on the run time statistics the kernel collects when
+// kernel.bpf_stats_enabled is set. The rates are computed between each
+// refresh of the program list so the first refresh after enabling the stats
+// only shows the totals
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// The columns the top view can be sorted by
+const (
+	SortCpu  = 0
+	SortRuns = 1
+	SortAvg  = 2
+	SortId   = 3
+)
+
+var sortNames = []string{"cpu %", "runs/sec", "avg ns", "id"}
+
+type BpfTopView struct {
+	flex   *tview.Flex
+	table  *tview.Table
+	status *tview.TextView
+
+	// The snapshot the next rates are computed against. Only used by the
+	// update go routine
+	prev     map[int]utils.BpfProgram
+	prevTime time.Time
+
+	// Only used from the ui go routine
+	rates        []utils.ProgramRate
+	sortColumn   int
+	statsEnabled bool
+	statsErr     error
+}
+
+func NewBpfTopView(t *Tui) *BpfTopView {
+	v := &BpfTopView{prev: map[int]utils.BpfProgram{}}
+	v.buildTable(t)
+	v.buildStatus()
+	v.flex = tview.NewFlex().
+		SetDirection(tview.FlexRow).
+		AddItem(v.status, 3, 0, false).
+		AddItem(v.table, 0, 1, true)
+	v.statsEnabled, v.statsErr = utils.GetBpfStatsEnabled()
+	v.render()
+	return v
+}
+
+// Save the current programs as the baseline for the next rates without
+// drawing anything
+func (v *BpfTopView) snapshot() []utils.ProgramRate {
+	lock.Lock()
+	cur := make(map[int]utils.BpfProgram, len(Programs))
+	for id, p := range Programs {
+		cur[id] = p
+	}
+	lock.Unlock()
+
+	now := time.Now()
+	rates := utils.ComputeProgramRates(v.prev, cur, now.Sub(v.prevTime))
+	v.prev = cur
+	v.prevTime = now
+	return rates
+}
+
+// Compute the rates since the previous refresh and redraw the table. This is
+// called every time the program list is refreshed
+func (v *BpfTopView) Update() {
+	rates := v.snapshot()
+	enabled, err := utils.GetBpfStatsEnabled()
+	tui.App.QueueUpdateDraw(func() {
+		v.rates = rates
+		v.statsEnabled = enabled
+		v.statsErr = err
+		v.render()
+	})
+}
+
+// Sort the rates by the selected column. Everything but the id is sorted from
+// most to least expensive
+func (v *BpfTopView) sortRates() {
+	sort.Slice(v.rates, func(i, j int) bool {
+		a, b := v.rates[i], v.rates[j]
+		switch v.sortColumn {
+		case SortCpu:
+			if a.CpuPercent != b.CpuPercent {
+				return a.CpuPercent > b.CpuPercent
+			}
+		case SortRuns:
+			if a.RunsPerSec != b.RunsPerSec {
+				return a.RunsPerSec > b.RunsPerSec
+			}
+		case SortAvg:
+			if a.AvgRunNs != b.AvgRunNs {
+				return a.AvgRunNs > b.AvgRunNs
+			}
+		}
+		return a.Program.ProgramId < b.Program.ProgramId
+	})
+}
+
+func (v *BpfTopView) render() {
+	v.status.Clear()
+	if v.statsErr != nil {
+		fmt.Fprintf(v.status, "[blue]Stats:[-] unknown (%v)\n", v.statsErr)
+	} else if v.statsEnabled {
+		fmt.Fprintf(v.status, "[blue]Stats:[-] [green]enabled[-]\n")
+	} else {
+		fmt.Fprintf(v.status, "[blue]Stats:[-] [red]disabled[-]. Press 'e' to enable kernel.bpf_stats_enabled\n")
+	}
+	fmt.Fprintf(v.status, "[blue]Sorted by:[-] %s. Press 's' to change the sort order", sortNames[v.sortColumn])
+
+	v.sortRates()
+	row, _ := v.table.GetSelection()
+	v.table.Clear()
+	headers := []string{"Id", "Type", "Name", "Runs/s", "Avg ns", "Cpu %", "Runs", "Run time", "Recursion misses"}
+	for i, header := range headers {
+		v.table.SetCell(0, i, tview.NewTableCell(header).
+			SetSelectable(false).
+			SetTextColor(tcell.ColorBlue))
+	}
+	for i, rate := range v.rates {
+		p := rate.Program
+		cells := []string{
+			strconv.Itoa(p.ProgramId),
+			p.ProgType,
+			p.Name,
+			fmt.Sprintf("%.1f", rate.RunsPerSec),
+			fmt.Sprintf("%.0f", rate.AvgRunNs),
+			fmt.Sprintf("%.3f", rate.CpuPercent),
+			strconv.Itoa(p.RunCnt),
+			time.Duration(p.RunTimeNs).String(),
+			strconv.Itoa(p.RecursionMisses),
+		}
+		for j, cell := range cells {
+			tableCell := tview.NewTableCell(cell)
+			if j >= 3 {
+				tableCell.SetAlign(tview.AlignRight)
+			}
+			v.table.SetCell(i+1, j, tableCell)
+		}
+	}
+	if row < 1 {
+		row = 1
+	}
+	v.table.Select(row, 0)
+}
+
+func (v *BpfTopView) buildStatus() {
+	v.status = tview.NewTextView().SetDynamicColors(true)
+	v.status.SetBorder(true).SetTitle("Top")
+}
+
+func (v *BpfTopView) buildTable(t *Tui) {
+	v.table = tview.NewTable()
+	v.table.SetBorder(true).SetTitle("Programs")
+	v.table.SetSelectable(true, false)
+	v.table.SetFixed(1, 0)
+	v.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 's':
+			v.sortColumn = (v.sortColumn + 1) % len(sortNames)
+			v.render()
+			return nil
+		case 'e':
+			err := utils.SetBpfStatsEnabled(!v.statsEnabled)
+			if err != nil {
+				t.DisplayError(fmt.Sprintf("Failed to change kernel.bpf_stats_enabled\n%v", err))
+				return nil
+			}
+			v.statsEnabled, v.statsErr = utils.GetBpfStatsEnabled()
+			v.render()
+			return nil
+		}
+		return event
+	})
+}
@@ -0,0 +1,49 @@
+package ui
+
+import (
+	"ebpfmon/utils"
+	"testing"
+	"time"
+)
+
+func TestTopViewSort(t *testing.T) {
+	utils.SetBackend(newFakeBackend())
+	v := NewBpfTopView(&Tui{})
+
+	lock.Lock()
+	Programs = map[int]utils.BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", Name: "cheap", RunCnt: 1000, RunTimeNs: 1000},
+		2: {ProgramId: 2, Tag: "bbbb", Name: "expensive", RunCnt: 10, RunTimeNs: 100000},
+		3: {ProgramId: 3, Tag: "cccc", Name: "idle"},
+	}
+	lock.Unlock()
+	v.snapshot()
+
+	lock.Lock()
+	Programs = map[int]utils.BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", Name: "cheap", RunCnt: 3000, RunTimeNs: 3000},
+		2: {ProgramId: 2, Tag: "bbbb", Name: "expensive", RunCnt: 20, RunTimeNs: 200000},
+		3: {ProgramId: 3, Tag: "cccc", Name: "idle"},
+	}
+	lock.Unlock()
+	// Pretend the refresh happened a second later
+	v.prevTime = v.prevTime.Add(-time.Second)
+	v.rates = v.snapshot()
+
+	expected := map[int][]string{
+		SortCpu:  {"expensive", "cheap", "idle"},
+		SortRuns: {"cheap", "expensive", "idle"},
+		SortAvg:  {"expensive", "cheap", "idle"},
+		SortId:   {"cheap", "expensive", "idle"},
+	}
+	for column, names := range expected {
+		v.sortColumn = column
+		v.render()
+		for row, name := range names {
+			cell := v.table.GetCell(row+1, 2)
+			if cell.Text != name {
+				t.Errorf("Sorting by %s: expected %s in row %d, got %s", sortNames[column], name, row+1, cell.Text)
+			}
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// This page tails the kernel trace pipe where bpf_printk writes its output.
+// The trace pipe doesn't say which program printed a line so each line is
+// attributed to the programs that call bpf_trace_printk, narrowed down to the
+// ones owned by the process that was running if there are any. Pressing ENTER
+// on a line jumps to its program in the explorer
+package ui
+
+import (
+	"ebpfmon/utils"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// Only the newest lines are kept
+const maxTraceLines = 1000
+
+// How often new lines are added to the table
+const traceLogInterval = 250 * time.Millisecond
+
+// A line of the trace pipe along with the programs that may have printed it
+type traceEntry struct {
+	Line     utils.TraceLine
+	Programs []int
+}
+
+type TraceLogView struct {
+	flex   *tview.Flex
+	filter *tview.InputField
+	table  *tview.Table
+	app    *Tui
+
+	// The newest lines with the oldest one first
+	entries []traceEntry
+
+	// The entries that match the filter in the order they are shown
+	shown []traceEntry
+
+	// New lines are still read while paused but the table isn't updated
+	paused bool
+	missed int
+
+	// Set while the trace pipe is being read. Closing it stops the stream
+	stop chan struct{}
+}
+
+// Get the text of the program column. Lines with several candidates get a
+// question mark since any of them may have printed the line
+func traceProgramsText(programs []int) string {
+	ids := []string{}
+	for _, id := range programs {
+		ids = append(ids, strconv.Itoa(id))
+	}
+	text := strings.Join(ids, ",")
+	if len(programs) > 1 {
+		text += "?"
+	}
+	return text
+}
+
+// Check if a line contains the filter in its comm, pid, programs or message.
+// The filter isn't case sensitive
+func (e traceEntry) matches(filter string) bool {
+	if filter == "" {
+		return true
+	}
+	filter = strings.ToLower(filter)
+	for _, text := range []string{e.Line.Comm, strconv.Itoa(e.Line.Pid), traceProgramsText(e.Programs), e.Line.Message} {
+		if strings.Contains(strings.ToLower(text), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add new lines and redraw the table unless the view is paused
+func (v *TraceLogView) addLines(entries []traceEntry) {
+	v.entries = append(v.entries, entries...)
+	if len(v.entries) > maxTraceLines {
+		v.entries = v.entries[len(v.entries)-maxTraceLines:]
+	}
+	if v.paused {
+		v.missed += len(entries)
+		v.updateTitle()
+		return
+	}
+	if len(entries) > 0 {
+		v.updateTable()
+	}
+}
+
+func (v *TraceLogView) updateTitle() {
+	title := "Trace pipe (/: filter, p: pause, c: clear, ENTER: go to program)"
+	if v.stop == nil {
+		title += " [stopped]"
+	} else if v.paused {
+		title += fmt.Sprintf(" [paused, %d new lines]", v.missed)
+	}
+	v.table.SetTitle(title)
+}
+
+// Show the lines that match the filter with the newest one first
+func (v *TraceLogView) updateTable() {
+	v.table.Clear()
+	for column, header := range []string{"Time", "CPU", "Comm", "Pid", "Program", "Message"} {
+		v.table.SetCell(0, column, tview.NewTableCell(header).SetSelectable(false).SetTextColor(tcell.ColorYellow))
+	}
+
+	filter := v.filter.GetText()
+	v.shown = []traceEntry{}
+	for i := len(v.entries) - 1; i >= 0; i-- {
+		if v.entries[i].matches(filter) {
+			v.shown = append(v.shown, v.entries[i])
+		}
+	}
+
+	for row, e := range v.shown {
+		cpu, pid := "-", "-"
+		if e.Line.Cpu >= 0 {
+			cpu = strconv.Itoa(e.Line.Cpu)
+		}
+		if e.Line.Pid >= 0 {
+			pid = strconv.Itoa(e.Line.Pid)
+		}
+		cells := []string{e.Line.Time.Format("15:04:05.000"), cpu, e.Line.Comm, pid, traceProgramsText(e.Programs), e.Line.Message}
+		for column, text := range cells {
+			v.table.SetCell(row+1, column, tview.NewTableCell(tview.Escape(text)))
+		}
+	}
+	v.updateTitle()
+}
+
+// Start reading the trace pipe in the background
+func (v *TraceLogView) Start() {
+	if v.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	v.stop = stop
+	v.updateTitle()
+
+	lines := make(chan utils.TraceLine, 256)
+	go func() {
+		err := utils.StreamTraceLog(lines, stop)
+		v.app.App.QueueUpdateDraw(func() {
+			// The stream may have been stopped or restarted in the meantime
+			if v.stop != stop {
+				return
+			}
+			v.Stop()
+			if err != nil {
+				v.app.DisplayError(fmt.Sprintf("Failed to read the trace pipe: %v", err))
+			}
+		})
+	}()
+	go v.receive(lines, stop)
+}
+
+// Collect lines and add them to the table every traceLogInterval. The
+// stream is stopped once the user switches to another page
+func (v *TraceLogView) receive(lines <-chan utils.TraceLine, stop chan struct{}) {
+	ticker := time.NewTicker(traceLogInterval)
+	defer ticker.Stop()
+	pending := []utils.TraceLine{}
+	for {
+		select {
+		case <-stop:
+			return
+		case line := <-lines:
+			pending = append(pending, line)
+			continue
+		case <-ticker.C:
+		}
+
+		lock.Lock()
+		programs := make(map[int]utils.BpfProgram, len(Programs))
+		for id, p := range Programs {
+			programs[id] = p
+		}
+		lock.Unlock()
+
+		batch := []traceEntry{}
+		for _, line := range pending {
+			batch = append(batch, traceEntry{Line: line, Programs: utils.AttributeTraceLine(line, programs)})
+		}
+		pending = []utils.TraceLine{}
+
+		v.app.App.QueueUpdateDraw(func() {
+			if v.stop != stop {
+				return
+			}
+			page, _ := v.app.pages.GetFrontPage()
+			if page != "tracelog" && page != "help" && page != "error" {
+				v.Stop()
+				return
+			}
+			v.addLines(batch)
+		})
+	}
+}
+
+// Stop reading the trace pipe
+func (v *TraceLogView) Stop() {
+	if v.stop == nil {
+		return
+	}
+	close(v.stop)
+	v.stop = nil
+	v.updateTitle()
+}
+
+// Switch to the explorer and show the program that printed the selected line.
+// The first one is used if there are several candidates
+func (v *TraceLogView) gotoProgram(row int) {
+	if row <= 0 || row > len(v.shown) {
+		return
+	}
+	programs := v.shown[row-1].Programs
+	if len(programs) == 0 {
+		v.app.DisplayError("No loaded program calls bpf_trace_printk so the line can't be attributed")
+		return
+	}
+	v.Stop()
+	v.app.pages.SwitchToPage("programs")
+	v.app.App.SetFocus(v.app.bpfExplorerView.programList)
+	if !v.app.bpfExplorerView.ShowProgram(programs[0]) {
+		v.app.DisplayError(fmt.Sprintf("Program %d is no longer loaded", programs[0]))
+	}
+}
+
+func (v *TraceLogView) buildTable() {
+	v.table = tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+	v.table.SetBorder(true)
+	v.table.SetSelectedFunc(func(row int, column int) {
+		v.gotoProgram(row)
+	})
+	v.table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case '/':
+			v.app.App.SetFocus(v.filter)
+		case 'p':
+			v.paused = !v.paused
+			v.missed = 0
+			v.updateTable()
+		case 'c':
+			v.entries = nil
+			v.updateTable()
+		default:
+			return event
+		}
+		return nil
+	})
+	v.updateTable()
+}
+
+func (v *TraceLogView) buildFilter() {
+	v.filter = tview.NewInputField().SetLabel("Filter: ")
+	v.filter.SetChangedFunc(func(text string) {
+		v.updateTable()
+	})
+	v.filter.SetDoneFunc(func(key tcell.Key) {
+		v.app.App.SetFocus(v.table)
+	})
+}
+
+func NewTraceLogView(t *Tui) *TraceLogView {
+	v := &TraceLogView{app: t}
+	v.buildFilter()
+	v.buildTable()
+	v.flex = tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(v.filter, 1, 0, false).
+		AddItem(v.table, 0, 1, true)
+	return v
+}
@@ -0,0 +1,34 @@
+package ui
+
+import (
+	"ebpfmon/utils"
+	"testing"
+)
+
+func TestTraceLogView(t *testing.T) {
+	v := NewTraceLogView(&Tui{})
+	v.addLines([]traceEntry{
+		{Line: utils.ParseTraceLine("bash-10 [001] .... 1.0: bpf_trace_printk: open /etc/passwd"), Programs: []int{4}},
+		{Line: utils.ParseTraceLine("curl-20 [000] .... 2.0: bpf_trace_printk: connect"), Programs: []int{4, 7}},
+	})
+	if v.table.GetRowCount() != 3 || v.table.GetCell(1, 2).Text != "curl" || v.table.GetCell(1, 4).Text != "4,7?" {
+		t.Fatalf("Expected the newest line first, got %d rows", v.table.GetRowCount())
+	}
+
+	v.filter.SetText("PASSWD")
+	if v.table.GetRowCount() != 2 || v.table.GetCell(1, 5).Text != "open /etc/passwd" {
+		t.Errorf("Expected only the matching line, got %d rows", v.table.GetRowCount())
+	}
+	v.filter.SetText("")
+
+	v.paused = true
+	v.addLines([]traceEntry{{Line: utils.ParseTraceLine("sh-30 [000] .... 3.0: bpf_trace_printk: exec")}})
+	if v.table.GetRowCount() != 3 || v.missed != 1 {
+		t.Errorf("Expected the table to stay the same while paused, got %d rows and %d missed", v.table.GetRowCount(), v.missed)
+	}
+	v.paused = false
+	v.updateTable()
+	if v.table.GetRowCount() != 4 {
+		t.Errorf("Expected the missed line after resuming, got %d rows", v.table.GetRowCount())
+	}
+}
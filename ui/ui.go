@@ -5,6 +5,7 @@
 package ui
 
 import (
+	"ebpfmon/rules"
 	"ebpfmon/utils"
 	"fmt"
 	"sync"
@@ -16,31 +17,58 @@ import (
 )
 
 var Programs map[int]utils.BpfProgram
-var BpftoolPath string
+
+// Everything that changed between refreshes of Programs. Guarded by lock
+var Events []utils.ProgramEvent
+var tracker = utils.NewProgramTracker()
+
+// The rules programs are checked against. nil if no rules file was given
+var Rules *rules.RuleSet
+
+// Every alert raised since ebpfmon started. Guarded by lock
+var Alerts []AlertEntry
+
+// The alerts of the currently loaded programs keyed by program id and the
+// alerts that were already raised keyed by program id, tag and rule. Guarded
+// by lock
+var programAlerts = map[int][]rules.Alert{}
+var raisedAlerts = map[string]bool{}
+
+// The baseline programs and maps are compared against. nil if no baseline
+// was given
+var Baseline *utils.Baseline
+
+// The current differences from the baseline and the kind of drift of each
+// program keyed by program id. Guarded by lock
+var Drift []utils.Drift
+var programDrift = map[int]string{}
+
+// Set when the last drift check ran without all of the attach points so
+// some of the drift may only be missing information. Guarded by lock
+var driftIncomplete bool
+
+// The oldest events and alerts are dropped once there are more than this
+const maxEvents = 10000
+
 var lock sync.Mutex
 var previousPage string
 var featureInfo string
 
-type FlowDissectorInfo struct {
-	DevName string `json:"devname"`
-	IfIndex int    `json:"ifindex"`
-	Id      int    `json:"id"`
-}
-
-type TcInfo struct {
-	DevName string `json:"devname"`
-	IfIndex int    `json:"ifindex"`
-	Kind    string `json:"kind"`
-	Name    string `json:"name"`
-	Id      int    `json:"id"`
-}
-
 type Tui struct {
 	App             *tview.Application
 	pages           *tview.Pages
 	bpfExplorerView *BpfExplorerView
 	bpfMapTableView *BpfMapTableView
+	mapEventsView   *MapEventsView
+	traceLogView    *TraceLogView
+	tailCallView    *TailCallView
+	linksView       *LinksView
+	btfView         *BtfView
 	bpfFeatureview  *BpfFeatureView
+	bpfTopView      *BpfTopView
+	timelineView    *TimelineView
+	alertsView      *AlertsView
+	driftView       *DriftView
 	helpView        *HelpView
 	errorView       *ErrorView
 }
@@ -52,9 +80,8 @@ func (t *Tui) DisplayError(err string) {
 	t.pages.SwitchToPage("error")
 }
 
-func NewTui(bpftoolPath string) *Tui {
+func NewTui() *Tui {
 	Programs = map[int]utils.BpfProgram{}
-	BpftoolPath = bpftoolPath
 
 	// Initialize the global page manager and the application
 	app := NewApp()
@@ -65,15 +92,34 @@ func NewTui(bpftoolPath string) *Tui {
 	tui.bpfExplorerView = NewBpfExplorerView(tui)
 	tui.bpfFeatureview = NewBpfFeatureView(tui)
 	tui.bpfMapTableView = NewBpfMapTableView(tui)
+	tui.mapEventsView = NewMapEventsView(tui)
 	tui.helpView = NewHelpView()
 	tui.errorView = NewErrorView()
 
 	fmt.Println("Collecting bpf information. This may take a few seconds")
 	updateBpfPrograms()
 
+	// The top view needs the programs as a baseline for its first rates
+	tui.bpfTopView = NewBpfTopView(tui)
+	tui.bpfTopView.snapshot()
+	tui.timelineView = NewTimelineView()
+	tui.alertsView = NewAlertsView()
+	tui.driftView = NewDriftView()
+	tui.traceLogView = NewTraceLogView(tui)
+	tui.tailCallView = NewTailCallView(tui)
+	tui.linksView = NewLinksView(tui)
+	tui.btfView = NewBtfView(tui)
+
 	// Set up proper page navigation and global quit key
 	// In page navigation happens in their respective files
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Keys typed into an input field (file names, btf types etc) must not
+		// quit or switch pages. That includes the Ctrl keys the input field
+		// edits with (i.e. Ctrl-K deletes to the end of the line)
+		if _, ok := app.GetFocus().(*tview.InputField); ok {
+			return event
+		}
+
 		// Set up q quit key and page navigation
 		if event.Rune() == 'q' || event.Rune() == 'Q' {
 			app.Stop()
@@ -98,6 +144,74 @@ func NewTui(bpftoolPath string) *Tui {
 			// Set focus to the input field
 			app.SetFocus(tui.bpfFeatureview.flex.GetItem(0))
 			return nil
+		} else if event.Key() == tcell.KeyCtrlT {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("top")
+			app.SetFocus(tui.bpfTopView.table)
+			return nil
+		} else if event.Key() == tcell.KeyCtrlL {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("timeline")
+			app.SetFocus(tui.timelineView.table)
+			return nil
+		} else if event.Key() == tcell.KeyCtrlR {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("alerts")
+			app.SetFocus(tui.alertsView.table)
+			return nil
+		} else if event.Key() == tcell.KeyCtrlG {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("drift")
+			app.SetFocus(tui.driftView.table)
+			return nil
+		} else if event.Key() == tcell.KeyCtrlP {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("tracelog")
+			app.SetFocus(tui.traceLogView.table)
+			tui.traceLogView.Start()
+			return nil
+		} else if event.Key() == tcell.KeyCtrlK {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("tailcalls")
+			app.SetFocus(tui.tailCallView.tree)
+			tui.tailCallView.Update()
+			return nil
+		} else if event.Key() == tcell.KeyCtrlN {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("links")
+			app.SetFocus(tui.linksView.table)
+			tui.linksView.Update()
+			return nil
+		} else if event.Key() == tcell.KeyCtrlB {
+			page, _ := pages.GetFrontPage()
+			if page != "help" {
+				previousPage = page
+			}
+			pages.SwitchToPage("btf")
+			app.SetFocus(tui.btfView.objects)
+			tui.btfView.Update()
+			return nil
 		} else if event.Key() == tcell.KeyF1 || event.Rune() == '?' {
 			name, _ := pages.GetFrontPage()
 			if name == "help" {
@@ -114,7 +228,7 @@ func NewTui(bpftoolPath string) *Tui {
 			return nil
 		} else if event.Key() == tcell.KeyESC {
 			name, prim := pages.GetFrontPage()
-			if name == "maptable" {
+			if name == "maptable" || name == "mapevents" {
 				return event
 			}
 			pages.SwitchToPage(previousPage)
@@ -130,8 +244,27 @@ func NewTui(bpftoolPath string) *Tui {
 	pages.AddPage("help", tui.helpView.modal, true, false)
 	pages.AddPage("features", tui.bpfFeatureview.flex, true, false)
 	pages.AddPage("maptable", tui.bpfMapTableView.pages, true, false)
+	pages.AddPage("mapevents", tui.mapEventsView.pages, true, false)
+	pages.AddPage("top", tui.bpfTopView.flex, true, false)
+	pages.AddPage("timeline", tui.timelineView.table, true, false)
+	pages.AddPage("alerts", tui.alertsView.table, true, false)
+	pages.AddPage("drift", tui.driftView.table, true, false)
+	pages.AddPage("tracelog", tui.traceLogView.flex, true, false)
+	pages.AddPage("tailcalls", tui.tailCallView.tree, true, false)
+	pages.AddPage("links", tui.linksView.table, true, false)
+	pages.AddPage("btf", tui.btfView.flex, true, false)
+	pages.AddPage("cfgexport", tui.bpfExplorerView.exportForm, true, false)
 	pages.AddPage("error", tui.errorView.modal, true, false)
 
+	// A watched map is dumped every second so the watch stops once another
+	// page is opened. The help and errors are shown on top of the map
+	pages.SetChangedFunc(func() {
+		name, _ := pages.GetFrontPage()
+		if name != "maptable" && name != "help" && name != "error" {
+			tui.bpfMapTableView.leave()
+		}
+	})
+
 	// Set starting page as previous page
 	previousPage = "programs"
 
@@ -146,5 +279,8 @@ func NewTui(bpftoolPath string) *Tui {
 
 func NewApp() *tview.Application {
 	app := tview.NewApplication()
+
+	// The mouse is used to follow the links in the disassembly
+	app.EnableMouse(true)
 	return app
 }
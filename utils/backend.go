@@ -0,0 +1,103 @@
+// The utils/backend.go file defines the interface that sits between ebpfmon
+// and whatever is actually used to gather information about bpf programs and
+// maps. The default implementation shells out to bpftool but any type that
+// satisfies the Backend interface can be plugged in instead
+package utils
+
+import (
+	"errors"
+	"sync"
+)
+
+// Returned when a backend has no way of providing some piece of information
+var ErrNotSupported = errors.New("not supported by this backend")
+
+// A Backend is a source of information about the bpf programs, maps and
+// attachments that are present on a system
+type Backend interface {
+	// List every bpf program that is loaded
+	Programs() ([]BpfProgram, error)
+
+	// List every bpf map that exists
+	Maps() ([]BpfMap, error)
+
+	// Dump all the entries of a map
+	MapEntries(mapId int) ([]BpfMapEntry, error)
+
+	// Create or update a single map entry
+	UpdateMapEntry(mapId int, key []byte, value []byte) error
+
+	// Set a different value for every cpu of a per cpu map entry
+	UpdateMapEntryValues(mapId int, key []byte, values [][]byte) error
+
+	// Delete a single map entry
+	DeleteMapEntry(mapId int, key []byte) error
+
+	// Get the btf of a map along with the types of its key and value
+	MapBtf(mapId int) (*MapBtf, error)
+
+	// Get every type of a btf object
+	Btf(btfId int) (*Btf, error)
+
+	// List the btf objects (vmlinux, kernel modules and the btf loaded with
+	// programs and maps)
+	BtfObjects() ([]BtfObject, error)
+
+	// Render the types of a btf object as C
+	BtfC(btfId int) (string, error)
+
+	// Read the records of a ringbuf or perf event array until stop is
+	// closed. This blocks until the stream ends
+	MapEvents(m BpfMap, events chan<- MapEvent, stop <-chan struct{}) error
+
+	// Read the lines bpf programs print to the trace pipe until stop is
+	// closed. This blocks until the stream ends
+	TraceLog(lines chan<- TraceLine, stop <-chan struct{}) error
+
+	// Get the disassembly of the xlated instructions of a program
+	ProgramDisassembly(progId int) ([]string, error)
+
+	// Get the disassembly of the native code the program was jit compiled to
+	ProgramJitedDisassembly(progId int) ([]string, error)
+
+	// List the programs attached to network devices (xdp, tc, flow dissector)
+	NetInfo() ([]NetInfo, error)
+
+	// List the programs attached to cgroups
+	CgroupInfo() ([]CgroupInfo, error)
+
+	// List the programs attached through perf events (kprobes, uprobes,
+	// tracepoints etc)
+	PerfInfo() ([]PerfInfo, error)
+
+	// List the bpf links (fentry, lsm, iter, struct_ops, netfilter, tcx etc)
+	Links() ([]BpfLink, error)
+
+	// Probe the bpf related features of the kernel. The result is human
+	// readable text
+	Features() (string, error)
+
+	// Check if the kernel is collecting run time statistics (run_cnt,
+	// run_time_ns) for programs
+	StatsEnabled() (bool, error)
+
+	// Turn the collection of run time statistics on or off
+	SetStatsEnabled(enabled bool) error
+}
+
+var backend Backend = &BpftoolBackend{}
+var backendLock sync.RWMutex
+
+// Set the backend that is used by all the Get* functions in this package
+func SetBackend(b Backend) {
+	backendLock.Lock()
+	defer backendLock.Unlock()
+	backend = b
+}
+
+// Get the backend that is currently in use
+func CurrentBackend() Backend {
+	backendLock.RLock()
+	defer backendLock.RUnlock()
+	return backend
+}
@@ -0,0 +1,273 @@
+// The utils/baseline.go file saves the programs and maps that are loaded on a
+// known good host and compares a live system against them. Program and map ids
+// differ between hosts (and reboots) so programs are identified by their
+// type, name and attach point and maps by their name and type instead. The tag
+// of a program is compared so changes to its code show up as drift
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DriftNew     = "new"
+	DriftMissing = "missing"
+	DriftChanged = "changed"
+)
+
+type BaselineProgram struct {
+	Tag      string `json:"tag"`
+	Name     string `json:"name,omitempty"`
+	ProgType string `json:"type"`
+
+	// Everywhere the program is attached
+	AttachPoint string `json:"attach_point,omitempty"`
+
+	// The executables of the processes that own the program
+	OwnerPaths []string `json:"owner_paths,omitempty"`
+}
+
+// The identity of the program. Programs with the same key are the same
+// program even if they were loaded on different hosts. The tag isn't part of
+// it since a program whose code changed is still the same program
+func (p BaselineProgram) Key() string {
+	key := p.ProgType + "/" + p.Name
+	if p.AttachPoint != "" {
+		key += "@" + p.AttachPoint
+	}
+	return key
+}
+
+// How the program is set up. Programs with the same key but a different
+// variant have changed (i.e. their code or owner)
+func (p BaselineProgram) variant() string {
+	variant := "tag " + p.Tag
+	if len(p.OwnerPaths) > 0 {
+		variant += " owned by " + strings.Join(p.OwnerPaths, ", ")
+	}
+	return variant
+}
+
+type BaselineMap struct {
+	Name       string `json:"name,omitempty"`
+	Type       string `json:"type"`
+	KeySize    int    `json:"bytes_key"`
+	ValueSize  int    `json:"bytes_value"`
+	MaxEntries int    `json:"max_entries"`
+}
+
+func (m BaselineMap) Key() string {
+	return m.Type + "/" + m.Name
+}
+
+func (m BaselineMap) variant() string {
+	return fmt.Sprintf("key %d bytes, value %d bytes, %d max entries", m.KeySize, m.ValueSize, m.MaxEntries)
+}
+
+type Baseline struct {
+	Created  time.Time         `json:"created"`
+	Hostname string            `json:"hostname,omitempty"`
+	Programs []BaselineProgram `json:"programs"`
+	Maps     []BaselineMap     `json:"maps"`
+}
+
+// A difference between a baseline and the live system
+type Drift struct {
+	// One of new, missing or changed
+	Kind string `json:"kind"`
+
+	// Either program or map
+	Object string `json:"object"`
+
+	// The identity of the program or map i.e. kprobe/name@do_sys_open
+	Key string `json:"key"`
+
+	// The ids of the live programs or maps. Empty for missing ones
+	Ids []int `json:"ids,omitempty"`
+
+	// What the baseline expected and what was found. Only set for changes
+	Expected []string `json:"expected,omitempty"`
+	Actual   []string `json:"actual,omitempty"`
+}
+
+func (d Drift) String() string {
+	result := fmt.Sprintf("%s %s %s", d.Kind, d.Object, d.Key)
+	if len(d.Ids) > 0 {
+		result += fmt.Sprintf(" (ids %v)", d.Ids)
+	}
+	if d.Kind == DriftChanged {
+		result += fmt.Sprintf(": expected [%s] got [%s]", strings.Join(d.Expected, "; "), strings.Join(d.Actual, "; "))
+	}
+	return result
+}
+
+func newBaselineProgram(p BpfProgram) BaselineProgram {
+	result := BaselineProgram{
+		Tag:         p.Tag,
+		Name:        p.Name,
+		ProgType:    p.ProgType,
+		AttachPoint: p.AttachSummary(),
+	}
+	seen := map[string]bool{}
+	for _, pid := range p.Pids {
+		if pid.Path != "" && !seen[pid.Path] {
+			seen[pid.Path] = true
+			result.OwnerPaths = append(result.OwnerPaths, pid.Path)
+		}
+	}
+	sort.Strings(result.OwnerPaths)
+	return result
+}
+
+func newBaselineMap(m BpfMap) BaselineMap {
+	return BaselineMap{
+		Name:       m.Name,
+		Type:       m.Type,
+		KeySize:    m.KeySize,
+		ValueSize:  m.ValueSize,
+		MaxEntries: m.MaxEntries,
+	}
+}
+
+// Build a baseline from the programs and maps that are currently loaded
+func NewBaseline(programs map[int]BpfProgram, maps []BpfMap) Baseline {
+	hostname, _ := os.Hostname()
+	baseline := Baseline{
+		Created:  time.Now(),
+		Hostname: hostname,
+		Programs: []BaselineProgram{},
+		Maps:     []BaselineMap{},
+	}
+	for _, p := range programs {
+		baseline.Programs = append(baseline.Programs, newBaselineProgram(p))
+	}
+	sort.Slice(baseline.Programs, func(i, j int) bool {
+		return baseline.Programs[i].Key() < baseline.Programs[j].Key()
+	})
+	for _, m := range maps {
+		baseline.Maps = append(baseline.Maps, newBaselineMap(m))
+	}
+	sort.Slice(baseline.Maps, func(i, j int) bool {
+		return baseline.Maps[i].Key() < baseline.Maps[j].Key()
+	})
+	return baseline
+}
+
+func SaveBaseline(path string, baseline Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func LoadBaseline(path string) (Baseline, error) {
+	baseline := Baseline{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return baseline, err
+	}
+	err = json.Unmarshal(data, &baseline)
+	if err != nil {
+		return baseline, fmt.Errorf("failed to parse baseline %s: %v", path, err)
+	}
+	return baseline, nil
+}
+
+// The variants and ids of every object with the same key
+type driftGroup struct {
+	variants map[string]bool
+	ids      []int
+}
+
+func (g *driftGroup) add(variant string, id int) {
+	g.variants[variant] = true
+	if id != 0 {
+		g.ids = append(g.ids, id)
+	}
+}
+
+func (g *driftGroup) sortedVariants() []string {
+	result := []string{}
+	for v := range g.variants {
+		result = append(result, v)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Compare two sets of groups. The same key can be present several times (i.e.
+// the same program loaded twice) so only the set of variants is compared
+func diffGroups(object string, expected map[string]*driftGroup, actual map[string]*driftGroup) []Drift {
+	result := []Drift{}
+	for key, want := range expected {
+		got, ok := actual[key]
+		if !ok {
+			result = append(result, Drift{Kind: DriftMissing, Object: object, Key: key})
+			continue
+		}
+		wantVariants := want.sortedVariants()
+		gotVariants := got.sortedVariants()
+		if strings.Join(wantVariants, "\n") != strings.Join(gotVariants, "\n") {
+			result = append(result, Drift{Kind: DriftChanged, Object: object, Key: key, Ids: got.ids, Expected: wantVariants, Actual: gotVariants})
+		}
+	}
+	for key, got := range actual {
+		if _, ok := expected[key]; !ok {
+			result = append(result, Drift{Kind: DriftNew, Object: object, Key: key, Ids: got.ids})
+		}
+	}
+	return result
+}
+
+func groupFor(groups map[string]*driftGroup, key string) *driftGroup {
+	g, ok := groups[key]
+	if !ok {
+		g = &driftGroup{variants: map[string]bool{}}
+		groups[key] = g
+	}
+	return g
+}
+
+// Compare the live programs and maps against the baseline. The result is
+// sorted by object and key
+func (b Baseline) Check(programs map[int]BpfProgram, maps []BpfMap) []Drift {
+	expected := map[string]*driftGroup{}
+	for _, p := range b.Programs {
+		groupFor(expected, p.Key()).add(p.variant(), 0)
+	}
+	actual := map[string]*driftGroup{}
+	ids := make([]int, 0, len(programs))
+	for id := range programs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		p := newBaselineProgram(programs[id])
+		groupFor(actual, p.Key()).add(p.variant(), id)
+	}
+	result := diffGroups("program", expected, actual)
+
+	expected = map[string]*driftGroup{}
+	for _, m := range b.Maps {
+		groupFor(expected, m.Key()).add(m.variant(), 0)
+	}
+	actual = map[string]*driftGroup{}
+	for _, m := range maps {
+		groupFor(actual, newBaselineMap(m).Key()).add(newBaselineMap(m).variant(), m.Id)
+	}
+	result = append(result, diffGroups("map", expected, actual)...)
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Object != result[j].Object {
+			return result[i].Object > result[j].Object
+		}
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBaselineCheck(t *testing.T) {
+	owner := []ProcessInfo{{Pid: 10, Comm: "agent", Path: "/usr/bin/agent"}}
+	golden := map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", Name: "open", ProgType: "kprobe", AttachPoint: []string{"do_sys_open"}, Pids: owner},
+		2: {ProgramId: 2, Tag: "bbbb", Name: "fw", ProgType: "xdp", Interface: "eth0"},
+		3: {ProgramId: 3, Tag: "cccc", Name: "exec", ProgType: "tracepoint"},
+	}
+	goldenMaps := []BpfMap{
+		{Id: 1, Name: "events", Type: "ringbuf", MaxEntries: 4096},
+		{Id: 2, Name: "counts", Type: "hash", KeySize: 4, ValueSize: 8, MaxEntries: 16},
+	}
+
+	path := filepath.Join(t.TempDir(), "baseline.json")
+	err := SaveBaseline(path, NewBaseline(golden, goldenMaps))
+	if err != nil {
+		t.Fatalf("Failed to save baseline: %v", err)
+	}
+	baseline, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("Failed to load baseline: %v", err)
+	}
+	if len(baseline.Programs) != 3 || len(baseline.Maps) != 2 {
+		t.Fatalf("Unexpected baseline %+v", baseline)
+	}
+
+	// The same programs with different ids are not drift
+	live := map[int]BpfProgram{}
+	for id, p := range golden {
+		p.ProgramId = id + 100
+		live[id+100] = p
+	}
+	drift := baseline.Check(live, goldenMaps)
+	if len(drift) != 0 {
+		t.Fatalf("Expected no drift, got %v", drift)
+	}
+
+	// The kprobe is owned by another binary, the code of the tracepoint
+	// changed, the xdp program is gone, a new program was loaded and the
+	// hash map grew
+	live = map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", Name: "open", ProgType: "kprobe", AttachPoint: []string{"do_sys_open"}, Pids: []ProcessInfo{{Pid: 11, Path: "/tmp/agent"}}},
+		3: {ProgramId: 3, Tag: "ffff", Name: "exec", ProgType: "tracepoint"},
+		4: {ProgramId: 4, Tag: "dddd", Name: "rootkit", ProgType: "kprobe"},
+	}
+	liveMaps := []BpfMap{
+		goldenMaps[0],
+		{Id: 2, Name: "counts", Type: "hash", KeySize: 4, ValueSize: 8, MaxEntries: 1024},
+	}
+	drift = baseline.Check(live, liveMaps)
+	expected := []struct {
+		kind string
+		key  string
+	}{
+		{DriftChanged, "kprobe/open@do_sys_open"},
+		{DriftNew, "kprobe/rootkit"},
+		{DriftChanged, "tracepoint/exec"},
+		{DriftMissing, "xdp/fw@eth0"},
+		{DriftChanged, "hash/counts"},
+	}
+	if len(drift) != len(expected) {
+		t.Fatalf("Expected %d differences, got %v", len(expected), drift)
+	}
+	for i, e := range expected {
+		if drift[i].Kind != e.kind || drift[i].Key != e.key {
+			t.Errorf("Expected %s %s, got %s", e.kind, e.key, drift[i])
+		}
+	}
+	if len(drift[1].Ids) != 1 || drift[1].Ids[0] != 4 {
+		t.Errorf("Expected the id of the new program, got %v", drift[1].Ids)
+	}
+	if len(drift[2].Expected) != 1 || drift[2].Expected[0] != "tag cccc" || drift[2].Actual[0] != "tag ffff" {
+		t.Errorf("Expected the tags of the changed program, got %s", drift[2])
+	}
+}
@@ -1,27 +1,75 @@
 // The utils/bpf.go file is for implementing code that handles some of the
-// specifics for getting information about bpf programs and maps. This includes
-// parsing the output of the bpftool binary.
+// specifics for getting information about bpf programs and maps. The actual
+// information is gathered by the current Backend (see backend.go)
 package utils
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
-	"strconv"
 	"strings"
 )
 
-var BpftoolPath string
-
 type ProcessInfo struct {
 	Pid     int    `json:"pid"`
 	Comm    string `json:"comm"`
-	Cmdline string
-	Path    string
-	Uid     int
-	Gid     int
+	Cmdline string `json:"cmdline,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Uid     int    `json:"uid,omitempty"`
+	Gid     int    `json:"gid,omitempty"`
+}
+
+type CgroupProgram struct {
+	Id          int    `json:"id"`
+	AttachType  string `json:"attach_type"`
+	AttachFlags string `json:"attach_flags"`
+	Name        string `json:"name"`
+}
+
+type CgroupInfo struct {
+	Cgroup   string          `json:"cgroup"`
+	Programs []CgroupProgram `json:"programs"`
+}
+
+type XdpInfo struct {
+	DevName string `json:"devname"`
+	IfIndex int    `json:"ifindex"`
+	Mode    string `json:"mode"`
+	Id      int    `json:"id"`
+}
+
+type TcInfo struct {
+	DevName string `json:"devname"`
+	IfIndex int    `json:"ifindex"`
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Id      int    `json:"id"`
+}
+
+type FlowDissectorInfo struct {
+	DevName string `json:"devname"`
+	IfIndex int    `json:"ifindex"`
+	Id      int    `json:"id"`
+}
+
+type NetInfo struct {
+	Xdp           []XdpInfo           `json:"xdp"`
+	Tc            []TcInfo            `json:"tc"`
+	FlowDissector []FlowDissectorInfo `json:"flow_dissector"`
+}
+
+type PerfInfo struct {
+	Pid        int    `json:"pid"`
+	Fd         int    `json:"fd"`
+	ProgId     int    `json:"prog_id"`
+	FdType     string `json:"fd_type"`
+	Func       string `json:"func,omitempty"`
+	Offset     int    `json:"offset,omitempty"`
+	Filename   string `json:"filename,omitempty"`
+	Tracepoint string `json:"tracepoint,omitempty"`
 }
 
 type BpfMap struct {
@@ -32,7 +80,7 @@ type BpfMap struct {
 	Type string `json:"type"`
 
 	// The name of the map if present
-	Name string `json:"name",omitempty`
+	Name string `json:"name,omitempty"`
 
 	// Any flags that are set on the map
 	Flags int `json:"flags"`
@@ -50,13 +98,13 @@ type BpfMap struct {
 	Memlock int `json:"bytes_memlock"`
 
 	// The btf id referenced by the map
-	BtfId int `json:"btf_id",omitempty`
+	BtfId int `json:"btf_id,omitempty"`
 
 	// The state of the map. Examples could be frozen, pinned etc
-	Frozen int `json:"frozen",omitempty`
+	Frozen int `json:"frozen,omitempty"`
 
 	// If the map is pinned the path will be here
-	Pinned []string `json:"pinned",omitempty`
+	Pinned []string `json:"pinned,omitempty"`
 }
 
 type BpfMapEntryRaw struct {
@@ -66,30 +114,53 @@ type BpfMapEntryRaw struct {
 	// The value of the map entry
 	Value []string `json:"value"`
 
-	// The formatted value of the map entry if it exists
-	Formatted struct {
-		// Value can be a variety of things
-		Value interface{} `json:"value"`
-	} `json:"formatted",omitempty`
+	// The value of each cpu for per cpu maps. bpftool doesn't set value for
+	// these
+	Values []BpfMapCpuValueRaw `json:"values,omitempty"`
+
+	// The formatted key and value of the map entry if the map has btf
+	Formatted *BpfMapEntryFormatted `json:"formatted,omitempty"`
+
+	// The id of the inner map for maps of maps. bpftool doesn't set value for
+	// these
+	InnerMapId *int `json:"inner_map_id,omitempty"`
+}
+
+// The value of a single cpu of a per cpu map entry
+type BpfMapCpuValueRaw struct {
+	Cpu   int      `json:"cpu"`
+	Value []string `json:"value"`
+}
+
+// The key and value of a map entry formatted by bpftool using the btf of the
+// map. They are kept as raw json so the order of struct fields is preserved.
+// Use ParseFormatted to decode them
+type BpfMapEntryFormatted struct {
+	Key   json.RawMessage `json:"key,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+
+	// The value of each cpu for per cpu maps
+	Values json.RawMessage `json:"values,omitempty"`
 }
 
 type BpfMapEntry struct {
 	// The key of the map entry
 	Key []byte `json:"key"`
 
-	// The value of the map entry
+	// The value of the map entry. For per cpu maps this is the value of the
+	// first cpu
 	Value []byte `json:"value"`
 
-	// The formatted value of the map entry if it exists
-	Formatted struct {
-		// Value can be a variety of things
-		Value interface{} `json:"value"`
-	} `json:"formatted",omitempty`
+	// The value of each cpu for per cpu maps
+	Values [][]byte `json:"values,omitempty"`
+
+	// The formatted key and value of the map entry if the map has btf
+	Formatted *BpfMapEntryFormatted `json:"formatted,omitempty"`
 }
 
 type BpfProgram struct {
 	// The name of the program. This field may be empty
-	Name string `json:"name",omitempty`
+	Name string `json:"name,omitempty"`
 
 	// The tag of the program. This field should not be empty
 	Tag string `json:"tag"`
@@ -121,51 +192,101 @@ type BpfProgram struct {
 	// The amount of memory that is locked
 	BytesMemlock int `json:"bytes_memlock"`
 
+	// The total time spent running the program. Only set when
+	// kernel.bpf_stats_enabled is on
+	RunTimeNs int `json:"run_time_ns,omitempty"`
+
+	// The number of times the program has run. Only set when
+	// kernel.bpf_stats_enabled is on
+	RunCnt int `json:"run_cnt,omitempty"`
+
+	// The number of times the program was skipped because it was already
+	// running on the same cpu. Only set when kernel.bpf_stats_enabled is on
+	RecursionMisses int `json:"recursion_misses,omitempty"`
+
 	// The ids of any maps the program references
-	MapIds []int `json:"map_ids",omitempty`
+	MapIds []int `json:"map_ids,omitempty"`
 
 	// The id of an btf objects the program references
-	BtfId int `json:"btf_id",omitempty`
+	BtfId int `json:"btf_id,omitempty"`
 
 	// If the program is pinned this field will contain the path
-	Pinned []string `json:"pinned",omitempty`
+	Pinned []string `json:"pinned,omitempty"`
 
 	Pids []ProcessInfo `json:"pids"`
 
 	// The attach points of the program. There may be multiple
-	AttachPoint []string
+	AttachPoint []string `json:"attach_point,omitempty"`
 
 	// The offset from the attach point
-	Offset int
+	Offset int `json:"offset,omitempty"`
 
 	// The fd of the bpf program
-	Fd int
+	Fd int `json:"fd,omitempty"`
 
-	// A sha256 hash representing a unique id for the program
-	Fingerprint []string
+	// A sha256 hash representing a unique id for the program. It is computed
+	// from the xlated instructions with map ids and kernel addresses removed
+	// so the same program has the same fingerprint on every host
+	Fingerprint string `json:"fingerprint,omitempty"`
 
 	// The disassembly of the program
-	Instructions []string
+	Instructions []string `json:"instructions,omitempty"`
+
+	// The helper functions the program calls
+	Helpers []HelperCall `json:"helpers,omitempty"`
 
 	// The network interface this program is attached to
-	Interface string
+	Interface string `json:"interface,omitempty"`
 
 	// The type of TC program
-	TcKind string
+	TcKind string `json:"tc_kind,omitempty"`
 
 	// Cgroup that the program is attached to
-	Cgroup string
+	Cgroup string `json:"cgroup,omitempty"`
 
 	// The attach type for the cgroup. Examples are ingress, egress, device, bind4, bind6 etc
-	CgroupAttachType string
+	CgroupAttachType string `json:"cgroup_attach_type,omitempty"`
 
 	// Either multi or override
-	CgroupAttachFlags string
+	CgroupAttachFlags string `json:"cgroup_attach_flags,omitempty"`
 }
 
-// Write a stringer for BpfProgram
+// Summarize everywhere the program is attached in a single line
+func (p BpfProgram) AttachSummary() string {
+	parts := []string{}
+	parts = append(parts, p.AttachPoint...)
+	if p.Interface != "" {
+		if p.TcKind != "" {
+			parts = append(parts, fmt.Sprintf("%s (%s)", p.Interface, p.TcKind))
+		} else {
+			parts = append(parts, p.Interface)
+		}
+	}
+	if p.Cgroup != "" {
+		parts = append(parts, fmt.Sprintf("%s (%s)", p.Cgroup, p.CgroupAttachType))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Get the names of the risky helpers the program calls
+func (p BpfProgram) RiskyHelpers() []string {
+	result := []string{}
+	for _, h := range p.Helpers {
+		if h.Risk != "" {
+			result = append(result, h.Name)
+		}
+	}
+	return result
+}
+
+// Write a stringer for BpfProgram. Programs that call risky helpers are
+// marked in the risk column
 func (p BpfProgram) String() string {
-	result := fmt.Sprintf("%6d: [green]%13s[-] [blue]%16s[-] %20s ", p.ProgramId, p.ProgType, p.Tag, p.Name)
+	risk := "    "
+	if len(p.RiskyHelpers()) > 0 {
+		risk = "[red]risk[-]"
+	}
+	result := fmt.Sprintf("%6d: %s [green]%13s[-] [blue]%16s[-] %20s ", p.ProgramId, risk, p.ProgType, p.Tag, p.Name)
 	for _, point := range p.AttachPoint {
 		result += fmt.Sprintf("%s, ", point)
 	}
@@ -186,61 +307,106 @@ func (p BpfMap) String() string {
 	return result
 }
 
+// Encode the key and value as lists of hex bytes the same way bpftool does
+// instead of the default base64 encoding of byte slices
+func (e BpfMapEntry) MarshalJSON() ([]byte, error) {
+	var values []BpfMapCpuValueRaw
+	for cpu, v := range e.Values {
+		values = append(values, BpfMapCpuValueRaw{Cpu: cpu, Value: bpftoolBytes(v)})
+	}
+	return json.Marshal(struct {
+		Key       []string              `json:"key"`
+		Value     []string              `json:"value"`
+		Values    []BpfMapCpuValueRaw   `json:"values,omitempty"`
+		Formatted *BpfMapEntryFormatted `json:"formatted,omitempty"`
+	}{
+		Key:       bpftoolBytes(e.Key),
+		Value:     bpftoolBytes(e.Value),
+		Values:    values,
+		Formatted: e.Formatted,
+	})
+}
+
+// Check if a map has a separate value for every cpu
+func IsPerCpuMap(mapType string) bool {
+	return strings.Contains(mapType, "percpu")
+}
+
+// Check if the values of a map are other maps
+func IsMapOfMaps(mapType string) bool {
+	return mapType == "array_of_maps" || mapType == "hash_of_maps"
+}
+
+// Get the id of the inner map an entry of a map of maps points to. The kernel
+// returns the id of the inner map as the value when the entry is looked up
+func InnerMapId(entry BpfMapEntry) (int, bool) {
+	if len(entry.Value) != 4 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(entry.Value)), true
+}
+
 // Write a stringer for BpfMapEntry
 func (e BpfMapEntry) String() string {
 	result := fmt.Sprintf("%v: %v", e.Key, e.Value)
 	return result
 }
 
-// Call the bpftool binary to get the disassembly of a program
-// using the program id
+// Get the disassembly of a program using the program id
 func GetBpfProgramDisassembly(programId int) ([]string, error) {
-	stdout, _, err := RunCmd("sudo", BpftoolPath, "prog", "dump", "xlated", "id", strconv.Itoa(programId))
+	return CurrentBackend().ProgramDisassembly(programId)
+}
+
+// Get the disassembly of the jit compiled code of a program
+func GetBpfProgramJitedDisassembly(programId int) ([]string, error) {
+	return CurrentBackend().ProgramJitedDisassembly(programId)
+}
+
+// Get the list of programs that are loaded
+func GetBpfPrograms() ([]BpfProgram, error) {
+	programs, err := CurrentBackend().Programs()
 	if err != nil {
-		return []string{}, err
+		log.Errorf("Error getting program info: %v\n", err)
 	}
-	// Convert the output to a string
-	outStr := string(stdout)
-	// Split the output into lines
-	result := strings.Split(outStr, "\n")
-	return result, nil
+	return programs, err
 }
 
-// Use bpftool map show to get the map info
-func GetBpfMapInfo() ([]BpfMap, error) {
-	var bpfMap []BpfMap
-	stdout, _, err := RunCmd("sudo", BpftoolPath, "map", "-jf", "show")
-	if err != nil {
-		log.Errorf("Error getting map info: %v\n", err)
-		return bpfMap, err
+// Fill in the cmdline and path of the processes that own each program
+func addProcessDetails(programs []BpfProgram) {
+	for _, program := range programs {
+		for j, pid := range program.Pids {
+			cmdline, err := GetProcessCmdline(pid.Pid)
+			if err == nil {
+				program.Pids[j].Cmdline = cmdline
+			}
+			path, err := GetProcessPath(pid.Pid)
+			if err == nil {
+				program.Pids[j].Path = path
+			}
+		}
 	}
+}
 
-	err = json.Unmarshal(stdout, &bpfMap)
+// Get the info for every map
+func GetBpfMapInfo() ([]BpfMap, error) {
+	bpfMap, err := CurrentBackend().Maps()
 	if err != nil {
-		log.Errorf("Error unmarshalling map info: %v\n", err)
-		return bpfMap, err
+		log.Errorf("Error getting map info: %v\n", err)
 	}
-	return bpfMap, nil
+	return bpfMap, err
 }
 
-// Parse the output of the bpftool binary to get the map info that correspond
-// to the map ids the bpf program is using. It assumed that at least one of
-// the ids should exist so finding none is considered an error
+// Get the map info that correspond to the map ids the bpf program is using.
+// It assumed that at least one of the ids should exist so finding none is
+// considered an error
 func GetBpfMapInfoByIds(mapIds []int) ([]BpfMap, error) {
-	tmp := []BpfMap{}
 	result := []BpfMap{}
 
-	// Call the bpftool binary to get the map info
-	stdout, _, err := RunCmd("sudo", BpftoolPath, "-j", "map", "show")
+	tmp, err := CurrentBackend().Maps()
 	if err != nil {
 		log.Errorf("Error getting map info for ids: %v\n%v\n", mapIds, err)
 		return []BpfMap{}, err
 	}
-	err = json.Unmarshal(stdout, &tmp)
-	if err != nil {
-		log.Errorf("Error unmarshalling map info for ids: %v\n%v\n", mapIds, err)
-		return []BpfMap{}, err
-	}
 
 	for _, m := range tmp {
 		if contains(mapIds, m.Id) {
@@ -254,6 +420,40 @@ func GetBpfMapInfoByIds(mapIds []int) ([]BpfMap, error) {
 	return result, nil
 }
 
+// Get the programs attached to network devices
+func GetBpfNetInfo() ([]NetInfo, error) {
+	return CurrentBackend().NetInfo()
+}
+
+// Get the programs attached to cgroups
+func GetBpfCgroupInfo() ([]CgroupInfo, error) {
+	return CurrentBackend().CgroupInfo()
+}
+
+// Get the programs attached through perf events
+func GetBpfPerfInfo() ([]PerfInfo, error) {
+	return CurrentBackend().PerfInfo()
+}
+
+// Get the human readable list of bpf features supported by the kernel
+func GetBpfFeatures() (string, error) {
+	return CurrentBackend().Features()
+}
+
+// Check if the kernel is collecting run time statistics for programs
+func GetBpfStatsEnabled() (bool, error) {
+	return CurrentBackend().StatsEnabled()
+}
+
+// Turn the collection of program run time statistics on or off
+func SetBpfStatsEnabled(enabled bool) error {
+	err := CurrentBackend().SetStatsEnabled(enabled)
+	if err != nil {
+		log.Errorf("Error setting kernel.bpf_stats_enabled to %v: %v\n", enabled, err)
+	}
+	return err
+}
+
 func convertStringSliceToByteSlice(strSlice []string) ([]byte, error) {
 
 	byteSlice := make([]byte, len(strSlice))
@@ -278,37 +478,27 @@ func convertStringSliceToByteSlice(strSlice []string) ([]byte, error) {
 	return byteSlice, nil
 }
 
-// Use bpftool map dump to get the data from a map
+// Get the data from a map
 func GetBpfMapEntries(mapId int) ([]BpfMapEntry, error) {
-	var result []BpfMapEntry
-	var mapData []BpfMapEntryRaw
-	stdout, _, err := RunCmd("sudo", BpftoolPath, "map", "-jf", "dump", "id", strconv.Itoa(mapId))
+	entries, err := CurrentBackend().MapEntries(mapId)
 	if err != nil {
 		log.Errorf("Error getting map entries for map id: %d\n%v\n", mapId, err)
-		return result, err
 	}
+	return entries, err
+}
 
-	// Convert map data to individual elements
-	err = json.Unmarshal(stdout, &mapData)
-	if err != nil {
-		log.Errorf("Error unmarshalling map entries for map id: %d\n%v\n", mapId, err)
-		return result, err
-	}
-
-	// Use hex.DecodeString to convert the key and value to byte slices
-	for i, _ := range mapData {
-		b, err := convertStringSliceToByteSlice(mapData[i].Key)
-		if err != nil {
-			return []BpfMapEntry{}, err
-		}
-
-		v, err := convertStringSliceToByteSlice(mapData[i].Value)
-		if err != nil {
-			return []BpfMapEntry{}, err
-		}
+// Create or update a single entry of a map
+func UpdateBpfMapEntry(mapId int, key []byte, value []byte) error {
+	return CurrentBackend().UpdateMapEntry(mapId, key, value)
+}
 
-		result = append(result, BpfMapEntry{Key: b, Value: v})
-	}
+// Set the value of every cpu of a per cpu map entry. values has a value for
+// each cpu
+func UpdateBpfMapEntryValues(mapId int, key []byte, values [][]byte) error {
+	return CurrentBackend().UpdateMapEntryValues(mapId, key, values)
+}
 
-	return result, nil
+// Delete a single entry of a map
+func DeleteBpfMapEntry(mapId int, key []byte) error {
+	return CurrentBackend().DeleteMapEntry(mapId, key)
 }
@@ -1,15 +1,21 @@
 package utils
 
 import (
+	"errors"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
 )
 
+// The path to bpftool used by the tests. Tests that need bpftool are skipped
+// when it is empty
+var bpftoolPath string
+
 func init() {
 	// Set the path to bpftool using the system path
 	bpftoolEnvPath, exists := os.LookupEnv("BPFTOOL_PATH")
@@ -22,14 +28,14 @@ func init() {
 		if err != nil {
 			panic(err)
 		}
-		BpftoolPath = bpftoolEnvPath
+		bpftoolPath = bpftoolEnvPath
 	} else {
 		path, err := Which("bpftool")
-		if err != nil {
-			panic(err)
+		if err == nil {
+			bpftoolPath = path
 		}
-		BpftoolPath = path
 	}
+	SetBackend(NewBpftoolBackend(bpftoolPath))
 
 	// Set simple logging for tests
 	log.SetOutput(os.Stdout)
@@ -108,12 +114,16 @@ func generateRandomString(length int) string {
 }
 
 func TestGetMapEntries(t *testing.T) {
+	if bpftoolPath == "" {
+		t.Skip("bpftool not found")
+	}
+
 	sysfsPath := "/sys/fs/bpf"
 	mapName := generateRandomString(10)
 	mapPinPath := sysfsPath + "/" + mapName
 
 	// Create a new bpf map using bpftool
-	_, stderr, err := RunCmd("sudo", "bpftool", "map", "create", mapPinPath, "type", "hash", "key", "4", "value", "4", "entries", "1024", "name", mapName)
+	_, stderr, err := RunCmd("sudo", bpftoolPath, "map", "create", mapPinPath, "type", "hash", "key", "4", "value", "4", "entries", "1024", "name", mapName)
 	if err != nil {
 		t.Errorf("Failed to create map at %s, got %v - %s", mapPinPath, err, stderr)
 		return
@@ -140,7 +150,7 @@ func TestGetMapEntries(t *testing.T) {
 	}
 
 	// Add entires to the map using bpftool map update
-	_, _, err = RunCmd("sudo", "bpftool", "map", "update", "id", strconv.Itoa(mapId), "key", "0x00", "0x00", "0x00", "0x00", "value", "0x00", "0x00", "0x00", "0x00")
+	_, _, err = RunCmd("sudo", bpftoolPath, "map", "update", "id", strconv.Itoa(mapId), "key", "0x00", "0x00", "0x00", "0x00", "value", "0x00", "0x00", "0x00", "0x00")
 
 	// Get the map entries
 	entries, err := GetBpfMapEntries(mapId)
@@ -177,3 +187,64 @@ func TestGetMapEntries(t *testing.T) {
 	}
 
 }
+
+func TestBpftoolMapEntriesPerCpu(t *testing.T) {
+	dir := t.TempDir()
+	recorder, _ := NewRecorder(dir)
+	err := recorder.Save([]string{"-jf", "map", "dump", "id", "6"}, []byte(`[
+		{"key":["0x00","0x00","0x00","0x00"],"values":[
+			{"cpu":0,"value":["0x01","0x00","0x00","0x00","0x00","0x00","0x00","0x00"]},
+			{"cpu":1,"value":["0x02","0x00","0x00","0x00","0x00","0x00","0x00","0x00"]}
+		]}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to save recording: %v", err)
+	}
+	replayer, _ := NewReplayer(dir)
+	backend := &BpftoolBackend{Replay: replayer}
+
+	entries, err := backend.MapEntries(6)
+	if err != nil {
+		t.Fatalf("Failed to get map entries: %v", err)
+	}
+	if len(entries) != 1 || len(entries[0].Values) != 2 || entries[0].Values[1][0] != 2 {
+		t.Fatalf("Expected a value for each cpu, got %+v", entries)
+	}
+	if entries[0].Value[0] != 1 {
+		t.Errorf("Expected the value of the first cpu as the value, got %v", entries[0].Value)
+	}
+
+	data, err := entries[0].MarshalJSON()
+	if err != nil || !strings.Contains(string(data), `"values":[{"cpu":0,`) {
+		t.Errorf("Expected the cpu values in the json, got %s (%v)", data, err)
+	}
+
+	err = backend.UpdateMapEntryValues(6, entries[0].Key, entries[0].Values)
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Expected different values per cpu to not be supported by bpftool, got %v", err)
+	}
+}
+
+func TestBpftoolMapEntriesMapOfMaps(t *testing.T) {
+	dir := t.TempDir()
+	recorder, _ := NewRecorder(dir)
+	err := recorder.Save([]string{"-jf", "map", "dump", "id", "7"}, []byte(`[
+		{"key":["0x00","0x00","0x00","0x00"],"inner_map_id":300}
+	]`))
+	if err != nil {
+		t.Fatalf("Failed to save recording: %v", err)
+	}
+	replayer, _ := NewReplayer(dir)
+	backend := &BpftoolBackend{Replay: replayer}
+
+	entries, err := backend.MapEntries(7)
+	if err != nil {
+		t.Fatalf("Failed to get map entries: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected a single entry, got %+v", entries)
+	}
+	if id, ok := InnerMapId(entries[0]); !ok || id != 300 {
+		t.Errorf("Expected inner map 300, got %d (%v)", id, ok)
+	}
+}
@@ -0,0 +1,395 @@
+// The utils/bpftool.go file implements the Backend interface by running the
+// bpftool binary and parsing its json output
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A Backend that gathers its information by running `sudo bpftool ...`
+type BpftoolBackend struct {
+	// The path to the bpftool binary
+	Path string
+
+	// If set the output of every read only command is saved with this
+	// recorder
+	Record *Recorder
+
+	// If set bpftool is never run. The output of each command is loaded from
+	// a previous recording instead
+	Replay *Replayer
+
+	// Set if bpftool was built with libbfd or llvm. Jited code can't be
+	// disassembled without one of them
+	JitDisassembly bool
+}
+
+func NewBpftoolBackend(path string) *BpftoolBackend {
+	return &BpftoolBackend{Path: path}
+}
+
+// Run bpftool with the given arguments and return stdout. On failure the
+// error contains the command that was run along with its stderr
+func (b *BpftoolBackend) run(args ...string) ([]byte, error) {
+	readOnly := isReadOnlyCommand(args)
+	if b.Replay != nil {
+		if !readOnly {
+			return nil, fmt.Errorf("`bpftool %s` can't be run while replaying a recording", strings.Join(args, " "))
+		}
+		return b.Replay.Load(args)
+	}
+
+	cmd := append([]string{"sudo", b.Path}, args...)
+	stdout, stderr, err := RunCmd(cmd...)
+	if err != nil {
+		return stdout, fmt.Errorf("failed to run `%s`: %v\n%s", strings.Join(cmd, " "), err, string(stderr))
+	}
+
+	if b.Record != nil && readOnly {
+		err = b.Record.Save(args, stdout)
+		if err != nil {
+			log.Errorf("Failed to record output of `bpftool %s`: %v\n", strings.Join(args, " "), err)
+		}
+	}
+	return stdout, nil
+}
+
+// Maps can't be changed while replaying since there is nothing to change
+func (b *BpftoolBackend) checkWritable() error {
+	if b.Replay != nil {
+		return errors.New("maps can't be modified while replaying a recording")
+	}
+	return nil
+}
+
+// Run bpftool with the given arguments and decode the json output into v
+func (b *BpftoolBackend) runJson(v interface{}, args ...string) error {
+	stdout, err := b.run(args...)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(stdout, v)
+	if err != nil {
+		return fmt.Errorf("failed to decode json output of `bpftool %s`: %v", strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// Format a byte slice as the hex arguments that bpftool expects for map keys
+// and values
+func bpftoolBytes(data []byte) []string {
+	result := make([]string, len(data))
+	for i, b := range data {
+		result[i] = fmt.Sprintf("0x%02x", b)
+	}
+	return result
+}
+
+func (b *BpftoolBackend) Programs() ([]BpfProgram, error) {
+	programs := []BpfProgram{}
+	err := b.runJson(&programs, "-j", "prog", "show")
+
+	// The processes in a recording belong to another machine (or no longer
+	// exist) so there is no point in looking them up
+	if b.Replay == nil {
+		addProcessDetails(programs)
+	}
+	return programs, err
+}
+
+func (b *BpftoolBackend) Maps() ([]BpfMap, error) {
+	maps := []BpfMap{}
+	err := b.runJson(&maps, "-j", "map", "show")
+	return maps, err
+}
+
+func (b *BpftoolBackend) MapEntries(mapId int) ([]BpfMapEntry, error) {
+	var result []BpfMapEntry
+	var mapData []BpfMapEntryRaw
+	err := b.runJson(&mapData, "-jf", "map", "dump", "id", strconv.Itoa(mapId))
+	if err != nil {
+		return result, err
+	}
+
+	// Convert the hex strings of each key and value to byte slices
+	for i := range mapData {
+		k, err := convertStringSliceToByteSlice(mapData[i].Key)
+		if err != nil {
+			return []BpfMapEntry{}, err
+		}
+
+		v, err := convertStringSliceToByteSlice(mapData[i].Value)
+		if err != nil {
+			return []BpfMapEntry{}, err
+		}
+
+		// Per cpu maps only have values. The first one is used as the value
+		var values [][]byte
+		for _, cpuValue := range mapData[i].Values {
+			cv, err := convertStringSliceToByteSlice(cpuValue.Value)
+			if err != nil {
+				return []BpfMapEntry{}, err
+			}
+			values = append(values, cv)
+		}
+		if len(mapData[i].Value) == 0 && len(values) > 0 {
+			v = values[0]
+		}
+
+		// Maps of maps only have the id of the inner map
+		if len(mapData[i].Value) == 0 && mapData[i].InnerMapId != nil {
+			v = make([]byte, 4)
+			binary.LittleEndian.PutUint32(v, uint32(*mapData[i].InnerMapId))
+		}
+
+		result = append(result, BpfMapEntry{Key: k, Value: v, Values: values, Formatted: mapData[i].Formatted})
+	}
+	return result, nil
+}
+
+func (b *BpftoolBackend) UpdateMapEntry(mapId int, key []byte, value []byte) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	args := []string{"map", "update", "id", strconv.Itoa(mapId), "key"}
+	args = append(args, bpftoolBytes(key)...)
+	args = append(args, "value")
+	args = append(args, bpftoolBytes(value)...)
+	_, err := b.run(args...)
+	return err
+}
+
+// bpftool always sets every cpu of a per cpu map to the same value so
+// different values can't be written
+func (b *BpftoolBackend) UpdateMapEntryValues(mapId int, key []byte, values [][]byte) error {
+	for _, v := range values {
+		if !bytes.Equal(v, values[0]) {
+			return fmt.Errorf("bpftool can only set every cpu to the same value. Use the native backend to set a single cpu: %w", ErrNotSupported)
+		}
+	}
+	if len(values) == 0 {
+		return errors.New("no values to update")
+	}
+	return b.UpdateMapEntry(mapId, key, values[0])
+}
+
+func (b *BpftoolBackend) DeleteMapEntry(mapId int, key []byte) error {
+	if err := b.checkWritable(); err != nil {
+		return err
+	}
+	args := []string{"map", "delete", "id", strconv.Itoa(mapId), "key"}
+	args = append(args, bpftoolBytes(key)...)
+	_, err := b.run(args...)
+	return err
+}
+
+// Get the btf of a map. bpftool only prints the key and value types
+// themselves when dumping the btf of a map so the whole btf object is dumped
+// as well to resolve the types they refer to
+func (b *BpftoolBackend) MapBtf(mapId int) (*MapBtf, error) {
+	id := strconv.Itoa(mapId)
+	m := BpfMap{}
+	err := b.runJson(&m, "-j", "map", "show", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if m.BtfId == 0 {
+		return nil, fmt.Errorf("map %d has no btf", mapId)
+	}
+
+	kv := struct {
+		Types []BtfType `json:"types"`
+	}{}
+	err = b.runJson(&kv, "-j", "btf", "dump", "map", "id", id, "kv")
+	if err != nil {
+		return nil, err
+	}
+	if len(kv.Types) != 2 {
+		return nil, fmt.Errorf("expected the key and value types of map %d, got %d types", mapId, len(kv.Types))
+	}
+
+	btf, err := b.Btf(m.BtfId)
+	if err != nil {
+		return nil, err
+	}
+	return &MapBtf{Btf: btf, KeyTypeId: kv.Types[0].Id, ValueTypeId: kv.Types[1].Id}, nil
+}
+
+func (b *BpftoolBackend) Btf(btfId int) (*Btf, error) {
+	all := struct {
+		Types []BtfType `json:"types"`
+	}{}
+	err := b.runJson(&all, "-j", "btf", "dump", "id", strconv.Itoa(btfId))
+	if err != nil {
+		return nil, err
+	}
+	return NewBtf(all.Types), nil
+}
+
+func (b *BpftoolBackend) BtfObjects() ([]BtfObject, error) {
+	objects := []BtfObject{}
+	err := b.runJson(&objects, "-j", "btf", "show")
+	return objects, err
+}
+
+func (b *BpftoolBackend) BtfC(btfId int) (string, error) {
+	stdout, err := b.run("btf", "dump", "id", strconv.Itoa(btfId), "format", "c")
+	return string(stdout), err
+}
+
+// Stream the records of a perf event array with `bpftool map event_pipe`.
+// bpftool can't read ringbufs
+func (b *BpftoolBackend) MapEvents(m BpfMap, events chan<- MapEvent, stop <-chan struct{}) error {
+	if m.Type != "perf_event_array" {
+		return fmt.Errorf("bpftool can only read perf event arrays. Use the native backend to read a %s: %w", m.Type, ErrNotSupported)
+	}
+	if b.Replay != nil {
+		return errors.New("events can't be read while replaying a recording")
+	}
+
+	return b.stream(stop, func(r io.Reader) error {
+		return decodeEventPipe(r, events, stop)
+	}, "-j", "map", "event_pipe", "id", strconv.Itoa(m.Id))
+}
+
+// Read the lines bpf programs print with `bpftool prog tracelog`
+func (b *BpftoolBackend) TraceLog(lines chan<- TraceLine, stop <-chan struct{}) error {
+	if b.Replay != nil {
+		return errors.New("the trace pipe can't be read while replaying a recording")
+	}
+	return b.stream(stop, func(r io.Reader) error {
+		return readTraceLines(r, lines, stop)
+	}, "prog", "tracelog")
+}
+
+// Run a bpftool command that keeps printing until it is interrupted and pass
+// its stdout to read. The command is stopped once stop is closed or read
+// returns
+func (b *BpftoolBackend) stream(stop <-chan struct{}, read func(io.Reader) error, args ...string) error {
+	cmd := exec.Command("sudo", append([]string{b.Path}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	// sudo passes SIGINT on to bpftool which then stops cleanly. Killing sudo
+	// would leave bpftool running
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+			cmd.Process.Signal(os.Interrupt)
+		case <-done:
+		}
+	}()
+
+	err = read(stdout)
+	if err != nil {
+		cmd.Process.Signal(os.Interrupt)
+	}
+	waitErr := cmd.Wait()
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	if err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run `%s`: %v\n%s", strings.Join(cmd.Args, " "), err, stderr.String())
+	}
+	return nil
+}
+
+func (b *BpftoolBackend) ProgramDisassembly(progId int) ([]string, error) {
+	stdout, err := b.run("prog", "dump", "xlated", "id", strconv.Itoa(progId))
+	if err != nil {
+		return []string{}, err
+	}
+	return strings.Split(string(stdout), "\n"), nil
+}
+
+// Get the disassembly of the jited code along with the raw opcodes. A
+// recording may contain it even if the bpftool of this machine can't
+func (b *BpftoolBackend) ProgramJitedDisassembly(progId int) ([]string, error) {
+	if !b.JitDisassembly && b.Replay == nil {
+		return []string{}, fmt.Errorf("bpftool was built without libbfd or llvm so disassembling jited code is %w", ErrNotSupported)
+	}
+	stdout, err := b.run("prog", "dump", "jited", "id", strconv.Itoa(progId), "opcodes")
+	if err != nil {
+		return []string{}, err
+	}
+	return strings.Split(string(stdout), "\n"), nil
+}
+
+func (b *BpftoolBackend) NetInfo() ([]NetInfo, error) {
+	netInfo := []NetInfo{}
+	err := b.runJson(&netInfo, "-j", "net", "show")
+	return netInfo, err
+}
+
+func (b *BpftoolBackend) CgroupInfo() ([]CgroupInfo, error) {
+	cgroupInfo := []CgroupInfo{}
+	err := b.runJson(&cgroupInfo, "-j", "cgroup", "tree")
+	return cgroupInfo, err
+}
+
+func (b *BpftoolBackend) PerfInfo() ([]PerfInfo, error) {
+	perfInfo := []PerfInfo{}
+	err := b.runJson(&perfInfo, "-j", "perf", "list")
+	return perfInfo, err
+}
+
+func (b *BpftoolBackend) Links() ([]BpfLink, error) {
+	links := []BpfLink{}
+	err := b.runJson(&links, "-j", "link", "show")
+	return links, err
+}
+
+func (b *BpftoolBackend) Features() (string, error) {
+	stdout, err := b.run("feature", "probe")
+	return string(stdout), err
+}
+
+func (b *BpftoolBackend) StatsEnabled() (bool, error) {
+	// The sysctl of this machine says nothing about the recording
+	if b.Replay != nil {
+		return false, fmt.Errorf("stats of a recording are %w", ErrNotSupported)
+	}
+	return readStatsSysctl()
+}
+
+func (b *BpftoolBackend) SetStatsEnabled(enabled bool) error {
+	if b.Replay != nil {
+		return fmt.Errorf("stats of a recording are %w", ErrNotSupported)
+	}
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	cmd := []string{"sudo", "sysctl", "-w", "kernel.bpf_stats_enabled=" + value}
+	_, stderr, err := RunCmd(cmd...)
+	if err != nil {
+		return fmt.Errorf("failed to run `%s`: %v\n%s", strings.Join(cmd, " "), err, string(stderr))
+	}
+	return nil
+}
@@ -0,0 +1,599 @@
+// The utils/btf.go file models the btf types that bpftool prints with
+// `bpftool btf dump -j`. They are used to split the raw bytes of a map key or
+// value into the fields of the C type it was declared as so each field can be
+// shown and edited on its own
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Larger types are too unwieldy to edit one field at a time
+const maxBtfFields = 512
+
+// A member of a struct or union
+type BtfMember struct {
+	Name   string `json:"name"`
+	TypeId int    `json:"type_id"`
+
+	// Where the member starts relative to the start of the struct
+	BitsOffset int `json:"bits_offset"`
+
+	// Only set for bitfields
+	BitfieldSize int `json:"bitfield_size,omitempty"`
+}
+
+// A single value of an enum
+type BtfEnumValue struct {
+	Name  string `json:"name"`
+	Value int64  `json:"val"`
+}
+
+// A parameter of a function prototype. Variadic functions end with a
+// parameter without a name or type
+type BtfParam struct {
+	Name   string `json:"name"`
+	TypeId int    `json:"type_id"`
+}
+
+// A single btf type. Which fields are set depends on the kind of the type
+type BtfType struct {
+	Id   int    `json:"id"`
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+
+	// The size in bytes of ints, floats, structs, unions and enums
+	Size int `json:"size,omitempty"`
+
+	// The type that pointers, typedefs, modifiers (const, volatile...) and
+	// arrays refer to
+	TypeId int `json:"type_id,omitempty"`
+
+	// INT only. encoding is one of (none), SIGNED, CHAR or BOOL. Enums use
+	// SIGNED or UNSIGNED
+	BitsOffset int    `json:"bits_offset,omitempty"`
+	NrBits     int    `json:"nr_bits,omitempty"`
+	Encoding   string `json:"encoding,omitempty"`
+
+	// ARRAY only
+	NrElems int `json:"nr_elems,omitempty"`
+
+	Members []BtfMember    `json:"members,omitempty"`
+	Values  []BtfEnumValue `json:"values,omitempty"`
+
+	// FUNC_PROTO only
+	RetTypeId int        `json:"ret_type_id,omitempty"`
+	Params    []BtfParam `json:"params,omitempty"`
+
+	// FWD only. struct or union
+	FwdKind string `json:"fwd_kind,omitempty"`
+}
+
+// The types of a btf object keyed by id
+type Btf struct {
+	Types map[int]BtfType
+
+	// Only set for raw btf. Split btf (kernel modules) also has the types of
+	// its base so firstId is the first type that belongs to the object itself
+	rawStrings []byte
+	base       *Btf
+	firstId    int
+}
+
+func NewBtf(types []BtfType) *Btf {
+	b := &Btf{Types: map[int]BtfType{}}
+	for _, t := range types {
+		b.Types[t.Id] = t
+	}
+	return b
+}
+
+// The btf of a map along with the ids of its key and value types
+type MapBtf struct {
+	Btf         *Btf
+	KeyTypeId   int
+	ValueTypeId int
+}
+
+// Get the btf of a map
+func GetBpfMapBtf(mapId int) (*MapBtf, error) {
+	return CurrentBackend().MapBtf(mapId)
+}
+
+// Get the btf types of a btf object
+func GetBpfBtf(btfId int) (*Btf, error) {
+	return CurrentBackend().Btf(btfId)
+}
+
+// Find a named struct, union, enum or typedef. If several types have the name
+// the one with the lowest id is returned
+func (b *Btf) FindType(name string) (int, bool) {
+	found := 0
+	for id, t := range b.Types {
+		if t.Name != name || (found != 0 && id > found) {
+			continue
+		}
+		switch t.Kind {
+		case "STRUCT", "UNION", "ENUM", "ENUM64", "TYPEDEF":
+			found = id
+		}
+	}
+	return found, found != 0
+}
+
+func (b *Btf) lookup(id int) (BtfType, error) {
+	if id == 0 {
+		return BtfType{Kind: "VOID"}, nil
+	}
+	t, ok := b.Types[id]
+	if !ok {
+		return t, fmt.Errorf("btf type %d not found", id)
+	}
+	return t, nil
+}
+
+func isBtfModifier(kind string) bool {
+	switch kind {
+	case "TYPEDEF", "CONST", "VOLATILE", "RESTRICT", "TYPE_TAG":
+		return true
+	}
+	return false
+}
+
+// Follow typedefs and modifiers until the underlying type is found
+func (b *Btf) resolve(id int) (BtfType, error) {
+	for i := 0; i < 32; i++ {
+		t, err := b.lookup(id)
+		if err != nil || !isBtfModifier(t.Kind) {
+			return t, err
+		}
+		id = t.TypeId
+	}
+	return BtfType{}, fmt.Errorf("btf type %d has too many modifiers", id)
+}
+
+// Get the size in bytes of a type
+func (b *Btf) Size(id int) (int, error) {
+	t, err := b.resolve(id)
+	if err != nil {
+		return 0, err
+	}
+	switch t.Kind {
+	case "INT", "FLOAT", "STRUCT", "UNION", "ENUM", "ENUM64":
+		return t.Size, nil
+	case "PTR":
+		return 8, nil
+	case "ARRAY":
+		size, err := b.Size(t.TypeId)
+		return size * t.NrElems, err
+	}
+	return 0, fmt.Errorf("btf type %d (%s) has no size", id, t.Kind)
+}
+
+// Get the C name of a type i.e. `struct event`, `__u32` or `char[16]`
+func (b *Btf) TypeName(id int) string {
+	t, err := b.lookup(id)
+	if err != nil {
+		return "?"
+	}
+
+	name := t.Name
+	if name == "" {
+		name = "(anon)"
+	}
+	switch t.Kind {
+	case "VOID":
+		return "void"
+	case "STRUCT", "UNION", "ENUM", "ENUM64":
+		kind := strings.ToLower(strings.TrimSuffix(t.Kind, "64"))
+		return kind + " " + name
+	case "FWD":
+		if t.FwdKind == "union" {
+			return "union " + name
+		}
+		return "struct " + name
+	case "PTR":
+		return b.TypeName(t.TypeId) + " *"
+	case "CONST", "VOLATILE", "RESTRICT":
+		return strings.ToLower(t.Kind) + " " + b.TypeName(t.TypeId)
+	case "TYPE_TAG":
+		return b.TypeName(t.TypeId)
+	case "ARRAY":
+		return fmt.Sprintf("%s[%d]", b.TypeName(t.TypeId), t.NrElems)
+	case "FUNC_PROTO":
+		return "func"
+	}
+	return name
+}
+
+// Get the name of the type that has to be looked up to understand a type.
+// Pointers, arrays and modifiers are followed to the named type they refer to
+// i.e. `struct event` for `const struct event *[4]`. Typedefs are kept since
+// they are declared by name. Anonymous types have no name
+func (b *Btf) DeclName(id int) string {
+	for i := 0; i < 32; i++ {
+		t, err := b.lookup(id)
+		if err != nil {
+			return ""
+		}
+		switch t.Kind {
+		case "PTR", "ARRAY", "CONST", "VOLATILE", "RESTRICT", "TYPE_TAG":
+			id = t.TypeId
+			continue
+		case "STRUCT", "UNION", "ENUM", "ENUM64", "FWD":
+			if t.Name == "" {
+				return ""
+			}
+			return b.TypeName(id)
+		}
+		return t.Name
+	}
+	return ""
+}
+
+const (
+	BtfFieldInt    = 0
+	BtfFieldBool   = 1
+	BtfFieldEnum   = 2
+	BtfFieldString = 3
+	BtfFieldFloat  = 4
+)
+
+// A scalar somewhere inside a key or value that can be edited on its own.
+// Structs and arrays are split into their members and elements while byte
+// arrays are kept together. They are edited as a string when they hold one and
+// as hex bytes otherwise
+type BtfField struct {
+	// Where the field is in the key or value i.e. value.stats[2].count
+	Path string
+
+	// The C type of the field
+	CType string
+
+	// One of the BtfField* kinds
+	Kind int
+
+	// The position of the field in bits so bitfields can be edited too
+	BitOffset int
+	Bits      int
+
+	Signed  bool
+	Pointer bool
+
+	// The possible values of an enum
+	Values []BtfEnumValue
+}
+
+// Split a type into the fields that can be edited. path is the name of the
+// top level field. Only the first member of a union can be edited since all
+// of its members share the same bytes
+func (b *Btf) Fields(id int, path string) ([]BtfField, error) {
+	fields := []BtfField{}
+	err := b.fields(id, path, 0, &fields)
+	return fields, err
+}
+
+func (b *Btf) fields(id int, path string, offset int, fields *[]BtfField) error {
+	if len(*fields) > maxBtfFields {
+		return fmt.Errorf("type has more than %d fields", maxBtfFields)
+	}
+
+	t, err := b.resolve(id)
+	if err != nil {
+		return err
+	}
+	field := BtfField{Path: path, CType: b.TypeName(id), BitOffset: offset, Bits: t.Size * 8}
+	switch t.Kind {
+	case "INT":
+		field.BitOffset += t.BitsOffset
+		field.Bits = t.NrBits
+		field.Signed = t.Encoding == "SIGNED"
+		if t.Encoding == "BOOL" {
+			field.Kind = BtfFieldBool
+		}
+	case "PTR":
+		field.Bits = 64
+		field.Pointer = true
+	case "ENUM", "ENUM64":
+		field.Kind = BtfFieldEnum
+		field.Signed = t.Encoding == "SIGNED"
+		field.Values = t.Values
+	case "FLOAT":
+		field.Kind = BtfFieldFloat
+		if t.Size != 4 && t.Size != 8 {
+			return fmt.Errorf("%s: unsupported float size %d", path, t.Size)
+		}
+	case "ARRAY":
+		elem, err := b.resolve(t.TypeId)
+		if err != nil {
+			return err
+		}
+		if elem.Kind == "INT" && elem.Size == 1 && elem.Encoding != "BOOL" {
+			field.Kind = BtfFieldString
+			field.Bits = t.NrElems * 8
+			break
+		}
+		size, err := b.Size(t.TypeId)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < t.NrElems; i++ {
+			err = b.fields(t.TypeId, fmt.Sprintf("%s[%d]", path, i), offset+i*size*8, fields)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case "STRUCT", "UNION":
+		members := t.Members
+		if t.Kind == "UNION" && len(members) > 1 {
+			members = members[:1]
+		}
+		for _, m := range members {
+			memberPath := path
+			if m.Name != "" {
+				memberPath += "." + m.Name
+			}
+			if m.BitfieldSize > 0 {
+				mt, err := b.resolve(m.TypeId)
+				if err != nil {
+					return err
+				}
+				*fields = append(*fields, BtfField{
+					Path:      memberPath,
+					CType:     fmt.Sprintf("%s:%d", b.TypeName(m.TypeId), m.BitfieldSize),
+					Kind:      BtfFieldInt,
+					BitOffset: offset + m.BitsOffset,
+					Bits:      m.BitfieldSize,
+					Signed:    mt.Encoding == "SIGNED",
+				})
+				continue
+			}
+			err = b.fields(m.TypeId, memberPath, offset+m.BitsOffset, fields)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s: %s can't be edited", path, b.TypeName(id))
+	}
+
+	*fields = append(*fields, field)
+	return nil
+}
+
+// Read bits from data. bpf maps store their data in host byte order and like
+// the rest of ebpfmon this assumes a little endian host
+func getBits(data []byte, offset int, bits int) uint64 {
+	if offset%8 == 0 && bits%8 == 0 && bits <= 64 {
+		buf := make([]byte, 8)
+		copy(buf, data[offset/8:(offset+bits)/8])
+		return binary.LittleEndian.Uint64(buf)
+	}
+
+	var v uint64
+	for i := 0; i < bits; i++ {
+		bit := offset + i
+		if data[bit/8]&(1<<(bit%8)) != 0 {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+func setBits(data []byte, offset int, bits int, v uint64) {
+	for i := 0; i < bits; i++ {
+		bit := offset + i
+		if v&(1<<i) != 0 {
+			data[bit/8] |= 1 << (bit % 8)
+		} else {
+			data[bit/8] &^= 1 << (bit % 8)
+		}
+	}
+}
+
+func (f BtfField) checkBounds(data []byte) error {
+	if f.BitOffset < 0 || (f.BitOffset+f.Bits+7)/8 > len(data) {
+		return fmt.Errorf("%s is outside of the %d bytes of data", f.Path, len(data))
+	}
+	if f.Kind != BtfFieldString && (f.Bits <= 0 || f.Bits > 64) {
+		return fmt.Errorf("%s has an unsupported size of %d bits", f.Path, f.Bits)
+	}
+	return nil
+}
+
+// Sign extend the lowest bits of v
+func signExtend(v uint64, bits int) int64 {
+	shift := 64 - bits
+	return int64(v<<shift) >> shift
+}
+
+// Read the field from a key or value and print it
+func (f BtfField) Decode(data []byte) (string, error) {
+	err := f.checkBounds(data)
+	if err != nil {
+		return "", err
+	}
+
+	if f.Kind == BtfFieldString {
+		s := data[f.BitOffset/8 : (f.BitOffset+f.Bits)/8]
+		if str, ok := printableString(s); ok {
+			return str, nil
+		}
+		return "0x" + hex.EncodeToString(s), nil
+	}
+
+	v := getBits(data, f.BitOffset, f.Bits)
+	switch f.Kind {
+	case BtfFieldBool:
+		return strconv.FormatBool(v != 0), nil
+	case BtfFieldFloat:
+		if f.Bits == 32 {
+			return strconv.FormatFloat(float64(math.Float32frombits(uint32(v))), 'g', -1, 32), nil
+		}
+		return strconv.FormatFloat(math.Float64frombits(v), 'g', -1, 64), nil
+	case BtfFieldEnum:
+		for _, e := range f.Values {
+			if (f.Signed && e.Value == signExtend(v, f.Bits)) || (!f.Signed && uint64(e.Value) == v) {
+				return e.Name, nil
+			}
+		}
+	}
+
+	if f.Pointer {
+		return fmt.Sprintf("%#x", v), nil
+	}
+	if f.Signed {
+		return strconv.FormatInt(signExtend(v, f.Bits), 10), nil
+	}
+	return strconv.FormatUint(v, 10), nil
+}
+
+// Parse an integer and make sure it fits in the field
+func (f BtfField) parseInt(text string) (uint64, error) {
+	if f.Signed {
+		v, err := strconv.ParseInt(text, 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s (%s) expects an integer: %s", f.Path, f.CType, text)
+		}
+		min := int64(-1) << (f.Bits - 1)
+		max := -(min + 1)
+		if v < min || v > max {
+			return 0, fmt.Errorf("%s (%s) must be between %d and %d", f.Path, f.CType, min, max)
+		}
+		return uint64(v), nil
+	}
+
+	if strings.HasPrefix(text, "-") {
+		return 0, fmt.Errorf("%s (%s) is unsigned and can't be negative", f.Path, f.CType)
+	}
+	v, err := strconv.ParseUint(text, 0, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s (%s) expects an integer: %s", f.Path, f.CType, text)
+	}
+	max := uint64(math.MaxUint64) >> (64 - f.Bits)
+	if v > max {
+		return 0, fmt.Errorf("%s (%s) must be between 0 and %d", f.Path, f.CType, max)
+	}
+	return v, nil
+}
+
+// Get the string held by a byte array. It has to be printable up to the first
+// NUL and only hold zeroes after it, otherwise writing the string back would
+// change bytes that were never shown
+func printableString(s []byte) (string, bool) {
+	end := len(s)
+	if i := strings.IndexByte(string(s), 0); i >= 0 {
+		end = i
+	}
+	for _, b := range s[end:] {
+		if b != 0 {
+			return "", false
+		}
+	}
+	for _, r := range string(s[:end]) {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return "", false
+		}
+	}
+	return string(s[:end]), true
+}
+
+// Parse the hex form of a byte array of size bytes i.e. 0xfe80. A string can
+// never be mistaken for it since it would need more than size bytes
+func hexBytes(text string, size int) ([]byte, bool) {
+	if !strings.HasPrefix(text, "0x") || len(text) != 2+2*size {
+		return nil, false
+	}
+	b, err := hex.DecodeString(text[2:])
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Parse text and write it into the field of a key or value. data is only
+// changed if text is valid for the type of the field
+func (f BtfField) Encode(data []byte, text string) error {
+	err := f.checkBounds(data)
+	if err != nil {
+		return err
+	}
+	text = strings.TrimSpace(text)
+
+	var v uint64
+	switch f.Kind {
+	case BtfFieldString:
+		if strings.HasPrefix(text, `"`) {
+			text, err = strconv.Unquote(text)
+			if err != nil {
+				return fmt.Errorf("%s (%s) is not a valid quoted string", f.Path, f.CType)
+			}
+		}
+		s := data[f.BitOffset/8 : (f.BitOffset+f.Bits)/8]
+		if b, ok := hexBytes(text, len(s)); ok {
+			copy(s, b)
+			return nil
+		}
+		if len(text) > len(s) {
+			return fmt.Errorf("%s (%s) can hold at most %d bytes", f.Path, f.CType, len(s))
+		}
+		copy(s, text)
+		for i := len(text); i < len(s); i++ {
+			s[i] = 0
+		}
+		return nil
+	case BtfFieldBool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return fmt.Errorf("%s (%s) expects true or false", f.Path, f.CType)
+		}
+		if b {
+			v = 1
+		}
+	case BtfFieldFloat:
+		fl, err := strconv.ParseFloat(text, f.Bits)
+		if err != nil {
+			return fmt.Errorf("%s (%s) expects a number: %s", f.Path, f.CType, text)
+		}
+		if f.Bits == 32 {
+			v = uint64(math.Float32bits(float32(fl)))
+		} else {
+			v = math.Float64bits(fl)
+		}
+	case BtfFieldEnum:
+		found := false
+		for _, e := range f.Values {
+			if e.Name == text {
+				v = uint64(e.Value) & (math.MaxUint64 >> (64 - f.Bits))
+				found = true
+				break
+			}
+		}
+		if !found {
+			v, err = f.parseInt(text)
+			if err != nil {
+				names := []string{}
+				for _, e := range f.Values {
+					names = append(names, e.Name)
+				}
+				return fmt.Errorf("%v. The names of its values are %s", err, strings.Join(names, ", "))
+			}
+		}
+	default:
+		v, err = f.parseInt(text)
+		if err != nil {
+			return err
+		}
+	}
+
+	setBits(data, f.BitOffset, f.Bits, v)
+	return nil
+}
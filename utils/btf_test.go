@@ -0,0 +1,128 @@
+package utils
+
+import "testing"
+
+// struct config { __u32 pid; int delta; enum mode mode; char comm[8]; unsigned int flag:1, level:3; bool on; }
+const configBtf = `{"types":[
+	{"id":1,"kind":"INT","name":"unsigned int","size":4,"bits_offset":0,"nr_bits":32,"encoding":"(none)"},
+	{"id":2,"kind":"TYPEDEF","name":"__u32","type_id":1},
+	{"id":3,"kind":"INT","name":"int","size":4,"bits_offset":0,"nr_bits":32,"encoding":"SIGNED"},
+	{"id":4,"kind":"ENUM","name":"mode","encoding":"UNSIGNED","size":4,"vlen":2,"values":[{"name":"MODE_OFF","val":0},{"name":"MODE_ON","val":1}]},
+	{"id":5,"kind":"INT","name":"char","size":1,"bits_offset":0,"nr_bits":8,"encoding":"SIGNED"},
+	{"id":6,"kind":"ARRAY","name":"","type_id":5,"index_type_id":1,"nr_elems":8},
+	{"id":7,"kind":"INT","name":"_Bool","size":1,"bits_offset":0,"nr_bits":8,"encoding":"BOOL"},
+	{"id":8,"kind":"STRUCT","name":"config","size":24,"vlen":7,"members":[
+		{"name":"pid","type_id":2,"bits_offset":0},
+		{"name":"delta","type_id":3,"bits_offset":32},
+		{"name":"mode","type_id":4,"bits_offset":64},
+		{"name":"comm","type_id":6,"bits_offset":96},
+		{"name":"flag","type_id":1,"bits_offset":160,"bitfield_size":1},
+		{"name":"level","type_id":1,"bits_offset":161,"bitfield_size":3},
+		{"name":"on","type_id":7,"bits_offset":168}
+	]}
+]}`
+
+func replayMapBtf(t *testing.T) *BpftoolBackend {
+	outputs := map[string]string{
+		"-j map show id 4":        `{"id":4,"type":"array","name":"config","bytes_key":4,"bytes_value":24,"max_entries":1,"btf_id":9}`,
+		"-j btf dump map id 4 kv": `{"types":[{"id":2,"kind":"TYPEDEF","name":"__u32","type_id":1},{"id":8,"kind":"STRUCT","name":"config","size":24,"vlen":7,"members":[]}]}`,
+		"-j btf dump id 9":        configBtf,
+		"-j map show id 5":        `{"id":5,"type":"hash","name":"nobtf","bytes_key":4,"bytes_value":4,"max_entries":1}`,
+	}
+	return NewReplayBackend(t, outputs)
+}
+
+func TestBtfFields(t *testing.T) {
+	backend := replayMapBtf(t)
+	m, err := backend.MapBtf(4)
+	if err != nil {
+		t.Fatalf("Failed to get map btf: %v", err)
+	}
+	if m.KeyTypeId != 2 || m.ValueTypeId != 8 {
+		t.Fatalf("Unexpected key and value types %d %d", m.KeyTypeId, m.ValueTypeId)
+	}
+	if _, err := backend.MapBtf(5); err == nil {
+		t.Errorf("Expected an error for a map without btf")
+	}
+
+	fields, err := m.Btf.Fields(m.ValueTypeId, "value")
+	if err != nil {
+		t.Fatalf("Failed to get fields: %v", err)
+	}
+	expected := []string{"value.pid __u32", "value.delta int", "value.mode enum mode", "value.comm char[8]", "value.flag unsigned int:1", "value.level unsigned int:3", "value.on _Bool"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %d fields, got %+v", len(expected), fields)
+	}
+	for i, f := range fields {
+		if f.Path+" "+f.CType != expected[i] {
+			t.Errorf("Expected %s, got %s %s", expected[i], f.Path, f.CType)
+		}
+	}
+
+	data := make([]byte, 24)
+	inputs := []string{"4294967295", "-2", "MODE_ON", "bash", "1", "5", "true"}
+	for i, f := range fields {
+		err := f.Encode(data, inputs[i])
+		if err != nil {
+			t.Fatalf("Failed to encode %s: %v", f.Path, err)
+		}
+	}
+	for i, f := range fields {
+		text, err := f.Decode(data)
+		if err != nil || text != inputs[i] {
+			t.Errorf("Expected %s for %s, got %s (%v)", inputs[i], f.Path, text, err)
+		}
+	}
+	if data[4] != 0xfe || data[7] != 0xff || data[20] != 0x0b {
+		t.Errorf("Unexpected encoding % x", data)
+	}
+
+	invalid := map[int]string{
+		0: "-1",
+		1: "2147483648",
+		2: "MODE_MAYBE",
+		3: "much too long",
+		5: "8",
+		6: "maybe",
+	}
+	for i, text := range invalid {
+		before := append([]byte{}, data...)
+		if err := fields[i].Encode(data, text); err == nil {
+			t.Errorf("Expected %s to be rejected for %s", text, fields[i].Path)
+		}
+		if string(before) != string(data) {
+			t.Errorf("Expected the data to be unchanged after rejecting %s", text)
+		}
+	}
+
+	if err := fields[0].Encode(data, "0x10"); err != nil || data[0] != 0x10 {
+		t.Errorf("Expected hex input to be accepted: %v", err)
+	}
+}
+
+func TestBtfByteArray(t *testing.T) {
+	comm := BtfField{Path: "value.comm", CType: "char[8]", Kind: BtfFieldString, Bits: 64}
+
+	// Bytes that aren't a string are shown and written back as hex
+	data := []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0x01}
+	text, err := comm.Decode(data)
+	if err != nil || text != "0xfe80000000000001" {
+		t.Fatalf("Expected hex for non string bytes, got %s (%v)", text, err)
+	}
+	if err := comm.Encode(data, "0x0102030405060708"); err != nil || data[0] != 1 || data[7] != 8 {
+		t.Errorf("Expected hex input to be written as is: % x (%v)", data, err)
+	}
+
+	// A string followed by something other than zeroes is not a string
+	copy(data, "ab\x00cdefg")
+	if text, _ := comm.Decode(data); text != "0x6162006364656667" {
+		t.Errorf("Expected bytes after the NUL to be kept, got %s", text)
+	}
+
+	if err := comm.Encode(data, "0x12"); err != nil || string(data) != "0x12\x00\x00\x00\x00" {
+		t.Errorf("Expected a short hex value to be a string: %q (%v)", data, err)
+	}
+	if text, _ := comm.Decode(data); text != "0x12" {
+		t.Errorf("Expected the string 0x12, got %s", text)
+	}
+}
@@ -0,0 +1,133 @@
+// The utils/btfc.go file renders btf types as C declarations the same way
+// `bpftool btf dump format c` does, one declaration per block. It is only
+// meant to be read so the declarations are in the order of their type ids
+// rather than in an order a compiler would accept
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Types nested deeper than this are most likely a loop in broken btf
+const maxCDeclDepth = 32
+
+// Render every named struct, union, enum, typedef and forward declaration of
+// the object as C. Declarations are separated by a blank line. The types of
+// the base of split btf aren't rendered
+func (b *Btf) CText() string {
+	ids := []int{}
+	for id := range b.Types {
+		if id >= b.firstId {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+
+	decls := []string{}
+	for _, id := range ids {
+		t := b.Types[id]
+		if t.Name == "" {
+			continue
+		}
+		switch t.Kind {
+		case "STRUCT", "UNION", "ENUM", "ENUM64":
+			decls = append(decls, b.cBody(t, 0, 0)+";")
+		case "FWD":
+			decls = append(decls, b.TypeName(id)+";")
+		case "TYPEDEF":
+			decls = append(decls, "typedef "+b.cDeclarator(t.TypeId, t.Name, 0, 0)+";")
+		}
+	}
+	if len(decls) == 0 {
+		return ""
+	}
+	return strings.Join(decls, "\n\n") + "\n"
+}
+
+// Add the name (or the rest of the declarator) after a type
+func withDeclarator(typeName string, inner string) string {
+	if inner == "" {
+		return typeName
+	}
+	return typeName + " " + inner
+}
+
+// Render the definition of a struct, union or enum without the trailing
+// semicolon. indent is the depth of the definition when it is nested in
+// another one
+func (b *Btf) cBody(t BtfType, indent int, depth int) string {
+	keyword := strings.ToLower(strings.TrimSuffix(t.Kind, "64"))
+	head := keyword
+	if t.Name != "" {
+		head += " " + t.Name
+	}
+	tabs := strings.Repeat("\t", indent+1)
+
+	lines := []string{head + " {"}
+	for _, m := range t.Members {
+		line := tabs + b.cDeclarator(m.TypeId, m.Name, indent+1, depth+1)
+		if m.BitfieldSize > 0 {
+			line += fmt.Sprintf(": %d", m.BitfieldSize)
+		}
+		lines = append(lines, line+";")
+	}
+	for _, v := range t.Values {
+		lines = append(lines, fmt.Sprintf("%s%s = %d,", tabs, v.Name, v.Value))
+	}
+	lines = append(lines, strings.Repeat("\t", indent)+"}")
+	return strings.Join(lines, "\n")
+}
+
+// Render a declaration of inner with the type id i.e. `char *comm[16]` or
+// `int (*handler)(void *)`. Pointers, arrays and function prototypes wrap
+// inner the way C declarators do
+func (b *Btf) cDeclarator(id int, inner string, indent int, depth int) string {
+	t, err := b.lookup(id)
+	if err != nil || depth > maxCDeclDepth {
+		return withDeclarator("?", inner)
+	}
+
+	switch t.Kind {
+	case "STRUCT", "UNION", "ENUM", "ENUM64":
+		if t.Name == "" {
+			return withDeclarator(b.cBody(t, indent, depth), inner)
+		}
+		return withDeclarator(b.TypeName(id), inner)
+	case "VOID", "FWD":
+		return withDeclarator(b.TypeName(id), inner)
+	case "PTR":
+		target, _ := b.lookup(t.TypeId)
+		if target.Kind == "ARRAY" || target.Kind == "FUNC_PROTO" {
+			return b.cDeclarator(t.TypeId, "(*"+inner+")", indent, depth+1)
+		}
+		return b.cDeclarator(t.TypeId, "*"+inner, indent, depth+1)
+	case "CONST", "VOLATILE", "RESTRICT":
+		qualifier := strings.ToLower(t.Kind)
+		target, _ := b.lookup(t.TypeId)
+		// A qualified pointer is written after the star i.e. `char *const p`
+		if target.Kind == "PTR" {
+			return b.cDeclarator(t.TypeId, withDeclarator(qualifier, inner), indent, depth+1)
+		}
+		return qualifier + " " + b.cDeclarator(t.TypeId, inner, indent, depth+1)
+	case "TYPE_TAG":
+		return b.cDeclarator(t.TypeId, inner, indent, depth+1)
+	case "ARRAY":
+		return b.cDeclarator(t.TypeId, fmt.Sprintf("%s[%d]", inner, t.NrElems), indent, depth+1)
+	case "FUNC_PROTO":
+		params := []string{}
+		for _, p := range t.Params {
+			if p.TypeId == 0 && p.Name == "" {
+				params = append(params, "...")
+				continue
+			}
+			params = append(params, b.cDeclarator(p.TypeId, p.Name, indent, depth+1))
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		return b.cDeclarator(t.RetTypeId, inner+"("+strings.Join(params, ", ")+")", indent, depth+1)
+	}
+	return withDeclarator(t.Name, inner)
+}
@@ -0,0 +1,124 @@
+// The utils/btfobjects.go file lists the btf objects that are loaded in the
+// kernel (vmlinux, kernel modules and the btf of programs and maps) and splits
+// their C rendering (`bpftool btf dump format c`) into declarations that can be
+// searched by name
+package utils
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// A btf object as printed by `bpftool btf show -j`
+type BtfObject struct {
+	Id     int    `json:"id"`
+	Size   int    `json:"size"`
+	Name   string `json:"name,omitempty"`
+	Kernel bool   `json:"kernel"`
+
+	// The programs and maps that were loaded with this btf
+	ProgIds []int `json:"prog_ids,omitempty"`
+	MapIds  []int `json:"map_ids,omitempty"`
+
+	// The processes holding the btf object
+	Pids []ProcessInfo `json:"pids,omitempty"`
+}
+
+// Describe where a btf object comes from: vmlinux, module or program
+func (o BtfObject) Kind() string {
+	if !o.Kernel {
+		return "program"
+	}
+	if o.Name == "vmlinux" {
+		return "vmlinux"
+	}
+	return "module"
+}
+
+// Get every btf object
+func GetBtfObjects() ([]BtfObject, error) {
+	return CurrentBackend().BtfObjects()
+}
+
+// Get the types of a btf object rendered as C
+func GetBtfC(btfId int) (string, error) {
+	return CurrentBackend().BtfC(btfId)
+}
+
+// A top level declaration in the C rendering of a btf object
+type CDecl struct {
+	// i.e. `struct event`, `enum state` or `u32` for a typedef
+	Name string
+	Text string
+}
+
+var (
+	cTaggedRegex  = regexp.MustCompile(`^(?:typedef\s+)?(struct|union|enum)\s+(\w+)\s*\{`)
+	cFuncPtrRegex = regexp.MustCompile(`\(\s*\*\s*(\w+)\s*\)`)
+	cLastIdRegex  = regexp.MustCompile(`(\w+)\s*(?:\[[^\]]*\]\s*)*(?:__attribute__\(\(.*\)\)\s*)?;\s*$`)
+)
+
+// Find the name a declaration defines
+func cDeclName(text string) string {
+	lines := strings.Split(text, "\n")
+	first := lines[0]
+	last := lines[len(lines)-1]
+
+	if strings.HasPrefix(first, "typedef") {
+		if len(lines) == 1 {
+			if m := cFuncPtrRegex.FindStringSubmatch(first); m != nil {
+				return m[1]
+			}
+		}
+		if m := cLastIdRegex.FindStringSubmatch(last); m != nil {
+			return m[1]
+		}
+		return first
+	}
+	if m := cTaggedRegex.FindStringSubmatch(first); m != nil {
+		return m[1] + " " + m[2]
+	}
+	// Forward declarations (struct foo;) and anything else
+	return strings.TrimSuffix(strings.TrimSpace(first), ";")
+}
+
+// Split the output of `bpftool btf dump format c` into its declarations. bpftool
+// separates them with blank lines. The header guard and pragmas are dropped
+func SplitCDecls(text string) []CDecl {
+	decls := []CDecl{}
+	for _, block := range strings.Split(text, "\n\n") {
+		block = strings.Trim(block, "\n")
+		if block == "" || strings.HasPrefix(block, "#") {
+			continue
+		}
+		decls = append(decls, CDecl{Name: cDeclName(block), Text: block})
+	}
+	return decls
+}
+
+// Find the declarations whose name contains query. Declarations named exactly
+// query (with or without the struct/union/enum keyword) come first
+func SearchCDecls(decls []CDecl, query string) []CDecl {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return decls
+	}
+
+	exact := []CDecl{}
+	partial := []CDecl{}
+	for _, d := range decls {
+		_, name, found := strings.Cut(d.Name, " ")
+		if !found {
+			name = d.Name
+		}
+		switch {
+		case d.Name == query || name == query:
+			exact = append(exact, d)
+		case strings.Contains(d.Name, query):
+			partial = append(partial, d)
+		}
+	}
+	sort.SliceStable(partial, func(i, j int) bool { return len(partial[i].Name) < len(partial[j].Name) })
+	return append(exact, partial...)
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// Trimmed down output of `bpftool btf dump id 1 format c`
+const testBtfC = `#ifndef __VMLINUX_H__
+#define __VMLINUX_H__
+
+#ifndef BPF_NO_PRESERVE_ACCESS_INDEX
+#pragma clang attribute push (__attribute__((preserve_access_index)), apply_to = record)
+#endif
+
+typedef unsigned int __u32;
+
+typedef __u32 u32;
+
+struct task_struct;
+
+struct event {
+	u32 pid;
+	char comm[16];
+};
+
+typedef struct {
+	int counter;
+} atomic_t;
+
+typedef int (*handler_t)(struct event *);
+
+enum state {
+	STATE_IDLE = 0,
+	STATE_BUSY = 1,
+};
+
+struct event_stats {
+	__u32 count;
+};
+
+#ifndef BPF_NO_PRESERVE_ACCESS_INDEX
+#pragma clang attribute pop
+#endif
+
+#endif /* __VMLINUX_H__ */
+`
+
+func TestBtfObjects(t *testing.T) {
+	outputs := map[string]string{
+		"-j btf show": `[
+			{"id":1,"size":5976078,"prog_ids":[],"map_ids":[],"kernel":true,"name":"vmlinux"},
+			{"id":2,"size":2912,"prog_ids":[],"map_ids":[],"kernel":true,"name":"nf_tables"},
+			{"id":7,"size":1024,"prog_ids":[10,11],"map_ids":[4],"kernel":false,"pids":[{"pid":42,"comm":"agent"}]}
+		]`,
+		"btf dump id 1 format c": testBtfC,
+	}
+	UseReplayBackend(t, outputs)
+
+	objects, err := GetBtfObjects()
+	if err != nil {
+		t.Fatalf("Failed to get the btf objects: %v", err)
+	}
+	kinds := []string{}
+	for _, o := range objects {
+		kinds = append(kinds, o.Kind())
+	}
+	if !reflect.DeepEqual(kinds, []string{"vmlinux", "module", "program"}) {
+		t.Errorf("Unexpected kinds %q", kinds)
+	}
+	if !reflect.DeepEqual(objects[2].ProgIds, []int{10, 11}) || !reflect.DeepEqual(objects[2].MapIds, []int{4}) {
+		t.Errorf("Unexpected references %+v", objects[2])
+	}
+
+	c, err := GetBtfC(1)
+	if err != nil {
+		t.Fatalf("Failed to dump the btf as C: %v", err)
+	}
+	decls := SplitCDecls(c)
+	names := []string{}
+	for _, d := range decls {
+		names = append(names, d.Name)
+	}
+	expected := []string{"__u32", "u32", "struct task_struct", "struct event", "atomic_t", "handler_t", "enum state", "struct event_stats"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Unexpected declarations %q", names)
+	}
+	if decls[3].Text != "struct event {\n\tu32 pid;\n\tchar comm[16];\n};" {
+		t.Errorf("Unexpected text of struct event %q", decls[3].Text)
+	}
+
+	// Exact matches come first and the struct keyword is optional
+	names = []string{}
+	for _, d := range SearchCDecls(decls, "event") {
+		names = append(names, d.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"struct event", "struct event_stats"}) {
+		t.Errorf("Unexpected search results %q", names)
+	}
+	if len(SearchCDecls(decls, "")) != len(decls) {
+		t.Errorf("An empty search should match every declaration")
+	}
+}
+
+func TestBtfDeclName(t *testing.T) {
+	btf := NewBtf([]BtfType{
+		{Id: 1, Kind: "INT", Name: "unsigned int", Size: 4},
+		{Id: 2, Kind: "TYPEDEF", Name: "u32", TypeId: 1},
+		{Id: 3, Kind: "STRUCT", Name: "event", Size: 4, Members: []BtfMember{{Name: "pid", TypeId: 2}}},
+		{Id: 4, Kind: "CONST", TypeId: 3},
+		{Id: 5, Kind: "PTR", TypeId: 4},
+		{Id: 6, Kind: "ARRAY", TypeId: 5, NrElems: 4},
+		{Id: 7, Kind: "STRUCT", Size: 4},
+	})
+	for id, expected := range map[int]string{2: "u32", 3: "struct event", 6: "struct event", 7: ""} {
+		if name := btf.DeclName(id); name != expected {
+			t.Errorf("Expected %q for type %d, got %q", expected, id, name)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+// The utils/btfraw.go file decodes btf in the binary format the kernel hands
+// out (BPF_OBJ_GET_INFO_BY_FD and /sys/kernel/btf) into the same types bpftool
+// prints with `bpftool btf dump -j` so the native backend doesn't need bpftool
+// to edit map entries field by field or render btf as C
+package utils
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const btfMagic = 0xeb9f
+
+// The btf kinds in the order of their BTF_KIND_* values
+var btfKindNames = []string{
+	"UNKN", "INT", "PTR", "ARRAY", "STRUCT", "UNION", "ENUM", "FWD", "TYPEDEF",
+	"VOLATILE", "CONST", "RESTRICT", "FUNC", "FUNC_PROTO", "VAR", "DATASEC",
+	"FLOAT", "DECL_TAG", "TYPE_TAG", "ENUM64",
+}
+
+// The encoding bits of an int (BTF_INT_SIGNED, BTF_INT_CHAR and BTF_INT_BOOL)
+var btfIntEncodings = map[uint32]string{
+	0: "(none)",
+	1: "SIGNED",
+	2: "CHAR",
+	4: "BOOL",
+}
+
+// Reads the type section of raw btf one field at a time
+type btfReader struct {
+	order binary.ByteOrder
+	data  []byte
+	pos   int
+}
+
+func (r *btfReader) u32() (uint32, error) {
+	if r.pos+4 > len(r.data) {
+		return 0, errors.New("btf type section is truncated")
+	}
+	v := r.order.Uint32(r.data[r.pos:])
+	r.pos += 4
+	return v, nil
+}
+
+// Read count u32s at once
+func (r *btfReader) u32s(count int) ([]uint32, error) {
+	result := make([]uint32, count)
+	for i := range result {
+		v, err := r.u32()
+		if err != nil {
+			return nil, err
+		}
+		result[i] = v
+	}
+	return result, nil
+}
+
+// Get the string at an offset of the string section. Split btf (kernel
+// modules) continues the string section of its base so offsets below the size
+// of the base strings are looked up there
+func (b *Btf) btfString(offset uint32) string {
+	strs := b.rawStrings
+	if b.base != nil {
+		if int(offset) < len(b.base.rawStrings) {
+			return b.base.btfString(offset)
+		}
+		offset -= uint32(len(b.base.rawStrings))
+	}
+	if int(offset) >= len(strs) {
+		return ""
+	}
+	end := int(offset)
+	for end < len(strs) && strs[end] != 0 {
+		end++
+	}
+	return string(strs[offset:end])
+}
+
+// Decode raw btf. base is the btf split btf was built on top of (vmlinux for
+// the btf of kernel modules) and nil otherwise. The types of base can be
+// looked up in the result as well
+func ParseRawBtf(data []byte, base *Btf) (*Btf, error) {
+	if len(data) < 24 {
+		return nil, errors.New("btf is too short for its header")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	if order.Uint16(data) != btfMagic {
+		order = binary.BigEndian
+		if order.Uint16(data) != btfMagic {
+			return nil, errors.New("btf has an invalid magic")
+		}
+	}
+	hdrLen := order.Uint32(data[4:])
+	typeOff, typeLen := order.Uint32(data[8:]), order.Uint32(data[12:])
+	strOff, strLen := order.Uint32(data[16:]), order.Uint32(data[20:])
+	typeStart, strStart := uint64(hdrLen)+uint64(typeOff), uint64(hdrLen)+uint64(strOff)
+	if typeStart+uint64(typeLen) > uint64(len(data)) || strStart+uint64(strLen) > uint64(len(data)) {
+		return nil, errors.New("btf sections are outside of the data")
+	}
+
+	b := &Btf{Types: map[int]BtfType{}, firstId: 1, base: base}
+	b.rawStrings = data[strStart : strStart+uint64(strLen)]
+	if base != nil {
+		for id, t := range base.Types {
+			b.Types[id] = t
+			if id >= b.firstId {
+				b.firstId = id + 1
+			}
+		}
+	}
+
+	r := &btfReader{order: order, data: data[typeStart : typeStart+uint64(typeLen)]}
+	for id := b.firstId; r.pos < len(r.data); id++ {
+		t, err := b.parseType(r, id)
+		if err != nil {
+			return nil, fmt.Errorf("btf type %d: %v", id, err)
+		}
+		b.Types[id] = t
+	}
+	return b, nil
+}
+
+// Decode the type at the position of the reader along with the data that
+// follows it
+func (b *Btf) parseType(r *btfReader, id int) (BtfType, error) {
+	header, err := r.u32s(3)
+	if err != nil {
+		return BtfType{}, err
+	}
+	info := header[1]
+	vlen := int(info & 0xffff)
+	kind := int(info>>24) & 0x1f
+	kindFlag := info>>31 == 1
+	if kind <= 0 || kind >= len(btfKindNames) {
+		return BtfType{}, fmt.Errorf("unknown kind %d", kind)
+	}
+	t := BtfType{Id: id, Kind: btfKindNames[kind], Name: b.btfString(header[0])}
+
+	// The last header field is the size for sized types and the type
+	// referred to for everything else
+	switch t.Kind {
+	case "INT", "STRUCT", "UNION", "ENUM", "ENUM64", "DATASEC", "FLOAT":
+		t.Size = int(header[2])
+	case "FUNC_PROTO":
+		t.RetTypeId = int(header[2])
+	default:
+		t.TypeId = int(header[2])
+	}
+
+	switch t.Kind {
+	case "INT":
+		v, err := r.u32()
+		if err != nil {
+			return t, err
+		}
+		t.NrBits = int(v & 0xff)
+		t.BitsOffset = int(v>>16) & 0xff
+		t.Encoding = btfIntEncodings[v>>24&0xf]
+		if t.Encoding == "" {
+			t.Encoding = "UNKN"
+		}
+	case "ARRAY":
+		v, err := r.u32s(3)
+		if err != nil {
+			return t, err
+		}
+		t.TypeId = int(v[0])
+		t.NrElems = int(v[2])
+	case "STRUCT", "UNION":
+		for i := 0; i < vlen; i++ {
+			v, err := r.u32s(3)
+			if err != nil {
+				return t, err
+			}
+			m := BtfMember{Name: b.btfString(v[0]), TypeId: int(v[1]), BitsOffset: int(v[2])}
+			if kindFlag {
+				m.BitsOffset = int(v[2] & 0xffffff)
+				m.BitfieldSize = int(v[2] >> 24)
+			}
+			t.Members = append(t.Members, m)
+		}
+	case "ENUM", "ENUM64":
+		t.Encoding = "UNSIGNED"
+		if kindFlag {
+			t.Encoding = "SIGNED"
+		}
+		for i := 0; i < vlen; i++ {
+			size := 2
+			if t.Kind == "ENUM64" {
+				size = 3
+			}
+			v, err := r.u32s(size)
+			if err != nil {
+				return t, err
+			}
+			value := int64(v[1])
+			if t.Kind == "ENUM64" {
+				value = int64(uint64(v[2])<<32 | uint64(v[1]))
+			} else if kindFlag {
+				value = int64(int32(v[1]))
+			}
+			t.Values = append(t.Values, BtfEnumValue{Name: b.btfString(v[0]), Value: value})
+		}
+	case "FWD":
+		t.FwdKind = "struct"
+		if kindFlag {
+			t.FwdKind = "union"
+		}
+	case "FUNC_PROTO":
+		for i := 0; i < vlen; i++ {
+			v, err := r.u32s(2)
+			if err != nil {
+				return t, err
+			}
+			t.Params = append(t.Params, BtfParam{Name: b.btfString(v[0]), TypeId: int(v[1])})
+		}
+	case "VAR", "DECL_TAG":
+		_, err = r.u32()
+	case "DATASEC":
+		_, err = r.u32s(3 * vlen)
+	}
+	return t, err
+}
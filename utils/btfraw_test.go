@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// Builds raw btf the way the kernel lays it out
+type rawBtfBuilder struct {
+	types   []uint32
+	strings []byte
+}
+
+func newRawBtfBuilder() *rawBtfBuilder {
+	return &rawBtfBuilder{strings: []byte{0}}
+}
+
+func (r *rawBtfBuilder) str(s string) uint32 {
+	if s == "" {
+		return 0
+	}
+	offset := uint32(len(r.strings))
+	r.strings = append(append(r.strings, s...), 0)
+	return offset
+}
+
+func (r *rawBtfBuilder) add(name string, kind int, kindFlag bool, vlen int, sizeOrType uint32, extra ...uint32) {
+	info := uint32(kind)<<24 | uint32(vlen)
+	if kindFlag {
+		info |= 1 << 31
+	}
+	r.types = append(append(r.types, r.str(name), info, sizeOrType), extra...)
+}
+
+func (r *rawBtfBuilder) bytes() []byte {
+	typeLen := uint32(len(r.types) * 4)
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint16(data, btfMagic)
+	data[2] = 1
+	binary.LittleEndian.PutUint32(data[4:], 24)
+	binary.LittleEndian.PutUint32(data[8:], 0)
+	binary.LittleEndian.PutUint32(data[12:], typeLen)
+	binary.LittleEndian.PutUint32(data[16:], typeLen)
+	binary.LittleEndian.PutUint32(data[20:], uint32(len(r.strings)))
+	for _, v := range r.types {
+		word := make([]byte, 4)
+		binary.LittleEndian.PutUint32(word, v)
+		data = append(data, word...)
+	}
+	return append(data, r.strings...)
+}
+
+// struct event { unsigned int pid; unsigned int flag:1; char comm[16]; };
+// enum mode { MODE_A = -1 }; typedef unsigned int (*handler_t)(unsigned int, ...);
+func testRawBtf() *rawBtfBuilder {
+	r := newRawBtfBuilder()
+	r.add("unsigned int", 1, false, 0, 4, 32)
+	r.add("event", 4, true, 3, 24, r.str("pid"), 1, 0, r.str("flag"), 1, 1<<24|32, r.str("comm"), 7, 64)
+	r.add("", 2, false, 0, 4)
+	r.add("", 13, false, 2, 1, 0, 1, 0, 0)
+	r.add("handler_t", 8, false, 0, 3)
+	r.add("mode", 6, true, 1, 4, r.str("MODE_A"), 0xffffffff)
+	r.add("", 3, false, 0, 0, 8, 1, 16)
+	r.add("char", 1, false, 0, 1, 2<<24|8)
+	return r
+}
+
+func TestParseRawBtf(t *testing.T) {
+	b, err := ParseRawBtf(testRawBtf().bytes(), nil)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if len(b.Types) != 8 {
+		t.Fatalf("Expected 8 types, got %d", len(b.Types))
+	}
+
+	event := b.Types[2]
+	if event.Kind != "STRUCT" || event.Name != "event" || event.Size != 24 || len(event.Members) != 3 {
+		t.Fatalf("Unexpected struct %+v", event)
+	}
+	if m := event.Members[1]; m.Name != "flag" || m.BitsOffset != 32 || m.BitfieldSize != 1 {
+		t.Errorf("Unexpected bitfield %+v", m)
+	}
+	if mode := b.Types[6]; mode.Encoding != "SIGNED" || mode.Values[0].Value != -1 {
+		t.Errorf("Unexpected enum %+v", mode)
+	}
+	if c := b.Types[8]; c.Encoding != "CHAR" || c.NrBits != 8 {
+		t.Errorf("Unexpected char %+v", c)
+	}
+
+	// The fields can be edited the same way as the ones bpftool prints
+	fields, err := b.Fields(2, "value")
+	if err != nil || len(fields) != 3 || fields[2].Kind != BtfFieldString {
+		t.Errorf("Unexpected fields %+v (%v)", fields, err)
+	}
+
+	text := b.CText()
+	for _, decl := range []string{
+		"struct event {\n\tunsigned int pid;\n\tunsigned int flag: 1;\n\tchar comm[16];\n};",
+		"typedef unsigned int (*handler_t)(unsigned int, ...);",
+		"enum mode {\n\tMODE_A = -1,\n};",
+	} {
+		if !strings.Contains(text, decl) {
+			t.Errorf("Expected %q in\n%s", decl, text)
+		}
+	}
+	if decls := SplitCDecls(text); len(decls) != 3 || decls[1].Name != "handler_t" {
+		t.Errorf("Unexpected declarations %+v", decls)
+	}
+
+	if _, err := ParseRawBtf([]byte{1, 2, 3}, nil); err == nil {
+		t.Errorf("Expected truncated btf to be rejected")
+	}
+}
+
+func TestParseSplitBtf(t *testing.T) {
+	base := testRawBtf()
+	b, err := ParseRawBtf(base.bytes(), nil)
+	if err != nil {
+		t.Fatalf("Failed to parse the base: %v", err)
+	}
+
+	// Split btf continues the type ids and string offsets of its base
+	split := &rawBtfBuilder{}
+	offset := uint32(len(base.strings))
+	split.strings = []byte("mod_stats\x00count\x00")
+	split.types = []uint32{offset, 4<<24 | 1, 4, offset + 10, 1, 0}
+	module, err := ParseRawBtf(split.bytes(), b)
+	if err != nil {
+		t.Fatalf("Failed to parse the split btf: %v", err)
+	}
+	stats := module.Types[9]
+	if stats.Name != "mod_stats" || stats.Members[0].Name != "count" {
+		t.Fatalf("Unexpected split type %+v", stats)
+	}
+	if text := module.CText(); text != "struct mod_stats {\n\tunsigned int count;\n};\n" {
+		t.Errorf("Expected only the types of the module, got\n%s", text)
+	}
+}
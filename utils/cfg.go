@@ -0,0 +1,278 @@
+// The utils/cfg.go file splits the xlated disassembly of a program into basic
+// blocks and works out how control flows between them. It only needs the text
+// printed by `bpftool prog dump xlated` (or the native disassembler) so it
+// works with either backend. The graph can be exported in the DOT format or
+// rendered as svg
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The kinds of edges between basic blocks
+const (
+	// A conditional jump that was taken
+	EdgeTaken = "taken"
+
+	// A conditional jump that wasn't taken or a block that simply ends
+	// because the next instruction is a jump target
+	EdgeFallthrough = "fallthrough"
+
+	// An unconditional jump
+	EdgeGoto = "goto"
+)
+
+// An edge from one basic block to another
+type CfgEdge struct {
+	// The id of the block that is jumped to
+	To int
+
+	// One of the Edge* kinds
+	Kind string
+
+	// Set if the edge jumps backwards i.e. a loop
+	BackEdge bool
+}
+
+// A sequence of instructions that is always run from start to end
+type BasicBlock struct {
+	Id int
+
+	// The indices of the first and last instruction
+	Start int
+	End   int
+
+	// The lines of the disassembly in the block including source line
+	// comments
+	Lines []string
+
+	Edges []CfgEdge
+}
+
+// The control flow graph of a program
+type Cfg struct {
+	Blocks []BasicBlock
+}
+
+// A single instruction of the disassembly
+type cfgInsn struct {
+	index int
+	code  uint8
+
+	// The lines printed in front of the instruction (source lines and
+	// function names) followed by the instruction itself
+	lines []string
+
+	// Set for the first instruction of a function
+	function bool
+}
+
+// Matches instructions like `  12: (15) if r1 == 0x0 goto pc+5`
+var cfgInsnRegex = regexp.MustCompile(`^\s*(\d+):\s+\(([0-9a-f]{2})\)`)
+
+// Matches the jump offset of an instruction
+var cfgJumpRegex = regexp.MustCompile(`\bgotol? pc([+-]\d+)`)
+
+// Check if an instruction is a jump or exit and get its target. target is -1
+// for instructions that don't jump anywhere (exits and calls)
+func (i cfgInsn) jump() (isJump bool, conditional bool, target int) {
+	class := i.code & 0x07
+	if class != bpfJmp && class != bpfJmp32 {
+		return false, false, -1
+	}
+	op := i.code & 0xf0
+	if op == bpfCall {
+		return false, false, -1
+	}
+	if op == bpfExit {
+		return true, false, -1
+	}
+
+	target = -1
+	if match := cfgJumpRegex.FindStringSubmatch(i.lines[len(i.lines)-1]); match != nil {
+		off, _ := strconv.Atoi(match[1])
+		target = i.index + 1 + off
+	}
+	return true, op != bpfJa, target
+}
+
+// Parse the instructions of a disassembly. Lines that aren't instructions
+// are kept with the instruction that follows them
+func parseCfgInsns(lines []string) []cfgInsn {
+	insns := []cfgInsn{}
+	pending := []string{}
+	function := false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		match := cfgInsnRegex.FindStringSubmatch(line)
+		if match == nil {
+			// Function names end with a colon while source lines start with
+			// a semicolon
+			trimmed := strings.TrimSpace(line)
+			if !strings.HasPrefix(trimmed, ";") && strings.HasSuffix(trimmed, ":") {
+				function = true
+			}
+			pending = append(pending, line)
+			continue
+		}
+
+		index, _ := strconv.Atoi(match[1])
+		code, _ := strconv.ParseUint(match[2], 16, 8)
+		insns = append(insns, cfgInsn{
+			index:    index,
+			code:     uint8(code),
+			lines:    append(pending, line),
+			function: function,
+		})
+		pending = []string{}
+		function = false
+	}
+	return insns
+}
+
+// Build the control flow graph of a program from its xlated disassembly
+func NewCfg(lines []string) (*Cfg, error) {
+	insns := parseCfgInsns(lines)
+	if len(insns) == 0 {
+		return nil, fmt.Errorf("no instructions found in the disassembly")
+	}
+
+	// A block starts at the first instruction, the start of every function,
+	// every jump target and after every jump
+	leaders := map[int]bool{insns[0].index: true}
+	for i, insn := range insns {
+		if insn.function {
+			leaders[insn.index] = true
+		}
+		isJump, _, target := insn.jump()
+		if !isJump {
+			continue
+		}
+		if target >= 0 {
+			leaders[target] = true
+		}
+		if i+1 < len(insns) {
+			leaders[insns[i+1].index] = true
+		}
+	}
+
+	cfg := &Cfg{}
+	blockOf := map[int]int{}
+	functions := map[int]bool{}
+	for _, insn := range insns {
+		functions[insn.index] = insn.function
+		if leaders[insn.index] {
+			cfg.Blocks = append(cfg.Blocks, BasicBlock{Id: len(cfg.Blocks), Start: insn.index})
+		}
+		block := &cfg.Blocks[len(cfg.Blocks)-1]
+		block.End = insn.index
+		block.Lines = append(block.Lines, insn.lines...)
+		blockOf[insn.index] = block.Id
+	}
+
+	// The edges are decided by the last instruction of each block
+	last := map[int]cfgInsn{}
+	for _, insn := range insns {
+		last[blockOf[insn.index]] = insn
+	}
+	for i := range cfg.Blocks {
+		block := &cfg.Blocks[i]
+		insn := last[block.Id]
+		isJump, conditional, target := insn.jump()
+		addEdge := func(to int, kind string) {
+			block.Edges = append(block.Edges, CfgEdge{To: to, Kind: kind, BackEdge: cfg.Blocks[to].Start <= insn.index})
+		}
+
+		if isJump && target >= 0 {
+			to, ok := blockOf[target]
+			if !ok {
+				return nil, fmt.Errorf("instruction %d jumps to %d which isn't an instruction", insn.index, target)
+			}
+			if conditional {
+				addEdge(to, EdgeTaken)
+			} else {
+				addEdge(to, EdgeGoto)
+			}
+		}
+
+		// Exits and unconditional jumps never continue with the next block.
+		// Neither does the last block of a function
+		if (isJump && !conditional) || i+1 >= len(cfg.Blocks) || functions[cfg.Blocks[i+1].Start] {
+			continue
+		}
+		addEdge(i+1, EdgeFallthrough)
+	}
+	return cfg, nil
+}
+
+// Escape a line for a DOT record label
+func dotEscape(s string) string {
+	s = strings.ReplaceAll(s, "\t", "    ")
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "{", `\{`, "}", `\}`, "<", `\<`, ">", `\>`, "|", `\|`)
+	return replacer.Replace(s)
+}
+
+// The colors of the edges in the DOT output
+var dotEdgeColors = map[string]string{
+	EdgeTaken:       "green",
+	EdgeFallthrough: "red",
+	EdgeGoto:        "black",
+}
+
+// Print the graph in the DOT format. Render it with `dot -Tsvg`
+func (c *Cfg) Dot(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph \"%s\" {\n", dotEscape(name))
+	b.WriteString("\tnode [shape=record fontname=\"monospace\"];\n")
+	for _, block := range c.Blocks {
+		lines := []string{}
+		for _, line := range block.Lines {
+			lines = append(lines, dotEscape(strings.TrimSpace(line)))
+		}
+		fmt.Fprintf(&b, "\tblock%d [label=\"{block %d|%s\\l}\"];\n", block.Id, block.Id, strings.Join(lines, "\\l"))
+	}
+	for _, block := range c.Blocks {
+		for _, edge := range block.Edges {
+			style := "solid"
+			if edge.BackEdge {
+				style = "dashed"
+			}
+			fmt.Fprintf(&b, "\tblock%d -> block%d [color=%s style=%s];\n", block.Id, edge.To, dotEdgeColors[edge.Kind], style)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// The formats a control flow graph can be exported in
+var CfgFormats = []string{"dot", "svg"}
+
+// Write the graph of a program to a file as DOT or rendered as svg. Rendering
+// needs the dot command of graphviz
+func WriteCfg(path string, format string, name string, cfg *Cfg) error {
+	dot := cfg.Dot(name)
+	switch format {
+	case "dot":
+		return os.WriteFile(path, []byte(dot), 0644)
+	case "svg":
+		dotPath, err := exec.LookPath("dot")
+		if err != nil {
+			return fmt.Errorf("rendering svg needs the dot command of graphviz: %v", err)
+		}
+		cmd := exec.Command(dotPath, "-Tsvg", "-o", path)
+		cmd.Stdin = strings.NewReader(dot)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("dot failed: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown format %s", format)
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewCfg(t *testing.T) {
+	xlated := []string{
+		"int prog(struct xdp_md * ctx):",
+		"; int i = 0;",
+		"   0: (b7) r1 = 0",
+		"   1: (18) r2 = map[id:3]",
+		"   3: (15) if r1 == 0x0 goto pc+2",
+		"; i++;",
+		"   4: (07) r1 += 1",
+		"   5: (05) goto pc-3",
+		"; return i;",
+		"   6: (bf) r0 = r1",
+		"   7: (85) call pc+1",
+		"   8: (95) exit",
+		"int sub(void):",
+		"   9: (b7) r0 = 0",
+		"  10: (95) exit",
+	}
+	cfg, err := NewCfg(xlated)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BasicBlock{
+		{Id: 0, Start: 0, End: 1, Lines: xlated[0:4], Edges: []CfgEdge{{To: 1, Kind: EdgeFallthrough}}},
+		{Id: 1, Start: 3, End: 3, Lines: xlated[4:5], Edges: []CfgEdge{{To: 3, Kind: EdgeTaken}, {To: 2, Kind: EdgeFallthrough}}},
+		{Id: 2, Start: 4, End: 5, Lines: xlated[5:8], Edges: []CfgEdge{{To: 1, Kind: EdgeGoto, BackEdge: true}}},
+		{Id: 3, Start: 6, End: 8, Lines: xlated[8:12]},
+		{Id: 4, Start: 9, End: 10, Lines: xlated[12:15]},
+	}
+	if !reflect.DeepEqual(cfg.Blocks, expected) {
+		t.Errorf("Unexpected blocks\n%+v\nexpected\n%+v", cfg.Blocks, expected)
+	}
+
+	dot := cfg.Dot("prog")
+	for _, s := range []string{
+		`digraph "prog" {`,
+		`block0 [label="{block 0|int prog(struct xdp_md * ctx):\l; int i = 0;\l0: (b7) r1 = 0\l1: (18) r2 = map[id:3]\l}"];`,
+		"block1 -> block3 [color=green style=solid];",
+		"block2 -> block1 [color=black style=dashed];",
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("Expected %s in\n%s", s, dot)
+		}
+	}
+
+	if _, err := NewCfg([]string{"0: (05) goto pc+5"}); err == nil {
+		t.Error("Expected an error for a jump out of the program")
+	}
+	if _, err := NewCfg([]string{}); err == nil {
+		t.Error("Expected an error for an empty disassembly")
+	}
+}
+
+func TestWriteCfg(t *testing.T) {
+	cfg, err := NewCfg([]string{"0: (95) exit"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "prog.dot")
+	if err := WriteCfg(path, "dot", "prog", cfg); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != cfg.Dot("prog") {
+		t.Errorf("Unexpected file contents %s", data)
+	}
+	if err := WriteCfg(path, "png", "prog", cfg); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
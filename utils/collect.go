@@ -0,0 +1,127 @@
+// The utils/collect.go file gathers the list of bpf programs and enriches each
+// one with where it is attached (perf events, cgroups, network devices, links),
+// its fingerprint and the helpers it calls. This is shared by the ui and the
+// command line subcommands
+package utils
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Add the attach point of programs attached through perf events
+func ApplyPerfEventData(programs map[int]BpfProgram) error {
+	perfInfo, err := GetBpfPerfInfo()
+	if err != nil {
+		return fmt.Errorf("Error getting perf event info: %v", err)
+	}
+
+	for _, prog := range perfInfo {
+		if entry, ok := programs[prog.ProgId]; ok {
+			entry.Fd = prog.Fd
+			entry.ProgType = prog.FdType
+			if prog.FdType == "kprobe" || prog.FdType == "kretprobe" {
+				entry.AttachPoint = append(entry.AttachPoint, prog.Func)
+				entry.Offset = prog.Offset
+			} else if prog.FdType == "uprobe" || prog.FdType == "uretprobe" {
+				entry.AttachPoint = append(entry.AttachPoint, prog.Filename)
+				entry.Offset = prog.Offset
+			} else {
+				entry.AttachPoint = append(entry.AttachPoint, prog.Tracepoint)
+			}
+			programs[prog.ProgId] = entry
+		}
+	}
+	return nil
+}
+
+// Add the cgroup of programs attached to cgroups
+func ApplyCgroupData(programs map[int]BpfProgram) error {
+	cgroupInfo, err := GetBpfCgroupInfo()
+	if err != nil {
+		return fmt.Errorf("Error getting cgroup info: %v", err)
+	}
+
+	for _, prog := range cgroupInfo {
+		for _, cgroupProg := range prog.Programs {
+			if entry, ok := programs[cgroupProg.Id]; ok {
+				entry.Cgroup = prog.Cgroup
+				entry.CgroupAttachFlags = cgroupProg.AttachFlags
+				entry.CgroupAttachType = cgroupProg.AttachType
+				programs[cgroupProg.Id] = entry
+			}
+		}
+	}
+	return nil
+}
+
+// Add the network interface of xdp and tc programs
+func ApplyNetData(programs map[int]BpfProgram) error {
+	netInfo, err := GetBpfNetInfo()
+	if err != nil {
+		return fmt.Errorf("Error getting net info: %v", err)
+	}
+
+	for _, prog := range netInfo {
+		for _, xdp := range prog.Xdp {
+			if entry, ok := programs[xdp.Id]; ok {
+				entry.Interface = xdp.DevName
+				programs[xdp.Id] = entry
+			}
+		}
+		for _, tc := range prog.Tc {
+			if entry, ok := programs[tc.Id]; ok {
+				entry.Interface = tc.DevName
+				entry.Name = tc.Name
+				entry.TcKind = tc.Kind
+				programs[tc.Id] = entry
+			}
+		}
+	}
+	return nil
+}
+
+// Returned by CollectPrograms when every program was listed but some of the
+// extra context (attach points etc) couldn't be found
+type EnrichError struct {
+	Err error
+}
+
+func (e *EnrichError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *EnrichError) Unwrap() error {
+	return e.Err
+}
+
+// Check if an error returned by CollectPrograms only means some extra context
+// is missing. The programs that exist are still complete in that case
+func IsEnrichError(err error) bool {
+	var enrichErr *EnrichError
+	return errors.As(err, &enrichErr)
+}
+
+// Get every loaded program keyed by program id along with all the extra
+// context that can be found for it. Failing to get the extra context is not
+// fatal. The programs are still returned along with the first error that
+// occurred as an EnrichError
+func CollectPrograms() (map[int]BpfProgram, error) {
+	programs := map[int]BpfProgram{}
+	tmp, err := GetBpfPrograms()
+	if err != nil {
+		return programs, fmt.Errorf("Failed to get program info\n%v", err)
+	}
+
+	for _, program := range tmp {
+		programs[program.ProgramId] = program
+	}
+
+	for _, apply := range []func(map[int]BpfProgram) error{ApplyPerfEventData, ApplyCgroupData, ApplyNetData, ApplyLinkData, ApplyFingerprints, ApplyHelpers} {
+		applyErr := apply(programs)
+		if applyErr != nil && err == nil {
+			err = &EnrichError{Err: applyErr}
+		}
+	}
+	return programs, err
+}
@@ -0,0 +1,147 @@
+// The utils/events.go file turns successive snapshots of the loaded programs
+// into load, unload and attach change events. The owner and attach point of a
+// program are remembered from the first time it was seen since both are often
+// gone by the time the program is unloaded
+package utils
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	EventLoad         = "load"
+	EventUnload       = "unload"
+	EventAttachChange = "attach_change"
+)
+
+type ProgramEvent struct {
+	// When the change was noticed. This is the time of the refresh, not the
+	// exact time of the change
+	Time time.Time `json:"time"`
+
+	// One of load, unload or attach_change
+	Type string `json:"event"`
+
+	ProgramId int    `json:"id"`
+	Name      string `json:"name,omitempty"`
+	ProgType  string `json:"type"`
+	Tag       string `json:"tag"`
+
+	// The processes that held the program when it was first seen
+	Owners []ProcessInfo `json:"owners,omitempty"`
+
+	// Where the program is attached. For unload events this is where it was
+	// attached when it was first seen
+	AttachPoint string `json:"attach_point,omitempty"`
+
+	// Where the program was attached before an attach change
+	PreviousAttachPoint string `json:"previous_attach_point,omitempty"`
+}
+
+// Keeps track of the programs between refreshes to find what changed
+type ProgramTracker struct {
+	// The programs as of the last update
+	programs map[int]BpfProgram
+
+	// Each program as it was the first time it was seen
+	firstSeen map[int]BpfProgram
+
+	// The first update only sets the baseline
+	started bool
+}
+
+func NewProgramTracker() *ProgramTracker {
+	return &ProgramTracker{
+		programs:  map[int]BpfProgram{},
+		firstSeen: map[int]BpfProgram{},
+	}
+}
+
+func newProgramEvent(eventType string, p BpfProgram, now time.Time) ProgramEvent {
+	return ProgramEvent{
+		Time:      now,
+		Type:      eventType,
+		ProgramId: p.ProgramId,
+		Name:      p.Name,
+		ProgType:  p.ProgType,
+		Tag:       p.Tag,
+		Owners:    p.Pids,
+	}
+}
+
+// Compare cur with the previous snapshot and return what changed sorted by
+// program id. The first call returns no events since everything in it was
+// loaded before ebpfmon started
+func (t *ProgramTracker) Update(cur map[int]BpfProgram, now time.Time) []ProgramEvent {
+	return t.update(cur, now, true)
+}
+
+// Like Update but only loads and unloads are returned. This is used when the
+// attach points of cur are incomplete since missing attach points would look
+// like programs being detached. The attach points of programs that were
+// already known are kept for the next comparison
+func (t *ProgramTracker) UpdateLoaded(cur map[int]BpfProgram, now time.Time) []ProgramEvent {
+	return t.update(cur, now, false)
+}
+
+func (t *ProgramTracker) update(cur map[int]BpfProgram, now time.Time, compareAttach bool) []ProgramEvent {
+	events := []ProgramEvent{}
+	next := make(map[int]BpfProgram, len(cur))
+	for id, old := range t.programs {
+		p, ok := cur[id]
+		if ok && p.Tag == old.Tag {
+			continue
+		}
+		// A different tag under the same id is a new program
+		first := t.firstSeen[id]
+		event := newProgramEvent(EventUnload, first, now)
+		event.AttachPoint = first.AttachSummary()
+		events = append(events, event)
+		delete(t.firstSeen, id)
+	}
+
+	for id, p := range cur {
+		next[id] = p
+		first, seen := t.firstSeen[id]
+		if !seen {
+			t.firstSeen[id] = p
+			if t.started {
+				event := newProgramEvent(EventLoad, p, now)
+				event.AttachPoint = p.AttachSummary()
+				events = append(events, event)
+			}
+			continue
+		}
+
+		old := t.programs[id]
+		if !compareAttach {
+			next[id] = old
+			continue
+		}
+		if p.AttachSummary() != old.AttachSummary() {
+			event := newProgramEvent(EventAttachChange, first, now)
+			event.AttachPoint = p.AttachSummary()
+			event.PreviousAttachPoint = old.AttachSummary()
+			events = append(events, event)
+
+			// Programs usually get attached right after they are loaded so
+			// remember the first place the program was actually attached
+			if first.AttachSummary() == "" {
+				first.AttachPoint = p.AttachPoint
+				first.Interface = p.Interface
+				first.TcKind = p.TcKind
+				first.Cgroup = p.Cgroup
+				first.CgroupAttachType = p.CgroupAttachType
+				t.firstSeen[id] = first
+			}
+		}
+	}
+
+	t.programs = next
+	t.started = true
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].ProgramId < events[j].ProgramId
+	})
+	return events
+}
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgramTracker(t *testing.T) {
+	tracker := NewProgramTracker()
+	now := time.Now()
+
+	owner := []ProcessInfo{{Pid: 42, Comm: "agent"}}
+	baseline := map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", ProgType: "kprobe", AttachPoint: []string{"do_sys_open"}},
+	}
+	events := tracker.Update(baseline, now)
+	if len(events) != 0 {
+		t.Fatalf("Expected no events for the baseline, got %+v", events)
+	}
+
+	// Program 2 is loaded by agent without being attached yet
+	cur := map[int]BpfProgram{
+		1: baseline[1],
+		2: {ProgramId: 2, Tag: "bbbb", ProgType: "xdp", Name: "fw", Pids: owner},
+	}
+	events = tracker.Update(cur, now)
+	if len(events) != 1 || events[0].Type != EventLoad || events[0].ProgramId != 2 {
+		t.Fatalf("Expected a load event for program 2, got %+v", events)
+	}
+	if len(events[0].Owners) != 1 || events[0].Owners[0].Comm != "agent" {
+		t.Errorf("Expected the owner in the load event, got %+v", events[0].Owners)
+	}
+
+	// Program 2 gets attached and program 1 is replaced with a new program
+	// using the same id
+	cur = map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "cccc", ProgType: "kprobe"},
+		2: {ProgramId: 2, Tag: "bbbb", ProgType: "xdp", Name: "fw", Interface: "eth0"},
+	}
+	events = tracker.Update(cur, now)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	if events[0].Type != EventUnload || events[0].Tag != "aaaa" || events[0].AttachPoint != "do_sys_open" {
+		t.Errorf("Expected an unload of the old program 1, got %+v", events[0])
+	}
+	if events[1].Type != EventLoad || events[1].Tag != "cccc" {
+		t.Errorf("Expected a load of the new program 1, got %+v", events[1])
+	}
+	if events[2].Type != EventAttachChange || events[2].AttachPoint != "eth0" || events[2].PreviousAttachPoint != "" {
+		t.Errorf("Expected an attach change for program 2, got %+v", events[2])
+	}
+
+	// The owner has exited by the time program 2 is unloaded but it is still
+	// known from when the program was first seen
+	events = tracker.Update(map[int]BpfProgram{1: cur[1]}, now)
+	if len(events) != 1 || events[0].Type != EventUnload || events[0].ProgramId != 2 {
+		t.Fatalf("Expected an unload event for program 2, got %+v", events)
+	}
+	if len(events[0].Owners) != 1 || events[0].Owners[0].Pid != 42 {
+		t.Errorf("Expected the first seen owner in the unload event, got %+v", events[0].Owners)
+	}
+	if events[0].AttachPoint != "eth0" {
+		t.Errorf("Expected the first attach point in the unload event, got %s", events[0].AttachPoint)
+	}
+}
+
+// Snapshots with missing attach points still report loads and unloads but
+// not detaches
+func TestProgramTrackerUpdateLoaded(t *testing.T) {
+	tracker := NewProgramTracker()
+	now := time.Now()
+	attached := BpfProgram{ProgramId: 1, Tag: "aaaa", ProgType: "xdp", Interface: "eth0"}
+	tracker.Update(map[int]BpfProgram{1: attached}, now)
+
+	events := tracker.UpdateLoaded(map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", ProgType: "xdp"},
+		2: {ProgramId: 2, Tag: "bbbb", ProgType: "kprobe"},
+	}, now)
+	if len(events) != 1 || events[0].Type != EventLoad || events[0].ProgramId != 2 {
+		t.Fatalf("Expected only a load event for program 2, got %+v", events)
+	}
+
+	// The next complete snapshot is compared with the last known attach point
+	events = tracker.Update(map[int]BpfProgram{1: attached}, now)
+	if len(events) != 1 || events[0].Type != EventUnload || events[0].ProgramId != 2 {
+		t.Errorf("Expected only an unload event for program 2, got %+v", events)
+	}
+}
@@ -0,0 +1,161 @@
+// The utils/fingerprint.go file computes the information that is derived from
+// the disassembly of a program (its fingerprint and the helpers it calls). A
+// program can't change once it is loaded so this is only done once for each
+// program
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Only the instruction lines of a disassembly are used. bpftool also prints
+// source lines and function signatures when the program has btf
+var insnLineRegex = regexp.MustCompile(`^\s*\d+: \(`)
+
+// Things in the disassembly that change between hosts or loads of the same
+// program. Map ids, the immediate of helper calls (which is relative to the
+// kernel's __bpf_call_base) and kernel addresses
+var volatileRegexes = []struct {
+	regex       *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`map\[id:\d+\]`), "map[id:?]"},
+	{regexp.MustCompile(`#-?\d+`), "#?"},
+	{regexp.MustCompile(`0xffff[0-9a-f]{8,12}`), "0x?"},
+}
+
+// Strip everything that differs between two loads of the same program from a
+// disassembly
+func NormalizeXlated(insns []string) []string {
+	result := []string{}
+	for _, insn := range insns {
+		if !insnLineRegex.MatchString(insn) {
+			continue
+		}
+		insn = strings.TrimSpace(insn)
+		for _, v := range volatileRegexes {
+			insn = v.regex.ReplaceAllString(insn, v.replacement)
+		}
+		result = append(result, insn)
+	}
+	return result
+}
+
+// Compute the fingerprint of a program from its xlated disassembly
+func Fingerprint(insns []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(NormalizeXlated(insns), "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+type programCode struct {
+	fingerprint string
+	helpers     []string
+	inventory   []HelperCall
+	err         error
+}
+
+// The code information of each program keyed by id and tag. Failures are
+// cached until the next refresh so the program isn't disassembled twice per
+// refresh but a temporary failure (i.e. sudo or bpftool failing) is retried
+var codeCache = map[string]programCode{}
+var codeCacheLock sync.Mutex
+
+func codeCacheKey(p BpfProgram) string {
+	return fmt.Sprintf("%d/%s", p.ProgramId, p.Tag)
+}
+
+// Drop the programs that are no longer loaded and the failures from the cache
+func pruneCodeCache(programs map[int]BpfProgram) {
+	loaded := map[string]bool{}
+	for _, p := range programs {
+		loaded[codeCacheKey(p)] = true
+	}
+
+	codeCacheLock.Lock()
+	defer codeCacheLock.Unlock()
+	for key, code := range codeCache {
+		if !loaded[key] || code.err != nil {
+			delete(codeCache, key)
+		}
+	}
+}
+
+func getProgramCode(p BpfProgram) programCode {
+	key := codeCacheKey(p)
+	codeCacheLock.Lock()
+	code, ok := codeCache[key]
+	codeCacheLock.Unlock()
+	if ok {
+		return code
+	}
+
+	insns, err := GetBpfProgramDisassembly(p.ProgramId)
+	if err != nil {
+		code = programCode{err: err}
+	} else {
+		code = programCode{fingerprint: Fingerprint(insns), helpers: ExtractHelpers(insns), inventory: HelperInventory(insns)}
+	}
+
+	codeCacheLock.Lock()
+	codeCache[key] = code
+	codeCacheLock.Unlock()
+	return code
+}
+
+// Get the helpers a program calls
+func GetProgramHelpers(p BpfProgram) ([]string, error) {
+	code := getProgramCode(p)
+	return code.helpers, code.err
+}
+
+// Get the helpers a program calls along with how often and why they are risky
+func GetProgramHelperInventory(p BpfProgram) ([]HelperCall, error) {
+	code := getProgramCode(p)
+	return code.inventory, code.err
+}
+
+// Get the fingerprint of a program
+func GetProgramFingerprint(p BpfProgram) (string, error) {
+	code := getProgramCode(p)
+	return code.fingerprint, code.err
+}
+
+// Set the fingerprint of every program. A program can be unloaded between
+// listing it and getting its disassembly so failures are only logged and the
+// fingerprint of that program is left empty. programs is the full list of
+// loaded programs so the cache is pruned to it first
+func ApplyFingerprints(programs map[int]BpfProgram) error {
+	pruneCodeCache(programs)
+	for id, p := range programs {
+		fingerprint, err := GetProgramFingerprint(p)
+		if err != nil {
+			log.Debugf("Failed to fingerprint program %d: %v\n", id, err)
+			continue
+		}
+		p.Fingerprint = fingerprint
+		programs[id] = p
+	}
+	return nil
+}
+
+// Set the helpers every program calls. Programs whose disassembly can't be
+// found are left without helpers just like with ApplyFingerprints
+func ApplyHelpers(programs map[int]BpfProgram) error {
+	for id, p := range programs {
+		helpers, err := GetProgramHelperInventory(p)
+		if err != nil {
+			log.Debugf("Failed to get the helpers of program %d: %v\n", id, err)
+			continue
+		}
+		p.Helpers = helpers
+		programs[id] = p
+	}
+	return nil
+}
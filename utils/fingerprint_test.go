@@ -0,0 +1,73 @@
+package utils
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	// The same program loaded twice on different kernels by bpftool
+	first := []string{
+		"int handle(struct pt_regs * ctx):",
+		"; int handle(struct pt_regs *ctx)",
+		"   0: (18) r1 = map[id:12]",
+		"   2: (85) call bpf_map_lookup_elem#196880",
+		"   3: (18) r2 = 0xffff888103c7e000",
+		"   5: (95) exit",
+		"",
+	}
+	// Loaded natively so there is no btf information
+	second := []string{
+		"   0: (18) r1 = map[id:47]",
+		"   2: (85) call bpf_map_lookup_elem#-10256",
+		"   3: (18) r2 = 0xffff9a0c4d1e2000",
+		"   5: (95) exit",
+	}
+	different := []string{
+		"   0: (18) r1 = map[id:12]",
+		"   2: (85) call bpf_map_update_elem#196880",
+		"   3: (18) r2 = 0xffff888103c7e000",
+		"   5: (95) exit",
+	}
+
+	if Fingerprint(first) != Fingerprint(second) {
+		t.Errorf("Expected the same fingerprint for the same program\n%v\n%v", NormalizeXlated(first), NormalizeXlated(second))
+	}
+	if Fingerprint(first) == Fingerprint(different) {
+		t.Errorf("Expected a different fingerprint for a different program")
+	}
+	if len(Fingerprint(first)) != 64 {
+		t.Errorf("Expected a hex encoded sha256, got %s", Fingerprint(first))
+	}
+}
+
+// Programs that differ only in a 64 bit constant are different programs
+func TestFingerprintConstants(t *testing.T) {
+	first := []string{"   0: (18) r1 = 0x1122334455667788", "   2: (95) exit"}
+	second := []string{"   0: (18) r1 = 0x8877665544332211", "   2: (95) exit"}
+	if Fingerprint(first) == Fingerprint(second) {
+		t.Errorf("Expected different fingerprints for different constants")
+	}
+}
+
+func TestPruneCodeCache(t *testing.T) {
+	codeCacheLock.Lock()
+	codeCache["101/a"] = programCode{fingerprint: "a"}
+	codeCache["102/b"] = programCode{fingerprint: "b"}
+	codeCache["103/c"] = programCode{err: ErrNotSupported}
+	codeCacheLock.Unlock()
+
+	pruneCodeCache(map[int]BpfProgram{
+		101: {ProgramId: 101, Tag: "a"},
+		103: {ProgramId: 103, Tag: "c"},
+	})
+
+	codeCacheLock.Lock()
+	defer codeCacheLock.Unlock()
+	if _, ok := codeCache["101/a"]; !ok {
+		t.Errorf("Expected the loaded program to stay cached")
+	}
+	if _, ok := codeCache["102/b"]; ok {
+		t.Errorf("Expected the unloaded program to be pruned")
+	}
+	if _, ok := codeCache["103/c"]; ok {
+		t.Errorf("Expected the failure to be retried")
+	}
+}
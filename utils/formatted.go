@@ -0,0 +1,114 @@
+// The utils/formatted.go file decodes the btf formatted keys and values that
+// bpftool prints for maps with btf. The json is decoded into a tree instead of
+// a map so struct fields keep the order they were declared in
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A node of a formatted key or value. Structs and arrays have children.
+// Everything else (numbers, enums, strings, bools) is a leaf
+type FormattedNode struct {
+	// The name of the struct field or the index of the array element. Empty
+	// for the root
+	Name string
+
+	// The printed value of a leaf
+	Value string
+
+	IsStruct bool
+	IsArray  bool
+	Children []*FormattedNode
+}
+
+// Decode a formatted key or value
+func ParseFormatted(data json.RawMessage) (*FormattedNode, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return parseFormattedNode(decoder, "")
+}
+
+func parseFormattedNode(decoder *json.Decoder, name string) (*FormattedNode, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	node := &FormattedNode{Name: name}
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			node.IsStruct = true
+			for decoder.More() {
+				fieldToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				field, _ := fieldToken.(string)
+				child, err := parseFormattedNode(decoder, field)
+				if err != nil {
+					return nil, err
+				}
+				node.Children = append(node.Children, child)
+			}
+		} else {
+			node.IsArray = true
+			for i := 0; decoder.More(); i++ {
+				child, err := parseFormattedNode(decoder, fmt.Sprintf("[%d]", i))
+				if err != nil {
+					return nil, err
+				}
+				node.Children = append(node.Children, child)
+			}
+		}
+		// The closing } or ]
+		_, err = decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+	case string:
+		node.Value = strconv.Quote(t)
+	case json.Number:
+		node.Value = t.String()
+	case bool:
+		node.Value = strconv.FormatBool(t)
+	case nil:
+		node.Value = "null"
+	}
+	return node, nil
+}
+
+// Print the node on a single line i.e. {pid: 1, comm: "init", flags: [0, 1]}
+func (n *FormattedNode) String() string {
+	if !n.IsStruct && !n.IsArray {
+		return n.Value
+	}
+
+	parts := make([]string, len(n.Children))
+	for i, child := range n.Children {
+		if n.IsStruct {
+			parts[i] = child.Name + ": " + child.String()
+		} else {
+			parts[i] = child.String()
+		}
+	}
+	if n.IsStruct {
+		return "{" + strings.Join(parts, ", ") + "}"
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// Print formatted json on a single line. If it can't be decoded the raw json
+// is returned instead
+func FormattedString(data json.RawMessage) string {
+	node, err := ParseFormatted(data)
+	if err != nil {
+		return string(data)
+	}
+	return node.String()
+}
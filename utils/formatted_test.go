@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseFormatted(t *testing.T) {
+	data := json.RawMessage(`{"pid":42,"comm":"bash","state":"TASK_RUNNING","inner":{"b":1,"a":[1,2]},"ok":true}`)
+	node, err := ParseFormatted(data)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	// The fields keep their order instead of being sorted
+	expected := `{pid: 42, comm: "bash", state: "TASK_RUNNING", inner: {b: 1, a: [1, 2]}, ok: true}`
+	if node.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, node.String())
+	}
+
+	inner := node.Children[3]
+	if !inner.IsStruct || inner.Name != "inner" || len(inner.Children) != 2 {
+		t.Fatalf("Unexpected inner struct %+v", inner)
+	}
+	array := inner.Children[1]
+	if !array.IsArray || array.Children[1].Name != "[1]" || array.Children[1].Value != "2" {
+		t.Errorf("Unexpected array %+v", array)
+	}
+
+	if FormattedString(json.RawMessage(`7`)) != "7" {
+		t.Errorf("Expected a scalar to be printed as is")
+	}
+	if FormattedString(json.RawMessage(`{"a":`)) != `{"a":` {
+		t.Errorf("Expected invalid json to be returned as is")
+	}
+}
+
+func TestBpftoolMapEntriesFormatted(t *testing.T) {
+	backend := NewReplayBackend(t, map[string]string{
+		"-jf map dump id 4": `[
+			{"key":["0x01","0x00","0x00","0x00"],"value":["0x2a","0x00","0x00","0x00"],"formatted":{"key":1,"value":{"pid":42}}},
+			{"key":["0x02","0x00","0x00","0x00"],"value":["0x00","0x00","0x00","0x00"]}
+		]`,
+	})
+
+	entries, err := backend.MapEntries(4)
+	if err != nil {
+		t.Fatalf("Failed to get map entries: %v", err)
+	}
+	if entries[0].Formatted == nil || FormattedString(entries[0].Formatted.Value) != "{pid: 42}" {
+		t.Errorf("Expected the formatted value to be kept, got %+v", entries[0].Formatted)
+	}
+	if entries[1].Formatted != nil {
+		t.Errorf("Expected no formatted value, got %+v", entries[1].Formatted)
+	}
+}
@@ -0,0 +1,75 @@
+// The utils/helperdocs.go file contains a one line summary of the commonly
+// used bpf helper functions. They are taken from the descriptions in
+// include/uapi/linux/bpf.h (also found in the bpf-helpers(7) man page)
+package utils
+
+var helperSummaries = map[string]string{
+	"bpf_map_lookup_elem":         "Perform a lookup in map for an entry associated to key.",
+	"bpf_map_update_elem":         "Add or update the value of the entry associated to key in map with value.",
+	"bpf_map_delete_elem":         "Delete entry with key from map.",
+	"bpf_map_push_elem":           "Push an element value in map.",
+	"bpf_map_pop_elem":            "Pop an element from map.",
+	"bpf_map_peek_elem":           "Get an element from map without removing it.",
+	"bpf_for_each_map_elem":       "For each element in map, call callback_fn function with map, callback_ctx and other map-specific parameters.",
+	"bpf_loop":                    "For nr_loops, call callback_fn function with callback_ctx as the context parameter.",
+	"bpf_probe_read":              "For tracing programs, safely attempt to read size bytes from kernel space address unsafe_ptr and store the data in dst.",
+	"bpf_probe_read_str":          "Copy a NUL terminated string from an unsafe kernel address unsafe_ptr to dst.",
+	"bpf_probe_read_user":         "Safely attempt to read size bytes from user space address unsafe_ptr and store the data in dst.",
+	"bpf_probe_read_user_str":     "Copy a NUL terminated string from an unsafe user address unsafe_ptr to dst.",
+	"bpf_probe_read_kernel":       "Safely attempt to read size bytes from kernel space address unsafe_ptr and store the data in dst.",
+	"bpf_probe_read_kernel_str":   "Copy a NUL terminated string from an unsafe kernel address unsafe_ptr to dst.",
+	"bpf_probe_write_user":        "Attempt in a safe way to write len bytes from the buffer src to dst in memory.",
+	"bpf_copy_from_user":          "Read size bytes from user space address user_ptr and store the data in dst.",
+	"bpf_ktime_get_ns":            "Return the time elapsed since system boot, in nanoseconds. Does not include time the system was suspended.",
+	"bpf_ktime_get_boot_ns":       "Return the time elapsed since system boot, in nanoseconds. Does include the time the system was suspended.",
+	"bpf_trace_printk":            "A printk()-like facility for debugging. Prints a message defined by fmt to /sys/kernel/tracing/trace_pipe.",
+	"bpf_trace_vprintk":           "Behaves like bpf_trace_printk() but takes an array of u64 to format and can handle more format args as a result.",
+	"bpf_snprintf":                "Outputs a string into the str buffer of size str_size based on a format string stored in a read-only map pointed by fmt.",
+	"bpf_get_prandom_u32":         "Get a pseudo-random number.",
+	"bpf_get_smp_processor_id":    "Get the SMP (symmetric multiprocessing) processor id.",
+	"bpf_get_current_pid_tgid":    "Get the current pid and tgid.",
+	"bpf_get_current_uid_gid":     "Get the current uid and gid.",
+	"bpf_get_current_comm":        "Copy the comm attribute of the current task into buf of size_of_buf.",
+	"bpf_get_current_task":        "Get the current task.",
+	"bpf_get_current_task_btf":    "Return a BTF pointer to the current task.",
+	"bpf_get_ns_current_pid_tgid": "Get the pid and tgid of the current task as seen from the pid namespace given by dev and ino.",
+	"bpf_get_stackid":             "Walk a user or a kernel stack and return its id.",
+	"bpf_get_stack":               "Return a user or a kernel stack in bpf program provided buffer.",
+	"bpf_get_func_ip":             "Get address of the traced function (for tracing and kprobe programs).",
+	"bpf_get_attach_cookie":       "Get bpf_cookie value provided (optionally) during the program attachment.",
+	"bpf_d_path":                  "Return full path for given struct path object.",
+	"bpf_send_signal":             "Send signal sig to the process of the current task.",
+	"bpf_send_signal_thread":      "Send signal sig to the thread corresponding to the current task.",
+	"bpf_override_return":         "Used for error injection, this helper uses kprobes to override the return value of the probed function, and to set it to rc.",
+	"bpf_tail_call":               "Trigger a tail call, or in other words, jump into another eBPF program.",
+	"bpf_perf_event_output":       "Write raw data blob into a special BPF perf event held by map of type BPF_MAP_TYPE_PERF_EVENT_ARRAY.",
+	"bpf_ringbuf_output":          "Copy size bytes from data into a ring buffer ringbuf.",
+	"bpf_ringbuf_reserve":         "Reserve size bytes of payload in a ring buffer ringbuf.",
+	"bpf_ringbuf_submit":          "Submit reserved ring buffer sample, pointed to by data.",
+	"bpf_ringbuf_discard":         "Discard reserved ring buffer sample, pointed to by data.",
+	"bpf_spin_lock":               "Acquire a spinlock represented by the pointer lock, which is stored as part of a value of a map.",
+	"bpf_spin_unlock":             "Release the lock previously locked by a call to bpf_spin_lock(lock).",
+	"bpf_task_storage_get":        "Get a bpf_local_storage from the task.",
+	"bpf_sk_storage_get":          "Get a bpf-local-storage from a sk.",
+	"bpf_kptr_xchg":               "Exchange kptr at pointer map_value with ptr, and return the old value.",
+	"bpf_sys_bpf":                 "Execute bpf syscall with given arguments.",
+	"bpf_skb_load_bytes":          "Load len bytes from offset from the packet associated to skb, into the buffer pointed by to.",
+	"bpf_skb_store_bytes":         "Store len bytes from address from into the packet associated to skb, at offset.",
+	"bpf_l3_csum_replace":         "Recompute the layer 3 (e.g. IP) checksum for the packet associated to skb.",
+	"bpf_l4_csum_replace":         "Recompute the layer 4 (e.g. TCP, UDP or ICMP) checksum for the packet associated to skb.",
+	"bpf_clone_redirect":          "Clone and redirect the packet associated to skb to another net device of index ifindex.",
+	"bpf_redirect":                "Redirect the packet to another net device of index ifindex.",
+	"bpf_redirect_map":            "Redirect the packet to the endpoint referenced by map at index key.",
+	"bpf_xdp_adjust_head":         "Adjust (move) xdp_md->data by delta bytes.",
+	"bpf_xdp_adjust_tail":         "Adjust (move) xdp_md->data_end by delta bytes.",
+	"bpf_fib_lookup":              "Do FIB lookup in kernel tables using parameters in params.",
+	"bpf_sk_lookup_tcp":           "Look for TCP socket matching tuple, optionally in a child network namespace netns.",
+	"bpf_sk_lookup_udp":           "Look for UDP socket matching tuple, optionally in a child network namespace netns.",
+	"bpf_sk_release":              "Release the reference held by sock.",
+}
+
+// Get the one line summary of a helper function (i.e. bpf_map_lookup_elem).
+// An empty string is returned for helpers without a summary
+func HelperSummary(name string) string {
+	return helperSummaries[name]
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractHelpers(t *testing.T) {
+	insns := []string{
+		"   0: (b7) r1 = 0",
+		"   1: (85) call bpf_get_current_pid_tgid#196880",
+		"   2: (85) call bpf_probe_write_user#-50000",
+		"   3: (85) call pc+5",
+		"   4: (85) call bpf_get_current_pid_tgid#196880",
+		"   5: (95) exit",
+	}
+	helpers := ExtractHelpers(insns)
+	if len(helpers) != 2 || helpers[0] != "bpf_get_current_pid_tgid" || helpers[1] != "bpf_probe_write_user" {
+		t.Errorf("Unexpected helpers %v", helpers)
+	}
+}
+
+func TestHelperInventory(t *testing.T) {
+	insns := []string{
+		"   0: (85) call bpf_get_current_pid_tgid#196880",
+		"   1: (85) call bpf_probe_write_user#-50000",
+		"   2: (85) call pc+5",
+		"   3: (85) call bpf_get_current_pid_tgid#196880",
+		"   4: (95) exit",
+	}
+	expected := []HelperCall{
+		{Name: "bpf_get_current_pid_tgid", Calls: 2},
+		{Name: "bpf_probe_write_user", Calls: 1, Risk: HelperRisk("bpf_probe_write_user")},
+	}
+	helpers := HelperInventory(insns)
+	if !reflect.DeepEqual(helpers, expected) {
+		t.Errorf("Unexpected inventory %+v", helpers)
+	}
+
+	p := BpfProgram{ProgramId: 3, Helpers: helpers}
+	if risky := p.RiskyHelpers(); len(risky) != 1 || risky[0] != "bpf_probe_write_user" {
+		t.Errorf("Unexpected risky helpers %v", risky)
+	}
+	if !strings.Contains(p.String(), "[red]risk[-]") {
+		t.Errorf("Expected the program to be marked as risky in %s", p.String())
+	}
+	p.Helpers = helpers[:1]
+	if strings.Contains(p.String(), "risk") {
+		t.Errorf("Expected the program not to be marked as risky in %s", p.String())
+	}
+}
@@ -0,0 +1,317 @@
+// The utils/insn.go file handles decoding raw bpf instructions and turning
+// them into text. The output mirrors the format of `bpftool prog dump xlated`
+// (which itself uses the kernel's disassembler) so that the rest of ebpfmon
+// doesn't care which backend produced it
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Instruction classes
+const (
+	bpfLd    = 0x00
+	bpfLdx   = 0x01
+	bpfSt    = 0x02
+	bpfStx   = 0x03
+	bpfAlu   = 0x04
+	bpfJmp   = 0x05
+	bpfJmp32 = 0x06
+	bpfAlu64 = 0x07
+)
+
+// Memory sizes and modes
+const (
+	bpfW  = 0x00
+	bpfH  = 0x08
+	bpfB  = 0x10
+	bpfDW = 0x18
+
+	bpfImm    = 0x00
+	bpfAbs    = 0x20
+	bpfInd    = 0x40
+	bpfMem    = 0x60
+	bpfMemSx  = 0x80
+	bpfAtomic = 0xc0
+)
+
+// Alu and jump operations
+const (
+	bpfX = 0x08
+
+	bpfAdd  = 0x00
+	bpfOr   = 0x40
+	bpfAnd  = 0x50
+	bpfNeg  = 0x80
+	bpfXor  = 0xa0
+	bpfMov  = 0xb0
+	bpfEnd  = 0xd0
+	bpfDiv  = 0x30
+	bpfMod  = 0x90
+	bpfToBe = 0x08
+
+	bpfJa   = 0x00
+	bpfCall = 0x80
+	bpfExit = 0x90
+
+	bpfFetch   = 0x01
+	bpfXchg    = 0xe0 | bpfFetch
+	bpfCmpXchg = 0xf0 | bpfFetch
+)
+
+// Values of the src register for special instructions
+const (
+	bpfPseudoMapFd       = 1
+	bpfPseudoMapValue    = 2
+	bpfPseudoMapIdxValue = 6
+	bpfPseudoCall        = 1
+	bpfPseudoFunc        = 4
+)
+
+var bpfAluString = map[uint8]string{
+	0x00: "+=",
+	0x10: "-=",
+	0x20: "*=",
+	0x30: "/=",
+	0x40: "|=",
+	0x50: "&=",
+	0x60: "<<=",
+	0x70: ">>=",
+	0x80: "neg",
+	0x90: "%=",
+	0xa0: "^=",
+	0xb0: "=",
+	0xc0: "s>>=",
+	0xd0: "endian",
+}
+
+var bpfAtomicAluString = map[uint8]string{
+	bpfAdd: "add",
+	bpfAnd: "and",
+	bpfOr:  "or",
+	bpfXor: "xor",
+}
+
+var bpfLdstString = map[uint8]string{
+	bpfW:  "u32",
+	bpfH:  "u16",
+	bpfB:  "u8",
+	bpfDW: "u64",
+}
+
+var bpfJmpString = map[uint8]string{
+	0x00: "jmp",
+	0x10: "==",
+	0x20: ">",
+	0x30: ">=",
+	0x40: "&",
+	0x50: "!=",
+	0x60: "s>",
+	0x70: "s>=",
+	0x80: "call",
+	0x90: "exit",
+	0xa0: "<",
+	0xb0: "<=",
+	0xc0: "s<",
+	0xd0: "s<=",
+}
+
+// A single decoded bpf instruction
+type BpfInsn struct {
+	Code   uint8
+	DstReg uint8
+	SrcReg uint8
+	Off    int16
+	Imm    int32
+}
+
+func (i BpfInsn) class() uint8 {
+	return i.Code & 0x07
+}
+
+func (i BpfInsn) size() uint8 {
+	return i.Code & 0x18
+}
+
+func (i BpfInsn) mode() uint8 {
+	return i.Code & 0xe0
+}
+
+func (i BpfInsn) op() uint8 {
+	return i.Code & 0xf0
+}
+
+// Whether the instruction is a 64 bit immediate load which takes up two
+// instruction slots
+func (i BpfInsn) IsDoubleWide() bool {
+	return i.Code == bpfLd|bpfImm|bpfDW
+}
+
+// Decode the raw instructions returned by the kernel. The kernel always uses
+// the host byte order which is little endian on every platform ebpfmon
+// supports
+func DecodeInsns(data []byte) []BpfInsn {
+	result := make([]BpfInsn, 0, len(data)/8)
+	for i := 0; i+8 <= len(data); i += 8 {
+		result = append(result, BpfInsn{
+			Code:   data[i],
+			DstReg: data[i+1] & 0x0f,
+			SrcReg: data[i+1] >> 4,
+			Off:    int16(binary.LittleEndian.Uint16(data[i+2 : i+4])),
+			Imm:    int32(binary.LittleEndian.Uint32(data[i+4 : i+8])),
+		})
+	}
+	return result
+}
+
+// Disassemble a list of instructions into the same text format bpftool
+// uses. resolveCall is used to find the name of the function a helper call
+// jumps to. It may be nil
+func DisassembleInsns(insns []BpfInsn, resolveCall func(insn BpfInsn) string) []string {
+	result := []string{}
+	for i := 0; i < len(insns); i++ {
+		var next BpfInsn
+		if i+1 < len(insns) {
+			next = insns[i+1]
+		}
+		result = append(result, fmt.Sprintf("%4d: %s", i, formatInsn(insns[i], next, resolveCall)))
+		if insns[i].IsDoubleWide() {
+			i++
+		}
+	}
+	return result
+}
+
+// Format a single instruction. next is only used for 64 bit immediate loads
+func formatInsn(insn BpfInsn, next BpfInsn, resolveCall func(insn BpfInsn) string) string {
+	reg := func(class uint8) byte {
+		if class == bpfAlu || class == bpfJmp32 {
+			return 'w'
+		}
+		return 'r'
+	}
+
+	switch class := insn.class(); class {
+	case bpfAlu, bpfAlu64:
+		r := reg(class)
+		op := insn.op()
+		if op == bpfEnd {
+			if class == bpfAlu64 {
+				return fmt.Sprintf("(%02x) r%d = bswap%d r%d", insn.Code, insn.DstReg, insn.Imm, insn.DstReg)
+			}
+			endian := "le"
+			if insn.Code&bpfToBe != 0 {
+				endian = "be"
+			}
+			return fmt.Sprintf("(%02x) r%d = %s%d r%d", insn.Code, insn.DstReg, endian, insn.Imm, insn.DstReg)
+		} else if op == bpfNeg {
+			return fmt.Sprintf("(%02x) %c%d = -%c%d", insn.Code, r, insn.DstReg, r, insn.DstReg)
+		} else if insn.Code&bpfX != 0 {
+			if op == bpfMov && insn.Off != 0 {
+				return fmt.Sprintf("(%02x) %c%d = (s%d)%c%d", insn.Code, r, insn.DstReg, insn.Off, r, insn.SrcReg)
+			}
+			signed := ""
+			if (op == bpfDiv || op == bpfMod) && insn.Off == 1 {
+				signed = "s"
+			}
+			return fmt.Sprintf("(%02x) %c%d %s%s %c%d", insn.Code, r, insn.DstReg, signed, bpfAluString[op], r, insn.SrcReg)
+		}
+		signed := ""
+		if (op == bpfDiv || op == bpfMod) && insn.Off == 1 {
+			signed = "s"
+		}
+		return fmt.Sprintf("(%02x) %c%d %s%s %d", insn.Code, r, insn.DstReg, signed, bpfAluString[op], insn.Imm)
+	case bpfStx:
+		size := bpfLdstString[insn.size()]
+		if insn.mode() == bpfMem {
+			return fmt.Sprintf("(%02x) *(%s *)(r%d %+d) = r%d", insn.Code, size, insn.DstReg, insn.Off, insn.SrcReg)
+		} else if insn.mode() == bpfAtomic {
+			op := uint8(insn.Imm) &^ bpfFetch
+			atomic := ""
+			if insn.size() == bpfDW {
+				atomic = "64"
+			}
+			switch {
+			case insn.Imm == bpfAdd || insn.Imm == bpfAnd || insn.Imm == bpfOr || insn.Imm == bpfXor:
+				return fmt.Sprintf("(%02x) lock *(%s *)(r%d %+d) %s r%d", insn.Code, size, insn.DstReg, insn.Off, bpfAluString[uint8(insn.Imm)], insn.SrcReg)
+			case insn.Imm&bpfFetch != 0 && bpfAtomicAluString[op] != "" && insn.Imm < bpfXchg:
+				return fmt.Sprintf("(%02x) r%d = atomic%s_fetch_%s((%s *)(r%d %+d), r%d)", insn.Code, insn.SrcReg, atomic, bpfAtomicAluString[op], size, insn.DstReg, insn.Off, insn.SrcReg)
+			case insn.Imm == bpfCmpXchg:
+				return fmt.Sprintf("(%02x) r0 = atomic%s_cmpxchg((%s *)(r%d %+d), r0, r%d)", insn.Code, atomic, size, insn.DstReg, insn.Off, insn.SrcReg)
+			case insn.Imm == bpfXchg:
+				return fmt.Sprintf("(%02x) r%d = atomic%s_xchg((%s *)(r%d %+d), r%d)", insn.Code, insn.SrcReg, atomic, size, insn.DstReg, insn.Off, insn.SrcReg)
+			}
+		}
+	case bpfSt:
+		if insn.mode() == bpfMem {
+			return fmt.Sprintf("(%02x) *(%s *)(r%d %+d) = %d", insn.Code, bpfLdstString[insn.size()], insn.DstReg, insn.Off, insn.Imm)
+		} else if insn.mode() == 0xc0 {
+			return fmt.Sprintf("(%02x) nospec", insn.Code)
+		}
+	case bpfLdx:
+		if insn.mode() == bpfMem || insn.mode() == bpfMemSx {
+			signed := ""
+			if insn.mode() == bpfMemSx {
+				signed = "s"
+			}
+			return fmt.Sprintf("(%02x) r%d = *(%s%s *)(r%d %+d)", insn.Code, insn.DstReg, signed, bpfLdstString[insn.size()], insn.SrcReg, insn.Off)
+		}
+	case bpfLd:
+		switch {
+		case insn.mode() == bpfAbs:
+			return fmt.Sprintf("(%02x) r0 = *(%s *)skb[%d]", insn.Code, bpfLdstString[insn.size()], insn.Imm)
+		case insn.mode() == bpfInd:
+			return fmt.Sprintf("(%02x) r0 = *(%s *)skb[r%d + %d]", insn.Code, bpfLdstString[insn.size()], insn.SrcReg, insn.Imm)
+		case insn.IsDoubleWide():
+			return fmt.Sprintf("(%02x) r%d = %s", insn.Code, insn.DstReg, formatImm64(insn, next))
+		}
+	case bpfJmp, bpfJmp32:
+		r := reg(class)
+		op := insn.op()
+		switch {
+		case op == bpfCall && class == bpfJmp:
+			if insn.SrcReg == bpfPseudoCall {
+				return fmt.Sprintf("(%02x) call pc%+d", insn.Code, insn.Imm)
+			}
+			name := ""
+			if resolveCall != nil {
+				name = resolveCall(insn)
+			}
+			if name == "" {
+				name = HelperName(int(insn.Imm))
+			}
+			if name == "" {
+				name = "unknown"
+			}
+			return fmt.Sprintf("(%02x) call %s#%d", insn.Code, name, insn.Imm)
+		case insn.Code == bpfJmp|bpfJa:
+			return fmt.Sprintf("(%02x) goto pc%+d", insn.Code, insn.Off)
+		case insn.Code == bpfJmp32|bpfJa:
+			return fmt.Sprintf("(%02x) gotol pc%+d", insn.Code, insn.Imm)
+		case insn.Code == bpfJmp|bpfExit:
+			return fmt.Sprintf("(%02x) exit", insn.Code)
+		case insn.Code&bpfX != 0:
+			return fmt.Sprintf("(%02x) if %c%d %s %c%d goto pc%+d", insn.Code, r, insn.DstReg, bpfJmpString[op], r, insn.SrcReg, insn.Off)
+		default:
+			return fmt.Sprintf("(%02x) if %c%d %s 0x%x goto pc%+d", insn.Code, r, insn.DstReg, bpfJmpString[op], uint32(insn.Imm), insn.Off)
+		}
+	}
+	return fmt.Sprintf("(%02x) BUG_%02x", insn.Code, insn.Code)
+}
+
+// Format the value of a 64 bit immediate load the same way bpftool does
+func formatImm64(insn BpfInsn, next BpfInsn) string {
+	switch insn.SrcReg {
+	case bpfPseudoMapFd:
+		return fmt.Sprintf("map[id:%d]", uint32(insn.Imm))
+	case bpfPseudoMapValue:
+		return fmt.Sprintf("map[id:%d][0]+%d", uint32(insn.Imm), uint32(next.Imm))
+	case bpfPseudoMapIdxValue:
+		return fmt.Sprintf("map[idx:%d]+%d", uint32(insn.Imm), uint32(next.Imm))
+	case bpfPseudoFunc:
+		return fmt.Sprintf("subprog[%+d]", insn.Imm)
+	}
+	imm := uint64(uint32(next.Imm))<<32 | uint64(uint32(insn.Imm))
+	return fmt.Sprintf("0x%x", imm)
+}
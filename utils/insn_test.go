@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// Encode a single instruction the way the kernel stores it
+func encodeInsn(code uint8, dst uint8, src uint8, off int16, imm int32) []byte {
+	b := make([]byte, 8)
+	b[0] = code
+	b[1] = dst | src<<4
+	binary.LittleEndian.PutUint16(b[2:], uint16(off))
+	binary.LittleEndian.PutUint32(b[4:], uint32(imm))
+	return b
+}
+
+// Tests that decoded instructions are printed the same way bpftool prints them
+func TestDisassembleInsns(t *testing.T) {
+	var prog []byte
+	prog = append(prog, encodeInsn(0xbf, 6, 1, 0, 0)...)
+	prog = append(prog, encodeInsn(0x62, 10, 0, -4, 0)...)
+	prog = append(prog, encodeInsn(0x07, 2, 0, 0, -4)...)
+	prog = append(prog, encodeInsn(0x18, 1, 1, 0, 25)...)
+	prog = append(prog, encodeInsn(0x00, 0, 0, 0, 0)...)
+	prog = append(prog, encodeInsn(0x85, 0, 0, 0, 1)...)
+	prog = append(prog, encodeInsn(0x15, 0, 0, 2, 0)...)
+	prog = append(prog, encodeInsn(0x79, 1, 0, 8, 0)...)
+	prog = append(prog, encodeInsn(0xdb, 0, 1, 0, 1)...)
+	prog = append(prog, encodeInsn(0x18, 2, 0, 0, 1)...)
+	prog = append(prog, encodeInsn(0x00, 0, 0, 0, 2)...)
+	prog = append(prog, encodeInsn(0x05, 0, 0, -3, 0)...)
+	prog = append(prog, encodeInsn(0xb4, 0, 0, 0, 0)...)
+	prog = append(prog, encodeInsn(0x95, 0, 0, 0, 0)...)
+
+	expected := []string{
+		"   0: (bf) r6 = r1",
+		"   1: (62) *(u32 *)(r10 -4) = 0",
+		"   2: (07) r2 += -4",
+		"   3: (18) r1 = map[id:25]",
+		"   5: (85) call bpf_map_lookup_elem#1",
+		"   6: (15) if r0 == 0x0 goto pc+2",
+		"   7: (79) r1 = *(u64 *)(r0 +8)",
+		"   8: (db) r1 = atomic64_fetch_add((u64 *)(r0 +0), r1)",
+		"   9: (18) r2 = 0x200000001",
+		"  11: (05) goto pc-3",
+		"  12: (b4) w0 = 0",
+		"  13: (95) exit",
+	}
+
+	result := DisassembleInsns(DecodeInsns(prog), nil)
+	if len(result) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d: %v", len(expected), len(result), result)
+	}
+	for i := range expected {
+		if result[i] != expected[i] {
+			t.Errorf("Expected '%s', got '%s'", expected[i], result[i])
+		}
+	}
+}
+
+// Tests that the call resolver takes precedence over the helper ids
+func TestDisassembleInsnsResolveCall(t *testing.T) {
+	prog := encodeInsn(0x85, 0, 0, 0, 344000)
+	result := DisassembleInsns(DecodeInsns(prog), func(insn BpfInsn) string {
+		return "__htab_map_lookup_elem"
+	})
+	if result[0] != "   0: (85) call __htab_map_lookup_elem#344000" {
+		t.Errorf("Unexpected disassembly '%s'", result[0])
+	}
+
+	result = DisassembleInsns(DecodeInsns(prog), nil)
+	if result[0] != "   0: (85) call unknown#344000" {
+		t.Errorf("Unexpected disassembly '%s'", result[0])
+	}
+}
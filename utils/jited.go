@@ -0,0 +1,94 @@
+// The utils/jited.go file lines up the xlated instructions of a program with
+// the native code they were jit compiled to. bpftool prints the source line
+// of a group of instructions as a `; ...` comment in front of it in both
+// dumps when the program has line info so the dumps are split at these
+// comments and the groups with the same source line are paired up
+package utils
+
+import "strings"
+
+// A group of instructions that were compiled from the same source line
+type DisassemblyBlock struct {
+	// The source line without the leading `;`. Empty for the instructions in
+	// front of the first source line or if there is no line info
+	Source string
+
+	Xlated []string
+	Jited  []string
+}
+
+// A group of lines of a single dump
+type sourceBlock struct {
+	source string
+	lines  []string
+}
+
+// Split a dump at its source line comments. Empty lines are dropped
+func splitSourceBlocks(lines []string) []sourceBlock {
+	blocks := []sourceBlock{}
+	current := sourceBlock{}
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, ";") {
+			if current.source != "" || len(current.lines) > 0 {
+				blocks = append(blocks, current)
+			}
+			current = sourceBlock{source: strings.TrimSpace(strings.TrimPrefix(trimmed, ";"))}
+			continue
+		}
+		current.lines = append(current.lines, line)
+	}
+	if current.source != "" || len(current.lines) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// Pair up the groups of xlated instructions and jited code that have the same
+// source line. The groups are in the same order in both dumps but either one
+// may have groups the other doesn't (i.e. instructions the verifier removed)
+// so those get a block of their own. Without line info the whole dumps end up
+// in a single block
+func AlignDisassembly(xlated []string, jited []string) []DisassemblyBlock {
+	x := splitSourceBlocks(xlated)
+	j := splitSourceBlocks(jited)
+
+	result := []DisassemblyBlock{}
+	xi, ji := 0, 0
+	for xi < len(x) && ji < len(j) {
+		if x[xi].source == j[ji].source {
+			result = append(result, DisassemblyBlock{Source: x[xi].source, Xlated: x[xi].lines, Jited: j[ji].lines})
+			xi++
+			ji++
+			continue
+		}
+
+		// Skip ahead in the jited code if the source line shows up later on.
+		// Otherwise the xlated group has no native code of its own
+		next := -1
+		for k := ji + 1; k < len(j); k++ {
+			if j[k].source == x[xi].source {
+				next = k
+				break
+			}
+		}
+		if next < 0 {
+			result = append(result, DisassemblyBlock{Source: x[xi].source, Xlated: x[xi].lines})
+			xi++
+			continue
+		}
+		for ; ji < next; ji++ {
+			result = append(result, DisassemblyBlock{Source: j[ji].source, Jited: j[ji].lines})
+		}
+	}
+	for ; xi < len(x); xi++ {
+		result = append(result, DisassemblyBlock{Source: x[xi].source, Xlated: x[xi].lines})
+	}
+	for ; ji < len(j); ji++ {
+		result = append(result, DisassemblyBlock{Source: j[ji].source, Jited: j[ji].lines})
+	}
+	return result
+}
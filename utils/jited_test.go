@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAlignDisassembly(t *testing.T) {
+	xlated := []string{
+		"int prog(void * ctx):",
+		"; int x = 1;",
+		"   0: (b7) r1 = 1",
+		"; if (x)",
+		"   1: (15) if r1 == 0x0 goto pc+1",
+		"; return 0;",
+		"   2: (b7) r0 = 0",
+		"   3: (95) exit",
+		"",
+	}
+	jited := []string{
+		"bpf_prog_1234_prog:",
+		"; int x = 1;",
+		"   0:\tmov    $0x1,%edi",
+		"; return 0;",
+		"   5:\txor    %eax,%eax",
+		"   7:\tret",
+		"; unreachable",
+		"   8:\tint3",
+	}
+
+	expected := []DisassemblyBlock{
+		{Source: "", Xlated: []string{"int prog(void * ctx):"}, Jited: []string{"bpf_prog_1234_prog:"}},
+		{Source: "int x = 1;", Xlated: []string{"   0: (b7) r1 = 1"}, Jited: []string{"   0:\tmov    $0x1,%edi"}},
+		{Source: "if (x)", Xlated: []string{"   1: (15) if r1 == 0x0 goto pc+1"}},
+		{Source: "return 0;", Xlated: []string{"   2: (b7) r0 = 0", "   3: (95) exit"}, Jited: []string{"   5:\txor    %eax,%eax", "   7:\tret"}},
+		{Source: "unreachable", Jited: []string{"   8:\tint3"}},
+	}
+	blocks := AlignDisassembly(xlated, jited)
+	if !reflect.DeepEqual(blocks, expected) {
+		t.Errorf("Unexpected blocks\n%+v\nexpected\n%+v", blocks, expected)
+	}
+
+	// Without line info everything ends up in one block
+	blocks = AlignDisassembly([]string{"0: (95) exit"}, []string{"0:\tret"})
+	if len(blocks) != 1 || len(blocks[0].Xlated) != 1 || len(blocks[0].Jited) != 1 {
+		t.Errorf("Expected a single block, got %+v", blocks)
+	}
+}
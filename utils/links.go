@@ -0,0 +1,270 @@
+// The utils/links.go file lists the bpf links on the system. Links are how
+// most of the newer attachment types (fentry/fexit, lsm, iterators,
+// struct_ops, netfilter, tcx, kprobe_multi and uprobe_multi) attach programs
+// and none of them show up in `perf list`, `net show` or `cgroup tree`
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A function a kprobe_multi link is attached to
+type BpfLinkFunc struct {
+	Func string `json:"func,omitempty"`
+}
+
+// A bpf link. The fields mirror the output of `bpftool link show -j` and only
+// the ones that belong to the type of the link are set
+type BpfLink struct {
+	Id         int    `json:"id"`
+	Type       string `json:"type"`
+	ProgId     int    `json:"prog_id"`
+	AttachType string `json:"attach_type,omitempty"`
+
+	// raw_tracepoint
+	TpName string `json:"tp_name,omitempty"`
+
+	// tracing (fentry, fexit, fmod_ret, lsm). The attached function is the
+	// btf type target_btf_id of the kernel btf object target_obj_id. When the
+	// target is another bpf program target_obj_id is the id of that program
+	TargetObjId int `json:"target_obj_id,omitempty"`
+	TargetBtfId int `json:"target_btf_id,omitempty"`
+
+	// The name of the kernel function a tracing link is attached to. Found
+	// through the btf of the target since bpftool only prints the ids
+	TargetFunc string `json:"target_func,omitempty"`
+
+	// cgroup
+	CgroupId uint64 `json:"cgroup_id,omitempty"`
+
+	// iter
+	TargetName string `json:"target_name,omitempty"`
+
+	// netns
+	NetnsIno int `json:"netns_ino,omitempty"`
+
+	// xdp, tcx and netkit
+	Ifindex int    `json:"ifindex,omitempty"`
+	Devname string `json:"devname,omitempty"`
+
+	// struct_ops and iterators over maps
+	MapId int `json:"map_id,omitempty"`
+
+	// netfilter
+	Pf   int `json:"pf,omitempty"`
+	Hook int `json:"hook,omitempty"`
+	Prio int `json:"prio,omitempty"`
+
+	// kprobe_multi and uprobe_multi
+	Retprobe bool          `json:"retprobe,omitempty"`
+	FuncCnt  int           `json:"func_cnt,omitempty"`
+	Funcs    []BpfLinkFunc `json:"funcs,omitempty"`
+	Path     string        `json:"path,omitempty"`
+	Pid      int           `json:"pid,omitempty"`
+
+	// perf_event
+	EventType  string `json:"event_type,omitempty"`
+	Func       string `json:"func,omitempty"`
+	File       string `json:"file,omitempty"`
+	Tracepoint string `json:"tracepoint,omitempty"`
+
+	// The processes holding the link
+	Pids []ProcessInfo `json:"pids,omitempty"`
+}
+
+// The netfilter hooks (enum nf_inet_hooks)
+var netfilterHookNames = []string{"prerouting", "input", "forward", "output", "postrouting"}
+
+// Get the name of a netfilter hook
+func netfilterHookName(hook int) string {
+	if hook >= 0 && hook < len(netfilterHookNames) {
+		return netfilterHookNames[hook]
+	}
+	return fmt.Sprintf("hook %d", hook)
+}
+
+// Get the name of a netfilter protocol family
+func netfilterPfName(pf int) string {
+	switch pf {
+	case 2:
+		return "ipv4"
+	case 10:
+		return "ipv6"
+	}
+	return fmt.Sprintf("pf %d", pf)
+}
+
+// Describe where the link attaches its program in a single line
+func (l BpfLink) AttachPoint() string {
+	switch l.Type {
+	case "raw_tracepoint":
+		return l.TpName
+	case "tracing":
+		if l.TargetFunc != "" {
+			return fmt.Sprintf("%s %s", l.AttachType, l.TargetFunc)
+		}
+		return fmt.Sprintf("%s (btf %d type %d)", l.AttachType, l.TargetObjId, l.TargetBtfId)
+	case "cgroup":
+		return fmt.Sprintf("cgroup %d (%s)", l.CgroupId, l.AttachType)
+	case "iter":
+		if l.MapId != 0 {
+			return fmt.Sprintf("iter %s (map %d)", l.TargetName, l.MapId)
+		}
+		return "iter " + l.TargetName
+	case "netns":
+		return fmt.Sprintf("netns %d (%s)", l.NetnsIno, l.AttachType)
+	case "xdp", "tcx", "netkit":
+		dev := l.Devname
+		if dev == "" {
+			dev = fmt.Sprintf("ifindex %d", l.Ifindex)
+		}
+		if l.AttachType != "" {
+			return fmt.Sprintf("%s (%s)", dev, l.AttachType)
+		}
+		return dev
+	case "struct_ops":
+		return fmt.Sprintf("struct_ops map %d", l.MapId)
+	case "netfilter":
+		return fmt.Sprintf("netfilter %s %s prio %d", netfilterPfName(l.Pf), netfilterHookName(l.Hook), l.Prio)
+	case "kprobe_multi":
+		names := []string{}
+		for _, f := range l.Funcs {
+			names = append(names, f.Func)
+		}
+		kind := "kprobe_multi"
+		if l.Retprobe {
+			kind = "kretprobe_multi"
+		}
+		if len(names) == 0 {
+			return fmt.Sprintf("%s (%d functions)", kind, l.FuncCnt)
+		}
+		return fmt.Sprintf("%s %s", kind, strings.Join(names, ","))
+	case "uprobe_multi":
+		kind := "uprobe_multi"
+		if l.Retprobe {
+			kind = "uretprobe_multi"
+		}
+		return fmt.Sprintf("%s %s (%d offsets)", kind, l.Path, l.FuncCnt)
+	case "perf_event":
+		for _, s := range []string{l.Func, l.File, l.Tracepoint} {
+			if s != "" {
+				return s
+			}
+		}
+		return l.EventType
+	}
+	return l.Type
+}
+
+// The names of the functions tracing links are attached to keyed by
+// "btf object/type". Only names that were found are kept so every other
+// target is looked up again on the next refresh
+var linkTargetCache = map[string]string{}
+
+// The kernel btf objects tracing links were resolved with keyed by their id.
+// Dumping vmlinux takes a while so each object is only dumped once
+var linkTargetBtf = map[int]*Btf{}
+var linkTargetLock sync.Mutex
+
+// Get the btf of the kernel object a tracing link points into. Targets that
+// aren't a kernel btf object (i.e. bpf programs) have no btf
+func linkTargetObject(objId int) (*Btf, error) {
+	if btf, ok := linkTargetBtf[objId]; ok {
+		return btf, nil
+	}
+	objects, err := GetBtfObjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range objects {
+		if o.Id != objId || !o.Kernel {
+			continue
+		}
+		btf, err := GetBpfBtf(o.Id)
+		if err != nil {
+			return nil, err
+		}
+		linkTargetBtf[objId] = btf
+		return btf, nil
+	}
+	return nil, nil
+}
+
+// Find the name of the kernel function a tracing link is attached to. Targets
+// that aren't a function of a kernel btf object have no name
+func tracingTargetName(l BpfLink) string {
+	key := strconv.Itoa(l.TargetObjId) + "/" + strconv.Itoa(l.TargetBtfId)
+	linkTargetLock.Lock()
+	defer linkTargetLock.Unlock()
+	if name, ok := linkTargetCache[key]; ok {
+		return name
+	}
+
+	btf, err := linkTargetObject(l.TargetObjId)
+	if err != nil {
+		log.Debugf("Failed to get btf %d for link %d: %v\n", l.TargetObjId, l.Id, err)
+		return ""
+	}
+	if btf == nil {
+		return ""
+	}
+	t, err := btf.lookup(l.TargetBtfId)
+	if err != nil || t.Kind != "FUNC" {
+		return ""
+	}
+	linkTargetCache[key] = t.Name
+	return t.Name
+}
+
+// Get every bpf link. The functions tracing links are attached to are
+// resolved to their name
+func GetBpfLinks() ([]BpfLink, error) {
+	links, err := CurrentBackend().Links()
+	if err != nil {
+		return links, err
+	}
+	for i, l := range links {
+		if l.Type == "tracing" && l.TargetFunc == "" {
+			links[i].TargetFunc = tracingTargetName(l)
+		}
+	}
+	return links, nil
+}
+
+// The link types whose attachments are already found through perf events,
+// cgroups or network devices
+var linkTypesWithOtherSource = map[string]bool{
+	"perf_event": true,
+	"cgroup":     true,
+	"xdp":        true,
+}
+
+// Add the attach points of programs attached through links. Links need a
+// 5.7+ kernel (and a recording that has them) so failing to list them isn't
+// an error
+func ApplyLinkData(programs map[int]BpfProgram) error {
+	links, err := GetBpfLinks()
+	if err != nil {
+		log.Debugf("Failed to get the bpf links: %v\n", err)
+		return nil
+	}
+
+	for _, link := range links {
+		entry, ok := programs[link.ProgId]
+		if !ok || linkTypesWithOtherSource[link.Type] {
+			continue
+		}
+		// tcx links are also listed as tc programs by `bpftool net show`
+		if (link.Type == "tcx" || link.Type == "netkit") && entry.Interface != "" {
+			continue
+		}
+		entry.AttachPoint = append(entry.AttachPoint, link.AttachPoint())
+		programs[link.ProgId] = entry
+	}
+	return nil
+}
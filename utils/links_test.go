@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBpftoolLinks(t *testing.T) {
+	linkTargetLock.Lock()
+	linkTargetCache = map[string]string{}
+	linkTargetBtf = map[int]*Btf{}
+	linkTargetLock.Unlock()
+	UseReplayBackend(t, map[string]string{
+		"-j link show": `[
+			{"id":1,"type":"tracing","prog_id":10,"prog_tag":"aaaa","attach_type":"trace_fentry","target_obj_id":1,"target_btf_id":4242,"pids":[{"pid":42,"comm":"agent"}]},
+			{"id":2,"type":"perf_event","prog_id":11,"event_type":"kprobe","func":"do_sys_open"},
+			{"id":3,"type":"netfilter","prog_id":12,"pf":2,"hook":1,"prio":-128,"flags":0},
+			{"id":4,"type":"kprobe_multi","prog_id":12,"retprobe":true,"func_cnt":2,"missed":0,"funcs":[{"addr":1,"func":"vfs_read","module":null},{"addr":2,"func":"vfs_write","module":null}]},
+			{"id":5,"type":"tcx","prog_id":13,"ifindex":2,"devname":"eth0","attach_type":"tcx_ingress"},
+			{"id":6,"type":"tracing","prog_id":14,"attach_type":"trace_fentry","target_obj_id":30,"target_btf_id":7}
+		]`,
+		"-j btf show":      `[{"id":1,"size":100,"name":"vmlinux","kernel":true},{"id":30,"size":10,"kernel":false,"prog_ids":[30]}]`,
+		"-j btf dump id 1": `{"types":[{"id":4242,"kind":"FUNC","name":"do_sys_openat2","type_id":1}]}`,
+	})
+
+	links, err := GetBpfLinks()
+	if err != nil {
+		t.Fatalf("Failed to get links: %v", err)
+	}
+	attach := []string{}
+	for _, l := range links {
+		attach = append(attach, l.AttachPoint())
+	}
+	// The target of the last link is a bpf program so it keeps its ids
+	expected := []string{
+		"trace_fentry do_sys_openat2",
+		"do_sys_open",
+		"netfilter ipv4 input prio -128",
+		"kretprobe_multi vfs_read,vfs_write",
+		"eth0 (tcx_ingress)",
+		"trace_fentry (btf 30 type 7)",
+	}
+	if !reflect.DeepEqual(attach, expected) {
+		t.Errorf("Unexpected attach points %q", attach)
+	}
+	if len(links[0].Pids) != 1 || links[0].Pids[0].Comm != "agent" {
+		t.Errorf("Expected the owner of the link, got %+v", links[0].Pids)
+	}
+
+	// perf_event links are already found through perf list and tcx links
+	// through net show
+	programs := map[int]BpfProgram{
+		10: {ProgramId: 10},
+		11: {ProgramId: 11, AttachPoint: []string{"do_sys_open"}},
+		12: {ProgramId: 12},
+		13: {ProgramId: 13, Interface: "eth0"},
+	}
+	err = ApplyLinkData(programs)
+	if err != nil {
+		t.Fatalf("Failed to apply the links: %v", err)
+	}
+	if a := programs[10].AttachPoint; len(a) != 1 || a[0] != expected[0] {
+		t.Errorf("Expected the fentry attach point, got %v", a)
+	}
+	if a := programs[11].AttachPoint; len(a) != 1 {
+		t.Errorf("Expected the perf event attach point only once, got %v", a)
+	}
+	if a := programs[12].AttachPoint; !reflect.DeepEqual(a, expected[2:4]) {
+		t.Errorf("Expected the netfilter and kprobe_multi attach points, got %v", a)
+	}
+	if a := programs[13].AttachPoint; len(a) != 0 {
+		t.Errorf("Expected no attach point for the tcx program, got %v", a)
+	}
+}
+
+func TestTracingTargetRetry(t *testing.T) {
+	linkTargetLock.Lock()
+	linkTargetCache = map[string]string{}
+	linkTargetBtf = map[int]*Btf{}
+	linkTargetLock.Unlock()
+	outputs := map[string]string{
+		"-j btf show": `[{"id":1,"size":100,"name":"vmlinux","kernel":true}]`,
+	}
+	UseReplayBackend(t, outputs)
+
+	// vmlinux can't be dumped so neither it nor the target are cached
+	link := BpfLink{Id: 1, Type: "tracing", TargetObjId: 1, TargetBtfId: 4242}
+	if name := tracingTargetName(link); name != "" {
+		t.Errorf("Expected no name, got %q", name)
+	}
+	if len(linkTargetCache) != 0 || len(linkTargetBtf) != 0 {
+		t.Fatalf("Expected nothing to be cached, got %v %v", linkTargetCache, linkTargetBtf)
+	}
+
+	// The next lookup dumps vmlinux again
+	outputs["-j btf dump id 1"] = `{"types":[{"id":4242,"kind":"FUNC","name":"do_sys_openat2","type_id":1}]}`
+	UseReplayBackend(t, outputs)
+	if name := tracingTargetName(link); name != "do_sys_openat2" {
+		t.Errorf("Expected the function after the retry, got %q", name)
+	}
+}
@@ -0,0 +1,85 @@
+// The utils/mapevents.go file streams the records that bpf programs write to
+// ringbuf and perf event array maps. These maps can't be dumped like other
+// maps. Their records have to be consumed as they are written
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// A single record read from a ringbuf or perf event array
+type MapEvent struct {
+	// When the record was read
+	Time time.Time
+
+	// The cpu the record was written on. Always -1 for ringbufs
+	Cpu int
+
+	Data []byte
+
+	// The number of records the kernel had to drop because the buffer was
+	// full. Data is empty when this is set
+	Lost int
+}
+
+// Check if the records of a map can be streamed
+func IsStreamMap(mapType string) bool {
+	return mapType == "ringbuf" || mapType == "perf_event_array"
+}
+
+// Read the records of a ringbuf or perf event array and send them to events
+// until stop is closed. This blocks until the stream ends
+func StreamBpfMapEvents(m BpfMap, events chan<- MapEvent, stop <-chan struct{}) error {
+	return CurrentBackend().MapEvents(m, events, stop)
+}
+
+// A single event printed by `bpftool -j map event_pipe`. The data is printed
+// as a list of numbers
+type eventPipeRecord struct {
+	Cpu  int   `json:"cpu"`
+	Data []int `json:"data"`
+	Lost *struct {
+		Count int `json:"count"`
+	} `json:"lost"`
+}
+
+// Decode the output of `bpftool -j map event_pipe`. bpftool prints a single
+// json list that is only closed once it is interrupted so it is decoded one
+// element at a time
+func decodeEventPipe(r io.Reader, events chan<- MapEvent, stop <-chan struct{}) error {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected a list of events, got %v", token)
+	}
+
+	for decoder.More() {
+		record := eventPipeRecord{}
+		err := decoder.Decode(&record)
+		if err != nil {
+			return err
+		}
+
+		event := MapEvent{Time: time.Now(), Cpu: record.Cpu}
+		if record.Lost != nil {
+			event.Lost = record.Lost.Count
+		}
+		event.Data = make([]byte, len(record.Data))
+		for i, b := range record.Data {
+			event.Data[i] = byte(b)
+		}
+
+		select {
+		case events <- event:
+		case <-stop:
+			return nil
+		}
+	}
+	return nil
+}
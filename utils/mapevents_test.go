@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeEventPipe(t *testing.T) {
+	output := `[{"index":0,"cpu":1,"data":[1,2,255]},{"index":1,"cpu":3,"lost":{"count":7}}]`
+	events := make(chan MapEvent, 10)
+	stop := make(chan struct{})
+
+	err := decodeEventPipe(strings.NewReader(output), events, stop)
+	if err != nil {
+		t.Fatalf("Failed to decode events: %v", err)
+	}
+	close(events)
+
+	received := []MapEvent{}
+	for e := range events {
+		received = append(received, e)
+	}
+	if len(received) != 2 {
+		t.Fatalf("Expected 2 events, got %+v", received)
+	}
+	if received[0].Cpu != 1 || string(received[0].Data) != "\x01\x02\xff" || received[0].Lost != 0 {
+		t.Errorf("Unexpected first event %+v", received[0])
+	}
+	if received[1].Cpu != 3 || len(received[1].Data) != 0 || received[1].Lost != 7 {
+		t.Errorf("Unexpected lost event %+v", received[1])
+	}
+
+	err = decodeEventPipe(strings.NewReader(`{"error":"no perf buffers"}`), events, stop)
+	if err == nil {
+		t.Errorf("Expected an error for output that isn't a list")
+	}
+}
@@ -0,0 +1,296 @@
+// The utils/mapfile.go file handles exporting the entries of a map to a json or
+// csv file and reading them back. The keys and values are written with a
+// format, width and endianness (the same ones the map view uses) so the files
+// are easy to read and edit by hand
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The names of the formats in the same order as the format constants
+var formatNames = []string{"hex", "decimal", "char", "raw", "btf"}
+var endiannessNames = []string{"little", "big"}
+
+// How map keys and values are printed
+type EntryFormat struct {
+	Format     int
+	Width      int
+	Endianness int
+}
+
+func indexOf(names []string, name string) int {
+	for i, n := range names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Build an EntryFormat from the names used in exported files i.e. hex, 4, little
+func ParseEntryFormat(format string, width int, endianness string) (EntryFormat, error) {
+	f := EntryFormat{
+		Format:     indexOf(formatNames, format),
+		Width:      width,
+		Endianness: indexOf(endiannessNames, endianness),
+	}
+	if f.Format < 0 {
+		return f, fmt.Errorf("unknown format %s. Expected one of %s", format, strings.Join(formatNames, ", "))
+	}
+	if f.Endianness < 0 {
+		return f, fmt.Errorf("unknown endianness %s. Expected little or big", endianness)
+	}
+	if width != DataWidth8 && width != DataWidth16 && width != DataWidth32 && width != DataWidth64 {
+		return f, fmt.Errorf("invalid width %d. Expected 1, 2, 4 or 8", width)
+	}
+	return f, nil
+}
+
+// Print the key and value of an entry
+func (f EntryFormat) FormatEntry(entry BpfMapEntry) (string, string) {
+	format := f.Format
+	if format == FormatBtf {
+		format = FormatHex
+	}
+	keyText := FormatBytes(format, f.Width, f.Endianness, entry.Key)
+	valueText := FormatBytes(format, f.Width, f.Endianness, entry.Value)
+
+	if f.Format == FormatBtf && entry.Formatted != nil {
+		if len(entry.Formatted.Key) > 0 {
+			keyText = FormattedString(entry.Formatted.Key)
+		}
+		if len(entry.Formatted.Value) > 0 {
+			valueText = FormattedString(entry.Formatted.Value)
+		}
+	}
+	return keyText, valueText
+}
+
+// Print the value of an entry. The values of per cpu entries are separated by
+// a |
+func (f EntryFormat) FormatValue(entry BpfMapEntry) string {
+	if len(entry.Values) == 0 {
+		_, value := f.FormatEntry(entry)
+		return value
+	}
+	values := []string{}
+	for _, v := range entry.Values {
+		values = append(values, FormatBytes(f.Format, f.Width, f.Endianness, v))
+	}
+	return strings.Join(values, " | ")
+}
+
+// Only the hex, decimal and raw formats can be parsed back since the others
+// lose information
+func (f EntryFormat) CheckImportable() error {
+	if f.Format == FormatChar || f.Format == FormatBtf {
+		return fmt.Errorf("data in the %s format can't be imported. Use hex, decimal or raw", formatNames[f.Format])
+	}
+	return nil
+}
+
+// Parse a key or value that was printed with this format back into size bytes
+func (f EntryFormat) ParseBytes(text string, size int) ([]byte, error) {
+	err := f.CheckImportable()
+	if err != nil {
+		return nil, err
+	}
+
+	width := f.Width
+	if f.Format == FormatRaw {
+		text = strings.Trim(text, "[]")
+		width = DataWidth8
+	}
+	base := 0
+	if f.Format == FormatDecimal {
+		base = 10
+	}
+
+	result := []byte{}
+	for _, s := range strings.Fields(text) {
+		v, err := strconv.ParseUint(s, base, width*8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %d byte %s value %s", width, formatNames[f.Format], s)
+		}
+		buf := make([]byte, 8)
+		if f.Endianness == EndianBig {
+			binary.BigEndian.PutUint64(buf, v)
+			buf = buf[8-width:]
+		} else {
+			binary.LittleEndian.PutUint64(buf, v)
+			buf = buf[:width]
+		}
+		result = append(result, buf...)
+	}
+
+	// The last value is padded with zeros when the size isn't a multiple of
+	// the width
+	for len(result) > size && result[len(result)-1] == 0 {
+		result = result[:len(result)-1]
+	}
+	if len(result) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d in %s", size, len(result), text)
+	}
+	return result, nil
+}
+
+// A single entry in an exported file. Entries of per cpu maps have a value for
+// each cpu instead of a single value
+type mapFileEntry struct {
+	Key    string   `json:"key"`
+	Value  string   `json:"value,omitempty"`
+	Values []string `json:"values,omitempty"`
+}
+
+// The json export of a map. The format is saved with the entries so the file
+// can be imported regardless of what is currently selected
+type mapFile struct {
+	MapId      int            `json:"map_id"`
+	MapName    string         `json:"map_name,omitempty"`
+	MapType    string         `json:"map_type"`
+	Format     string         `json:"format"`
+	Width      int            `json:"width"`
+	Endianness string         `json:"endianness"`
+	Entries    []mapFileEntry `json:"entries"`
+}
+
+// Write the entries of a map as json or csv. The csv file only has a key and
+// value column (or a column for each cpu of a per cpu map) so it has to be
+// imported with the same format it was exported with. Formats that can't be
+// imported back are refused
+func WriteMapEntries(w io.Writer, fileType string, m BpfMap, entries []BpfMapEntry, f EntryFormat) error {
+	err := f.CheckImportable()
+	if err != nil {
+		return err
+	}
+	rows := []mapFileEntry{}
+	cpus := 0
+	for _, e := range entries {
+		key, value := f.FormatEntry(e)
+		row := mapFileEntry{Key: key, Value: value}
+		if len(e.Values) > 0 {
+			row.Value = ""
+			for _, v := range e.Values {
+				row.Values = append(row.Values, FormatBytes(f.Format, f.Width, f.Endianness, v))
+			}
+			cpus = len(e.Values)
+		}
+		rows = append(rows, row)
+	}
+
+	switch fileType {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(mapFile{
+			MapId:      m.Id,
+			MapName:    m.Name,
+			MapType:    m.Type,
+			Format:     formatNames[f.Format],
+			Width:      f.Width,
+			Endianness: endiannessNames[f.Endianness],
+			Entries:    rows,
+		})
+	case "csv":
+		writer := csv.NewWriter(w)
+		header := []string{"key", "value"}
+		if cpus > 0 {
+			header = []string{"key"}
+			for cpu := 0; cpu < cpus; cpu++ {
+				header = append(header, fmt.Sprintf("cpu%d", cpu))
+			}
+		}
+		writer.Write(header)
+		for _, r := range rows {
+			if cpus > 0 {
+				writer.Write(append([]string{r.Key}, r.Values...))
+			} else {
+				writer.Write([]string{r.Key, r.Value})
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}
+	return fmt.Errorf("unknown file type %s. Expected json or csv", fileType)
+}
+
+// Read entries that were exported with WriteMapEntries. f is only used for
+// csv files since json files contain their format
+func ReadMapEntries(r io.Reader, fileType string, m BpfMap, f EntryFormat) ([]BpfMapEntry, error) {
+	rows := []mapFileEntry{}
+	switch fileType {
+	case "json":
+		file := mapFile{}
+		err := json.NewDecoder(r).Decode(&file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode json: %v", err)
+		}
+		f, err = ParseEntryFormat(file.Format, file.Width, file.Endianness)
+		if err != nil {
+			return nil, err
+		}
+		rows = file.Entries
+	case "csv":
+		records, err := csv.NewReader(r).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv: %v", err)
+		}
+		if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "key" {
+			return nil, errors.New("expected a csv file with a key and value column")
+		}
+		perCpu := records[0][1] != "value"
+		for _, record := range records[1:] {
+			if perCpu {
+				rows = append(rows, mapFileEntry{Key: record[0], Values: record[1:]})
+			} else {
+				rows = append(rows, mapFileEntry{Key: record[0], Value: record[1]})
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown file type %s. Expected json or csv", fileType)
+	}
+
+	result := []BpfMapEntry{}
+	for i, row := range rows {
+		key, err := f.ParseBytes(row.Key, m.KeySize)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d key: %v", i, err)
+		}
+		if len(row.Values) > 0 {
+			entry := BpfMapEntry{Key: key}
+			for cpu, text := range row.Values {
+				value, err := f.ParseBytes(text, m.ValueSize)
+				if err != nil {
+					return nil, fmt.Errorf("entry %d value of cpu %d: %v", i, cpu, err)
+				}
+				entry.Values = append(entry.Values, value)
+			}
+			entry.Value = entry.Values[0]
+			result = append(result, entry)
+			continue
+		}
+		value, err := f.ParseBytes(row.Value, m.ValueSize)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d value: %v", i, err)
+		}
+		result = append(result, BpfMapEntry{Key: key, Value: value})
+	}
+	return result, nil
+}
+
+// Guess the type of a file from its name. Anything that isn't a csv file is
+// treated as json
+func MapFileType(path string) string {
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return "csv"
+	}
+	return "json"
+}
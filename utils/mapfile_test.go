@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMapEntriesRoundTrip(t *testing.T) {
+	m := BpfMap{Id: 4, Type: "hash", KeySize: 4, ValueSize: 6}
+	entries := []BpfMapEntry{
+		{Key: []byte{1, 0, 0, 0}, Value: []byte{1, 2, 3, 4, 5, 6}},
+		{Key: []byte{2, 0, 0, 0}, Value: []byte{0xff, 0, 0, 0, 0, 0x80}},
+	}
+
+	formats := []EntryFormat{
+		{Format: FormatHex, Width: DataWidth8, Endianness: EndianLittle},
+		{Format: FormatDecimal, Width: DataWidth32, Endianness: EndianBig},
+		{Format: FormatHex, Width: DataWidth64, Endianness: EndianLittle},
+		{Format: FormatRaw, Width: DataWidth16, Endianness: EndianLittle},
+	}
+	for _, f := range formats {
+		for _, fileType := range []string{"json", "csv"} {
+			buf := &strings.Builder{}
+			err := WriteMapEntries(buf, fileType, m, entries, f)
+			if err != nil {
+				t.Fatalf("Failed to write %s: %v", fileType, err)
+			}
+
+			// json files know their format so they are read with a different one
+			readFormat := f
+			if fileType == "json" {
+				readFormat = EntryFormat{Format: FormatDecimal, Width: DataWidth8}
+			}
+			result, err := ReadMapEntries(strings.NewReader(buf.String()), fileType, m, readFormat)
+			if err != nil {
+				t.Fatalf("Failed to read %s %+v: %v\n%s", fileType, f, err, buf.String())
+			}
+			for i := range entries {
+				if !bytes.Equal(result[i].Key, entries[i].Key) || !bytes.Equal(result[i].Value, entries[i].Value) {
+					t.Errorf("%s %+v: expected %v, got %v", fileType, f, entries[i], result[i])
+				}
+			}
+		}
+	}
+
+	_, err := ReadMapEntries(strings.NewReader("key,value\n1,2\n"), "csv", m, EntryFormat{Format: FormatChar, Width: DataWidth8})
+	if err == nil {
+		t.Errorf("Expected the char format to be rejected")
+	}
+	err = WriteMapEntries(&strings.Builder{}, "json", m, entries, EntryFormat{Format: FormatBtf, Width: DataWidth8})
+	if err == nil {
+		t.Errorf("Expected the btf format to be refused for exports")
+	}
+	_, err = ReadMapEntries(strings.NewReader("key,value\n0x01 0x00,0x00\n"), "csv", m, EntryFormat{Format: FormatHex, Width: DataWidth8})
+	if err == nil {
+		t.Errorf("Expected a key of the wrong size to be rejected")
+	}
+}
+
+func TestPerCpuMapEntriesRoundTrip(t *testing.T) {
+	m := BpfMap{Id: 6, Type: "percpu_hash", KeySize: 1, ValueSize: 2}
+	entries := []BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1, 0}, Values: [][]byte{{1, 0}, {2, 0}}},
+		{Key: []byte{2}, Value: []byte{0, 0}, Values: [][]byte{{0, 0}, {0xff, 1}}},
+	}
+	f := EntryFormat{Format: FormatHex, Width: DataWidth8}
+	for _, fileType := range []string{"json", "csv"} {
+		buf := &strings.Builder{}
+		err := WriteMapEntries(buf, fileType, m, entries, f)
+		if err != nil {
+			t.Fatalf("Failed to write %s: %v", fileType, err)
+		}
+		if fileType == "csv" && !strings.HasPrefix(buf.String(), "key,cpu0,cpu1\n") {
+			t.Errorf("Expected a column for each cpu\n%s", buf.String())
+		}
+
+		result, err := ReadMapEntries(strings.NewReader(buf.String()), fileType, m, f)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v\n%s", fileType, err, buf.String())
+		}
+		if !PlanMapImport(m, entries, result).Empty() {
+			t.Errorf("%s: expected every cpu to round trip, got %v", fileType, result)
+		}
+	}
+}
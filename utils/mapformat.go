@@ -0,0 +1,228 @@
+// The utils/mapformat.go file prints the raw bytes of map keys and values as
+// hex, decimal, characters or a plain byte list. Multi byte numbers are
+// printed with the selected width and byte order
+package utils
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// How the bytes of a key or value are printed
+const (
+	FormatHex     = 0
+	FormatDecimal = 1
+	FormatChar    = 2
+	FormatRaw     = 3
+	FormatBtf     = 4
+)
+
+// The size in bytes of each printed number
+const (
+	DataWidth8  = 1
+	DataWidth16 = 2
+	DataWidth32 = 4
+	DataWidth64 = 8
+)
+
+// The byte order of each printed number
+const (
+	EndianLittle = 0
+	EndianBig    = 1
+)
+
+func asDecimal(width int, endian int, data []byte) string {
+	var result string = ""
+	switch width {
+	case DataWidth8:
+		for _, b := range data {
+			result += strconv.Itoa(int(b)) + " "
+		}
+		break
+	case DataWidth16:
+		if len(data)%DataWidth16 != 0 {
+			return ""
+		}
+
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 2 {
+				result += strconv.Itoa(int(binary.LittleEndian.Uint16(data[i:i+2]))) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 2 {
+				result += strconv.Itoa(int(binary.BigEndian.Uint16(data[i:i+2]))) + " "
+			}
+		}
+		break
+	case DataWidth32:
+		if len(data)%DataWidth32 != 0 {
+			return ""
+		}
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 4 {
+				result += strconv.Itoa(int(binary.LittleEndian.Uint32(data[i:i+4]))) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 4 {
+				result += strconv.Itoa(int(binary.BigEndian.Uint32(data[i:i+4]))) + " "
+			}
+		}
+		break
+	case DataWidth64:
+		if len(data)%DataWidth64 != 0 {
+			return ""
+		}
+
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 8 {
+				result += strconv.Itoa(int(binary.LittleEndian.Uint64(data[i:i+8]))) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 8 {
+				result += strconv.Itoa(int(binary.BigEndian.Uint64(data[i:i+8]))) + " "
+			}
+		}
+		break
+	}
+	result = strings.Trim(result, " ")
+	return result
+}
+
+// Similar to the asDecimal function except it displays the data as hex
+func asHex(width int, endian int, data []byte) string {
+	var result string = ""
+	switch width {
+	case DataWidth8:
+		for _, b := range data {
+			result += fmt.Sprintf("%#02x", b) + " "
+		}
+		break
+	case DataWidth16:
+		if len(data)%DataWidth16 != 0 {
+			return ""
+		}
+
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 2 {
+				result += fmt.Sprintf("%#04x", binary.LittleEndian.Uint16(data[i:i+2])) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 2 {
+				result += fmt.Sprintf("%#04x", binary.BigEndian.Uint16(data[i:i+2])) + " "
+			}
+		}
+		break
+	case DataWidth32:
+		if len(data)%DataWidth32 != 0 {
+			return ""
+		}
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 4 {
+				result += fmt.Sprintf("%#08x", binary.LittleEndian.Uint32(data[i:i+4])) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 4 {
+				result += fmt.Sprintf("%#08x", binary.BigEndian.Uint32(data[i:i+4])) + " "
+			}
+		}
+		break
+	case DataWidth64:
+		if len(data)%DataWidth64 != 0 {
+			return ""
+		}
+
+		if endian == EndianLittle {
+			for i := 0; i < len(data); i += 8 {
+				result += fmt.Sprintf("%#016x", binary.LittleEndian.Uint64(data[i:i+8])) + " "
+			}
+		} else {
+			for i := 0; i < len(data); i += 8 {
+				result += fmt.Sprintf("%#016x", binary.BigEndian.Uint64(data[i:i+8])) + " "
+			}
+		}
+		break
+	}
+	result = strings.Trim(result, " ")
+
+	return result
+}
+
+func asChar(data []byte) string {
+	var result string = ""
+	for _, b := range data {
+		if b >= 32 && b <= 126 {
+			result += fmt.Sprintf("%c", b)
+		} else {
+			result += "."
+		}
+	}
+	return result
+}
+
+// Doesn't change the default formatting of the data
+func asRaw(data []byte) string {
+	return fmt.Sprintf("%v", data)
+}
+
+// Adds some null bytes to the beggining of a slice
+func padBytesBeginning(data []byte, width int) []byte {
+	if len(data)%width == 0 {
+		return data
+	}
+
+	var bytesNeeded int = width - (len(data) % width)
+
+	var result []byte
+	for i := 0; i < bytesNeeded; i++ {
+		result = append(result, 0)
+	}
+	result = append(result, data...)
+	return result
+}
+
+// Add some null bytes to the end of a slice
+func padBytesEnd(data []byte, width int) []byte {
+	if len(data)%width == 0 {
+		return data
+	}
+
+	var bytesNeeded int = width - (len(data) % width)
+
+	var result []byte
+	for i := 0; i < bytesNeeded; i++ {
+		result = append(result, 0)
+	}
+	result = append(data, result...)
+	return result
+}
+
+// Adds padding to the bytes based on endianness
+func PadBytes(data []byte, width int) []byte {
+	if len(data)%width == 0 {
+		return data
+	}
+
+	return padBytesEnd(data, width)
+}
+
+// Apply a format based on the specified format, width, endianness
+func FormatBytes(format int, width int, endianness int, data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+
+	data = PadBytes(data, width)
+
+	switch format {
+	case FormatHex:
+		return asHex(width, endianness, data)
+	case FormatDecimal:
+		return asDecimal(width, endianness, data)
+	case FormatChar:
+		return asChar(data)
+	default:
+		return asRaw(data)
+	}
+}
@@ -0,0 +1,106 @@
+// The utils/mapimport.go file works out how to turn the current entries of a
+// map into a set of previously exported entries and applies those changes
+package utils
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// The changes needed to make a map match a set of imported entries
+type MapImportPlan struct {
+	// Entries whose key isn't in the map yet
+	Add []BpfMapEntry
+
+	// Entries whose key is in the map with a different value. Previous holds
+	// the current entries in the same order
+	Change   []BpfMapEntry
+	Previous []BpfMapEntry
+
+	// Entries in the map that aren't in the imported entries
+	Delete []BpfMapEntry
+}
+
+// Entries of array maps always exist and can't be deleted
+func canDeleteEntries(m BpfMap) bool {
+	return m.Type != "array" && m.Type != "percpu_array"
+}
+
+// Check if two entries of the same key hold the same value. Entries of per cpu
+// maps are compared cpu by cpu
+func sameValues(a BpfMapEntry, b BpfMapEntry) bool {
+	if len(a.Values) == 0 && len(b.Values) == 0 {
+		return bytes.Equal(a.Value, b.Value)
+	}
+	if len(a.Values) != len(b.Values) {
+		return false
+	}
+	for cpu := range a.Values {
+		if !bytes.Equal(a.Values[cpu], b.Values[cpu]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Compare the current entries of a map with the entries that are imported
+func PlanMapImport(m BpfMap, current []BpfMapEntry, imported []BpfMapEntry) MapImportPlan {
+	plan := MapImportPlan{}
+	existing := map[string]BpfMapEntry{}
+	for _, e := range current {
+		existing[string(e.Key)] = e
+	}
+
+	seen := map[string]bool{}
+	for _, e := range imported {
+		seen[string(e.Key)] = true
+		old, ok := existing[string(e.Key)]
+		if !ok {
+			plan.Add = append(plan.Add, e)
+		} else if !sameValues(old, e) {
+			plan.Change = append(plan.Change, e)
+			plan.Previous = append(plan.Previous, old)
+		}
+	}
+
+	if canDeleteEntries(m) {
+		for _, e := range current {
+			if !seen[string(e.Key)] {
+				plan.Delete = append(plan.Delete, e)
+			}
+		}
+	}
+	return plan
+}
+
+// Check if the plan changes anything
+func (p MapImportPlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Change) == 0 && len(p.Delete) == 0
+}
+
+func (p MapImportPlan) String() string {
+	return fmt.Sprintf("%d to add, %d to change, %d to delete", len(p.Add), len(p.Change), len(p.Delete))
+}
+
+// Write the changes of the plan to a map. This stops at the first entry that
+// fails so the map may be partially updated
+func ApplyMapImport(mapId int, plan MapImportPlan) error {
+	for _, e := range append(append([]BpfMapEntry{}, plan.Add...), plan.Change...) {
+		var err error
+		if len(e.Values) > 0 {
+			err = UpdateBpfMapEntryValues(mapId, e.Key, e.Values)
+		} else {
+			err = UpdateBpfMapEntry(mapId, e.Key, e.Value)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update key %v: %v", e.Key, err)
+		}
+	}
+	for _, e := range plan.Delete {
+		err := DeleteBpfMapEntry(mapId, e.Key)
+		if err != nil {
+			return fmt.Errorf("failed to delete key %v: %v", e.Key, err)
+		}
+	}
+	return nil
+}
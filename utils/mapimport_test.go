@@ -0,0 +1,50 @@
+package utils
+
+import "testing"
+
+func TestPlanMapImport(t *testing.T) {
+	current := []BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{2}},
+		{Key: []byte{3}, Value: []byte{3}},
+	}
+	imported := []BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{20}},
+		{Key: []byte{4}, Value: []byte{4}},
+	}
+
+	plan := PlanMapImport(BpfMap{Type: "hash"}, current, imported)
+	if len(plan.Add) != 1 || plan.Add[0].Key[0] != 4 {
+		t.Errorf("Expected key 4 to be added, got %v", plan.Add)
+	}
+	if len(plan.Change) != 1 || plan.Change[0].Value[0] != 20 || plan.Previous[0].Value[0] != 2 {
+		t.Errorf("Expected key 2 to be changed, got %v %v", plan.Change, plan.Previous)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0].Key[0] != 3 {
+		t.Errorf("Expected key 3 to be deleted, got %v", plan.Delete)
+	}
+
+	// Entries of arrays can't be deleted
+	plan = PlanMapImport(BpfMap{Type: "array"}, current, imported)
+	if len(plan.Delete) != 0 {
+		t.Errorf("Expected no deletes for an array, got %v", plan.Delete)
+	}
+	if !PlanMapImport(BpfMap{Type: "hash"}, current, current).Empty() {
+		t.Errorf("Expected an empty plan when nothing changed")
+	}
+}
+
+func TestPlanMapImportPerCpu(t *testing.T) {
+	current := []BpfMapEntry{{Key: []byte{1}, Value: []byte{1}, Values: [][]byte{{1}, {2}}}}
+	imported := []BpfMapEntry{{Key: []byte{1}, Value: []byte{1}, Values: [][]byte{{1}, {3}}}}
+
+	// Only the second cpu differs
+	plan := PlanMapImport(BpfMap{Type: "percpu_array"}, current, imported)
+	if len(plan.Change) != 1 || plan.Change[0].Values[1][0] != 3 {
+		t.Errorf("Expected the value of cpu 1 to be changed, got %v", plan.Change)
+	}
+	if !PlanMapImport(BpfMap{Type: "percpu_array"}, current, current).Empty() {
+		t.Errorf("Expected an empty plan when no cpu changed")
+	}
+}
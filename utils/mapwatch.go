@@ -0,0 +1,103 @@
+// The utils/mapwatch.go file compares consecutive dumps of a map so the map
+// view can show which entries were added, changed or removed since the
+// previous dump and how often each entry has changed while it was watched
+package utils
+
+import (
+	"bytes"
+	"sort"
+	"time"
+)
+
+const (
+	EntryUnchanged = 0
+	EntryNew       = 1
+	EntryChanged   = 2
+	EntryRemoved   = 3
+)
+
+// An entry of a watched map along with what happened to it in the last dump
+type WatchedEntry struct {
+	Entry BpfMapEntry
+
+	// One of the Entry* constants
+	Status int
+
+	// How many times the value changed since the watch started
+	Changes int
+
+	// When the entry was last added or changed. Zero if it has been the same
+	// since the watch started
+	LastChange time.Time
+}
+
+// Compare the values of two entries including the value of every cpu
+func entryValuesEqual(a BpfMapEntry, b BpfMapEntry) bool {
+	if !bytes.Equal(a.Value, b.Value) || len(a.Values) != len(b.Values) {
+		return false
+	}
+	for i := range a.Values {
+		if !bytes.Equal(a.Values[i], b.Values[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keeps track of the entries of a map between dumps
+type MapWatcher struct {
+	entries map[string]WatchedEntry
+	started bool
+}
+
+func NewMapWatcher() *MapWatcher {
+	return &MapWatcher{entries: map[string]WatchedEntry{}}
+}
+
+// Compare a new dump of the map with the previous one. The result has the
+// current entries in the order they were dumped followed by the entries that
+// were removed since the previous dump. The first dump is only used as the
+// starting point so every entry is unchanged
+func (w *MapWatcher) Update(entries []BpfMapEntry, now time.Time) []WatchedEntry {
+	result := []WatchedEntry{}
+	current := map[string]WatchedEntry{}
+	for _, e := range entries {
+		key := string(e.Key)
+		watched, ok := w.entries[key]
+		if !ok {
+			watched = WatchedEntry{Status: EntryNew, LastChange: now}
+			if !w.started {
+				watched = WatchedEntry{Status: EntryUnchanged}
+			}
+		} else if !entryValuesEqual(watched.Entry, e) {
+			watched.Status = EntryChanged
+			watched.Changes++
+			watched.LastChange = now
+		} else {
+			watched.Status = EntryUnchanged
+		}
+		watched.Entry = e
+		current[key] = watched
+		result = append(result, watched)
+	}
+
+	// Removed entries are only reported once. The counter starts over if the
+	// key is added again
+	for _, e := range entries {
+		delete(w.entries, string(e.Key))
+	}
+	removed := []WatchedEntry{}
+	for _, watched := range w.entries {
+		watched.Status = EntryRemoved
+		watched.LastChange = now
+		removed = append(removed, watched)
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return bytes.Compare(removed[i].Entry.Key, removed[j].Entry.Key) < 0
+	})
+	result = append(result, removed...)
+
+	w.entries = current
+	w.started = true
+	return result
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMapWatcher(t *testing.T) {
+	w := NewMapWatcher()
+	now := time.Unix(1000, 0)
+	first := w.Update([]BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{2}},
+		{Key: []byte{3}, Value: []byte{3}},
+	}, now)
+	for _, e := range first {
+		if e.Status != EntryUnchanged {
+			t.Errorf("Expected the first dump to be unchanged, got %+v", e)
+		}
+	}
+
+	second := w.Update([]BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{5}},
+		{Key: []byte{4}, Value: []byte{4}},
+	}, now.Add(time.Second))
+	expected := []struct {
+		key     byte
+		status  int
+		changes int
+	}{
+		{1, EntryUnchanged, 0},
+		{2, EntryChanged, 1},
+		{4, EntryNew, 0},
+		{3, EntryRemoved, 0},
+	}
+	if len(second) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), second)
+	}
+	for i, e := range expected {
+		if second[i].Entry.Key[0] != e.key || second[i].Status != e.status || second[i].Changes != e.changes {
+			t.Errorf("Expected %+v, got %+v", e, second[i])
+		}
+	}
+
+	third := w.Update([]BpfMapEntry{
+		{Key: []byte{1}, Value: []byte{1}},
+		{Key: []byte{2}, Value: []byte{6}},
+		{Key: []byte{4}, Value: []byte{4}},
+	}, now.Add(2*time.Second))
+	if len(third) != 3 || third[1].Changes != 2 || third[2].Status != EntryUnchanged {
+		t.Errorf("Unexpected third dump %+v", third)
+	}
+}
@@ -0,0 +1,1382 @@
+// The utils/native_linux.go file implements the Backend interface using the
+// bpf(2) syscall directly. This removes the dependency on bpftool entirely at
+// the cost of a few features that bpftool gets from libbpf (feature probing,
+// legacy tc attachments)
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Attributes used by the BPF_*_GET_NEXT_ID and BPF_*_GET_FD_BY_ID commands
+type bpfIdAttr struct {
+	id        uint32
+	nextId    uint32
+	openFlags uint32
+}
+
+// Attributes used by BPF_OBJ_GET_INFO_BY_FD
+type bpfInfoAttr struct {
+	fd      uint32
+	infoLen uint32
+	info    uint64
+}
+
+// Attributes used by the BPF_MAP_*_ELEM commands
+type bpfMapElemAttr struct {
+	mapFd uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+// Attributes used by BPF_PROG_QUERY
+type bpfQueryAttr struct {
+	targetFd    uint32
+	attachType  uint32
+	queryFlags  uint32
+	attachFlags uint32
+	progIds     uint64
+	progCnt     uint32
+	_           uint32
+}
+
+// Attributes used by BPF_TASK_FD_QUERY
+type bpfTaskFdQueryAttr struct {
+	pid         uint32
+	fd          uint32
+	flags       uint32
+	bufLen      uint32
+	buf         uint64
+	progId      uint32
+	fdType      uint32
+	probeOffset uint64
+	probeAddr   uint64
+}
+
+// Mirrors struct bpf_prog_info
+type bpfProgInfo struct {
+	progType             uint32
+	id                   uint32
+	tag                  [8]byte
+	jitedProgLen         uint32
+	xlatedProgLen        uint32
+	jitedProgInsns       uint64
+	xlatedProgInsns      uint64
+	loadTime             uint64
+	createdByUid         uint32
+	nrMapIds             uint32
+	mapIds               uint64
+	name                 [16]byte
+	ifindex              uint32
+	gplCompatible        uint32
+	netnsDev             uint64
+	netnsIno             uint64
+	nrJitedKsyms         uint32
+	nrJitedFuncLens      uint32
+	jitedKsyms           uint64
+	jitedFuncLens        uint64
+	btfId                uint32
+	funcInfoRecSize      uint32
+	funcInfo             uint64
+	nrFuncInfo           uint32
+	nrLineInfo           uint32
+	lineInfo             uint64
+	jitedLineInfo        uint64
+	nrJitedLineInfo      uint32
+	lineInfoRecSize      uint32
+	jitedLineInfoRecSize uint32
+	nrProgTags           uint32
+	progTags             uint64
+	runTimeNs            uint64
+	runCnt               uint64
+	recursionMisses      uint64
+	verifiedInsns        uint32
+	attachBtfObjId       uint32
+	attachBtfId          uint32
+	_                    uint32
+}
+
+// Mirrors struct bpf_map_info
+type bpfMapInfo struct {
+	mapType               uint32
+	id                    uint32
+	keySize               uint32
+	valueSize             uint32
+	maxEntries            uint32
+	mapFlags              uint32
+	name                  [16]byte
+	ifindex               uint32
+	btfVmlinuxValueTypeId uint32
+	netnsDev              uint64
+	netnsIno              uint64
+	btfId                 uint32
+	btfKeyTypeId          uint32
+	btfValueTypeId        uint32
+	_                     uint32
+	mapExtra              uint64
+}
+
+// Mirrors struct bpf_btf_info
+type bpfBtfInfo struct {
+	btf       uint64
+	btfSize   uint32
+	id        uint32
+	name      uint64
+	nameLen   uint32
+	kernelBtf uint32
+}
+
+// Mirrors struct bpf_link_info. The type specific part is left as raw bytes
+type bpfLinkInfo struct {
+	linkType uint32
+	id       uint32
+	progId   uint32
+	_        uint32
+	extra    [64]byte
+}
+
+// bpf(2) commands
+const (
+	bpfMapLookupElem  = 1
+	bpfMapUpdateElem  = 2
+	bpfMapDeleteElem  = 3
+	bpfMapGetNextKey  = 4
+	bpfProgGetNextId  = 11
+	bpfMapGetNextId   = 12
+	bpfProgGetFdById  = 13
+	bpfMapGetFdById   = 14
+	bpfObjGetInfoByFd = 15
+	bpfProgQuery      = 16
+	bpfBtfGetFdById   = 19
+	bpfTaskFdQuery    = 20
+	bpfBtfGetNextId   = 23
+	bpfLinkGetFdById  = 30
+	bpfLinkGetNextId  = 31
+)
+
+// Names of the program types (enum bpf_prog_type) as printed by bpftool
+var progTypeNames = []string{
+	"unspec", "socket_filter", "kprobe", "sched_cls", "sched_act",
+	"tracepoint", "xdp", "perf_event", "cgroup_skb", "cgroup_sock",
+	"lwt_in", "lwt_out", "lwt_xmit", "sock_ops", "sk_skb", "cgroup_device",
+	"sk_msg", "raw_tracepoint", "cgroup_sock_addr", "lwt_seg6local",
+	"lirc_mode2", "sk_reuseport", "flow_dissector", "cgroup_sysctl",
+	"raw_tracepoint_writable", "cgroup_sockopt", "tracing", "struct_ops",
+	"ext", "lsm", "sk_lookup", "syscall", "netfilter",
+}
+
+// Names of the map types (enum bpf_map_type) as printed by bpftool
+var mapTypeNames = []string{
+	"unspec", "hash", "array", "prog_array", "perf_event_array",
+	"percpu_hash", "percpu_array", "stack_trace", "cgroup_array", "lru_hash",
+	"lru_percpu_hash", "lpm_trie", "array_of_maps", "hash_of_maps", "devmap",
+	"sockmap", "cpumap", "xskmap", "sockhash", "cgroup_storage",
+	"reuseport_sockarray", "percpu_cgroup_storage", "queue", "stack",
+	"sk_storage", "devmap_hash", "struct_ops", "ringbuf", "inode_storage",
+	"task_storage", "bloom_filter", "user_ringbuf", "cgrp_storage",
+}
+
+// Names of the attach types (enum bpf_attach_type) as printed by bpftool
+var attachTypeNames = []string{
+	"cgroup_inet_ingress", "cgroup_inet_egress", "cgroup_inet_sock_create",
+	"cgroup_sock_ops", "sk_skb_stream_parser", "sk_skb_stream_verdict",
+	"cgroup_device", "sk_msg_verdict", "cgroup_inet4_bind",
+	"cgroup_inet6_bind", "cgroup_inet4_connect", "cgroup_inet6_connect",
+	"cgroup_inet4_post_bind", "cgroup_inet6_post_bind",
+	"cgroup_udp4_sendmsg", "cgroup_udp6_sendmsg", "lirc_mode2",
+	"flow_dissector", "cgroup_sysctl", "cgroup_udp4_recvmsg",
+	"cgroup_udp6_recvmsg", "cgroup_getsockopt", "cgroup_setsockopt",
+	"trace_raw_tp", "trace_fentry", "trace_fexit", "modify_return",
+	"lsm_mac", "trace_iter", "cgroup_inet4_getpeername",
+	"cgroup_inet6_getpeername", "cgroup_inet4_getsockname",
+	"cgroup_inet6_getsockname", "xdp_devmap", "cgroup_inet_sock_release",
+	"xdp_cpumap", "sk_lookup", "xdp", "sk_skb_verdict",
+	"sk_reuseport_select", "sk_reuseport_select_or_migrate", "perf_event",
+	"trace_kprobe_multi", "lsm_cgroup", "struct_ops", "netfilter",
+	"tcx_ingress", "tcx_egress", "trace_uprobe_multi",
+}
+
+// The attach types that can be queried on a cgroup
+var cgroupAttachTypes = []uint32{
+	0, 1, 2, 3, 6, 8, 9, 10, 11, 12, 13, 14, 15, 18, 19, 20, 21, 22, 29, 30,
+	31, 32, 34, 43,
+}
+
+// Names of the perf event fd types returned by BPF_TASK_FD_QUERY
+var perfFdTypeNames = []string{
+	"raw_tracepoint", "tracepoint", "kprobe", "kretprobe", "uprobe",
+	"uretprobe",
+}
+
+const (
+	bpfLinkTypeTcx = 11
+	bpfFRetprobe   = 1
+	bpfFAllowMulti = 2
+	bpfFOverride   = 1
+	iflaXdp        = 43
+	iflaXdpAtt     = 2
+	iflaXdpProgId  = 4
+)
+
+// Get a name from one of the name tables above. Unknown values are printed
+// the same way bpftool prints them
+func lookupName(names []string, value uint32) string {
+	if int(value) < len(names) {
+		return names[value]
+	}
+	return fmt.Sprintf("type %d", value)
+}
+
+// Convert a null terminated c string to a go string
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i != -1 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func bpfSyscall(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	fd, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return int(fd), errno
+	}
+	return int(fd), nil
+}
+
+// Walk all the ids of a given object type using one of the GET_NEXT_ID
+// commands
+func bpfObjIds(cmd int) ([]uint32, error) {
+	var ids []uint32
+	attr := bpfIdAttr{}
+	for {
+		_, err := bpfSyscall(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		if errors.Is(err, unix.ENOENT) {
+			return ids, nil
+		} else if err != nil {
+			return ids, err
+		}
+		ids = append(ids, attr.nextId)
+		attr.id = attr.nextId
+	}
+}
+
+// Get an fd for an object using one of the GET_FD_BY_ID commands
+func bpfObjFd(cmd int, id uint32) (int, error) {
+	attr := bpfIdAttr{id: id}
+	return bpfSyscall(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+}
+
+// Fill info with the information about the object behind fd
+func bpfObjInfo(fd int, info unsafe.Pointer, size uintptr) error {
+	attr := bpfInfoAttr{
+		fd:      uint32(fd),
+		infoLen: uint32(size),
+		info:    uint64(uintptr(info)),
+	}
+	_, err := bpfSyscall(bpfObjGetInfoByFd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	return err
+}
+
+// Read a key from /proc/self/fdinfo/<fd> (i.e. memlock, frozen)
+func fdinfoValue(fd int, key string) (int, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/fdinfo/%d", fd))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), ":")
+		if found && name == key {
+			return strconv.Atoi(strings.TrimSpace(value))
+		}
+	}
+	return 0, fmt.Errorf("%s not found in fdinfo", key)
+}
+
+// Parse the list of possible cpus i.e. 0-7 or 0,2-3
+func possibleCpus() (int, error) {
+	content, err := os.ReadFile("/sys/devices/system/cpu/possible")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, part := range strings.Split(strings.TrimSpace(string(content)), ",") {
+		low, high, found := strings.Cut(part, "-")
+		if !found {
+			high = low
+		}
+		l, err := strconv.Atoi(low)
+		if err != nil {
+			return 0, err
+		}
+		h, err := strconv.Atoi(high)
+		if err != nil {
+			return 0, err
+		}
+		count += h - l + 1
+	}
+	return count, nil
+}
+
+// Convert a time relative to boot into a unix timestamp
+func bootTimeToUnix(ns uint64) int {
+	var boot unix.Timespec
+	if err := unix.ClockGettime(unix.CLOCK_BOOTTIME, &boot); err != nil {
+		return 0
+	}
+	sinceLoad := time.Duration(boot.Nano() - int64(ns))
+	return int(time.Now().Add(-sinceLoad).Unix())
+}
+
+// A Backend that talks to the kernel directly using the bpf syscall
+type NativeBackend struct {
+	// Kernel symbols used to resolve helper calls. Loaded on first use
+	symsOnce sync.Once
+	syms     map[uint64]string
+	callBase uint64
+}
+
+func NewNativeBackend() (Backend, error) {
+	// Make sure the bpf syscall is usable before committing to this backend
+	_, err := bpfObjIds(bpfProgGetNextId)
+	if err != nil {
+		return nil, fmt.Errorf("bpf syscall is not usable: %v", err)
+	}
+	return &NativeBackend{}, nil
+}
+
+func (n *NativeBackend) progInfo(fd int) (bpfProgInfo, error) {
+	info := bpfProgInfo{}
+	err := bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	return info, err
+}
+
+func (n *NativeBackend) mapInfo(fd int) (bpfMapInfo, error) {
+	info := bpfMapInfo{}
+	err := bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	return info, err
+}
+
+func (n *NativeBackend) Programs() ([]BpfProgram, error) {
+	result := []BpfProgram{}
+	ids, err := bpfObjIds(bpfProgGetNextId)
+	if err != nil {
+		return result, err
+	}
+
+	owners := findBpfFdOwners("prog_id")
+	for _, id := range ids {
+		fd, err := bpfObjFd(bpfProgGetFdById, id)
+		if err != nil {
+			// The program may have been unloaded since we got the id
+			continue
+		}
+
+		info, err := n.progInfo(fd)
+		if err != nil {
+			unix.Close(fd)
+			continue
+		}
+
+		// A second call is needed to get the map ids
+		mapIds := make([]uint32, info.nrMapIds)
+		if len(mapIds) > 0 {
+			info = bpfProgInfo{nrMapIds: uint32(len(mapIds)), mapIds: uint64(uintptr(unsafe.Pointer(&mapIds[0])))}
+			err = bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+			runtime.KeepAlive(mapIds)
+			if err != nil {
+				unix.Close(fd)
+				continue
+			}
+		}
+		memlock, _ := fdinfoValue(fd, "memlock")
+		unix.Close(fd)
+
+		program := BpfProgram{
+			Name:            cString(info.name[:]),
+			Tag:             hex.EncodeToString(info.tag[:]),
+			ProgramId:       int(info.id),
+			ProgType:        lookupName(progTypeNames, info.progType),
+			GplCompatible:   info.gplCompatible&1 == 1,
+			LoadedAt:        bootTimeToUnix(info.loadTime),
+			OwnerUid:        int(info.createdByUid),
+			BytesXlated:     int(info.xlatedProgLen),
+			Jited:           info.jitedProgLen > 0,
+			BytesJited:      int(info.jitedProgLen),
+			BytesMemlock:    memlock,
+			RunTimeNs:       int(info.runTimeNs),
+			RunCnt:          int(info.runCnt),
+			RecursionMisses: int(info.recursionMisses),
+			BtfId:           int(info.btfId),
+			Pids:            owners[int(info.id)],
+		}
+		for _, mapId := range mapIds {
+			program.MapIds = append(program.MapIds, int(mapId))
+		}
+		result = append(result, program)
+	}
+	addProcessDetails(result)
+	return result, nil
+}
+
+// Get the map info for every map
+func (n *NativeBackend) Maps() ([]BpfMap, error) {
+	result := []BpfMap{}
+	ids, err := bpfObjIds(bpfMapGetNextId)
+	if err != nil {
+		return result, err
+	}
+
+	for _, id := range ids {
+		fd, err := bpfObjFd(bpfMapGetFdById, id)
+		if err != nil {
+			continue
+		}
+		info, err := n.mapInfo(fd)
+		if err != nil {
+			unix.Close(fd)
+			continue
+		}
+		memlock, _ := fdinfoValue(fd, "memlock")
+		frozen, _ := fdinfoValue(fd, "frozen")
+		unix.Close(fd)
+
+		result = append(result, BpfMap{
+			Id:         int(info.id),
+			Type:       lookupName(mapTypeNames, info.mapType),
+			Name:       cString(info.name[:]),
+			Flags:      int(info.mapFlags),
+			KeySize:    int(info.keySize),
+			ValueSize:  int(info.valueSize),
+			MaxEntries: int(info.maxEntries),
+			Memlock:    memlock,
+			BtfId:      int(info.btfId),
+			Frozen:     frozen,
+		})
+	}
+	return result, nil
+}
+
+// Open a map by id and return its fd along with the size of a value buffer
+// for that map. Per cpu maps need room for a value from every cpu
+func (n *NativeBackend) openMap(mapId int) (int, bpfMapInfo, int, error) {
+	fd, err := bpfObjFd(bpfMapGetFdById, uint32(mapId))
+	if err != nil {
+		return -1, bpfMapInfo{}, 0, fmt.Errorf("failed to open map %d: %v", mapId, err)
+	}
+	info, err := n.mapInfo(fd)
+	if err != nil {
+		unix.Close(fd)
+		return -1, info, 0, fmt.Errorf("failed to get info for map %d: %v", mapId, err)
+	}
+
+	valueSize := int(info.valueSize)
+	if IsPerCpuMap(lookupName(mapTypeNames, info.mapType)) {
+		cpus, err := possibleCpus()
+		if err != nil {
+			unix.Close(fd)
+			return -1, info, 0, err
+		}
+		valueSize = ((valueSize + 7) / 8 * 8) * cpus
+	}
+	return fd, info, valueSize, nil
+}
+
+func mapElemSyscall(cmd int, fd int, key []byte, value []byte, flags uint64) error {
+	attr := bpfMapElemAttr{mapFd: uint32(fd), flags: flags}
+	if len(key) > 0 {
+		attr.key = uint64(uintptr(unsafe.Pointer(&key[0])))
+	}
+	if len(value) > 0 {
+		attr.value = uint64(uintptr(unsafe.Pointer(&value[0])))
+	}
+	_, err := bpfSyscall(cmd, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+func (n *NativeBackend) MapEntries(mapId int) ([]BpfMapEntry, error) {
+	var result []BpfMapEntry
+	fd, info, valueSize, err := n.openMap(mapId)
+	if err != nil {
+		return result, err
+	}
+	defer unix.Close(fd)
+
+	if info.keySize == 0 {
+		return result, fmt.Errorf("map %d has no keys and can't be dumped", mapId)
+	}
+
+	var key []byte
+	for {
+		nextKey := make([]byte, info.keySize)
+		attr := bpfMapElemAttr{mapFd: uint32(fd), value: uint64(uintptr(unsafe.Pointer(&nextKey[0])))}
+		if key != nil {
+			attr.key = uint64(uintptr(unsafe.Pointer(&key[0])))
+		}
+		_, err := bpfSyscall(bpfMapGetNextKey, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		runtime.KeepAlive(key)
+		runtime.KeepAlive(nextKey)
+		if errors.Is(err, unix.ENOENT) {
+			break
+		} else if err != nil {
+			return result, fmt.Errorf("failed to iterate map %d: %v", mapId, err)
+		}
+
+		value := make([]byte, valueSize)
+		err = mapElemSyscall(bpfMapLookupElem, fd, nextKey, value, 0)
+		if errors.Is(err, unix.ENOENT) {
+			// Deleted while we were iterating. The previous key is kept since
+			// GET_NEXT_KEY restarts from the first key when given a key that
+			// no longer exists
+			continue
+		} else if err != nil {
+			return result, fmt.Errorf("failed to lookup key %v in map %d: %v", nextKey, mapId, err)
+		}
+		key = nextKey
+		entry := BpfMapEntry{Key: key, Value: value[:info.valueSize]}
+		if IsPerCpuMap(lookupName(mapTypeNames, info.mapType)) {
+			// Per cpu values are each rounded up to 8 bytes
+			stride := (int(info.valueSize) + 7) / 8 * 8
+			for i := 0; i < valueSize; i += stride {
+				entry.Values = append(entry.Values, value[i:i+int(info.valueSize)])
+			}
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+func (n *NativeBackend) UpdateMapEntry(mapId int, key []byte, value []byte) error {
+	fd, info, valueSize, err := n.openMap(mapId)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if len(key) != int(info.keySize) || len(value) != int(info.valueSize) {
+		return fmt.Errorf("map %d expects a %d byte key and a %d byte value", mapId, info.keySize, info.valueSize)
+	}
+
+	// Like bpftool, per cpu maps get the same value on every cpu
+	buf := make([]byte, valueSize)
+	stride := (int(info.valueSize) + 7) / 8 * 8
+	for i := 0; i < valueSize; i += stride {
+		copy(buf[i:], value)
+	}
+	return mapElemSyscall(bpfMapUpdateElem, fd, key, buf, 0)
+}
+
+func (n *NativeBackend) UpdateMapEntryValues(mapId int, key []byte, values [][]byte) error {
+	fd, info, valueSize, err := n.openMap(mapId)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	stride := (int(info.valueSize) + 7) / 8 * 8
+	if valueSize == int(info.valueSize) || len(values)*stride != valueSize {
+		return fmt.Errorf("map %d expects a value for each of its %d cpus", mapId, valueSize/stride)
+	}
+	buf := make([]byte, valueSize)
+	for i, v := range values {
+		if len(v) != int(info.valueSize) {
+			return fmt.Errorf("map %d expects a %d byte value", mapId, info.valueSize)
+		}
+		copy(buf[i*stride:], v)
+	}
+	return mapElemSyscall(bpfMapUpdateElem, fd, key, buf, 0)
+}
+
+func (n *NativeBackend) DeleteMapEntry(mapId int, key []byte) error {
+	fd, _, _, err := n.openMap(mapId)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	return mapElemSyscall(bpfMapDeleteElem, fd, key, nil, 0)
+}
+
+// Get the btf of a map along with the ids of its key and value types from the
+// map info
+func (n *NativeBackend) MapBtf(mapId int) (*MapBtf, error) {
+	fd, info, _, err := n.openMap(mapId)
+	if err != nil {
+		return nil, err
+	}
+	unix.Close(fd)
+	if info.btfId == 0 {
+		return nil, fmt.Errorf("map %d has no btf", mapId)
+	}
+
+	btf, err := n.Btf(int(info.btfId))
+	if err != nil {
+		return nil, err
+	}
+	return &MapBtf{Btf: btf, KeyTypeId: int(info.btfKeyTypeId), ValueTypeId: int(info.btfValueTypeId)}, nil
+}
+
+// Get the raw btf of a btf object along with its info and name. The info is
+// read twice since the size of the btf is only known after the first read
+func rawBtf(btfId int) ([]byte, bpfBtfInfo, string, error) {
+	fd, err := bpfObjFd(bpfBtfGetFdById, uint32(btfId))
+	if err != nil {
+		return nil, bpfBtfInfo{}, "", fmt.Errorf("failed to open btf %d: %v", btfId, err)
+	}
+	defer unix.Close(fd)
+
+	info := bpfBtfInfo{}
+	err = bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	if err != nil {
+		return nil, info, "", fmt.Errorf("failed to get info for btf %d: %v", btfId, err)
+	}
+	if info.btfSize == 0 {
+		return nil, info, "", fmt.Errorf("btf %d is empty", btfId)
+	}
+	data := make([]byte, info.btfSize)
+	name := make([]byte, 64)
+	info = bpfBtfInfo{
+		btf:     uint64(uintptr(unsafe.Pointer(&data[0]))),
+		btfSize: uint32(len(data)),
+		name:    uint64(uintptr(unsafe.Pointer(&name[0]))),
+		nameLen: uint32(len(name)),
+	}
+	err = bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(name)
+	if err != nil {
+		return nil, info, "", fmt.Errorf("failed to get btf %d: %v", btfId, err)
+	}
+	return data[:info.btfSize], info, cString(name), nil
+}
+
+// Decode the btf of a btf object. The btf of kernel modules only has the
+// types the module adds on top of vmlinux so vmlinux is decoded first
+func (n *NativeBackend) Btf(btfId int) (*Btf, error) {
+	data, info, name, err := rawBtf(btfId)
+	if err != nil {
+		return nil, err
+	}
+
+	var base *Btf
+	if info.kernelBtf != 0 && name != "vmlinux" {
+		raw, err := os.ReadFile("/sys/kernel/btf/vmlinux")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the vmlinux btf of module %s: %v", name, err)
+		}
+		base, err = ParseRawBtf(raw, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the vmlinux btf: %v", err)
+		}
+	}
+	btf, err := ParseRawBtf(data, base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode btf %d: %v", btfId, err)
+	}
+	return btf, nil
+}
+
+// Render the types of a btf object as C without bpftool
+func (n *NativeBackend) BtfC(btfId int) (string, error) {
+	btf, err := n.Btf(btfId)
+	if err != nil {
+		return "", err
+	}
+	return btf.CText(), nil
+}
+
+// Walk every btf object the same way `bpftool btf show` does. The programs
+// and maps loaded with an object are found through their btf_id
+func (n *NativeBackend) BtfObjects() ([]BtfObject, error) {
+	result := []BtfObject{}
+	ids, err := bpfObjIds(bpfBtfGetNextId)
+	if err != nil {
+		return result, err
+	}
+
+	progs := map[int][]int{}
+	progIds, _ := bpfObjIds(bpfProgGetNextId)
+	for _, id := range progIds {
+		fd, err := bpfObjFd(bpfProgGetFdById, id)
+		if err != nil {
+			continue
+		}
+		info, err := n.progInfo(fd)
+		unix.Close(fd)
+		if err == nil && info.btfId != 0 {
+			progs[int(info.btfId)] = append(progs[int(info.btfId)], int(id))
+		}
+	}
+	maps := map[int][]int{}
+	mapIds, _ := bpfObjIds(bpfMapGetNextId)
+	for _, id := range mapIds {
+		fd, err := bpfObjFd(bpfMapGetFdById, id)
+		if err != nil {
+			continue
+		}
+		info, err := n.mapInfo(fd)
+		unix.Close(fd)
+		if err == nil && info.btfId != 0 {
+			maps[int(info.btfId)] = append(maps[int(info.btfId)], int(id))
+		}
+	}
+
+	owners := findBpfFdOwners("btf_id")
+	for _, id := range ids {
+		fd, err := bpfObjFd(bpfBtfGetFdById, id)
+		if err != nil {
+			// The btf may have been released since we got the id
+			continue
+		}
+		name := make([]byte, 64)
+		info := bpfBtfInfo{
+			name:    uint64(uintptr(unsafe.Pointer(&name[0]))),
+			nameLen: uint32(len(name)),
+		}
+		err = bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+		runtime.KeepAlive(name)
+		unix.Close(fd)
+		if err != nil {
+			continue
+		}
+		result = append(result, BtfObject{
+			Id:      int(info.id),
+			Size:    int(info.btfSize),
+			Name:    cString(name),
+			Kernel:  info.kernelBtf != 0,
+			ProgIds: progs[int(info.id)],
+			MapIds:  maps[int(info.id)],
+			Pids:    owners[int(info.id)],
+		})
+	}
+	return result, nil
+}
+
+// Stream the records of a ringbuf. Reading a perf event array needs a perf
+// buffer on every cpu which isn't implemented. Use the bpftool backend instead
+func (n *NativeBackend) MapEvents(m BpfMap, events chan<- MapEvent, stop <-chan struct{}) error {
+	if m.Type != "ringbuf" {
+		return fmt.Errorf("the native backend can only read ringbufs. Use the bpftool backend to read a %s: %w", m.Type, ErrNotSupported)
+	}
+
+	fd, info, _, err := n.openMap(m.Id)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	return readRingbuf(fd, int(info.maxEntries), events, stop)
+}
+
+// Read the trace pipe directly. Closing the pipe wakes up the pending read
+// once stop is closed
+func (n *NativeBackend) TraceLog(lines chan<- TraceLine, stop <-chan struct{}) error {
+	var pipe *os.File
+	var err error
+	for _, path := range tracePipePaths {
+		pipe, err = os.Open(path)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open the trace pipe: %v", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		pipe.Close()
+	}()
+
+	err = readTraceLines(pipe, lines, stop)
+	select {
+	case <-stop:
+		return nil
+	default:
+	}
+	return err
+}
+
+// Load the kernel symbols so helper calls can be resolved to a name
+func (n *NativeBackend) loadKernelSymbols() {
+	n.syms = map[uint64]string{}
+	f, err := os.Open("/proc/kallsyms")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		addr, err := strconv.ParseUint(fields[0], 16, 64)
+		if err != nil || addr == 0 {
+			continue
+		}
+		if fields[2] == "__bpf_call_base" {
+			n.callBase = addr
+		}
+		n.syms[addr] = fields[2]
+	}
+}
+
+// Resolve the target of a helper call. In the xlated instructions the
+// immediate is the offset of the helper from __bpf_call_base
+func (n *NativeBackend) resolveCall(insn BpfInsn) string {
+	n.symsOnce.Do(n.loadKernelSymbols)
+	if n.callBase == 0 {
+		return ""
+	}
+	return n.syms[n.callBase+uint64(int64(insn.Imm))]
+}
+
+func (n *NativeBackend) ProgramDisassembly(progId int) ([]string, error) {
+	fd, err := bpfObjFd(bpfProgGetFdById, uint32(progId))
+	if err != nil {
+		return []string{}, fmt.Errorf("failed to open program %d: %v", progId, err)
+	}
+	defer unix.Close(fd)
+
+	info, err := n.progInfo(fd)
+	if err != nil {
+		return []string{}, err
+	}
+	if info.xlatedProgLen == 0 {
+		return []string{}, errors.New("no xlated instructions available. Root privileges are required")
+	}
+
+	insns := make([]byte, info.xlatedProgLen)
+	info = bpfProgInfo{xlatedProgLen: uint32(len(insns)), xlatedProgInsns: uint64(uintptr(unsafe.Pointer(&insns[0])))}
+	err = bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	runtime.KeepAlive(insns)
+	if err != nil {
+		return []string{}, err
+	}
+	return DisassembleInsns(DecodeInsns(insns), n.resolveCall), nil
+}
+
+// There is no disassembler for native code. Use the bpftool backend instead
+func (n *NativeBackend) ProgramJitedDisassembly(progId int) ([]string, error) {
+	return []string{}, fmt.Errorf("disassembling jited code is %w", ErrNotSupported)
+}
+
+// Names of the link types (enum bpf_link_type) as printed by bpftool
+var linkTypeNames = []string{
+	"unspec", "raw_tracepoint", "tracing", "cgroup", "iter", "netns", "xdp",
+	"perf_event", "kprobe_multi", "struct_ops", "netfilter", "tcx",
+	"uprobe_multi", "netkit",
+}
+
+// Names of the perf event types of perf_event links (enum
+// bpf_perf_event_type)
+var perfEventTypeNames = []string{
+	"unspec", "uprobe", "uretprobe", "kprobe", "kretprobe", "tracepoint",
+	"event",
+}
+
+// Read a field of the type specific part of a link
+func linkU32(link *bpfLinkInfo, offset int) uint32 {
+	return *(*uint32)(unsafe.Pointer(&link.extra[offset]))
+}
+
+func linkU64(link *bpfLinkInfo, offset int) uint64 {
+	return *(*uint64)(unsafe.Pointer(&link.extra[offset]))
+}
+
+func setLinkU32(link *bpfLinkInfo, offset int, value uint32) {
+	*(*uint32)(unsafe.Pointer(&link.extra[offset])) = value
+}
+
+func setLinkU64(link *bpfLinkInfo, offset int, value uint64) {
+	*(*uint64)(unsafe.Pointer(&link.extra[offset])) = value
+}
+
+// Get the info of a link. Names, paths and addresses are returned through
+// buffers that are passed in a second call once the type of the link is known
+func (n *NativeBackend) linkInfo(fd int) (BpfLink, error) {
+	info := bpfLinkInfo{}
+	err := bpfObjInfo(fd, unsafe.Pointer(&info), unsafe.Sizeof(info))
+	if err != nil {
+		return BpfLink{}, err
+	}
+	link := BpfLink{
+		Id:     int(info.id),
+		Type:   lookupName(linkTypeNames, info.linkType),
+		ProgId: int(info.progId),
+	}
+
+	name := make([]byte, 4096)
+	namePtr := uint64(uintptr(unsafe.Pointer(&name[0])))
+	var addrs []uint64
+	second := bpfLinkInfo{}
+	switch link.Type {
+	case "raw_tracepoint", "iter":
+		setLinkU64(&second, 0, namePtr)
+		setLinkU32(&second, 8, uint32(len(name)))
+	case "kprobe_multi":
+		count := linkU32(&info, 8)
+		if count > 0 {
+			addrs = make([]uint64, count)
+			setLinkU64(&second, 0, uint64(uintptr(unsafe.Pointer(&addrs[0]))))
+			setLinkU32(&second, 8, count)
+		}
+	case "uprobe_multi":
+		setLinkU64(&second, 0, namePtr)
+		setLinkU32(&second, 32, uint32(len(name)))
+	case "perf_event":
+		setLinkU64(&second, 8, namePtr)
+		setLinkU32(&second, 16, uint32(len(name)))
+	}
+	if second != (bpfLinkInfo{}) {
+		err = bpfObjInfo(fd, unsafe.Pointer(&second), unsafe.Sizeof(second))
+		runtime.KeepAlive(name)
+		runtime.KeepAlive(addrs)
+		if err == nil {
+			info = second
+		}
+	}
+
+	switch link.Type {
+	case "raw_tracepoint":
+		link.TpName = cString(name)
+	case "tracing":
+		link.AttachType = lookupName(attachTypeNames, linkU32(&info, 0))
+		link.TargetObjId = int(linkU32(&info, 4))
+		link.TargetBtfId = int(linkU32(&info, 8))
+	case "cgroup":
+		link.CgroupId = linkU64(&info, 0)
+		link.AttachType = lookupName(attachTypeNames, linkU32(&info, 8))
+	case "iter":
+		link.TargetName = cString(name)
+		link.MapId = int(linkU32(&info, 12))
+	case "netns":
+		link.NetnsIno = int(linkU32(&info, 0))
+		link.AttachType = lookupName(attachTypeNames, linkU32(&info, 4))
+	case "xdp", "tcx", "netkit":
+		link.Ifindex = int(linkU32(&info, 0))
+		if link.Type != "xdp" {
+			link.AttachType = lookupName(attachTypeNames, linkU32(&info, 4))
+		}
+		if iface, err := net.InterfaceByIndex(link.Ifindex); err == nil {
+			link.Devname = iface.Name
+		}
+	case "struct_ops":
+		link.MapId = int(linkU32(&info, 0))
+	case "netfilter":
+		link.Pf = int(linkU32(&info, 0))
+		link.Hook = int(linkU32(&info, 4))
+		link.Prio = int(int32(linkU32(&info, 8)))
+	case "kprobe_multi":
+		link.FuncCnt = int(linkU32(&info, 8))
+		link.Retprobe = linkU32(&info, 12)&bpfFRetprobe != 0
+		n.symsOnce.Do(n.loadKernelSymbols)
+		for _, addr := range addrs {
+			// The addresses are zero without CAP_SYSLOG
+			if sym, ok := n.syms[addr]; ok {
+				link.Funcs = append(link.Funcs, BpfLinkFunc{Func: sym})
+			}
+		}
+	case "uprobe_multi":
+		link.Path = cString(name)
+		link.FuncCnt = int(linkU32(&info, 36))
+		link.Retprobe = linkU32(&info, 40)&bpfFRetprobe != 0
+		link.Pid = int(linkU32(&info, 44))
+	case "perf_event":
+		link.EventType = lookupName(perfEventTypeNames, linkU32(&info, 0))
+		switch link.EventType {
+		case "kprobe", "kretprobe":
+			link.Func = cString(name)
+		case "uprobe", "uretprobe":
+			link.File = cString(name)
+		case "tracepoint":
+			link.Tracepoint = cString(name)
+		}
+	}
+	return link, nil
+}
+
+// Walk every link the same way `bpftool link show` does
+func (n *NativeBackend) Links() ([]BpfLink, error) {
+	result := []BpfLink{}
+	ids, err := bpfObjIds(bpfLinkGetNextId)
+	if err != nil {
+		return result, err
+	}
+
+	owners := findBpfFdOwners("link_id")
+	for _, id := range ids {
+		fd, err := bpfObjFd(bpfLinkGetFdById, id)
+		if err != nil {
+			// The link may have been removed since we got the id
+			continue
+		}
+		link, err := n.linkInfo(fd)
+		unix.Close(fd)
+		if err != nil {
+			continue
+		}
+		link.Pids = owners[link.Id]
+		result = append(result, link)
+	}
+	return result, nil
+}
+
+// Get the name of a program by id. Used to fill in attachment info
+func (n *NativeBackend) progName(id uint32) string {
+	fd, err := bpfObjFd(bpfProgGetFdById, id)
+	if err != nil {
+		return ""
+	}
+	defer unix.Close(fd)
+	info, err := n.progInfo(fd)
+	if err != nil {
+		return ""
+	}
+	return cString(info.name[:])
+}
+
+// XDP programs are found using netlink so both legacy and link based
+// attachments are included. Only tcx links are reported for tc since legacy
+// cls_bpf filters would require walking every qdisc
+func (n *NativeBackend) NetInfo() ([]NetInfo, error) {
+	info := NetInfo{}
+	xdp, err := netlinkXdpPrograms()
+	if err != nil {
+		return []NetInfo{}, err
+	}
+	info.Xdp = xdp
+
+	ids, err := bpfObjIds(bpfLinkGetNextId)
+	if err != nil {
+		return []NetInfo{info}, err
+	}
+	for _, id := range ids {
+		fd, err := bpfObjFd(bpfLinkGetFdById, id)
+		if err != nil {
+			continue
+		}
+		link := bpfLinkInfo{}
+		err = bpfObjInfo(fd, unsafe.Pointer(&link), unsafe.Sizeof(link))
+		unix.Close(fd)
+		if err != nil || link.linkType != bpfLinkTypeTcx {
+			continue
+		}
+
+		ifindex := *(*uint32)(unsafe.Pointer(&link.extra[0]))
+		attachType := *(*uint32)(unsafe.Pointer(&link.extra[4]))
+		tc := TcInfo{
+			IfIndex: int(ifindex),
+			Kind:    tcxKind(attachType),
+			Name:    n.progName(link.progId),
+			Id:      int(link.progId),
+		}
+		if iface, err := net.InterfaceByIndex(int(ifindex)); err == nil {
+			tc.DevName = iface.Name
+		}
+		info.Tc = append(info.Tc, tc)
+	}
+	return []NetInfo{info}, nil
+}
+
+// Name the attach type of a tcx link the way `bpftool net show` does i.e.
+// tcx/ingress
+func tcxKind(attachType uint32) string {
+	name := lookupName(attachTypeNames, attachType)
+	return "tcx/" + strings.TrimPrefix(name, "tcx_")
+}
+
+// Dump the links using netlink and pull out any attached xdp programs
+func netlinkXdpPrograms() ([]XdpInfo, error) {
+	result := []XdpInfo{}
+	rib, err := syscall.NetlinkRIB(unix.RTM_GETLINK, unix.AF_UNSPEC)
+	if err != nil {
+		return result, err
+	}
+	msgs, err := syscall.ParseNetlinkMessage(rib)
+	if err != nil {
+		return result, err
+	}
+
+	modes := map[uint8]string{1: "driver", 2: "generic", 3: "offload", 4: "multi"}
+	for _, msg := range msgs {
+		if msg.Header.Type != unix.RTM_NEWLINK || len(msg.Data) < unix.SizeofIfInfomsg {
+			continue
+		}
+		ifinfo := (*syscall.IfInfomsg)(unsafe.Pointer(&msg.Data[0]))
+		attrs, err := syscall.ParseNetlinkRouteAttr(&msg)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		var xdp []byte
+		for _, attr := range attrs {
+			switch attr.Attr.Type {
+			case unix.IFLA_IFNAME:
+				name = cString(attr.Value)
+			case iflaXdp | unix.NLA_F_NESTED, iflaXdp:
+				xdp = attr.Value
+			}
+		}
+
+		// Walk the nested IFLA_XDP attributes
+		var mode uint8
+		var progId uint32
+		for len(xdp) >= unix.SizeofRtAttr {
+			attr := (*unix.RtAttr)(unsafe.Pointer(&xdp[0]))
+			if int(attr.Len) < unix.SizeofRtAttr || int(attr.Len) > len(xdp) {
+				break
+			}
+			value := xdp[unix.SizeofRtAttr:attr.Len]
+			switch attr.Type {
+			case iflaXdpAtt:
+				if len(value) >= 1 {
+					mode = value[0]
+				}
+			case iflaXdpProgId:
+				if len(value) >= 4 {
+					progId = *(*uint32)(unsafe.Pointer(&value[0]))
+				}
+			}
+			xdp = xdp[(int(attr.Len)+unix.NLA_ALIGNTO-1) & ^(unix.NLA_ALIGNTO-1):]
+		}
+
+		if progId != 0 {
+			result = append(result, XdpInfo{
+				DevName: name,
+				IfIndex: int(ifinfo.Index),
+				Mode:    modes[mode],
+				Id:      int(progId),
+			})
+		}
+	}
+	return result, nil
+}
+
+// Walk the cgroup2 hierarchy and query each cgroup for attached programs the
+// same way `bpftool cgroup tree` does
+func (n *NativeBackend) CgroupInfo() ([]CgroupInfo, error) {
+	result := []CgroupInfo{}
+	names := map[uint32]string{}
+	err := filepath.WalkDir("/sys/fs/cgroup", func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		fd, err := unix.Open(path, unix.O_RDONLY|unix.O_DIRECTORY, 0)
+		if err != nil {
+			return nil
+		}
+		defer unix.Close(fd)
+
+		info := CgroupInfo{Cgroup: path}
+		for _, attachType := range cgroupAttachTypes {
+			ids := make([]uint32, 64)
+			attr := bpfQueryAttr{
+				targetFd:   uint32(fd),
+				attachType: attachType,
+				progIds:    uint64(uintptr(unsafe.Pointer(&ids[0]))),
+				progCnt:    uint32(len(ids)),
+			}
+			_, err := bpfSyscall(bpfProgQuery, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+			runtime.KeepAlive(ids)
+			if err != nil {
+				continue
+			}
+
+			flags := ""
+			if attr.attachFlags&bpfFAllowMulti != 0 {
+				flags = "multi"
+			} else if attr.attachFlags&bpfFOverride != 0 {
+				flags = "override"
+			}
+			for _, id := range ids[:attr.progCnt] {
+				if _, ok := names[id]; !ok {
+					names[id] = n.progName(id)
+				}
+				info.Programs = append(info.Programs, CgroupProgram{
+					Id:          int(id),
+					AttachType:  lookupName(attachTypeNames, attachType),
+					AttachFlags: flags,
+					Name:        names[id],
+				})
+			}
+		}
+		if len(info.Programs) > 0 {
+			result = append(result, info)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Find perf events with bpf programs by querying every anonymous inode fd of
+// every process, the same way `bpftool perf list` does
+func (n *NativeBackend) PerfInfo() ([]PerfInfo, error) {
+	result := []PerfInfo{}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return result, err
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+
+		fdDir := filepath.Join("/proc", proc.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		for _, fdEntry := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fdEntry.Name()))
+			if err != nil || !strings.HasPrefix(target, "anon_inode:") {
+				continue
+			}
+			fd, err := strconv.Atoi(fdEntry.Name())
+			if err != nil {
+				continue
+			}
+
+			buf := make([]byte, 256)
+			attr := bpfTaskFdQueryAttr{
+				pid:    uint32(pid),
+				fd:     uint32(fd),
+				bufLen: uint32(len(buf)),
+				buf:    uint64(uintptr(unsafe.Pointer(&buf[0]))),
+			}
+			_, err = bpfSyscall(bpfTaskFdQuery, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+			runtime.KeepAlive(buf)
+			if err != nil {
+				continue
+			}
+
+			name := cString(buf)
+			perf := PerfInfo{
+				Pid:    pid,
+				Fd:     fd,
+				ProgId: int(attr.progId),
+				FdType: lookupName(perfFdTypeNames, attr.fdType),
+			}
+			switch perf.FdType {
+			case "kprobe", "kretprobe":
+				perf.Func = name
+				perf.Offset = int(attr.probeOffset)
+				if name == "" {
+					perf.Func = fmt.Sprintf("%#x", attr.probeAddr)
+				}
+			case "uprobe", "uretprobe":
+				perf.Filename = name
+				perf.Offset = int(attr.probeOffset)
+			default:
+				perf.Tracepoint = name
+			}
+			result = append(result, perf)
+		}
+	}
+	return result, nil
+}
+
+func (n *NativeBackend) Features() (string, error) {
+	return "", fmt.Errorf("feature probing is %w", ErrNotSupported)
+}
+
+func (n *NativeBackend) StatsEnabled() (bool, error) {
+	return readStatsSysctl()
+}
+
+// The native backend already runs as root so the sysctl can be written
+// directly
+func (n *NativeBackend) SetStatsEnabled(enabled bool) error {
+	value := "0"
+	if enabled {
+		value = "1"
+	}
+	return os.WriteFile(statsSysctlPath, []byte(value), 0644)
+}
+
+// Scan the fdinfo of every process to find which processes hold a bpf object.
+// key is the fdinfo field holding the object id (i.e. prog_id or map_id)
+func findBpfFdOwners(key string) map[int][]ProcessInfo {
+	result := map[int][]ProcessInfo{}
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return result
+	}
+
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		fdinfoDir := filepath.Join("/proc", proc.Name(), "fdinfo")
+		files, err := os.ReadDir(fdinfoDir)
+		if err != nil {
+			continue
+		}
+
+		seen := map[int]bool{}
+		comm := ""
+		for _, file := range files {
+			content, err := os.ReadFile(filepath.Join(fdinfoDir, file.Name()))
+			if err != nil {
+				continue
+			}
+			// Links show the prog_id of their program too but holding a
+			// link isn't holding the program. bpftool doesn't count them
+			// either
+			if key != "link_id" && strings.Contains(string(content), "\nlink_type:") {
+				continue
+			}
+			for _, line := range strings.Split(string(content), "\n") {
+				name, value, found := strings.Cut(line, ":")
+				if !found || name != key {
+					continue
+				}
+				id, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil || seen[id] {
+					break
+				}
+				seen[id] = true
+				if comm == "" {
+					c, _ := os.ReadFile(filepath.Join("/proc", proc.Name(), "comm"))
+					comm = strings.TrimSpace(string(c))
+				}
+				result[id] = append(result[id], ProcessInfo{Pid: pid, Comm: comm})
+				break
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+import "fmt"
+
+// The bpf syscall only exists on linux
+func NewNativeBackend() (Backend, error) {
+	return nil, fmt.Errorf("the native backend is %w on this platform", ErrNotSupported)
+}
@@ -0,0 +1,154 @@
+// The utils/record.go file handles saving the raw output of bpftool so that
+// it can be replayed later on another machine. Every response is stored as
+// <dir>/<command>/<unix nano timestamp>.<json|txt> where command is the
+// bpftool arguments joined by underscores (i.e. prog_show, map_dump_id_12)
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Build the name of the directory used to store the output of a command.
+// Flags like -j are left out of the name
+func recordingKey(args []string) string {
+	parts := []string{}
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		parts = append(parts, strings.ReplaceAll(arg, string(filepath.Separator), "_"))
+	}
+	return strings.Join(parts, "_")
+}
+
+// Whether a command asks bpftool for json output
+func isJsonCommand(args []string) bool {
+	for _, arg := range args {
+		if arg == "-j" || arg == "-jf" || arg == "-jp" {
+			return true
+		}
+	}
+	return false
+}
+
+// The bpftool verbs that only read state. Only their output is recorded
+// since replaying a command that changes something can't change anything
+var readOnlyVerbs = map[string]bool{
+	"show":  true,
+	"list":  true,
+	"dump":  true,
+	"tree":  true,
+	"probe": true,
+}
+
+// Whether a command only reads state i.e. `prog show` but not `map update`.
+// The verb is the second argument after the flags
+func isReadOnlyCommand(args []string) bool {
+	words := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			words = append(words, arg)
+		}
+	}
+	return len(words) >= 2 && readOnlyVerbs[words[1]]
+}
+
+// Saves the raw output of every read only bpftool command that is run
+type Recorder struct {
+	// The directory the recordings are written to
+	Dir string
+
+	lock sync.Mutex
+}
+
+func NewRecorder(dir string) (*Recorder, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{Dir: dir}, nil
+}
+
+// Save the output of a command
+func (r *Recorder) Save(args []string, output []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	dir := filepath.Join(r.Dir, recordingKey(args))
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	ext := ".txt"
+	if isJsonCommand(args) {
+		ext = ".json"
+	}
+	name := filepath.Join(dir, strconv.FormatInt(time.Now().UnixNano(), 10)+ext)
+	return os.WriteFile(name, output, 0644)
+}
+
+// Serves previously recorded bpftool output. Each time a command is loaded
+// the next recording (in time order) is returned. Once the recordings for a
+// command run out the last one keeps being returned
+type Replayer struct {
+	// The directory the recordings are read from
+	Dir string
+
+	lock      sync.Mutex
+	files     map[string][]string
+	positions map[string]int
+}
+
+func NewReplayer(dir string) (*Replayer, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &Replayer{Dir: dir, files: map[string][]string{}, positions: map[string]int{}}, nil
+}
+
+// Get the next recorded output of a command
+func (r *Replayer) Load(args []string) ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := recordingKey(args)
+	files, ok := r.files[key]
+	if !ok {
+		entries, err := os.ReadDir(filepath.Join(r.Dir, key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				files = append(files, filepath.Join(r.Dir, key, entry.Name()))
+			}
+		}
+
+		// The names are timestamps so sorting them puts them in time order
+		sort.Strings(files)
+		r.files[key] = files
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no recording of `bpftool %s` in %s", strings.Join(args, " "), r.Dir)
+	}
+
+	pos := r.positions[key]
+	if pos < len(files)-1 {
+		r.positions[key] = pos + 1
+	}
+	return os.ReadFile(files[pos])
+}
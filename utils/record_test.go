@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordingKey(t *testing.T) {
+	key := recordingKey([]string{"-jf", "map", "dump", "id", "12"})
+	if key != "map_dump_id_12" {
+		t.Errorf("Expected map_dump_id_12, got %s", key)
+	}
+}
+
+func TestIsReadOnlyCommand(t *testing.T) {
+	commands := map[string]bool{
+		"-j prog show":                  true,
+		"-jf map dump id 12":            true,
+		"-j cgroup tree":                true,
+		"btf dump id 1 format c":        true,
+		"map update id 1 key 0 value 0": false,
+		"map delete id 1 key 0":         false,
+		"prog":                          false,
+	}
+	for command, expected := range commands {
+		if isReadOnlyCommand(strings.Fields(command)) != expected {
+			t.Errorf("Expected %v for `%s`", expected, command)
+		}
+	}
+}
+
+// Tests that recordings are replayed in order and the last one sticks
+func TestRecordReplay(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+
+	args := []string{"-j", "prog", "show"}
+	outputs := []string{
+		`[{"id":1,"type":"kprobe","tag":"aaaa"}]`,
+		`[{"id":1,"type":"kprobe","tag":"aaaa"},{"id":2,"type":"xdp","tag":"bbbb"}]`,
+	}
+	for _, output := range outputs {
+		err = recorder.Save(args, []byte(output))
+		if err != nil {
+			t.Fatalf("Failed to save recording: %v", err)
+		}
+		// Make sure each recording gets a unique timestamp
+		time.Sleep(time.Millisecond)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "prog_show", "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 recordings, got %d", len(files))
+	}
+
+	replayer, err := NewReplayer(dir)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	backend := &BpftoolBackend{Replay: replayer}
+
+	expectedCounts := []int{1, 2, 2}
+	for _, expected := range expectedCounts {
+		programs, err := backend.Programs()
+		if err != nil {
+			t.Fatalf("Failed to replay programs: %v", err)
+		}
+		if len(programs) != expected {
+			t.Errorf("Expected %d programs, got %d", expected, len(programs))
+		}
+	}
+
+	// Commands that were never recorded are an error
+	_, err = backend.Maps()
+	if err == nil {
+		t.Errorf("Expected an error for a command with no recording")
+	}
+
+	// Maps can't be changed in a recording
+	err = backend.UpdateMapEntry(1, []byte{0}, []byte{0})
+	if err == nil {
+		t.Errorf("Expected an error when updating a map during replay")
+	}
+
+	// Neither can anything else that isn't a read
+	_, err = backend.run("map", "delete", "id", "1", "key", "0")
+	if err == nil {
+		t.Errorf("Expected an error when running a write command during replay")
+	}
+}
+
+func TestNewReplayerMissingDir(t *testing.T) {
+	_, err := NewReplayer(filepath.Join(t.TempDir(), "missing"))
+	if !os.IsNotExist(err) {
+		t.Errorf("Expected a not exist error, got %v", err)
+	}
+}
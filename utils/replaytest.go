@@ -0,0 +1,39 @@
+// The utils/replaytest.go file builds replay backends from canned bpftool
+// output so the tests of every package can run without bpftool or root
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// Create a bpftool backend that replays the given outputs. The keys are the
+// bpftool arguments separated by spaces (i.e. "-j prog show")
+func NewReplayBackend(t testing.TB, outputs map[string]string) *BpftoolBackend {
+	t.Helper()
+	recorder, err := NewRecorder(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create recorder: %v", err)
+	}
+	for args, output := range outputs {
+		err = recorder.Save(strings.Fields(args), []byte(output))
+		if err != nil {
+			t.Fatalf("Failed to save %s: %v", args, err)
+		}
+	}
+
+	replayer, err := NewReplayer(recorder.Dir)
+	if err != nil {
+		t.Fatalf("Failed to create replayer: %v", err)
+	}
+	return &BpftoolBackend{Replay: replayer}
+}
+
+// Replay the given outputs for the rest of the test. The previous backend is
+// restored once the test is done
+func UseReplayBackend(t testing.TB, outputs map[string]string) {
+	t.Helper()
+	previous := CurrentBackend()
+	SetBackend(NewReplayBackend(t, outputs))
+	t.Cleanup(func() { SetBackend(previous) })
+}
@@ -0,0 +1,83 @@
+//go:build linux
+
+package utils
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// Set in the header of a record that is still being written
+	ringbufBusyBit = 1 << 31
+
+	// Set in the header of a record that was discarded by the program
+	ringbufDiscardBit = 1 << 30
+
+	// Size of the header in front of every record
+	ringbufHeaderSize = 8
+
+	// How often the ringbuf is checked for new records
+	ringbufPollInterval = 100 * time.Millisecond
+)
+
+// Read the records of a ringbuf by mapping it into memory the same way libbpf
+// does. The first page holds the position of the consumer, the second one
+// the position of the producer and the data follows. The data is mapped twice
+// in a row so records that wrap around can be read in one go
+func readRingbuf(fd int, size int, events chan<- MapEvent, stop <-chan struct{}) error {
+	pageSize := os.Getpagesize()
+	consumer, err := unix.Mmap(fd, 0, pageSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer unix.Munmap(consumer)
+	producer, err := unix.Mmap(fd, int64(pageSize), pageSize+2*size, unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	defer unix.Munmap(producer)
+
+	data := producer[pageSize:]
+	mask := uint64(size - 1)
+	consumerPos := (*uint64)(unsafe.Pointer(&consumer[0]))
+	producerPos := (*uint64)(unsafe.Pointer(&producer[0]))
+
+	ticker := time.NewTicker(ringbufPollInterval)
+	defer ticker.Stop()
+	for {
+		pos := atomic.LoadUint64(consumerPos)
+		for pos < atomic.LoadUint64(producerPos) {
+			header := atomic.LoadUint32((*uint32)(unsafe.Pointer(&data[pos&mask])))
+			if header&ringbufBusyBit != 0 {
+				break
+			}
+
+			length := uint64(header &^ (ringbufBusyBit | ringbufDiscardBit))
+			if header&ringbufDiscardBit == 0 {
+				start := (pos + ringbufHeaderSize) & mask
+				event := MapEvent{Time: time.Now(), Cpu: -1, Data: make([]byte, length)}
+				copy(event.Data, data[start:start+length])
+				select {
+				case events <- event:
+				case <-stop:
+					return nil
+				}
+			}
+
+			// Records are aligned to 8 bytes
+			pos += (length + ringbufHeaderSize + 7) &^ 7
+			atomic.StoreUint64(consumerPos, pos)
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
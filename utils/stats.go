@@ -0,0 +1,64 @@
+// The utils/stats.go file turns the cumulative run time statistics the kernel
+// keeps for each program (run_cnt, run_time_ns) into rates between two
+// snapshots of the programs
+package utils
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// The sysctl that controls whether the kernel collects program statistics
+const statsSysctlPath = "/proc/sys/kernel/bpf_stats_enabled"
+
+// Anyone can read the sysctl so this doesn't need root
+func readStatsSysctl() (bool, error) {
+	data, err := os.ReadFile(statsSysctlPath)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) != "0", nil
+}
+
+// The cost of a single program between two snapshots
+type ProgramRate struct {
+	Program BpfProgram
+
+	// The number of times the program ran per second
+	RunsPerSec float64
+
+	// The average time a single run took in nanoseconds
+	AvgRunNs float64
+
+	// The percentage of a single cpu spent running the program
+	CpuPercent float64
+
+	// The number of recursion misses since the previous snapshot
+	NewRecursionMisses int
+}
+
+// Compute the rate of each program in cur compared to prev. elapsed is the
+// time between the two snapshots. Programs that are new in cur (or were
+// reloaded with the same id) only get their cumulative counters
+func ComputeProgramRates(prev map[int]BpfProgram, cur map[int]BpfProgram, elapsed time.Duration) []ProgramRate {
+	result := make([]ProgramRate, 0, len(cur))
+	for id, p := range cur {
+		rate := ProgramRate{Program: p}
+		old, ok := prev[id]
+		if ok && old.Tag == p.Tag && p.RunCnt >= old.RunCnt && p.RunTimeNs >= old.RunTimeNs && elapsed > 0 {
+			runs := p.RunCnt - old.RunCnt
+			runTime := p.RunTimeNs - old.RunTimeNs
+			rate.RunsPerSec = float64(runs) / elapsed.Seconds()
+			rate.CpuPercent = float64(runTime) / float64(elapsed.Nanoseconds()) * 100
+			if runs > 0 {
+				rate.AvgRunNs = float64(runTime) / float64(runs)
+			}
+			if p.RecursionMisses >= old.RecursionMisses {
+				rate.NewRecursionMisses = p.RecursionMisses - old.RecursionMisses
+			}
+		}
+		result = append(result, rate)
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeProgramRates(t *testing.T) {
+	prev := map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", RunCnt: 100, RunTimeNs: 10000},
+		2: {ProgramId: 2, Tag: "bbbb", RunCnt: 50, RunTimeNs: 5000},
+	}
+	cur := map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "aaaa", RunCnt: 300, RunTimeNs: 50000, RecursionMisses: 2},
+		// Reloaded so the counters went backwards
+		2: {ProgramId: 2, Tag: "bbbb", RunCnt: 10, RunTimeNs: 1000},
+		3: {ProgramId: 3, Tag: "cccc", RunCnt: 10, RunTimeNs: 1000},
+	}
+
+	rates := map[int]ProgramRate{}
+	for _, rate := range ComputeProgramRates(prev, cur, 2*time.Second) {
+		rates[rate.Program.ProgramId] = rate
+	}
+	if len(rates) != 3 {
+		t.Fatalf("Expected 3 rates, got %d", len(rates))
+	}
+
+	rate := rates[1]
+	if rate.RunsPerSec != 100 {
+		t.Errorf("Expected 100 runs/sec, got %f", rate.RunsPerSec)
+	}
+	if rate.AvgRunNs != 200 {
+		t.Errorf("Expected 200 ns/run, got %f", rate.AvgRunNs)
+	}
+	if rate.CpuPercent != 0.002 {
+		t.Errorf("Expected 0.002%% cpu, got %f", rate.CpuPercent)
+	}
+	if rate.NewRecursionMisses != 2 {
+		t.Errorf("Expected 2 recursion misses, got %d", rate.NewRecursionMisses)
+	}
+
+	for _, id := range []int{2, 3} {
+		if rates[id].RunsPerSec != 0 || rates[id].AvgRunNs != 0 {
+			t.Errorf("Expected no rate for program %d, got %+v", id, rates[id])
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// The utils/tailcall.go file works out which programs tail call into which
+// other programs. Programs tail call through the slots of prog_array maps so
+// a program can jump to every program in the prog arrays it uses
+package utils
+
+import (
+	"encoding/binary"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// A slot of a prog array that a program can tail call through
+type TailCall struct {
+	MapId   int
+	MapName string
+
+	// The index of the slot in the prog array
+	Index int
+
+	// The program in the slot
+	ProgramId int
+}
+
+// The tail calls every program can make
+type TailCallGraph struct {
+	// The tail calls keyed by the id of the calling program. Sorted by map id
+	// and index
+	Calls map[int][]TailCall
+
+	// Every program that is in the slot of a prog array
+	Targets map[int]bool
+}
+
+// Get the id of the program in a slot of a prog array. The kernel returns the
+// id of the program as the value when the slot is looked up
+func TailCallTarget(entry BpfMapEntry) (int, bool) {
+	if len(entry.Value) != 4 || len(entry.Key) != 4 {
+		return 0, false
+	}
+	return int(binary.LittleEndian.Uint32(entry.Value)), true
+}
+
+// Build the tail call graph from the programs, their prog arrays and the
+// entries of each prog array keyed by map id
+func NewTailCallGraph(programs map[int]BpfProgram, progArrays map[int]BpfMap, entries map[int][]BpfMapEntry) *TailCallGraph {
+	graph := &TailCallGraph{Calls: map[int][]TailCall{}, Targets: map[int]bool{}}
+	slots := map[int][]TailCall{}
+	for mapId, m := range progArrays {
+		for _, e := range entries[mapId] {
+			target, ok := TailCallTarget(e)
+			if !ok {
+				continue
+			}
+			slots[mapId] = append(slots[mapId], TailCall{
+				MapId:     mapId,
+				MapName:   m.Name,
+				Index:     int(binary.LittleEndian.Uint32(e.Key)),
+				ProgramId: target,
+			})
+			graph.Targets[target] = true
+		}
+	}
+
+	for id, p := range programs {
+		calls := []TailCall{}
+		for _, mapId := range p.MapIds {
+			calls = append(calls, slots[mapId]...)
+		}
+		if len(calls) == 0 {
+			continue
+		}
+		sort.Slice(calls, func(i, j int) bool {
+			if calls[i].MapId != calls[j].MapId {
+				return calls[i].MapId < calls[j].MapId
+			}
+			return calls[i].Index < calls[j].Index
+		})
+		graph.Calls[id] = calls
+	}
+	return graph
+}
+
+// Get the programs the tail call chains start from. These are the programs
+// that make tail calls without being in a prog array themselves. Programs
+// that only call each other in a cycle have no such program so the lowest id
+// of the cycle is used. The ids are sorted
+func (g *TailCallGraph) Roots() []int {
+	callers := []int{}
+	for id := range g.Calls {
+		callers = append(callers, id)
+	}
+	sort.Ints(callers)
+
+	roots := []int{}
+	reached := map[int]bool{}
+	var visit func(id int)
+	visit = func(id int) {
+		if reached[id] {
+			return
+		}
+		reached[id] = true
+		for _, call := range g.Calls[id] {
+			visit(call.ProgramId)
+		}
+	}
+	for _, id := range callers {
+		if !g.Targets[id] {
+			roots = append(roots, id)
+			visit(id)
+		}
+	}
+	for _, id := range callers {
+		if !reached[id] {
+			roots = append(roots, id)
+			visit(id)
+		}
+	}
+	sort.Ints(roots)
+	return roots
+}
+
+// Dump every prog array and build the tail call graph of the programs. Prog
+// arrays that can't be dumped are left out
+func GetTailCallGraph(programs map[int]BpfProgram) (*TailCallGraph, error) {
+	maps, err := CurrentBackend().Maps()
+	if err != nil {
+		return nil, err
+	}
+
+	progArrays := map[int]BpfMap{}
+	entries := map[int][]BpfMapEntry{}
+	for _, m := range maps {
+		if m.Type != "prog_array" {
+			continue
+		}
+		// The map may have been removed since it was listed
+		e, err := GetBpfMapEntries(m.Id)
+		if err != nil {
+			log.Debugf("Failed to dump prog array %d: %v\n", m.Id, err)
+			continue
+		}
+		progArrays[m.Id] = m
+		entries[m.Id] = e
+	}
+	return NewTailCallGraph(programs, progArrays, entries), nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+// A prog array slot pointing to a program
+func slot(index byte, progId byte) BpfMapEntry {
+	return BpfMapEntry{Key: []byte{index, 0, 0, 0}, Value: []byte{progId, 0, 0, 0}}
+}
+
+func TestTailCallGraph(t *testing.T) {
+	programs := map[int]BpfProgram{
+		1: {ProgramId: 1, MapIds: []int{10, 20}},
+		2: {ProgramId: 2, MapIds: []int{10}},
+		3: {ProgramId: 3},
+		5: {ProgramId: 5, MapIds: []int{30}},
+		6: {ProgramId: 6, MapIds: []int{31}},
+	}
+	progArrays := map[int]BpfMap{
+		10: {Id: 10, Name: "jmp"},
+		20: {Id: 20, Name: "other"},
+		30: {Id: 30, Name: "loop_a"},
+		31: {Id: 31, Name: "loop_b"},
+	}
+	entries := map[int][]BpfMapEntry{
+		10: {slot(1, 2), slot(0, 3)},
+		20: {slot(4, 3)},
+		30: {slot(0, 6)},
+		31: {slot(0, 5)},
+	}
+
+	graph := NewTailCallGraph(programs, progArrays, entries)
+	expected := []TailCall{
+		{MapId: 10, MapName: "jmp", Index: 0, ProgramId: 3},
+		{MapId: 10, MapName: "jmp", Index: 1, ProgramId: 2},
+		{MapId: 20, MapName: "other", Index: 4, ProgramId: 3},
+	}
+	if !reflect.DeepEqual(graph.Calls[1], expected) {
+		t.Errorf("Unexpected tail calls of program 1: %+v", graph.Calls[1])
+	}
+	if _, ok := graph.Calls[3]; ok {
+		t.Errorf("Expected program 3 to not make any tail calls")
+	}
+
+	// Program 2 is only reached from program 1 and programs 5 and 6 call each
+	// other so the lowest one starts the chain
+	if roots := graph.Roots(); !reflect.DeepEqual(roots, []int{1, 5}) {
+		t.Errorf("Expected roots 1 and 5, got %v", roots)
+	}
+}
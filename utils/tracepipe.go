@@ -0,0 +1,120 @@
+// The utils/tracepipe.go file reads the kernel trace pipe where bpf_printk
+// (bpf_trace_printk) writes its output and works out which program printed
+// each line where that is possible
+package utils
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where the trace pipe can be found. Older systems only mount tracefs under
+// debugfs
+var tracePipePaths = []string{
+	"/sys/kernel/tracing/trace_pipe",
+	"/sys/kernel/debug/tracing/trace_pipe",
+}
+
+// A single line of the trace pipe
+type TraceLine struct {
+	// When the line was read
+	Time time.Time
+
+	// The task that was running when the line was printed
+	Comm string
+	Pid  int
+	Cpu  int
+
+	// The kernel timestamp in seconds since boot
+	Timestamp float64
+
+	// The event that printed the line. bpf_trace_printk for bpf_printk
+	Event   string
+	Message string
+
+	// The line as it was read. Lines that can't be parsed only have this
+	Raw string
+}
+
+// Matches lines like
+//
+//	bash-1234    [002] d..31  1234.567890: bpf_trace_printk: hello
+//
+// The tgid column and the irq flags are only printed on some kernels
+var traceLineRegex = regexp.MustCompile(`^\s*(.+)-(\d+)\s+(?:\(\s*[-\d]+\)\s+)?\[(\d+)\]\s+(?:\S+\s+)?(\d+\.\d+):\s+([^:\s]+):\s?(.*)$`)
+
+// Parse a line of the trace pipe. The raw line is kept if it doesn't have
+// the usual format
+func ParseTraceLine(line string) TraceLine {
+	result := TraceLine{Time: time.Now(), Pid: -1, Cpu: -1, Raw: line, Message: line}
+	match := traceLineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return result
+	}
+
+	result.Comm = strings.TrimSpace(match[1])
+	result.Pid, _ = strconv.Atoi(match[2])
+	result.Cpu, _ = strconv.Atoi(match[3])
+	result.Timestamp, _ = strconv.ParseFloat(match[4], 64)
+	result.Event = match[5]
+	result.Message = match[6]
+	return result
+}
+
+// Read the trace pipe and send each line to lines until stop is closed. This
+// blocks until the pipe is closed
+func StreamTraceLog(lines chan<- TraceLine, stop <-chan struct{}) error {
+	return CurrentBackend().TraceLog(lines, stop)
+}
+
+// Send every line of r to lines until r ends or stop is closed
+func readTraceLines(r io.Reader, lines chan<- TraceLine, stop <-chan struct{}) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		select {
+		case lines <- ParseTraceLine(scanner.Text()):
+		case <-stop:
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// Check if a program can print to the trace pipe
+func printsToTracePipe(p BpfProgram) bool {
+	helpers, err := GetProgramHelpers(p)
+	if err != nil {
+		return false
+	}
+	for _, h := range helpers {
+		if h == "bpf_trace_printk" || h == "bpf_trace_vprintk" {
+			return true
+		}
+	}
+	return false
+}
+
+// Guess which programs may have printed a line. The trace pipe doesn't say
+// which program printed a line so these are the programs that call
+// bpf_trace_printk. The pid of the line is the task that was running when the
+// program fired, not the process that loaded it, so it can't narrow them down.
+// The ids are sorted. Lines of other trace events aren't attributed at all
+func AttributeTraceLine(line TraceLine, programs map[int]BpfProgram) []int {
+	candidates := []int{}
+	if line.Event != "bpf_trace_printk" {
+		return candidates
+	}
+
+	for id, p := range programs {
+		if printsToTracePipe(p) {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Ints(candidates)
+	return candidates
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTraceLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		comm    string
+		pid     int
+		cpu     int
+		event   string
+		message string
+	}{
+		{"           <...>-1234    [002] d..31  1234.567890: bpf_trace_printk: hello world", "<...>", 1234, 2, "bpf_trace_printk", "hello world"},
+		{"  kworker/u8:2-9   (    9) [000] ....  42.000001: bpf_trace_printk: pid=9", "kworker/u8:2", 9, 0, "bpf_trace_printk", "pid=9"},
+		{"sshd-session-77 [001] 10.5: bpf_trace_printk: ", "sshd-session", 77, 1, "bpf_trace_printk", ""},
+		{"CPU:3 [LOST 12 EVENTS]", "", -1, -1, "", "CPU:3 [LOST 12 EVENTS]"},
+	}
+	for _, test := range tests {
+		line := ParseTraceLine(test.line)
+		if line.Comm != test.comm || line.Pid != test.pid || line.Cpu != test.cpu || line.Event != test.event || line.Message != test.message {
+			t.Errorf("Unexpected result for %q: %+v", test.line, line)
+		}
+	}
+}
+
+func TestAttributeTraceLine(t *testing.T) {
+	// Fill the code cache so no disassembly is needed
+	programs := map[int]BpfProgram{
+		1: {ProgramId: 1, Tag: "a"},
+		2: {ProgramId: 2, Tag: "b", Pids: []ProcessInfo{{Pid: 50}}},
+		3: {ProgramId: 3, Tag: "c"},
+		4: {ProgramId: 4, Tag: "d"},
+	}
+	codeCacheLock.Lock()
+	codeCache["1/a"] = programCode{helpers: []string{"bpf_map_lookup_elem", "bpf_trace_printk"}}
+	codeCache["2/b"] = programCode{helpers: []string{"bpf_trace_printk"}}
+	codeCache["3/c"] = programCode{helpers: []string{"bpf_trace_vprintk"}}
+	codeCache["4/d"] = programCode{helpers: []string{"bpf_map_lookup_elem"}}
+	codeCacheLock.Unlock()
+
+	line := TraceLine{Pid: 10, Event: "bpf_trace_printk"}
+	if ids := AttributeTraceLine(line, programs); !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Errorf("Expected every program that prints, got %v", ids)
+	}
+	// The pid is the traced task so owning the program doesn't make it the
+	// one that printed
+	line.Pid = 50
+	if ids := AttributeTraceLine(line, programs); !reflect.DeepEqual(ids, []int{1, 2, 3}) {
+		t.Errorf("Expected the pid to not narrow the programs, got %v", ids)
+	}
+	line.Event = "sched_switch"
+	if ids := AttributeTraceLine(line, programs); len(ids) != 0 {
+		t.Errorf("Expected other events to not be attributed, got %v", ids)
+	}
+}
@@ -279,15 +279,6 @@ func contains(s []int, e int) bool {
 	return false
 }
 
-// Write a function with a receiver to compare two BpfProgram structs
-func (p BpfProgram) Compare(other BpfProgram) bool {
-	if p.ProgramId == other.ProgramId &&
-		p.Tag == other.Tag {
-		return true
-	}
-	return false
-}
-
 // Tview uses a special syntax in strings to colorize things. This function
 // removes those color codes from a string
 // And example string would look like "[blue]mystring[-]"